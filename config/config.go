@@ -0,0 +1,807 @@
+// Package config は、設定ファイル、環境変数及びコマンドライン引数からサーバの設定を読み込み、検証する。
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/handler"
+	"github.com/TechBowl-japan/go-stations/handler/middleware"
+	"github.com/TechBowl-japan/go-stations/pkg/basicauth"
+	"github.com/TechBowl-japan/go-stations/pkg/listener"
+	"github.com/TechBowl-japan/go-stations/pkg/logging"
+	"github.com/TechBowl-japan/go-stations/pkg/outbox"
+	"github.com/TechBowl-japan/go-stations/pkg/tlsconfig"
+	"github.com/TechBowl-japan/go-stations/pkg/webhook"
+)
+
+// Config は、サーバの設定全体を表す。
+type Config struct {
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	TLS       TLSConfig       `yaml:"tls" toml:"tls"`
+	DB        DBConfig        `yaml:"db" toml:"db"`
+	Log       LogConfig       `yaml:"log" toml:"log"`
+	AccessLog AccessLogConfig `yaml:"access_log" toml:"access_log"`
+	Auth      AuthConfig      `yaml:"auth" toml:"auth"`
+	RateLimit RateLimitConfig `yaml:"rate_limit" toml:"rate_limit"`
+	CORS      CORSConfig      `yaml:"cors" toml:"cors"`
+	Admin     AdminConfig     `yaml:"admin" toml:"admin"`
+	Tracing   TracingConfig   `yaml:"tracing" toml:"tracing"`
+	Health    HealthConfig    `yaml:"health" toml:"health"`
+	TODO      TODOConfig      `yaml:"todo" toml:"todo"`
+	WebSocket WebSocketConfig `yaml:"websocket" toml:"websocket"`
+	GraphQL   GraphQLConfig   `yaml:"graphql" toml:"graphql"`
+	Webhook   WebhookConfig   `yaml:"webhook" toml:"webhook"`
+	Outbox    OutboxConfig    `yaml:"outbox" toml:"outbox"`
+	// SecurityHeaders は、メインのリスナーのレスポンスに付与するヘッダである。
+	SecurityHeaders SecurityHeadersConfig `yaml:"security_headers" toml:"security_headers"`
+	Compression     CompressionConfig     `yaml:"compression" toml:"compression"`
+	Timeout         TimeoutConfig         `yaml:"timeout" toml:"timeout"`
+	PanicReport     PanicReportConfig     `yaml:"panic_report" toml:"panic_report"`
+	// TimeZone は、 time.Local とするIANAのタイムゾーン名である。
+	TimeZone string `yaml:"time_zone" toml:"time_zone"`
+}
+
+// ServerConfig は、HTTPサーバの設定を表す。
+type ServerConfig struct {
+	// Addr は、host:port、Unixドメインソケットの場合は unix:<path>、ソケットアクティベーションの場合は systemd:<name> である。
+	// 管理用及びリダイレクト用のリスナーも同じ形式で指定する。
+	Addr string `yaml:"addr" toml:"addr"`
+	// UnixSocketMode は、Unixドメインソケットの8進数のパーミッション(e.g. 0660)である。
+	UnixSocketMode string `yaml:"unix_socket_mode" toml:"unix_socket_mode"`
+	// UnixSocketOwner は、Unixドメインソケットの所有者(user[:group])である。空文字の場合は変更しない。
+	UnixSocketOwner string `yaml:"unix_socket_owner" toml:"unix_socket_owner"`
+	// ShutdownTimeout は、シャットダウン時に処理中のリクエストを待つ最大の時間である。
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	// ShutdownDrainDelay は、/readyz を失敗させてからGraceful shutdownを開始するまでの時間である。
+	ShutdownDrainDelay time.Duration `yaml:"shutdown_drain_delay" toml:"shutdown_drain_delay"`
+	// ShutdownHookTimeout は、全てのサーバの停止後に実行する後処理(e.g. DBのクローズ)それぞれの最大の時間である。
+	ShutdownHookTimeout time.Duration `yaml:"shutdown_hook_timeout" toml:"shutdown_hook_timeout"`
+	// ReadHeaderTimeout は、リクエストヘッダを読み込む最大の時間であり、Slowlorisのようなクライアントを切断する。
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout"`
+	// ReadTimeout は、ボディを含むリクエスト全体を読み込む最大の時間である。0の場合はタイムアウトしない。
+	ReadTimeout time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	// WriteTimeout は、リクエストヘッダの読み込み後からレスポンスの書き込みを終えるまでの最大の時間である。
+	// 0の場合はタイムアウトしない。/debug/pprof/ で長時間プロファイルできるよう、管理用のリスナーには適用しない。
+	WriteTimeout time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	// IdleTimeout は、keep-aliveのコネクションで次のリクエストを待つ最大の時間である。
+	IdleTimeout time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	// MaxHeaderBytes は、リクエストヘッダの最大のサイズである。
+	MaxHeaderBytes int `yaml:"max_header_bytes" toml:"max_header_bytes"`
+	// TrustedProxies は、X-Forwarded-For を信頼するプロキシのIPアドレス、またはCIDRである。
+	// "unix" の場合は、Unixドメインソケットで接続したクライアントを信頼する。
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+}
+
+// TLSConfig は、メインのリスナーのHTTPSの設定を表す。 CertFile が空文字の場合はHTTPSで待ち受けない。
+type TLSConfig struct {
+	// CertFile 及び KeyFile は、変更された場合に再読み込みする。
+	CertFile string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile  string `yaml:"key_file" toml:"key_file"`
+	// MinVersion は、TLSの最小のバージョン(1.2 または 1.3)である。
+	MinVersion string `yaml:"min_version" toml:"min_version"`
+	// CipherSuites は、TLS 1.2の暗号スイートの名前である。空の場合はGoのデフォルトを使用する。
+	CipherSuites []string `yaml:"cipher_suites" toml:"cipher_suites"`
+	// ClientAuth は、none、optional または require である。クライアント証明書は ClientCAFile で検証する。
+	ClientAuth   string `yaml:"client_auth" toml:"client_auth"`
+	ClientCAFile string `yaml:"client_ca_file" toml:"client_ca_file"`
+	// ClientPrincipals は、クライアント証明書のSubject(e.g. CN=alice,O=Example)から /api のユーザIDへの対応である。
+	// 空の場合はCommon NameをユーザIDとする。
+	ClientPrincipals map[string]string `yaml:"client_principals" toml:"client_principals"`
+	// RedirectAddr は、HTTPからHTTPSへリダイレクトするリスナーのアドレスである。空文字の場合はリダイレクトしない。
+	RedirectAddr string `yaml:"redirect_addr" toml:"redirect_addr"`
+}
+
+// ApplyTimeouts は、 srv のタイムアウト及びヘッダサイズの上限を設定する。
+func (c *ServerConfig) ApplyTimeouts(srv *http.Server) {
+	srv.ReadHeaderTimeout = c.ReadHeaderTimeout
+	srv.ReadTimeout = c.ReadTimeout
+	srv.WriteTimeout = c.WriteTimeout
+	srv.IdleTimeout = c.IdleTimeout
+	srv.MaxHeaderBytes = c.MaxHeaderBytes
+}
+
+// SocketMode は、 UnixSocketMode をファイルモードとして返す。空文字の場合は0(umaskに従う)を返す。
+func (c *ServerConfig) SocketMode() (fs.FileMode, error) {
+	if c.UnixSocketMode == "" {
+		return 0, nil
+	}
+	m, err := strconv.ParseUint(c.UnixSocketMode, 8, 32)
+	if err != nil || m > 0o777 {
+		return 0, fmt.Errorf("8進数のパーミッション(e.g. 0660)を指定する必要があります: %s", c.UnixSocketMode)
+	}
+	return fs.FileMode(m), nil
+}
+
+// DBConfig は、SQLiteのDBの設定を表す。
+type DBConfig struct {
+	Path string `yaml:"path" toml:"path"`
+}
+
+// LogConfig は、標準エラー出力に書き込むアプリケーションログの設定を表す。
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level"`
+	Format string `yaml:"format" toml:"format"`
+}
+
+// AccessLogConfig は、アクセスログの設定を表す。
+type AccessLogConfig struct {
+	Format string `yaml:"format" toml:"format"`
+	// File は、アクセスログのパスである。空文字の場合は標準出力に書き込む。
+	File        string `yaml:"file" toml:"file"`
+	MaxSizeMB   int    `yaml:"max_size_mb" toml:"max_size_mb"`
+	MaxBackups  int    `yaml:"max_backups" toml:"max_backups"`
+	RotateDaily bool   `yaml:"rotate_daily" toml:"rotate_daily"`
+	Compress    bool   `yaml:"compress" toml:"compress"`
+	// RedactQueryParams は、値を記録しないクエリパラメータである。
+	RedactQueryParams []string `yaml:"redact_query_params" toml:"redact_query_params"`
+}
+
+// AuthConfig は、/api のBasic認証の設定を表す。
+type AuthConfig struct {
+	UserID   string `yaml:"user_id" toml:"user_id"`
+	Password string `yaml:"password" toml:"password"`
+}
+
+// RateLimitConfig は、/api のクライアント毎のレート制限の設定を表す。
+type RateLimitConfig struct {
+	// Rate は、1秒あたりに許可するリクエスト数である。
+	Rate  float64 `yaml:"rate" toml:"rate"`
+	Burst int     `yaml:"burst" toml:"burst"`
+	// IPRate 及び IPBurst は、認証前のIPアドレス毎のリクエストを制限し、資格情報の総当たりも制限する。
+	IPRate  float64 `yaml:"ip_rate" toml:"ip_rate"`
+	IPBurst int     `yaml:"ip_burst" toml:"ip_burst"`
+	// Rules は、パス及びHTTPメソッド毎のクライアント毎のレート制限であり、先頭から評価して最初にマッチしたルールを適用する。
+	// いずれのルールにもマッチしないリクエストは制限しない。空の場合は、/api 以下の全てのリクエストに Rate 及び Burst を適用する。
+	Rules []RateLimitRule `yaml:"rules" toml:"rules"`
+}
+
+// RateLimitRule は、パス及びHTTPメソッド毎のレート制限を表す。
+type RateLimitRule struct {
+	// Method は、制限対象のHTTPメソッドである。空文字の場合は全てのメソッドを対象とする。
+	Method string `yaml:"method" toml:"method"`
+	// Path は、制限対象のパスの前方一致条件である。
+	Path  string  `yaml:"path" toml:"path"`
+	Rate  float64 `yaml:"rate" toml:"rate"`
+	Burst int     `yaml:"burst" toml:"burst"`
+}
+
+// ClientRules は、認証後のクライアント毎のレート制限のルールを返す。
+func (c *RateLimitConfig) ClientRules() []middleware.RateLimitRule {
+	if len(c.Rules) == 0 {
+		return []middleware.RateLimitRule{
+			{Path: "/api/", Rate: c.Rate, Burst: c.Burst},
+		}
+	}
+	rules := make([]middleware.RateLimitRule, 0, len(c.Rules))
+	for _, r := range c.Rules {
+		rules = append(rules, middleware.RateLimitRule{
+			Method: r.Method,
+			Path:   r.Path,
+			Rate:   r.Rate,
+			Burst:  r.Burst,
+		})
+	}
+	return rules
+}
+
+// IPRules は、認証前のIPアドレス毎のレート制限のルールを返す。
+func (c *RateLimitConfig) IPRules() []middleware.RateLimitRule {
+	return []middleware.RateLimitRule{
+		{Path: "/api/", Rate: c.IPRate, Burst: c.IPBurst},
+	}
+}
+
+// CORSConfig は、ブラウザから /api へのクロスオリジンリクエストの設定を表す。 AllowedOrigins が空の場合はCORSを無効とする。
+type CORSConfig struct {
+	// AllowedOrigins は、完全一致のオリジン(https://app.example.com)、ワイルドカードのサブドメイン(https://*.example.com)、または * である。
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins"`
+	// AllowedMethods 及び AllowedHeaders は、プリフライトリクエストで許可する。 AllowedHeaders を * とした場合は全てのヘッダを許可する。
+	AllowedMethods []string `yaml:"allowed_methods" toml:"allowed_methods"`
+	AllowedHeaders []string `yaml:"allowed_headers" toml:"allowed_headers"`
+	// AllowCredentials は、Basic認証のような資格情報を含むリクエストを許可するかを表す。 * とは併用できない。
+	AllowCredentials bool `yaml:"allow_credentials" toml:"allow_credentials"`
+	// MaxAge は、ブラウザがプリフライトリクエストの結果をキャッシュする時間である。
+	MaxAge time.Duration `yaml:"max_age" toml:"max_age"`
+}
+
+// Middleware は、CORSのミドルウェアの設定を返す。
+func (c *CORSConfig) Middleware() middleware.CORSConfig {
+	return middleware.CORSConfig{
+		AllowedOrigins:   c.AllowedOrigins,
+		AllowedMethods:   c.AllowedMethods,
+		AllowedHeaders:   c.AllowedHeaders,
+		AllowCredentials: c.AllowCredentials,
+		MaxAge:           c.MaxAge,
+	}
+}
+
+// SecurityHeadersConfig は、セキュリティ関連のヘッダの設定を表す。空文字または0の場合はそのヘッダを付与しない。
+type SecurityHeadersConfig struct {
+	// HSTSMaxAge は、HTTPSの場合のみ付与する Strict-Transport-Security の max-age である。
+	HSTSMaxAge            time.Duration `yaml:"hsts_max_age" toml:"hsts_max_age"`
+	HSTSIncludeSubdomains bool          `yaml:"hsts_include_subdomains" toml:"hsts_include_subdomains"`
+	ContentSecurityPolicy string        `yaml:"content_security_policy" toml:"content_security_policy"`
+	ReferrerPolicy        string        `yaml:"referrer_policy" toml:"referrer_policy"`
+}
+
+// Middleware は、セキュリティ関連のヘッダを付与するミドルウェアの設定を返す。
+func (c *SecurityHeadersConfig) Middleware() middleware.SecurityHeadersConfig {
+	return middleware.SecurityHeadersConfig{
+		HSTSMaxAge:            c.HSTSMaxAge,
+		HSTSIncludeSubdomains: c.HSTSIncludeSubdomains,
+		ContentSecurityPolicy: c.ContentSecurityPolicy,
+		ReferrerPolicy:        c.ReferrerPolicy,
+	}
+}
+
+// CompressionConfig は、レスポンスの圧縮及びgzipで圧縮されたリクエストボディの展開の設定を表す。
+type CompressionConfig struct {
+	Enabled bool `yaml:"enabled" toml:"enabled"`
+	// Encodings は、br、zstd 及び gzip から選んだレスポンスの圧縮方式を優先する順に並べたものである。
+	// Accept-Encoding のq値が最も大きい方式を使用し、q値が同じ場合はこの順序で選ぶ。
+	Encodings []string `yaml:"encodings" toml:"encodings"`
+	// Level は、gzipの圧縮レベル(1(最速)から9(最小))である。
+	Level int `yaml:"level" toml:"level"`
+	// BrotliLevel は、brotliの圧縮レベル(0(最速)から11(最小))である。
+	BrotliLevel int `yaml:"brotli_level" toml:"brotli_level"`
+	// ZstdLevel は、zstdの圧縮レベル(1(最速)から22(最小))であり、対応する最も近いレベルを使用する。
+	ZstdLevel int `yaml:"zstd_level" toml:"zstd_level"`
+	// MinSize は、圧縮するレスポンスの最小のバイト数である。
+	MinSize int `yaml:"min_size" toml:"min_size"`
+	// MaxDecompressedBodySize は、展開したリクエストボディの最大のバイト数である。
+	MaxDecompressedBodySize int `yaml:"max_decompressed_body_size" toml:"max_decompressed_body_size"`
+}
+
+// Middleware は、圧縮のミドルウェアを返す。圧縮しない場合は nil を返す。
+func (c *CompressionConfig) Middleware() (middleware.HTTPMiddleware, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	encoders := make([]middleware.Encoder, 0, len(c.Encodings))
+	for _, name := range c.Encodings {
+		var e middleware.Encoder
+		var err error
+		switch name {
+		case "br":
+			e, err = middleware.NewBrotliEncoder(c.BrotliLevel)
+		case "zstd":
+			e, err = middleware.NewZstdEncoder(c.ZstdLevel)
+		case "gzip":
+			e, err = middleware.NewGzipEncoder(c.Level)
+		default:
+			err = fmt.Errorf("未対応の圧縮方式です: %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		encoders = append(encoders, e)
+	}
+	m, err := middleware.NewCompressionMiddleware(middleware.CompressionConfig{
+		Encoders:                encoders,
+		MinSize:                 c.MinSize,
+		MaxDecompressedBodySize: int64(c.MaxDecompressedBodySize),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// TimeoutConfig は、/api へのリクエスト毎の最大の処理時間の設定を表す。
+type TimeoutConfig struct {
+	// Default は、いずれのルートにもマッチしないリクエストの上限である。0の場合は制限しない。
+	Default time.Duration `yaml:"default" toml:"default"`
+	// Routes は、"[METHOD ]PATH" から上限への対応(e.g. "GET /api/todos": "2s")である。 PATH は前方一致で比較し、
+	// 最も長い PATH を優先する。上限が0の場合はタイムアウトしない(e.g. ストリーミングのレスポンス)。
+	Routes map[string]string `yaml:"routes" toml:"routes"`
+	// Status は、タイムアウトしたリクエストのステータスコード(503 または 504)である。
+	Status int `yaml:"status" toml:"status"`
+}
+
+// Middleware は、タイムアウトのミドルウェアを返す。上限を設定しない場合は nil を返す。
+func (c *TimeoutConfig) Middleware() (middleware.HTTPMiddleware, error) {
+	if c.Default == 0 && len(c.Routes) == 0 {
+		return nil, nil
+	}
+	rules := make([]middleware.TimeoutRule, 0, len(c.Routes))
+	for route, v := range c.Routes {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: 時間の形式が不正です: %s", route, v)
+		}
+		rule := middleware.TimeoutRule{Path: route, Timeout: d}
+		if method, path, ok := strings.Cut(route, " "); ok {
+			rule.Method, rule.Path = method, strings.TrimSpace(path)
+		}
+		if !strings.HasPrefix(rule.Path, "/") {
+			return nil, fmt.Errorf("%s: パスは / から始まる必要があります", route)
+		}
+		rules = append(rules, rule)
+	}
+	// NOTE: マップの順序は不定のため、より長いパス、同じパスではメソッドを指定したルールを優先する。
+	sort.Slice(rules, func(i, j int) bool {
+		if len(rules[i].Path) != len(rules[j].Path) {
+			return len(rules[i].Path) > len(rules[j].Path)
+		}
+		return rules[i].Method > rules[j].Method
+	})
+	m, err := middleware.NewTimeoutMiddleware(middleware.TimeoutConfig{
+		Rules:   rules,
+		Default: c.Default,
+		Status:  c.Status,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// AdminConfig は、/metrics、/debug/pprof/、ヘルスチェック、/version、/loglevel 及び /do-panic を
+// 認証無しで提供する管理用のリスナーの設定を表す。
+type AdminConfig struct {
+	// Addr は、外部から到達できないようにする必要がある管理用のリスナーのアドレスである。
+	// 空文字の場合は全てのエンドポイントをメインのリスナーで提供し、/metrics にはBasic認証を設定する。
+	Addr string `yaml:"addr" toml:"addr"`
+}
+
+// TracingConfig は、スパンの送信の設定を表す。 Endpoint が空文字の場合はトレーシングを無効とする。
+type TracingConfig struct {
+	// Endpoint は、OTLP/HTTPのトレースのエンドポイント(e.g. http://localhost:4318/v1/traces)である。
+	// ユーザ情報やクエリに資格情報を含む場合があるため、出力時には伏せる。
+	Endpoint    string `yaml:"endpoint" toml:"endpoint"`
+	ServiceName string `yaml:"service_name" toml:"service_name"`
+}
+
+// PanicReportConfig は、リカバリしたpanicの通知の設定を表す。 WebhookURL が空文字の場合はログに記録するのみとする。
+type PanicReportConfig struct {
+	// WebhookURL は、panic毎にJSONをPOSTする先のURLである。
+	// 通常はトークンを含むため、出力時には伏せる。
+	WebhookURL string `yaml:"webhook_url" toml:"webhook_url"`
+	// Timeout は、 WebhookURL へのリクエスト毎の最大の時間である。
+	Timeout time.Duration `yaml:"timeout" toml:"timeout"`
+}
+
+// HealthConfig は、readinessのチェックの設定を表す。
+type HealthConfig struct {
+	// MinFreeDiskMB は、DBのディレクトリに必要な空き容量である。
+	MinFreeDiskMB int `yaml:"min_free_disk_mb" toml:"min_free_disk_mb"`
+}
+
+// TODOConfig は、TODOのエンドポイントの設定を表す。
+type TODOConfig struct {
+	// DefaultPageSize は、size パラメータを省略した場合に返すTODOの件数である。
+	DefaultPageSize int `yaml:"default_page_size" toml:"default_page_size"`
+	// EventReplaySize は、/api/todos/events に再接続したクライアントへ再送する直近のイベント数である。
+	EventReplaySize int `yaml:"event_replay_size" toml:"event_replay_size"`
+	// EventBufferSize は、クライアント毎に溜めるイベント数である。これより遅いクライアントは切断する。
+	EventBufferSize int `yaml:"event_buffer_size" toml:"event_buffer_size"`
+	// EventHeartbeat は、イベントの無いストリームを維持するハートビートの間隔である。
+	EventHeartbeat time.Duration `yaml:"event_heartbeat" toml:"event_heartbeat"`
+}
+
+// WebSocketConfig は、/api/ws の設定を表す。
+type WebSocketConfig struct {
+	// MaxMessageSize は、クライアントからのメッセージ毎の最大のバイト数である。
+	MaxMessageSize int `yaml:"max_message_size" toml:"max_message_size"`
+	// PingInterval は、アイドル状態のコネクションを維持するpingの間隔である。
+	PingInterval time.Duration `yaml:"ping_interval" toml:"ping_interval"`
+	// PongTimeout は、クライアントからメッセージもpongも無い状態を許容する最大の時間であり、 PingInterval より長い必要がある。
+	PongTimeout time.Duration `yaml:"pong_timeout" toml:"pong_timeout"`
+	// SendBuffer は、クライアント毎に溜めるメッセージ数である。これより遅いクライアントは切断する。
+	SendBuffer int `yaml:"send_buffer" toml:"send_buffer"`
+	// CommandTimeout は、コマンド毎の最大の処理時間である。
+	CommandTimeout time.Duration `yaml:"command_timeout" toml:"command_timeout"`
+}
+
+// Handler は、WebSocketのハンドラの設定を返す。
+func (c *WebSocketConfig) Handler() handler.WebSocketConfig {
+	return handler.WebSocketConfig{
+		MaxMessageSize: int64(c.MaxMessageSize),
+		PingInterval:   c.PingInterval,
+		PongTimeout:    c.PongTimeout,
+		SendBuffer:     c.SendBuffer,
+		CommandTimeout: c.CommandTimeout,
+	}
+}
+
+// GraphQLConfig は、/api/graphql 及び /api/graphql/stream の設定を表す。
+type GraphQLConfig struct {
+	// MaxDepth は、オペレーションのフィールドの最大のネストの深さである。
+	MaxDepth int `yaml:"max_depth" toml:"max_depth"`
+	// MaxComplexity は、オペレーションの最大の複雑度であり、各フィールドはTODO毎に1と数える。
+	MaxComplexity int `yaml:"max_complexity" toml:"max_complexity"`
+	// MaxPageSize は、todos で一度に要求できるTODOの最大の件数である。
+	MaxPageSize int `yaml:"max_page_size" toml:"max_page_size"`
+	// MaxRequestSize は、リクエストボディ毎の最大のバイト数である。
+	MaxRequestSize int `yaml:"max_request_size" toml:"max_request_size"`
+}
+
+// Handler は、GraphQLのハンドラの設定を返す。
+func (c *GraphQLConfig) Handler() handler.GraphQLConfig {
+	return handler.GraphQLConfig{
+		MaxDepth:       c.MaxDepth,
+		MaxComplexity:  c.MaxComplexity,
+		MaxPageSize:    c.MaxPageSize,
+		MaxRequestSize: int64(c.MaxRequestSize),
+	}
+}
+
+// WebhookConfig は、/api/webhooks で管理するWebhookの送信の設定を表す。
+type WebhookConfig struct {
+	// Workers は、同時に送信する数である。
+	Workers int `yaml:"workers" toml:"workers"`
+	// MaxAttempts は、初回を含む送信毎の最大の試行回数である。
+	MaxAttempts int `yaml:"max_attempts" toml:"max_attempts"`
+	// InitialBackoff は、初回の再送までの時間であり、再送の度に MaxBackoff まで倍にする。
+	InitialBackoff time.Duration `yaml:"initial_backoff" toml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff" toml:"max_backoff"`
+	// Timeout は、試行毎の最大の時間である。
+	Timeout time.Duration `yaml:"timeout" toml:"timeout"`
+	// PollInterval は、送信時刻を過ぎた送信を確認する間隔である。
+	PollInterval time.Duration `yaml:"poll_interval" toml:"poll_interval"`
+	// AllowPrivateNetworks は、ループバック、リンクローカル及びプライベートアドレスへの送信を許可するかを表す。
+	// Webhookを登録できる誰もが内部のサービスに到達できてしまうため、開発用途のみを想定している。
+	AllowPrivateNetworks bool `yaml:"allow_private_networks" toml:"allow_private_networks"`
+}
+
+// Dispatcher は、 logger にログを書き込むWebhookのディスパッチャの設定を返す。
+func (c *WebhookConfig) Dispatcher(logger *slog.Logger) webhook.Config {
+	return webhook.Config{
+		Workers:        c.Workers,
+		MaxAttempts:    c.MaxAttempts,
+		InitialBackoff: c.InitialBackoff,
+		MaxBackoff:     c.MaxBackoff,
+		Timeout:        c.Timeout,
+		PollInterval:   c.PollInterval,
+		Logger:         logger,
+
+		AllowPrivateNetworks: c.AllowPrivateNetworks,
+	}
+}
+
+// OutboxConfig は、outbox に記録したTODOの変更のイベントの中継の設定を表す。
+// イベントは常に /api/todos/events、/api/ws、/api/graphql/stream 及びWebhookへ中継する。
+type OutboxConfig struct {
+	// BatchSize は、一度に sink へ中継する最大のイベント数である。
+	BatchSize int `yaml:"batch_size" toml:"batch_size"`
+	// PollInterval は、中継していないイベント(e.g. 別のプロセスが記録したもの)を確認する間隔である。
+	PollInterval time.Duration `yaml:"poll_interval" toml:"poll_interval"`
+	// InitialBackoff は、 sink の失敗後の初回の再試行までの時間であり、再試行の度に MaxBackoff まで倍にする。
+	InitialBackoff time.Duration `yaml:"initial_backoff" toml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff" toml:"max_backoff"`
+	// Timeout は、 sink へイベントをまとめて中継する最大の時間である。
+	Timeout time.Duration `yaml:"timeout" toml:"timeout"`
+	// Retention は、全ての sink へ中継した後にイベントを保持する時間である。
+	Retention time.Duration `yaml:"retention" toml:"retention"`
+	// Log は、イベントをアプリケーションログに書き込むかを表す。
+	Log bool `yaml:"log" toml:"log"`
+	// File は、イベントをNDJSONとして追記するファイルのパスである。空文字の場合は書き込まない。
+	File string `yaml:"file" toml:"file"`
+}
+
+// Relay は、 logger にログを書き込む outbox の中継の設定を返す。
+func (c *OutboxConfig) Relay(logger *slog.Logger) outbox.Config {
+	return outbox.Config{
+		BatchSize:      c.BatchSize,
+		PollInterval:   c.PollInterval,
+		InitialBackoff: c.InitialBackoff,
+		MaxBackoff:     c.MaxBackoff,
+		Timeout:        c.Timeout,
+		Retention:      c.Retention,
+		Logger:         logger,
+	}
+}
+
+// Default は、何も指定しない場合の設定を返す。
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:                ":8080",
+			UnixSocketMode:      "0660",
+			ShutdownTimeout:     5 * time.Second,
+			ShutdownHookTimeout: 5 * time.Second,
+			ReadHeaderTimeout:   5 * time.Second,
+			ReadTimeout:         30 * time.Second,
+			WriteTimeout:        30 * time.Second,
+			IdleTimeout:         2 * time.Minute,
+			MaxHeaderBytes:      64 << 10,
+		},
+		TLS: TLSConfig{
+			MinVersion: "1.2",
+			ClientAuth: tlsconfig.ClientAuthNone,
+		},
+		DB: DBConfig{
+			Path: ".sqlite3/todo.db",
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: logging.FormatJSON,
+		},
+		AccessLog: AccessLogConfig{
+			Format:            middleware.AccessLogFormatJSON,
+			MaxSizeMB:         100,
+			MaxBackups:        7,
+			Compress:          true,
+			RedactQueryParams: []string{"token", "access_token", "api_key", "password"},
+		},
+		Admin: AdminConfig{
+			Addr: "127.0.0.1:8081",
+		},
+		RateLimit: RateLimitConfig{
+			Rate:    10,
+			Burst:   20,
+			IPRate:  50,
+			IPBurst: 100,
+		},
+		CORS: CORSConfig{
+			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+			AllowedHeaders: []string{"Authorization", "Content-Type"},
+			MaxAge:         10 * time.Minute,
+		},
+		SecurityHeaders: SecurityHeadersConfig{
+			HSTSMaxAge:            365 * 24 * time.Hour,
+			ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'",
+			ReferrerPolicy:        "no-referrer",
+		},
+		Compression: CompressionConfig{
+			Enabled:                 true,
+			Encodings:               []string{"br", "zstd", "gzip"},
+			Level:                   6,
+			BrotliLevel:             4,
+			ZstdLevel:               3,
+			MinSize:                 1024,
+			MaxDecompressedBodySize: 10 << 20,
+		},
+		Timeout: TimeoutConfig{
+			Default: 10 * time.Second,
+			Routes:  map[string]string{"GET /api/todos/events": "0s", "GET /api/ws": "0s", "/api/graphql/stream": "0s"},
+			Status:  503,
+		},
+		Tracing: TracingConfig{
+			ServiceName: "go-stations",
+		},
+		PanicReport: PanicReportConfig{
+			Timeout: 10 * time.Second,
+		},
+		Health: HealthConfig{
+			MinFreeDiskMB: 64,
+		},
+		TODO: TODOConfig{
+			DefaultPageSize: 5,
+			EventReplaySize: 256,
+			EventBufferSize: 64,
+			EventHeartbeat:  15 * time.Second,
+		},
+		WebSocket: WebSocketConfig{
+			MaxMessageSize: 64 << 10,
+			PingInterval:   30 * time.Second,
+			PongTimeout:    time.Minute,
+			SendBuffer:     64,
+			CommandTimeout: 10 * time.Second,
+		},
+		GraphQL: GraphQLConfig{
+			MaxDepth:       10,
+			MaxComplexity:  1000,
+			MaxPageSize:    100,
+			MaxRequestSize: 64 << 10,
+		},
+		Webhook: WebhookConfig{
+			Workers:        4,
+			MaxAttempts:    8,
+			InitialBackoff: 10 * time.Second,
+			MaxBackoff:     time.Hour,
+			Timeout:        10 * time.Second,
+			PollInterval:   time.Second,
+		},
+		Outbox: OutboxConfig{
+			BatchSize:      100,
+			PollInterval:   time.Second,
+			InitialBackoff: time.Second,
+			MaxBackoff:     time.Minute,
+			Timeout:        10 * time.Second,
+			Retention:      24 * time.Hour,
+		},
+		TimeZone: "Asia/Tokyo",
+	}
+}
+
+// Validate は、全ての値を検証し、見つかった全ての問題を [errors.Join] でまとめて返す。
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	addrs := []struct{ key, addr string }{
+		{"server.addr", c.Server.Addr},
+		{"admin.addr", c.Admin.Addr},
+		{"tls.redirect_addr", c.TLS.RedirectAddr},
+	}
+	for i, a := range addrs {
+		// NOTE: server.addr 以外は、空文字の場合に待ち受けない。
+		if a.addr == "" && i > 0 {
+			continue
+		}
+		if _, _, err := listener.ParseAddr(a.addr); err != nil {
+			errs = append(errs, fmt.Errorf("%s が不正です: %w", a.key, err))
+		}
+	}
+	if network, _, _ := listener.ParseAddr(c.Server.Addr); c.TLS.RedirectAddr != "" && network != listener.NetworkTCP {
+		errs = append(errs, fmt.Errorf("tls.redirect_addr を指定する場合、server.addr にはTCPのアドレスを指定する必要があります: %s", c.Server.Addr))
+	}
+	if _, err := c.Server.SocketMode(); err != nil {
+		errs = append(errs, fmt.Errorf("server.unix_socket_mode が不正です: %w", err))
+	}
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout には正の時間を指定する必要があります: %s", c.Server.ShutdownTimeout)
+	check(c.Server.ShutdownDrainDelay >= 0, "server.shutdown_drain_delay には0以上の時間を指定する必要があります: %s", c.Server.ShutdownDrainDelay)
+	check(c.Server.ShutdownHookTimeout > 0, "server.shutdown_hook_timeout には正の時間を指定する必要があります: %s", c.Server.ShutdownHookTimeout)
+	check(c.Server.ReadHeaderTimeout > 0, "server.read_header_timeout には正の時間を指定する必要があります: %s", c.Server.ReadHeaderTimeout)
+	check(c.Server.ReadTimeout >= 0, "server.read_timeout には0以上の時間を指定する必要があります: %s", c.Server.ReadTimeout)
+	check(c.Server.WriteTimeout >= 0, "server.write_timeout には0以上の時間を指定する必要があります: %s", c.Server.WriteTimeout)
+	check(c.Server.IdleTimeout >= 0, "server.idle_timeout には0以上の時間を指定する必要があります: %s", c.Server.IdleTimeout)
+	check(c.Server.MaxHeaderBytes > 0, "server.max_header_bytes には正の整数を指定する必要があります: %d", c.Server.MaxHeaderBytes)
+
+	errs = append(errs, c.TLS.validate()...)
+
+	check(c.DB.Path != "", "db.path を指定する必要があります")
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log.level が不正です: %w", err))
+	}
+	check(c.Log.Format == logging.FormatJSON || c.Log.Format == logging.FormatText,
+		"log.format には %s または %s を指定する必要があります: %s", logging.FormatJSON, logging.FormatText, c.Log.Format)
+
+	switch c.AccessLog.Format {
+	case middleware.AccessLogFormatJSON, middleware.AccessLogFormatText, middleware.AccessLogFormatCombined:
+	default:
+		errs = append(errs, fmt.Errorf("access_log.format には %s, %s または %s を指定する必要があります: %s",
+			middleware.AccessLogFormatJSON, middleware.AccessLogFormatText, middleware.AccessLogFormatCombined, c.AccessLog.Format))
+	}
+	check(c.AccessLog.MaxSizeMB > 0, "access_log.max_size_mb には正の整数を指定する必要があります: %d", c.AccessLog.MaxSizeMB)
+	check(c.AccessLog.MaxBackups >= 0, "access_log.max_backups には0以上の整数を指定する必要があります: %d", c.AccessLog.MaxBackups)
+
+	if c.Auth.UserID == "" || c.Auth.Password == "" {
+		errs = append(errs, fmt.Errorf("auth.user_id 及び auth.password を指定する必要があります"))
+	} else if _, err := basicauth.NewBasicAuthInfo(c.Auth.UserID, c.Auth.Password); err != nil {
+		errs = append(errs, fmt.Errorf("auth が不正です: %w", err))
+	}
+
+	check(c.RateLimit.Rate > 0, "rate_limit.rate には正の数を指定する必要があります: %g", c.RateLimit.Rate)
+	check(c.RateLimit.Burst > 0, "rate_limit.burst には正の整数を指定する必要があります: %d", c.RateLimit.Burst)
+	check(c.RateLimit.IPRate > 0, "rate_limit.ip_rate には正の数を指定する必要があります: %g", c.RateLimit.IPRate)
+	check(c.RateLimit.IPBurst > 0, "rate_limit.ip_burst には正の整数を指定する必要があります: %d", c.RateLimit.IPBurst)
+	for i, r := range c.RateLimit.Rules {
+		check(r.Method == "" || isToken(r.Method), "rate_limit.rules[%d].method が不正です: %s", i, r.Method)
+		check(strings.HasPrefix(r.Path, "/"), "rate_limit.rules[%d].path は / から始まる必要があります: %s", i, r.Path)
+		check(r.Rate > 0, "rate_limit.rules[%d].rate には正の数を指定する必要があります: %g", i, r.Rate)
+		check(r.Burst > 0, "rate_limit.rules[%d].burst には正の整数を指定する必要があります: %d", i, r.Burst)
+	}
+
+	if _, err := middleware.NewCORSMiddleware(c.CORS.Middleware()); err != nil {
+		errs = append(errs, fmt.Errorf("cors が不正です: %w", err))
+	}
+
+	check(c.SecurityHeaders.HSTSMaxAge >= 0, "security_headers.hsts_max_age には0以上の時間を指定する必要があります: %s", c.SecurityHeaders.HSTSMaxAge)
+
+	check(c.Compression.Level >= 1 && c.Compression.Level <= 9, "compression.level には1から9の整数を指定する必要があります: %d", c.Compression.Level)
+	check(c.Compression.BrotliLevel >= 0 && c.Compression.BrotliLevel <= 11, "compression.brotli_level には0から11の整数を指定する必要があります: %d", c.Compression.BrotliLevel)
+	check(c.Compression.ZstdLevel >= 1 && c.Compression.ZstdLevel <= 22, "compression.zstd_level には1から22の整数を指定する必要があります: %d", c.Compression.ZstdLevel)
+	if c.Compression.Enabled {
+		check(len(c.Compression.Encodings) > 0, "compression.encodings を指定する必要があります")
+		if _, err := c.Compression.Middleware(); err != nil {
+			errs = append(errs, fmt.Errorf("compression が不正です: %w", err))
+		}
+	}
+	check(c.Compression.MinSize > 0, "compression.min_size には正の整数を指定する必要があります: %d", c.Compression.MinSize)
+	check(c.Compression.MaxDecompressedBodySize > 0, "compression.max_decompressed_body_size には正の整数を指定する必要があります: %d", c.Compression.MaxDecompressedBodySize)
+
+	if _, err := c.Timeout.Middleware(); err != nil {
+		errs = append(errs, fmt.Errorf("timeout が不正です: %w", err))
+	}
+
+	// NOTE: URLは資格情報を含む場合があるため、メッセージに含めない。
+	if c.Tracing.Endpoint != "" {
+		u, err := url.Parse(c.Tracing.Endpoint)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"tracing.endpoint には http(s):// から始まるURLを指定する必要があります")
+	}
+	check(c.Tracing.ServiceName != "", "tracing.service_name を指定する必要があります")
+
+	if c.PanicReport.WebhookURL != "" {
+		u, err := url.Parse(c.PanicReport.WebhookURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"panic_report.webhook_url には http(s):// から始まるURLを指定する必要があります")
+	}
+	check(c.PanicReport.Timeout > 0, "panic_report.timeout には正の時間を指定する必要があります: %s", c.PanicReport.Timeout)
+
+	check(c.Health.MinFreeDiskMB >= 0, "health.min_free_disk_mb には0以上の整数を指定する必要があります: %d", c.Health.MinFreeDiskMB)
+
+	check(c.TODO.DefaultPageSize > 0, "todo.default_page_size には正の整数を指定する必要があります: %d", c.TODO.DefaultPageSize)
+	check(c.TODO.EventReplaySize > 0, "todo.event_replay_size には正の整数を指定する必要があります: %d", c.TODO.EventReplaySize)
+	check(c.TODO.EventBufferSize > 0, "todo.event_buffer_size には正の整数を指定する必要があります: %d", c.TODO.EventBufferSize)
+	check(c.TODO.EventHeartbeat > 0, "todo.event_heartbeat には正の時間を指定する必要があります: %s", c.TODO.EventHeartbeat)
+
+	check(c.WebSocket.MaxMessageSize > 0, "websocket.max_message_size には正の整数を指定する必要があります: %d", c.WebSocket.MaxMessageSize)
+	check(c.WebSocket.PingInterval > 0, "websocket.ping_interval には正の時間を指定する必要があります: %s", c.WebSocket.PingInterval)
+	check(c.WebSocket.PongTimeout > c.WebSocket.PingInterval,
+		"websocket.pong_timeout には websocket.ping_interval より長い時間を指定する必要があります: %s", c.WebSocket.PongTimeout)
+	check(c.WebSocket.SendBuffer > 0, "websocket.send_buffer には正の整数を指定する必要があります: %d", c.WebSocket.SendBuffer)
+	check(c.WebSocket.CommandTimeout > 0, "websocket.command_timeout には正の時間を指定する必要があります: %s", c.WebSocket.CommandTimeout)
+	check(c.GraphQL.MaxDepth > 0, "graphql.max_depth には正の整数を指定する必要があります: %d", c.GraphQL.MaxDepth)
+	check(c.GraphQL.MaxComplexity > 0, "graphql.max_complexity には正の整数を指定する必要があります: %d", c.GraphQL.MaxComplexity)
+	check(c.GraphQL.MaxPageSize >= c.TODO.DefaultPageSize,
+		"graphql.max_page_size には todo.default_page_size 以上の整数を指定する必要があります: %d", c.GraphQL.MaxPageSize)
+	check(c.GraphQL.MaxRequestSize > 0, "graphql.max_request_size には正の整数を指定する必要があります: %d", c.GraphQL.MaxRequestSize)
+
+	check(c.Webhook.Workers > 0, "webhook.workers には正の整数を指定する必要があります: %d", c.Webhook.Workers)
+	check(c.Webhook.MaxAttempts > 0, "webhook.max_attempts には正の整数を指定する必要があります: %d", c.Webhook.MaxAttempts)
+	check(c.Webhook.InitialBackoff > 0, "webhook.initial_backoff には正の時間を指定する必要があります: %s", c.Webhook.InitialBackoff)
+	check(c.Webhook.MaxBackoff >= c.Webhook.InitialBackoff,
+		"webhook.max_backoff には webhook.initial_backoff 以上の時間を指定する必要があります: %s", c.Webhook.MaxBackoff)
+	check(c.Webhook.Timeout > 0, "webhook.timeout には正の時間を指定する必要があります: %s", c.Webhook.Timeout)
+	check(c.Webhook.PollInterval > 0, "webhook.poll_interval には正の時間を指定する必要があります: %s", c.Webhook.PollInterval)
+
+	check(c.Outbox.BatchSize > 0, "outbox.batch_size には正の整数を指定する必要があります: %d", c.Outbox.BatchSize)
+	check(c.Outbox.PollInterval > 0, "outbox.poll_interval には正の時間を指定する必要があります: %s", c.Outbox.PollInterval)
+	check(c.Outbox.InitialBackoff > 0, "outbox.initial_backoff には正の時間を指定する必要があります: %s", c.Outbox.InitialBackoff)
+	check(c.Outbox.MaxBackoff >= c.Outbox.InitialBackoff,
+		"outbox.max_backoff には outbox.initial_backoff 以上の時間を指定する必要があります: %s", c.Outbox.MaxBackoff)
+	check(c.Outbox.Timeout > 0, "outbox.timeout には正の時間を指定する必要があります: %s", c.Outbox.Timeout)
+	check(c.Outbox.Retention >= time.Second, "outbox.retention には1秒以上の時間を指定する必要があります: %s", c.Outbox.Retention)
+
+	if _, err := time.LoadLocation(c.TimeZone); err != nil {
+		errs = append(errs, fmt.Errorf("time_zone が不正です: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// isToken は、 s がHTTPメソッドとして使用できるトークンであるかを返す。
+func isToken(s string) bool {
+	for _, r := range s {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *TLSConfig) validate() []error {
+	var errs []error
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("tls.cert_file 及び tls.key_file は両方を指定する必要があります"))
+	}
+	if _, err := tlsconfig.ParseVersion(c.MinVersion); err != nil {
+		errs = append(errs, fmt.Errorf("tls.min_version が不正です: %w", err))
+	}
+	if _, err := tlsconfig.ParseCipherSuites(c.CipherSuites); err != nil {
+		errs = append(errs, fmt.Errorf("tls.cipher_suites が不正です: %w", err))
+	}
+	if _, err := tlsconfig.ParseClientAuth(c.ClientAuth); err != nil {
+		errs = append(errs, fmt.Errorf("tls.client_auth が不正です: %w", err))
+	}
+
+	enabled := c.CertFile != ""
+	clientAuth := c.ClientAuth != "" && c.ClientAuth != tlsconfig.ClientAuthNone
+	if clientAuth && c.ClientCAFile == "" {
+		errs = append(errs, fmt.Errorf("tls.client_auth を指定する場合、tls.client_ca_file を指定する必要があります"))
+	}
+	if len(c.ClientPrincipals) > 0 && !clientAuth {
+		errs = append(errs, fmt.Errorf("tls.client_principals を指定する場合、tls.client_auth を指定する必要があります"))
+	}
+	if !enabled && (clientAuth || c.RedirectAddr != "") {
+		errs = append(errs, fmt.Errorf("tls.client_auth 及び tls.redirect_addr を指定する場合、tls.cert_file を指定する必要があります"))
+	}
+	return errs
+}
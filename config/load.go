@@ -0,0 +1,480 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// redacted は、 Redacted の出力で秘匿する値を置き換える文字列である。
+const redacted = "[REDACTED]"
+
+// Options は、サーバの設定ではなく読み込み方を制御するコマンドライン引数を表す。
+type Options struct {
+	// File は、設定ファイルのパスである。形式は拡張子(.yaml、.yml または .toml)で判定する。
+	File string
+	// PrintConfig は、読み込んだ設定を出力して終了するかを表す。
+	PrintConfig bool
+}
+
+// Load は、デフォルト値、設定ファイル、環境変数、コマンドライン引数の順に優先度が高くなるよう設定を組み立てる。
+//
+// args はプログラム名を除いたコマンドライン引数であり、 getenv は通常 [os.Getenv] である。
+// 値の問題は全てまとめて返す。 -h を指定した場合は [flag.ErrHelp] を返す。
+func Load(args []string, getenv func(string) string, output io.Writer) (*Config, *Options, error) {
+	opts := &Options{}
+
+	fs := flag.NewFlagSet("go-stations", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&opts.File, "config", getenv("CONFIG_FILE"), "設定ファイル(.yaml、.yml または .toml)のパス (env: CONFIG_FILE)")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "読み込んだ設定を秘匿する値を伏せて出力し、終了する")
+
+	// NOTE: 設定ファイルのパスを知るためにフラグを先に解析するが、適用は最後に行う必要がある。
+	staged := make(map[string]string)
+	for _, f := range Default().fields() {
+		fs.Var(&stagedValue{
+			name:   f.key,
+			def:    f.value.String(),
+			isBool: isBoolValue(f.value),
+			staged: staged,
+		}, f.key, fmt.Sprintf("%s (env: %s)", f.usage, f.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, nil, fmt.Errorf("不明な引数が指定されています: %s", strings.Join(fs.Args(), " "))
+	}
+
+	cfg := Default()
+	if opts.File != "" {
+		if err := cfg.loadFile(opts.File); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var errs []error
+	// NOTE: OpenTelemetryの汎用のエンドポイントはベースURLであり、トレース用のエンドポイントで上書きされる。
+	if base := getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+		cfg.Tracing.Endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	for _, f := range cfg.fields() {
+		if v := getenv(f.env); v != "" {
+			if err := f.value.Set(v); err != nil {
+				errs = append(errs, fmt.Errorf("環境変数 %s が不正です: %w", f.env, err))
+			}
+		}
+	}
+	for _, f := range cfg.fields() {
+		if v, ok := staged[f.key]; ok {
+			if err := f.value.Set(v); err != nil {
+				errs = append(errs, fmt.Errorf("フラグ -%s が不正です: %w", f.key, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, errors.Join(errs...)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, opts, nil
+}
+
+// loadFile は、 path のファイルの値で上書きする。
+//
+// タイプミスを検出するため、不明なキーはエラーとする。
+func (c *Config) loadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		d := yaml.NewDecoder(bytes.NewReader(b))
+		d.KnownFields(true)
+		// NOTE: 空のファイルはエラーとしない。
+		if err := d.Decode(c); err != nil && err != io.EOF {
+			return fmt.Errorf("設定ファイル %s を読み込めません: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(b), c)
+		if err != nil {
+			return fmt.Errorf("設定ファイル %s を読み込めません: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, 0, len(undecoded))
+			for _, k := range undecoded {
+				keys = append(keys, k.String())
+			}
+			return fmt.Errorf("設定ファイル %s に不明なキーが含まれています: %s", path, strings.Join(keys, ", "))
+		}
+	default:
+		return fmt.Errorf("設定ファイルの拡張子には .yaml, .yml または .toml を指定する必要があります: %s", path)
+	}
+	return nil
+}
+
+// Redacted は、秘匿する値を置き換えた c のコピーを返す。
+func (c *Config) Redacted() *Config {
+	r := *c
+	for _, f := range r.fields() {
+		if f.secret && f.value.String() != "" {
+			// NOTE: 文字列の設定は失敗しない。
+			_ = f.value.Set(redacted)
+		}
+	}
+	return &r
+}
+
+// Map は、フラグ名(e.g. "server.addr")をキーとした値を返す。
+func (c *Config) Map() map[string]string {
+	m := make(map[string]string)
+	for _, f := range c.fields() {
+		m[f.key] = f.value.String()
+	}
+	return m
+}
+
+// WriteYAML は、設定ファイルとして読み込めるYAMLで c を w に書き込む。
+func (c *Config) WriteYAML(w io.Writer) error {
+	e := yaml.NewEncoder(w)
+	e.SetIndent(2)
+	if err := e.Encode(c); err != nil {
+		return err
+	}
+	return e.Close()
+}
+
+// field は、設定値とフラグ及び環境変数を対応付ける。
+type field struct {
+	// key は、YAMLのキーを . で繋いだフラグ名である。
+	key    string
+	env    string
+	usage  string
+	secret bool
+	value  flag.Value
+}
+
+func (c *Config) fields() []field {
+	return []field{
+		{key: "server.addr", env: "PORT", usage: "サーバの待ち受けアドレス(host:port、unix:<path> または systemd:<name>)", value: (*stringValue)(&c.Server.Addr)},
+		{key: "server.unix_socket_mode", env: "UNIX_SOCKET_MODE", usage: "Unixドメインソケットの8進数のパーミッション", value: (*stringValue)(&c.Server.UnixSocketMode)},
+		{key: "server.unix_socket_owner", env: "UNIX_SOCKET_OWNER", usage: "Unixドメインソケットの所有者(user[:group])、空文字の場合は変更しない", value: (*stringValue)(&c.Server.UnixSocketOwner)},
+		{key: "server.shutdown_timeout", env: "SHUTDOWN_TIMEOUT", usage: "シャットダウン時に処理中のリクエストを待つ最大の時間", value: (*durationValue)(&c.Server.ShutdownTimeout)},
+		{key: "server.shutdown_drain_delay", env: "SHUTDOWN_DRAIN_DELAY", usage: "/readyz を失敗させてからGraceful shutdownを開始するまでの時間", value: (*durationValue)(&c.Server.ShutdownDrainDelay)},
+		{key: "server.shutdown_hook_timeout", env: "SHUTDOWN_HOOK_TIMEOUT", usage: "全てのサーバの停止後に実行する後処理それぞれの最大の時間", value: (*durationValue)(&c.Server.ShutdownHookTimeout)},
+		{key: "server.read_header_timeout", env: "READ_HEADER_TIMEOUT", usage: "リクエストヘッダを読み込む最大の時間", value: (*durationValue)(&c.Server.ReadHeaderTimeout)},
+		{key: "server.read_timeout", env: "READ_TIMEOUT", usage: "リクエスト全体を読み込む最大の時間、0の場合はタイムアウトしない", value: (*durationValue)(&c.Server.ReadTimeout)},
+		{key: "server.write_timeout", env: "WRITE_TIMEOUT", usage: "レスポンスを書き込む最大の時間、0の場合はタイムアウトしない", value: (*durationValue)(&c.Server.WriteTimeout)},
+		{key: "server.idle_timeout", env: "IDLE_TIMEOUT", usage: "keep-aliveのコネクションで次のリクエストを待つ最大の時間", value: (*durationValue)(&c.Server.IdleTimeout)},
+		{key: "server.max_header_bytes", env: "MAX_HEADER_BYTES", usage: "リクエストヘッダの最大のサイズ", value: (*intValue)(&c.Server.MaxHeaderBytes)},
+		{key: "server.trusted_proxies", env: "TRUSTED_PROXIES", usage: "信頼するプロキシのIPアドレスまたはCIDRのカンマ区切りのリスト、unix はUnixドメインソケットのクライアントを信頼する", value: (*stringListValue)(&c.Server.TrustedProxies)},
+		{key: "tls.cert_file", env: "TLS_CERT_FILE", usage: "PEMの証明書チェーンのパス、空文字の場合はHTTPSで待ち受けない", value: (*stringValue)(&c.TLS.CertFile)},
+		{key: "tls.key_file", env: "TLS_KEY_FILE", usage: "PEMの秘密鍵のパス", value: (*stringValue)(&c.TLS.KeyFile)},
+		{key: "tls.min_version", env: "TLS_MIN_VERSION", usage: "TLSの最小のバージョン(1.2 または 1.3)", value: (*stringValue)(&c.TLS.MinVersion)},
+		{key: "tls.cipher_suites", env: "TLS_CIPHER_SUITES", usage: "TLS 1.2の暗号スイートのカンマ区切りのリスト、空の場合はGoのデフォルト", value: (*stringListValue)(&c.TLS.CipherSuites)},
+		{key: "tls.client_auth", env: "TLS_CLIENT_AUTH", usage: "クライアント証明書の検証(none、optional または require)", value: (*stringValue)(&c.TLS.ClientAuth)},
+		{key: "tls.client_ca_file", env: "TLS_CLIENT_CA_FILE", usage: "クライアント証明書を検証するPEMのCA証明書のパス", value: (*stringValue)(&c.TLS.ClientCAFile)},
+		{key: "tls.client_principals", env: "TLS_CLIENT_PRINCIPALS", usage: "クライアント証明書の subject:user_id の組のセミコロン区切りのリスト、空の場合はCommon Name", value: (*stringMapValue)(&c.TLS.ClientPrincipals)},
+		{key: "tls.redirect_addr", env: "TLS_REDIRECT_ADDR", usage: "HTTPからHTTPSへリダイレクトする待ち受けアドレス、空文字の場合はリダイレクトしない", value: (*stringValue)(&c.TLS.RedirectAddr)},
+		{key: "db.path", env: "DB_PATH", usage: "SQLiteのDBのパス", value: (*stringValue)(&c.DB.Path)},
+		{key: "log.level", env: "LOG_LEVEL", usage: "ログレベル(debug、info、warn または error)", value: (*stringValue)(&c.Log.Level)},
+		{key: "log.format", env: "LOG_FORMAT", usage: "ログの形式(json または text)", value: (*stringValue)(&c.Log.Format)},
+		{key: "access_log.format", env: "ACCESS_LOG_FORMAT", usage: "アクセスログの形式(json、text または combined)", value: (*stringValue)(&c.AccessLog.Format)},
+		{key: "access_log.file", env: "ACCESS_LOG_FILE", usage: "アクセスログのパス、空文字の場合は標準出力", value: (*stringValue)(&c.AccessLog.File)},
+		{key: "access_log.max_size_mb", env: "ACCESS_LOG_MAX_SIZE_MB", usage: "アクセスログをローテーションするサイズ(MB)", value: (*intValue)(&c.AccessLog.MaxSizeMB)},
+		{key: "access_log.max_backups", env: "ACCESS_LOG_MAX_BACKUPS", usage: "保持するローテーション済みのアクセスログの数、0の場合は全て保持する", value: (*intValue)(&c.AccessLog.MaxBackups)},
+		{key: "access_log.rotate_daily", env: "ACCESS_LOG_ROTATE_DAILY", usage: "アクセスログを日毎にローテーションする", value: (*boolValue)(&c.AccessLog.RotateDaily)},
+		{key: "access_log.compress", env: "ACCESS_LOG_COMPRESS", usage: "ローテーション済みのアクセスログを圧縮する", value: (*boolValue)(&c.AccessLog.Compress)},
+		{key: "access_log.redact_query_params", env: "ACCESS_LOG_REDACT_QUERY_PARAMS", usage: "値を記録しないクエリパラメータのカンマ区切りのリスト", value: (*stringListValue)(&c.AccessLog.RedactQueryParams)},
+		{key: "auth.user_id", env: "BASIC_AUTH_USER_ID", usage: "/api のBasic認証のユーザID", value: (*stringValue)(&c.Auth.UserID)},
+		{key: "auth.password", env: "BASIC_AUTH_PASSWORD", usage: "/api のBasic認証のパスワード", secret: true, value: (*stringValue)(&c.Auth.Password)},
+		{key: "rate_limit.rate", env: "API_RATE_LIMIT", usage: "/api のクライアント毎に1秒あたりに許可するリクエスト数", value: (*floatValue)(&c.RateLimit.Rate)},
+		{key: "rate_limit.burst", env: "API_RATE_LIMIT_BURST", usage: "/api のクライアント毎に瞬間的に許可するリクエスト数", value: (*intValue)(&c.RateLimit.Burst)},
+		{key: "rate_limit.ip_rate", env: "API_IP_RATE_LIMIT", usage: "/api の認証前のIPアドレス毎に1秒あたりに許可するリクエスト数", value: (*floatValue)(&c.RateLimit.IPRate)},
+		{key: "rate_limit.ip_burst", env: "API_IP_RATE_LIMIT_BURST", usage: "/api の認証前のIPアドレス毎に瞬間的に許可するリクエスト数", value: (*intValue)(&c.RateLimit.IPBurst)},
+		{key: "rate_limit.rules", env: "API_RATE_LIMIT_RULES", usage: "パス及びHTTPメソッド毎のクライアント毎のレート制限である [METHOD ]PATH:rate:burst のセミコロン区切りのリスト、先頭から評価して最初にマッチしたルールを適用する(空の場合は /api 以下に rate_limit.rate 及び rate_limit.burst を適用する)", value: (*rateLimitRulesValue)(&c.RateLimit.Rules)},
+		{key: "security_headers.hsts_max_age", env: "HSTS_MAX_AGE", usage: "HTTPSで付与する Strict-Transport-Security の max-age、0の場合は付与しない", value: (*durationValue)(&c.SecurityHeaders.HSTSMaxAge)},
+		{key: "security_headers.hsts_include_subdomains", env: "HSTS_INCLUDE_SUBDOMAINS", usage: "Strict-Transport-Security をサブドメインにも適用する", value: (*boolValue)(&c.SecurityHeaders.HSTSIncludeSubdomains)},
+		{key: "security_headers.content_security_policy", env: "CONTENT_SECURITY_POLICY", usage: "Content-Security-Policy ヘッダ、空文字の場合は付与しない", value: (*stringValue)(&c.SecurityHeaders.ContentSecurityPolicy)},
+		{key: "security_headers.referrer_policy", env: "REFERRER_POLICY", usage: "Referrer-Policy ヘッダ、空文字の場合は付与しない", value: (*stringValue)(&c.SecurityHeaders.ReferrerPolicy)},
+		{key: "compression.enabled", env: "COMPRESSION_ENABLED", usage: "レスポンスを圧縮し、gzipで圧縮されたリクエストボディを展開する", value: (*boolValue)(&c.Compression.Enabled)},
+		{key: "compression.encodings", env: "COMPRESSION_ENCODINGS", usage: "br、zstd 及び gzip から選んだレスポンスの圧縮方式を優先する順に並べたカンマ区切りのリスト", value: (*stringListValue)(&c.Compression.Encodings)},
+		{key: "compression.level", env: "COMPRESSION_LEVEL", usage: "gzipの圧縮レベル(1(最速)から9(最小))", value: (*intValue)(&c.Compression.Level)},
+		{key: "compression.brotli_level", env: "COMPRESSION_BROTLI_LEVEL", usage: "brotliの圧縮レベル(0(最速)から11(最小))", value: (*intValue)(&c.Compression.BrotliLevel)},
+		{key: "compression.zstd_level", env: "COMPRESSION_ZSTD_LEVEL", usage: "zstdの圧縮レベル(1(最速)から22(最小))", value: (*intValue)(&c.Compression.ZstdLevel)},
+		{key: "compression.min_size", env: "COMPRESSION_MIN_SIZE", usage: "圧縮するレスポンスの最小のバイト数", value: (*intValue)(&c.Compression.MinSize)},
+		{key: "compression.max_decompressed_body_size", env: "COMPRESSION_MAX_DECOMPRESSED_BODY_SIZE", usage: "展開したリクエストボディの最大のバイト数", value: (*intValue)(&c.Compression.MaxDecompressedBodySize)},
+		{key: "timeout.default", env: "REQUEST_TIMEOUT", usage: "/api へのリクエストの最大の処理時間、0の場合は制限しない", value: (*durationValue)(&c.Timeout.Default)},
+		{key: "timeout.routes", env: "REQUEST_TIMEOUT_ROUTES", usage: "パスの前方一致でタイムアウトを上書きする [METHOD ]PATH:時間 の組のセミコロン区切りのリスト、0の場合はタイムアウトしない(デフォルトでは GET /api/todos/events、GET /api/ws 及び /api/graphql/stream はタイムアウトしない)", value: (*stringMapValue)(&c.Timeout.Routes)},
+		{key: "timeout.status", env: "REQUEST_TIMEOUT_STATUS", usage: "タイムアウトしたリクエストのステータスコード(503 または 504)", value: (*intValue)(&c.Timeout.Status)},
+		{key: "cors.allowed_origins", env: "CORS_ALLOWED_ORIGINS", usage: "/api の呼び出しを許可するオリジン(e.g. https://*.example.com)のカンマ区切りのリスト、空の場合はCORSを無効とする", value: (*stringListValue)(&c.CORS.AllowedOrigins)},
+		{key: "cors.allowed_methods", env: "CORS_ALLOWED_METHODS", usage: "プリフライトリクエストで許可するメソッドのカンマ区切りのリスト", value: (*stringListValue)(&c.CORS.AllowedMethods)},
+		{key: "cors.allowed_headers", env: "CORS_ALLOWED_HEADERS", usage: "プリフライトリクエストで許可するリクエストヘッダのカンマ区切りのリスト、* の場合は全てのヘッダを許可する", value: (*stringListValue)(&c.CORS.AllowedHeaders)},
+		{key: "cors.allow_credentials", env: "CORS_ALLOW_CREDENTIALS", usage: "資格情報を含むクロスオリジンリクエストを許可する", value: (*boolValue)(&c.CORS.AllowCredentials)},
+		{key: "cors.max_age", env: "CORS_MAX_AGE", usage: "ブラウザがプリフライトリクエストの結果をキャッシュする時間", value: (*durationValue)(&c.CORS.MaxAge)},
+		{key: "admin.addr", env: "ADMIN_ADDR", usage: "管理用のリスナーのアドレス、空文字の場合はメインのリスナーで全て提供する", value: (*stringValue)(&c.Admin.Addr)},
+		{key: "tracing.endpoint", env: "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", usage: "OTLP/HTTPのトレースのエンドポイント、空文字の場合はトレーシングを無効とする", secret: true, value: (*stringValue)(&c.Tracing.Endpoint)},
+		{key: "panic_report.webhook_url", env: "PANIC_REPORT_WEBHOOK_URL", usage: "リカバリしたpanicをJSONで受け取るURL、空文字の場合はログに記録するのみ", secret: true, value: (*stringValue)(&c.PanicReport.WebhookURL)},
+		{key: "panic_report.timeout", env: "PANIC_REPORT_TIMEOUT", usage: "panicの通知先へのリクエスト毎の最大の時間", value: (*durationValue)(&c.PanicReport.Timeout)},
+		{key: "tracing.service_name", env: "OTEL_SERVICE_NAME", usage: "スパンに記録するサービス名", value: (*stringValue)(&c.Tracing.ServiceName)},
+		{key: "health.min_free_disk_mb", env: "READYZ_MIN_FREE_DISK_MB", usage: "DBのディレクトリに必要な空き容量(MB)", value: (*intValue)(&c.Health.MinFreeDiskMB)},
+		{key: "todo.default_page_size", env: "TODO_DEFAULT_PAGE_SIZE", usage: "size を省略した場合に返すTODOの件数", value: (*intValue)(&c.TODO.DefaultPageSize)},
+		{key: "todo.event_replay_size", env: "TODO_EVENT_REPLAY_SIZE", usage: "再接続したクライアントへ再送する直近のTODOのイベント数", value: (*intValue)(&c.TODO.EventReplaySize)},
+		{key: "todo.event_buffer_size", env: "TODO_EVENT_BUFFER_SIZE", usage: "クライアント毎に溜めるTODOのイベント数、これより遅いクライアントは切断する", value: (*intValue)(&c.TODO.EventBufferSize)},
+		{key: "todo.event_heartbeat", env: "TODO_EVENT_HEARTBEAT", usage: "イベントの無いTODOのイベントストリームのハートビートの間隔", value: (*durationValue)(&c.TODO.EventHeartbeat)},
+		{key: "websocket.max_message_size", env: "WEBSOCKET_MAX_MESSAGE_SIZE", usage: "/api/ws のクライアントからのメッセージ毎の最大のバイト数", value: (*intValue)(&c.WebSocket.MaxMessageSize)},
+		{key: "websocket.ping_interval", env: "WEBSOCKET_PING_INTERVAL", usage: "アイドル状態の /api/ws のコネクションのpingの間隔", value: (*durationValue)(&c.WebSocket.PingInterval)},
+		{key: "websocket.pong_timeout", env: "WEBSOCKET_PONG_TIMEOUT", usage: "/api/ws のクライアントからメッセージもpongも無い状態を許容する最大の時間", value: (*durationValue)(&c.WebSocket.PongTimeout)},
+		{key: "websocket.send_buffer", env: "WEBSOCKET_SEND_BUFFER", usage: "/api/ws のクライアント毎に溜めるメッセージ数、これより遅いクライアントは切断する", value: (*intValue)(&c.WebSocket.SendBuffer)},
+		{key: "websocket.command_timeout", env: "WEBSOCKET_COMMAND_TIMEOUT", usage: "/api/ws のコマンド毎の最大の処理時間", value: (*durationValue)(&c.WebSocket.CommandTimeout)},
+		{key: "graphql.max_depth", env: "GRAPHQL_MAX_DEPTH", usage: "GraphQLのオペレーションのフィールドの最大のネストの深さ", value: (*intValue)(&c.GraphQL.MaxDepth)},
+		{key: "graphql.max_complexity", env: "GRAPHQL_MAX_COMPLEXITY", usage: "GraphQLのオペレーションの最大の複雑度、各フィールドはTODO毎に1と数える", value: (*intValue)(&c.GraphQL.MaxComplexity)},
+		{key: "graphql.max_page_size", env: "GRAPHQL_MAX_PAGE_SIZE", usage: "GraphQLの todos で一度に要求できるTODOの最大の件数", value: (*intValue)(&c.GraphQL.MaxPageSize)},
+		{key: "graphql.max_request_size", env: "GRAPHQL_MAX_REQUEST_SIZE", usage: "GraphQLのリクエストボディ毎の最大のバイト数", value: (*intValue)(&c.GraphQL.MaxRequestSize)},
+		{key: "webhook.workers", env: "WEBHOOK_WORKERS", usage: "同時に送信するWebhookの数", value: (*intValue)(&c.Webhook.Workers)},
+		{key: "webhook.max_attempts", env: "WEBHOOK_MAX_ATTEMPTS", usage: "Webhookの送信毎の最大の試行回数", value: (*intValue)(&c.Webhook.MaxAttempts)},
+		{key: "webhook.initial_backoff", env: "WEBHOOK_INITIAL_BACKOFF", usage: "失敗したWebhookの初回の再送までの時間、再送の度に倍にする", value: (*durationValue)(&c.Webhook.InitialBackoff)},
+		{key: "webhook.max_backoff", env: "WEBHOOK_MAX_BACKOFF", usage: "Webhookの再送の最大の間隔", value: (*durationValue)(&c.Webhook.MaxBackoff)},
+		{key: "webhook.timeout", env: "WEBHOOK_TIMEOUT", usage: "Webhookの試行毎の最大の時間", value: (*durationValue)(&c.Webhook.Timeout)},
+		{key: "webhook.poll_interval", env: "WEBHOOK_POLL_INTERVAL", usage: "送信時刻を過ぎたWebhookを確認する間隔", value: (*durationValue)(&c.Webhook.PollInterval)},
+		{key: "webhook.allow_private_networks", env: "WEBHOOK_ALLOW_PRIVATE_NETWORKS", usage: "ループバック、リンクローカル及びプライベートアドレスへのWebhookの送信を許可する、開発用途のみ", value: (*boolValue)(&c.Webhook.AllowPrivateNetworks)},
+		{key: "outbox.batch_size", env: "OUTBOX_BATCH_SIZE", usage: "一度に sink へ中継する outbox の最大のイベント数", value: (*intValue)(&c.Outbox.BatchSize)},
+		{key: "outbox.poll_interval", env: "OUTBOX_POLL_INTERVAL", usage: "中継していない outbox のイベントを確認する間隔", value: (*durationValue)(&c.Outbox.PollInterval)},
+		{key: "outbox.initial_backoff", env: "OUTBOX_INITIAL_BACKOFF", usage: "outbox の sink の失敗後の初回の再試行までの時間、再試行の度に倍にする", value: (*durationValue)(&c.Outbox.InitialBackoff)},
+		{key: "outbox.max_backoff", env: "OUTBOX_MAX_BACKOFF", usage: "outbox の sink の再試行の最大の間隔", value: (*durationValue)(&c.Outbox.MaxBackoff)},
+		{key: "outbox.timeout", env: "OUTBOX_TIMEOUT", usage: "sink へ outbox のイベントをまとめて中継する最大の時間", value: (*durationValue)(&c.Outbox.Timeout)},
+		{key: "outbox.retention", env: "OUTBOX_RETENTION", usage: "全ての sink へ中継した後に outbox のイベントを保持する時間", value: (*durationValue)(&c.Outbox.Retention)},
+		{key: "outbox.log", env: "OUTBOX_LOG", usage: "outbox のイベントをアプリケーションログに書き込む", value: (*boolValue)(&c.Outbox.Log)},
+		{key: "outbox.file", env: "OUTBOX_FILE", usage: "outbox のイベントを追記するNDJSONのファイルのパス、空文字の場合は書き込まない", value: (*stringValue)(&c.Outbox.File)},
+		{key: "time_zone", env: "TIME_ZONE", usage: "IANAのタイムゾーン名", value: (*stringValue)(&c.TimeZone)},
+	}
+}
+
+// stagedValue は、設定ファイル及び環境変数の後に適用するフラグの値を記録する。
+type stagedValue struct {
+	name   string
+	def    string
+	isBool bool
+	staged map[string]string
+}
+
+func (v *stagedValue) String() string {
+	return v.def
+}
+
+func (v *stagedValue) Set(s string) error {
+	v.staged[v.name] = s
+	return nil
+}
+
+func (v *stagedValue) IsBoolFlag() bool {
+	return v.isBool
+}
+
+func isBoolValue(v flag.Value) bool {
+	_, ok := v.(*boolValue)
+	return ok
+}
+
+type stringValue string
+
+func (v *stringValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return string(*v)
+}
+
+func (v *stringValue) Set(s string) error {
+	*v = stringValue(s)
+	return nil
+}
+
+type intValue int
+
+func (v *intValue) String() string {
+	if v == nil {
+		return "0"
+	}
+	return strconv.Itoa(int(*v))
+}
+
+func (v *intValue) Set(s string) error {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("整数を指定する必要があります: %s", s)
+	}
+	*v = intValue(i)
+	return nil
+}
+
+type floatValue float64
+
+func (v *floatValue) String() string {
+	if v == nil {
+		return "0"
+	}
+	return strconv.FormatFloat(float64(*v), 'g', -1, 64)
+}
+
+func (v *floatValue) Set(s string) error {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("数値を指定する必要があります: %s", s)
+	}
+	*v = floatValue(f)
+	return nil
+}
+
+type boolValue bool
+
+func (v *boolValue) String() string {
+	if v == nil {
+		return "false"
+	}
+	return strconv.FormatBool(bool(*v))
+}
+
+func (v *boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("true または false を指定する必要があります: %s", s)
+	}
+	*v = boolValue(b)
+	return nil
+}
+
+type durationValue time.Duration
+
+func (v *durationValue) String() string {
+	if v == nil {
+		return "0s"
+	}
+	return time.Duration(*v).String()
+}
+
+func (v *durationValue) Set(s string) error {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("時間(e.g. 5s)を指定する必要があります: %s", s)
+	}
+	*v = durationValue(d)
+	return nil
+}
+
+// stringListValue は、カンマ区切りのリストである。空の要素は無視する。
+type stringListValue []string
+
+func (v *stringListValue) String() string {
+	if v == nil {
+		return ""
+	}
+	return strings.Join(*v, ",")
+}
+
+func (v *stringListValue) Set(s string) error {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	*v = list
+	return nil
+}
+
+// stringMapValue は、セミコロン区切りの key:value の組のリストである。
+//
+// 組は最後のコロンで分割するため、キーにはコロンを含められるが、値には含められない。
+type stringMapValue map[string]string
+
+func (v *stringMapValue) String() string {
+	if v == nil {
+		return ""
+	}
+	pairs := make([]string, 0, len(*v))
+	for k, val := range *v {
+		pairs = append(pairs, k+":"+val)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ";")
+}
+
+func (v *stringMapValue) Set(s string) error {
+	m := make(map[string]string)
+	for _, e := range strings.Split(s, ";") {
+		if e = strings.TrimSpace(e); e == "" {
+			continue
+		}
+		i := strings.LastIndex(e, ":")
+		if i <= 0 || i == len(e)-1 {
+			return fmt.Errorf("key:value の形式で指定する必要があります: %s", e)
+		}
+		m[strings.TrimSpace(e[:i])] = strings.TrimSpace(e[i+1:])
+	}
+	*v = m
+	return nil
+}
+
+// rateLimitRulesValue は、セミコロン区切りの [METHOD ]PATH:rate:burst のリストである。
+type rateLimitRulesValue []RateLimitRule
+
+func (v *rateLimitRulesValue) String() string {
+	if v == nil {
+		return ""
+	}
+	rules := make([]string, 0, len(*v))
+	for _, r := range *v {
+		route := r.Path
+		if r.Method != "" {
+			route = r.Method + " " + r.Path
+		}
+		rules = append(rules, fmt.Sprintf("%s:%s:%d", route, strconv.FormatFloat(r.Rate, 'g', -1, 64), r.Burst))
+	}
+	return strings.Join(rules, ";")
+}
+
+func (v *rateLimitRulesValue) Set(s string) error {
+	var rules []RateLimitRule
+	for _, e := range strings.Split(s, ";") {
+		if e = strings.TrimSpace(e); e == "" {
+			continue
+		}
+		// NOTE: パスにはコロンを含められるよう、末尾から分割する。
+		parts := strings.Split(e, ":")
+		if len(parts) < 3 {
+			return fmt.Errorf("[METHOD ]PATH:rate:burst の形式で指定する必要があります: %s", e)
+		}
+		n := len(parts)
+		rate, err := strconv.ParseFloat(strings.TrimSpace(parts[n-2]), 64)
+		if err != nil {
+			return fmt.Errorf("rate には数値を指定する必要があります: %s", e)
+		}
+		burst, err := strconv.Atoi(strings.TrimSpace(parts[n-1]))
+		if err != nil {
+			return fmt.Errorf("burst には整数を指定する必要があります: %s", e)
+		}
+		rule := RateLimitRule{Path: strings.TrimSpace(strings.Join(parts[:n-2], ":")), Rate: rate, Burst: burst}
+		if method, path, ok := strings.Cut(rule.Path, " "); ok {
+			rule.Method, rule.Path = method, strings.TrimSpace(path)
+		}
+		rules = append(rules, rule)
+	}
+	*v = rules
+	return nil
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/pkg/metrics"
+)
+
+// Reloader は、設定を再読み込みし、再読み込み可能な部分を実行中のサーバに適用する。
+//
+// 再読み込み可能な部分は、ログレベル、Basic認証の資格情報、レート制限及びCORSである。
+// それ以外の部分の変更は Reload の結果で報告し、再起動後に適用する。
+type Reloader struct {
+	load  func() (*Config, error)
+	hooks []func(cfg *Config) error
+
+	mu      sync.Mutex
+	current *Config
+	status  ReloadStatus
+}
+
+// ReloadStatus は、 Reloader が行った再読み込みの要約を表す。
+type ReloadStatus struct {
+	Successes uint64
+	Failures  uint64
+	// LastReload は、最後に再読み込みした時刻である。再読み込みしていない場合はゼロ値である。
+	LastReload time.Time
+	// LastError は、最後の再読み込みのエラーである。成功した場合は nil である。
+	LastError error
+}
+
+// ReloadResult は、再読み込みで変更されたキー(e.g. auth.password)を表す。
+type ReloadResult struct {
+	// Applied は、新しい値を適用したキーである。
+	Applied []string
+	// Ignored は、新しい値の適用に再起動が必要なキーである。
+	Ignored []string
+}
+
+// NewReloader は、 cfg から開始し、 load で新しい設定を読み込む Reloader を返す。
+func NewReloader(cfg *Config, load func() (*Config, error)) *Reloader {
+	return &Reloader{
+		load:    load,
+		current: cfg,
+	}
+}
+
+// OnReload は、再読み込みした設定を適用する fn を登録する。 Reload と同時に呼び出してはならない。
+//
+// fn は登録順に呼び出す。いずれかが失敗した場合は、サーバが部分的な設定で動作しないよう、
+// 呼び出し済みの fn に元の設定を再度適用する。
+func (r *Reloader) OnReload(fn func(cfg *Config) error) {
+	r.hooks = append(r.hooks, fn)
+}
+
+// Current は、適用中の設定を返す。
+func (r *Reloader) Current() *Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Status は、これまでの再読み込みの要約を返す。
+func (r *Reloader) Status() ReloadStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// Reload は、設定を読み込み、再読み込み可能な部分を適用する。
+//
+// 新しい設定が不正、または適用できない場合は、現在の設定を維持してエラーを返す。
+func (r *Reloader) Reload() (*ReloadResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res, err := r.reload()
+	r.status.LastReload = time.Now()
+	r.status.LastError = err
+	if err != nil {
+		r.status.Failures++
+	} else {
+		r.status.Successes++
+	}
+	return res, err
+}
+
+func (r *Reloader) reload() (*ReloadResult, error) {
+	loaded, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+
+	next := *r.current
+	next.Log.Level = loaded.Log.Level
+	next.Auth = loaded.Auth
+	next.RateLimit = loaded.RateLimit
+	next.CORS = loaded.CORS
+
+	for i, hook := range r.hooks {
+		if err := hook(&next); err != nil {
+			var errs []error
+			for _, h := range r.hooks[:i] {
+				errs = append(errs, h(r.current))
+			}
+			if rerr := errors.Join(errs...); rerr != nil {
+				return nil, fmt.Errorf("設定を適用できません: %w (元の設定への復元にも失敗しました: %v)", err, rerr)
+			}
+			return nil, fmt.Errorf("設定を適用できません: %w", err)
+		}
+	}
+
+	res := &ReloadResult{
+		Applied: diffKeys(r.current, &next),
+		Ignored: diffKeys(&next, loaded),
+	}
+	r.current = &next
+	return res, nil
+}
+
+// diffKeys は、 a と b で値の異なるキーを昇順に返す。
+func diffKeys(a, b *Config) []string {
+	am, bm := a.Map(), b.Map()
+	var keys []string
+	for k, v := range am {
+		if bm[k] != v {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Collectors は、 r の再読み込みに関するメトリクスを返す。
+func (r *Reloader) Collectors() []metrics.Collector {
+	return []metrics.Collector{
+		metrics.NewCollectorFunc(
+			"config_reloads_total",
+			"Total number of configuration reloads by result.",
+			metrics.TypeCounter,
+			func() []metrics.Sample {
+				s := r.Status()
+				return []metrics.Sample{
+					{Labels: metrics.Labels{"result": "success"}, Value: float64(s.Successes)},
+					{Labels: metrics.Labels{"result": "failure"}, Value: float64(s.Failures)},
+				}
+			},
+		),
+		metrics.NewCollectorFunc(
+			"config_last_reload_successful",
+			"Whether the last configuration reload succeeded (1) or failed (0).",
+			metrics.TypeGauge,
+			func() []metrics.Sample {
+				s := r.Status()
+				if s.LastReload.IsZero() {
+					return nil
+				}
+				v := 1.0
+				if s.LastError != nil {
+					v = 0
+				}
+				return []metrics.Sample{{Value: v}}
+			},
+		),
+		metrics.NewCollectorFunc(
+			"config_last_reload_timestamp_seconds",
+			"Unix time of the last configuration reload.",
+			metrics.TypeGauge,
+			func() []metrics.Sample {
+				s := r.Status()
+				if s.LastReload.IsZero() {
+					return nil
+				}
+				return []metrics.Sample{{Value: float64(s.LastReload.UnixNano()) / 1e9}}
+			},
+		),
+	}
+}
@@ -0,0 +1,81 @@
+package config_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/TechBowl-japan/go-stations/config"
+)
+
+func TestReloader(t *testing.T) {
+	initial := config.Default()
+	initial.Auth.UserID = "user"
+	initial.Auth.Password = "pass"
+
+	var loaded *config.Config
+	var loadErr error
+	r := config.NewReloader(initial, func() (*config.Config, error) {
+		return loaded, loadErr
+	})
+
+	var applied []string
+	var hookErr error
+	r.OnReload(func(cfg *config.Config) error {
+		applied = append(applied, cfg.Auth.Password)
+		return nil
+	})
+	r.OnReload(func(cfg *config.Config) error {
+		return hookErr
+	})
+
+	// NOTE: 再読み込み可能な設定は適用し、それ以外の設定は再起動まで適用しない。
+	next := *initial
+	next.Auth.Password = "new-pass"
+	next.Log.Level = "debug"
+	next.Server.Addr = ":9000"
+	next.RateLimit.Rules = []config.RateLimitRule{{Method: "POST", Path: "/api/todos", Rate: 1, Burst: 5}}
+	loaded = &next
+	res, err := r.Reload()
+	if err != nil {
+		t.Fatalf("予期しないエラーが発生しました: %v", err)
+	}
+	want := &config.ReloadResult{
+		Applied: []string{"auth.password", "log.level", "rate_limit.rules"},
+		Ignored: []string{"server.addr"},
+	}
+	if diff := cmp.Diff(want, res); diff != "" {
+		t.Errorf("期待していない結果です (-want +got):\n%s", diff)
+	}
+	if got := r.Current(); got.Auth.Password != "new-pass" || got.Server.Addr != ":8080" {
+		t.Errorf("期待していない設定です, got = %+v", got)
+	}
+
+	// NOTE: 読み込みに失敗した場合は、現在の設定を維持する。
+	loadErr = errors.New("invalid")
+	if _, err := r.Reload(); err == nil {
+		t.Error("エラーが発生していません")
+	}
+	loadErr = nil
+
+	// NOTE: 適用に失敗した場合は、適用済みの設定を元に戻す。
+	rollback := next
+	rollback.Auth.Password = "rollback-pass"
+	loaded = &rollback
+	hookErr = errors.New("failed")
+	if _, err := r.Reload(); !errors.Is(err, hookErr) {
+		t.Errorf("期待していないエラーです, got = %v", err)
+	}
+	if diff := cmp.Diff([]string{"new-pass", "rollback-pass", "new-pass"}, applied); diff != "" {
+		t.Errorf("期待していない適用順です (-want +got):\n%s", diff)
+	}
+	if got := r.Current().Auth.Password; got != "new-pass" {
+		t.Errorf("設定が維持されていません, got = %s", got)
+	}
+
+	s := r.Status()
+	if s.Successes != 1 || s.Failures != 2 || s.LastError == nil || s.LastReload.IsZero() {
+		t.Errorf("期待していない状態です, got = %+v", s)
+	}
+}
@@ -0,0 +1,118 @@
+package config_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/config"
+)
+
+func TestApplyTimeouts(t *testing.T) {
+	t.Parallel()
+
+	const timeout = 100 * time.Millisecond
+
+	cases := map[string]struct {
+		// send は、サーバへ送信するリクエストであり、 - の位置で送信を止める。
+		send string
+		// response は、切断前にレスポンスを受け取るかである。
+		response bool
+	}{
+		"Slow headers": {
+			send: "GET / HTTP/1.1\r\nHost: example.com\r\n-",
+		},
+		"Slow body": {
+			send:     "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 10\r\n\r\nabc-",
+			response: true,
+		},
+		"Idle keep-alive": {
+			send:     "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n-",
+			response: true,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := config.Default().Server
+			cfg.ReadHeaderTimeout = timeout
+			cfg.ReadTimeout = 2 * timeout
+			cfg.WriteTimeout = 2 * timeout
+			cfg.IdleTimeout = timeout
+
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, err := io.ReadAll(r.Body); err != nil {
+					http.Error(w, err.Error(), http.StatusRequestTimeout)
+				}
+			}))
+			cfg.ApplyTimeouts(srv.Config)
+			srv.Start()
+			t.Cleanup(srv.Close)
+
+			conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+			if err != nil {
+				t.Fatal("接続に失敗しました, err =", err)
+			}
+			defer conn.Close()
+
+			send, _, _ := strings.Cut(c.send, "-")
+			if _, err := io.WriteString(conn, send); err != nil {
+				t.Fatal("リクエストの送信に失敗しました, err =", err)
+			}
+
+			// NOTE: タイムアウトより十分長く待っても切断されない場合は失敗とする。
+			if err := conn.SetReadDeadline(time.Now().Add(10 * timeout)); err != nil {
+				t.Fatal("読み込みの期限の設定に失敗しました, err =", err)
+			}
+			br := bufio.NewReader(conn)
+			if c.response {
+				resp, err := http.ReadResponse(br, nil)
+				if err != nil {
+					t.Fatal("レスポンスの読み込みに失敗しました, err =", err)
+				}
+				resp.Body.Close()
+			}
+			_, err = io.Copy(io.Discard, br)
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatal("遅いクライアントが切断されませんでした")
+			}
+		})
+	}
+}
+
+func TestApplyTimeoutsMaxHeaderBytes(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Default().Server
+	cfg.MaxHeaderBytes = 1 << 10
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	cfg.ApplyTimeouts(srv.Config)
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal("リクエストの作成に失敗しました, err =", err)
+	}
+	req.Header.Set("X-Large", strings.Repeat("a", 8<<10))
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal("リクエストに失敗しました, err =", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("期待していない HTTP status code です, got = %d, want = %d", resp.StatusCode, http.StatusRequestHeaderFieldsTooLarge)
+	}
+}
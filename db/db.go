@@ -1,8 +1,10 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	_ "embed"
+	"fmt"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -10,6 +12,10 @@ import (
 //go:embed schema.sql
 var schema string
 
+// SchemaVersion is the version of schema.sql, which is stored in PRAGMA user_version.
+// It must be incremented together with user_version in schema.sql whenever the schema changes.
+const SchemaVersion = 3
+
 // NewDB returns go-sqlite3 driver based *sql.DB.
 func NewDB(path string) (*sql.DB, error) {
 	db, err := sql.Open("sqlite3", path)
@@ -23,3 +29,51 @@ func NewDB(path string) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// Checkpoint writes the content of the write-ahead log back into the database file and truncates the log.
+// It is a no-op unless the database is in WAL mode, so it is safe to call before closing db on shutdown.
+func Checkpoint(ctx context.Context, db *sql.DB) error {
+	var busy, logFrames, checkpointed int
+	if err := db.QueryRowContext(ctx, `PRAGMA wal_checkpoint(TRUNCATE)`).Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return err
+	}
+	if busy != 0 {
+		return fmt.Errorf("checkpoint did not complete: %d of %d frames checkpointed", checkpointed, logFrames)
+	}
+	return nil
+}
+
+// ReadSchemaVersion returns the schema version stored in db.
+func ReadSchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRowContext(ctx, `PRAGMA user_version`).Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// CheckSchema returns an error if the schema version differs from SchemaVersion
+// or the tables and triggers defined in the schema are missing.
+func CheckSchema(ctx context.Context, db *sql.DB) error {
+	version, err := ReadSchemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if version != SchemaVersion {
+		return fmt.Errorf("schema version is %d, want %d", version, SchemaVersion)
+	}
+
+	const query = `SELECT COUNT(*) FROM sqlite_master WHERE
+		(type = 'table' AND name IN ('todos', 'webhooks', 'webhook_deliveries', 'outbox', 'outbox_offsets')) OR
+		(type = 'trigger' AND name IN ('trigger_todos_updated_at', 'trigger_webhooks_updated_at', 'trigger_webhook_deliveries_updated_at', 'trigger_webhooks_deleted'))`
+	const want = 9
+
+	var num int
+	if err := db.QueryRowContext(ctx, query).Scan(&num); err != nil {
+		return err
+	}
+	if num != want {
+		return fmt.Errorf("schema is not applied: found %d of %d objects", num, want)
+	}
+	return nil
+}
@@ -1,9 +1,12 @@
 package db_test
 
 import (
+	"context"
 	"errors"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/TechBowl-japan/go-stations/db"
 	"github.com/mattn/go-sqlite3"
@@ -44,3 +47,129 @@ func TestNewDB(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckSchema(t *testing.T) {
+	t.Parallel()
+
+	d, err := db.NewDB(filepath.Join(t.TempDir(), "db_test.db"))
+	if err != nil {
+		t.Fatal("failed to create db, err =", err)
+	}
+	t.Cleanup(func() {
+		d.Close()
+	})
+
+	if err := db.CheckSchema(context.Background(), d); err != nil {
+		t.Errorf("unexpected error, err = %s", err)
+	}
+
+	if _, err := d.Exec(`DROP TRIGGER trigger_todos_updated_at`); err != nil {
+		t.Fatal("failed to drop trigger, err =", err)
+	}
+	if err := db.CheckSchema(context.Background(), d); err == nil {
+		t.Error("expected error, but got nil")
+	}
+}
+
+func TestReadSchemaVersion(t *testing.T) {
+	t.Parallel()
+
+	d, err := db.NewDB(filepath.Join(t.TempDir(), "db_test.db"))
+	if err != nil {
+		t.Fatal("failed to create db, err =", err)
+	}
+	t.Cleanup(func() {
+		d.Close()
+	})
+
+	version, err := db.ReadSchemaVersion(context.Background(), d)
+	if err != nil {
+		t.Fatal("unexpected error, err =", err)
+	}
+	if version != db.SchemaVersion {
+		t.Errorf("unexpected value, given = %d, expected = %d", version, db.SchemaVersion)
+	}
+
+	if _, err := d.Exec(`PRAGMA user_version = 0`); err != nil {
+		t.Fatal("failed to update user_version, err =", err)
+	}
+	if err := db.CheckSchema(context.Background(), d); err == nil {
+		t.Error("expected error, but got nil")
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		wal bool
+	}{
+		"Rollback journal": {wal: false},
+		"WAL":              {wal: true},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			path := filepath.Join(t.TempDir(), "db_test.db")
+			d, err := db.NewDB(path)
+			if err != nil {
+				t.Fatal("failed to create db, err =", err)
+			}
+			t.Cleanup(func() {
+				d.Close()
+			})
+
+			ctx := context.Background()
+			if c.wal {
+				if _, err := d.ExecContext(ctx, `PRAGMA journal_mode=WAL`); err != nil {
+					t.Fatal("failed to enable WAL, err =", err)
+				}
+				if _, err := d.ExecContext(ctx, `INSERT INTO todos(subject) VALUES('checkpoint')`); err != nil {
+					t.Fatal("failed to insert, err =", err)
+				}
+			}
+
+			if err := db.Checkpoint(ctx, d); err != nil {
+				t.Fatal("unexpected error, err =", err)
+			}
+			if c.wal {
+				info, err := os.Stat(path + "-wal")
+				if err != nil {
+					t.Fatal("failed to stat WAL file, err =", err)
+				}
+				if info.Size() != 0 {
+					t.Errorf("WAL file is not truncated, size = %d", info.Size())
+				}
+			}
+		})
+	}
+}
+
+func TestQueryInterrupted(t *testing.T) {
+	t.Parallel()
+
+	d, err := db.NewDB(filepath.Join(t.TempDir(), "db_test.db"))
+	if err != nil {
+		t.Fatal("failed to create db, err =", err)
+	}
+	t.Cleanup(func() {
+		d.Close()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// NOTE: the query never ends unless interrupted by the context.
+	start := time.Now()
+	var n int64
+	err = d.QueryRowContext(ctx, `WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c) SELECT count(*) FROM c`).Scan(&n)
+	if err == nil {
+		t.Fatal("expected error, but got nil")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("query was not interrupted in time, elapsed = %s, err = %s", elapsed, err)
+	}
+}
@@ -11,3 +11,67 @@ CREATE TRIGGER IF NOT EXISTS trigger_todos_updated_at AFTER UPDATE ON todos
 BEGIN
   UPDATE todos SET updated_at = DATETIME('now') WHERE id == NEW.id;
 END;
+
+CREATE TABLE IF NOT EXISTS webhooks (
+  id          INTEGER  NOT NULL PRIMARY KEY AUTOINCREMENT,
+  url         TEXT     NOT NULL,
+  secret      TEXT     NOT NULL,
+  event_types TEXT     NOT NULL DEFAULT '',
+  created_at  DATETIME NOT NULL DEFAULT (DATETIME('now')),
+  updated_at  DATETIME NOT NULL DEFAULT (DATETIME('now')),
+  CHECK(url <> ''),
+  CHECK(secret <> '')
+);
+
+CREATE TRIGGER IF NOT EXISTS trigger_webhooks_updated_at AFTER UPDATE ON webhooks
+BEGIN
+  UPDATE webhooks SET updated_at = DATETIME('now') WHERE id == NEW.id;
+END;
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id               INTEGER  NOT NULL PRIMARY KEY AUTOINCREMENT,
+  webhook_id       INTEGER  NOT NULL,
+  event_id         TEXT     NOT NULL,
+  event_type       TEXT     NOT NULL,
+  payload          TEXT     NOT NULL,
+  status           TEXT     NOT NULL DEFAULT 'pending',
+  attempts         INTEGER  NOT NULL DEFAULT 0,
+  next_attempt_at  DATETIME NOT NULL DEFAULT (DATETIME('now')),
+  last_status_code INTEGER  NOT NULL DEFAULT 0,
+  last_error       TEXT     NOT NULL DEFAULT '',
+  created_at       DATETIME NOT NULL DEFAULT (DATETIME('now')),
+  updated_at       DATETIME NOT NULL DEFAULT (DATETIME('now')),
+  CHECK(status IN ('pending', 'succeeded', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS index_webhook_deliveries_pending ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS index_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id, id);
+CREATE INDEX IF NOT EXISTS index_webhook_deliveries_event_id ON webhook_deliveries(event_id);
+
+CREATE TRIGGER IF NOT EXISTS trigger_webhook_deliveries_updated_at AFTER UPDATE ON webhook_deliveries
+BEGIN
+  UPDATE webhook_deliveries SET updated_at = DATETIME('now') WHERE id == NEW.id;
+END;
+
+-- NOTE: go-sqlite3 does not enforce foreign keys by default, so the history is deleted with the webhook by a trigger.
+CREATE TRIGGER IF NOT EXISTS trigger_webhooks_deleted AFTER DELETE ON webhooks
+BEGIN
+  DELETE FROM webhook_deliveries WHERE webhook_id == OLD.id;
+END;
+
+-- NOTE: Events are written in the same transaction as the change of TODOs and relayed to each sink in order of id.
+CREATE TABLE IF NOT EXISTS outbox (
+  id         INTEGER  NOT NULL PRIMARY KEY AUTOINCREMENT,
+  event_type TEXT     NOT NULL,
+  payload    TEXT     NOT NULL,
+  source     TEXT     NOT NULL DEFAULT '',
+  created_at DATETIME NOT NULL DEFAULT (DATETIME('now'))
+);
+
+CREATE TABLE IF NOT EXISTS outbox_offsets (
+  sink       TEXT     NOT NULL PRIMARY KEY,
+  last_id    INTEGER  NOT NULL DEFAULT 0,
+  updated_at DATETIME NOT NULL DEFAULT (DATETIME('now'))
+);
+
+PRAGMA user_version = 3;
@@ -1,10 +1,14 @@
 module github.com/TechBowl-japan/go-stations
 
-go 1.16
+go 1.22
 
 require (
-	github.com/google/go-cmp v0.6.0 // indirect
+	github.com/BurntSushi/toml v1.6.0
+	github.com/andybalholm/brotli v1.2.0
+	github.com/google/go-cmp v0.6.0
 	github.com/jstemmer/go-junit-report v0.9.1
+	github.com/klauspost/compress v1.18.0
 	github.com/mattn/go-sqlite3 v1.14.7
 	github.com/mileusna/useragent v1.3.4
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,698 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/pkg/graphql"
+	"github.com/TechBowl-japan/go-stations/pkg/httperror"
+	"github.com/TechBowl-japan/go-stations/pkg/pubsub"
+	"github.com/TechBowl-japan/go-stations/pkg/shutdown"
+	"github.com/TechBowl-japan/go-stations/service"
+)
+
+// The codes of GraphQL errors in extensions.code.
+const (
+	GraphQLErrorBadUserInput = "BAD_USER_INPUT"
+	GraphQLErrorNotFound     = "NOT_FOUND"
+	GraphQLErrorInternal     = "INTERNAL_SERVER_ERROR"
+)
+
+// A GraphQLConfig configures GraphQLHandler. Zero values are replaced with the defaults.
+type GraphQLConfig struct {
+	// MaxDepth is the maximum nesting of fields in an operation. Defaults to 10.
+	MaxDepth int
+	// MaxComplexity is the maximum complexity of an operation, where each field counts once per TODO. Defaults to 1000.
+	MaxComplexity int
+	// MaxPageSize is the maximum number of TODOs requested by the first argument. Defaults to 100.
+	MaxPageSize int
+	// DefaultPageSize is the number of TODOs returned when first is omitted. Defaults to DefaultPageSize.
+	DefaultPageSize int
+	// Heartbeat is the interval of comments keeping idle subscription streams alive. Defaults to DefaultHeartbeatInterval.
+	Heartbeat time.Duration
+	// MaxRequestSize is the maximum size of the body of POST in bytes. Defaults to 64KiB.
+	MaxRequestSize int64
+}
+
+// A GraphQLHandler serves the GraphQL API of TODOs.
+//
+// Queries and mutations are served by ServeHTTP, and subscriptions by the handler returned by StreamHandler.
+type GraphQLHandler struct {
+	svc    *service.TODOService
+	broker *pubsub.Broker
+	cfg    GraphQLConfig
+	schema *graphql.Schema
+	logger *slog.Logger
+}
+
+// NewGraphQLHandler returns GraphQLHandler which reads and changes TODOs by svc and
+// sends the events published to broker to subscriptions.
+func NewGraphQLHandler(svc *service.TODOService, broker *pubsub.Broker, cfg GraphQLConfig, logger *slog.Logger) *GraphQLHandler {
+	if cfg.MaxDepth <= 0 {
+		cfg.MaxDepth = 10
+	}
+	if cfg.MaxComplexity <= 0 {
+		cfg.MaxComplexity = 1000
+	}
+	if cfg.MaxPageSize <= 0 {
+		cfg.MaxPageSize = 100
+	}
+	if cfg.DefaultPageSize <= 0 {
+		cfg.DefaultPageSize = DefaultPageSize
+	}
+	cfg.DefaultPageSize = min(cfg.DefaultPageSize, cfg.MaxPageSize)
+	if cfg.Heartbeat <= 0 {
+		cfg.Heartbeat = DefaultHeartbeatInterval
+	}
+	if cfg.MaxRequestSize <= 0 {
+		cfg.MaxRequestSize = 64 << 10
+	}
+
+	h := &GraphQLHandler{
+		svc:    svc,
+		broker: broker,
+		cfg:    cfg,
+		logger: logger,
+	}
+	schema, err := h.newSchema()
+	if err != nil {
+		// NOTE: The schema is fixed, so an error is a bug of newSchema.
+		panic(err)
+	}
+	h.schema = schema
+	return h
+}
+
+// ServeHTTP executes a query by GET or POST, or a mutation by POST.
+//
+// GET takes the query, operationName and variables (JSON) query parameters, and POST takes GraphQLRequest.
+// Errors of the operation are returned with 200 OK in the errors of the response.
+//
+// Ref: https://graphql.github.io/graphql-over-http/draft/
+func (h *GraphQLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		httperror.Write(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+	req, err := h.decode(w, r)
+	if err != nil {
+		httperror.Write(w, r, decodeErrorStatus(err))
+		return
+	}
+
+	op, err := h.prepare(req)
+	if err != nil {
+		writeGraphQLResult(w, graphql.ErrorResult(err))
+		return
+	}
+	switch op.Kind {
+	case graphql.OperationSubscription:
+		writeGraphQLResult(w, graphql.ErrorResult(&graphql.Error{Message: "subscriptions are served at /api/graphql/stream"}))
+		return
+	case graphql.OperationMutation:
+		// NOTE: GET must be safe, e.g. links and prefetches must not change TODOs.
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			httperror.Write(w, r, http.StatusMethodNotAllowed)
+			return
+		}
+	}
+	writeGraphQLResult(w, op.Execute(h.withTODOLoader(r.Context())))
+}
+
+// StreamHandler returns the handler streaming the results of a subscription as Server-Sent Events.
+//
+// The request is the same as ServeHTTP. Each result is sent as a next event, and a complete event is sent
+// when the subscription ends. Invalid operations are responded with 400 Bad Request and the errors.
+//
+// Ref: https://github.com/enisdenjo/graphql-sse/blob/master/PROTOCOL.md
+func (h *GraphQLHandler) StreamHandler() http.Handler {
+	return http.HandlerFunc(h.serveStream)
+}
+
+func (h *GraphQLHandler) serveStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		httperror.Write(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+	req, err := h.decode(w, r)
+	if err != nil {
+		httperror.Write(w, r, decodeErrorStatus(err))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	op, err := h.prepare(req)
+	if err == nil && op.Kind != graphql.OperationSubscription {
+		err = &graphql.Error{Message: "only subscriptions are served at /api/graphql/stream"}
+	}
+	var results <-chan *graphql.Result
+	if err == nil {
+		results, err = op.Subscribe(ctx)
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, graphql.ErrorResult(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	// NOTE: Disables buffering by reverse proxies such as nginx.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	write := newStreamWriter(w)
+	// NOTE: Flushes the headers so that the client knows the subscription has started.
+	if err := write(func(io.Writer) error { return nil }); err != nil {
+		return
+	}
+	ticker := time.NewTicker(h.cfg.Heartbeat)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case res, ok := <-results:
+			if !ok {
+				write(func(w io.Writer) error {
+					_, err := io.WriteString(w, "event: complete\ndata: \n\n")
+					return err
+				})
+				return
+			}
+			err = write(func(w io.Writer) error {
+				data, err := json.Marshal(res)
+				if err != nil {
+					return err
+				}
+				_, err = fmt.Fprintf(w, "event: next\ndata: %s\n\n", data)
+				return err
+			})
+		case <-ticker.C:
+			err = write(func(w io.Writer) error {
+				_, err := io.WriteString(w, ": heartbeat\n\n")
+				return err
+			})
+		case <-shutdown.Done(r.Context()):
+			return
+		case <-r.Context().Done():
+			return
+		}
+		if err != nil {
+			h.logger.DebugContext(r.Context(), "could not write graphql result", slog.Any("err", err))
+			return
+		}
+	}
+}
+
+// prepare validates the operation of req within the limits.
+func (h *GraphQLHandler) prepare(req *model.GraphQLRequest) (*graphql.Operation, error) {
+	return h.schema.Prepare(graphql.Params{
+		Query:         req.Query,
+		OperationName: req.OperationName,
+		Variables:     req.Variables,
+		MaxDepth:      h.cfg.MaxDepth,
+		MaxComplexity: h.cfg.MaxComplexity,
+	})
+}
+
+// decode reads the operation from the query parameters of GET or the body of POST.
+//
+// NOTE: The body is limited since the time to validate an operation grows with its size.
+func (h *GraphQLHandler) decode(w http.ResponseWriter, r *http.Request) (*model.GraphQLRequest, error) {
+	var req model.GraphQLRequest
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			dec := json.NewDecoder(strings.NewReader(v))
+			dec.UseNumber()
+			if err := dec.Decode(&req.Variables); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.cfg.MaxRequestSize))
+		dec.UseNumber()
+		if err := dec.Decode(&req); err != nil {
+			return nil, err
+		}
+	}
+	if req.Query == "" {
+		return nil, errors.New("query is required")
+	}
+	return &req, nil
+}
+
+// decodeErrorStatus returns the status of the error returned by decode.
+func decodeErrorStatus(err error) int {
+	var merr *http.MaxBytesError
+	if errors.As(err, &merr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// writeGraphQLResult writes res as the response of ServeHTTP.
+func writeGraphQLResult(w http.ResponseWriter, res *graphql.Result) {
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, res)
+}
+
+// todoConnection is the page of TODOs resolved by the todos field.
+type todoConnection struct {
+	todos       []*model.TODO
+	hasNextPage bool
+}
+
+// todoLoaderKey is the context key of the loader of TODOs shared in an operation.
+type todoLoaderKey struct{}
+
+// withTODOLoader returns ctx storing a new loader of TODOs, which batches the todo fields of an operation.
+//
+// The loader caches TODOs, so it must not outlive an operation.
+func (h *GraphQLHandler) withTODOLoader(ctx context.Context) context.Context {
+	l := graphql.NewLoader(func(ctx context.Context, ids []int64) (map[int64]*model.TODO, error) {
+		todos, err := h.svc.ReadTODOsByIDs(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[int64]*model.TODO, len(todos))
+		for _, todo := range todos {
+			m[todo.ID] = todo
+		}
+		return m, nil
+	})
+	return context.WithValue(ctx, todoLoaderKey{}, l)
+}
+
+// todoLoader returns the loader of TODOs stored by withTODOLoader.
+func (h *GraphQLHandler) todoLoader(ctx context.Context) *graphql.Loader[int64, *model.TODO] {
+	if l, ok := ctx.Value(todoLoaderKey{}).(*graphql.Loader[int64, *model.TODO]); ok {
+		return l
+	}
+	return h.todoLoader(h.withTODOLoader(ctx))
+}
+
+// newSchema defines the GraphQL schema of TODOs:
+//
+//	type Query {
+//	  todo(id: ID!): TODO
+//	  todos(first: Int, after: String): TODOConnection!
+//	}
+//	type Mutation {
+//	  createTODO(subject: String!, description: String): TODO
+//	  updateTODO(id: ID!, subject: String!, description: String): TODO
+//	  deleteTODOs(ids: [ID!]!): [ID!]
+//	}
+//	type Subscription {
+//	  todoEvents(users: [String!]): TODOEvent!
+//	}
+//
+// The cursors of todos are opaque, and TODOs are ordered from the newest like GET /api/todos.
+func (h *GraphQLHandler) newSchema() (*graphql.Schema, error) {
+	dateTime := &graphql.Scalar{
+		Name: "DateTime",
+		Serialize: func(v interface{}) (interface{}, error) {
+			t, ok := v.(time.Time)
+			if !ok {
+				return nil, fmt.Errorf("not a time: %v", v)
+			}
+			return t.Format(time.RFC3339Nano), nil
+		},
+		ParseValue: func(v interface{}) (interface{}, error) {
+			s, ok := v.(string)
+			if !ok {
+				return nil, fmt.Errorf("not a DateTime: %v", v)
+			}
+			return time.Parse(time.RFC3339Nano, s)
+		},
+	}
+	todoField := func(name string, typ graphql.Type, fn func(todo *model.TODO) interface{}) *graphql.Field {
+		return &graphql.Field{
+			Name: name,
+			Type: &graphql.NonNull{OfType: typ},
+			Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+				return fn(p.Source.(*model.TODO)), nil
+			},
+		}
+	}
+	todo := &graphql.Object{
+		Name: "TODO",
+		Fields: []*graphql.Field{
+			todoField("id", graphql.ID, func(todo *model.TODO) interface{} { return todo.ID }),
+			todoField("subject", graphql.String, func(todo *model.TODO) interface{} { return todo.Subject }),
+			todoField("description", graphql.String, func(todo *model.TODO) interface{} { return todo.Description }),
+			todoField("createdAt", dateTime, func(todo *model.TODO) interface{} { return todo.CreatedAt }),
+			todoField("updatedAt", dateTime, func(todo *model.TODO) interface{} { return todo.UpdatedAt }),
+		},
+	}
+
+	edge := &graphql.Object{
+		Name: "TODOEdge",
+		Fields: []*graphql.Field{
+			todoField("cursor", graphql.String, func(todo *model.TODO) interface{} { return encodeCursor(todo.ID) }),
+			todoField("node", todo, func(todo *model.TODO) interface{} { return todo }),
+		},
+	}
+	pageInfo := &graphql.Object{
+		Name: "PageInfo",
+		Fields: []*graphql.Field{
+			{
+				Name: "hasNextPage",
+				Type: &graphql.NonNull{OfType: graphql.Boolean},
+				Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*todoConnection).hasNextPage, nil
+				},
+			},
+			{
+				Name: "endCursor",
+				Type: graphql.String,
+				Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+					c := p.Source.(*todoConnection)
+					if len(c.todos) == 0 {
+						return nil, nil
+					}
+					return encodeCursor(c.todos[len(c.todos)-1].ID), nil
+				},
+			},
+		},
+	}
+	todos := &graphql.NonNull{OfType: &graphql.List{OfType: &graphql.NonNull{OfType: todo}}}
+	connection := &graphql.Object{
+		Name: "TODOConnection",
+		Fields: []*graphql.Field{
+			{
+				Name: "edges",
+				Type: &graphql.NonNull{OfType: &graphql.List{OfType: &graphql.NonNull{OfType: edge}}},
+				Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*todoConnection).todos, nil
+				},
+			},
+			{
+				Name: "nodes",
+				Type: todos,
+				Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*todoConnection).todos, nil
+				},
+			},
+			{
+				Name: "pageInfo",
+				Type: &graphql.NonNull{OfType: pageInfo},
+				Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+					return p.Source, nil
+				},
+			},
+			{
+				Name: "totalCount",
+				Type: &graphql.NonNull{OfType: graphql.Int},
+				Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+					num, err := h.svc.CountTODO(ctx)
+					if err != nil {
+						return nil, h.resolverError(ctx, err)
+					}
+					return num, nil
+				},
+			},
+		},
+	}
+
+	query := &graphql.Object{
+		Name: "Query",
+		Fields: []*graphql.Field{
+			{
+				Name: "todo",
+				Type: todo,
+				Args: []*graphql.Argument{
+					{Name: "id", Type: &graphql.NonNull{OfType: graphql.ID}},
+				},
+				Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseGraphQLID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					load := h.todoLoader(ctx).Load(ctx, id)
+					return graphql.Thunk(func() (interface{}, error) {
+						v, err := load()
+						if err != nil {
+							return nil, h.resolverError(ctx, err)
+						}
+						return v, nil
+					}), nil
+				},
+			},
+			{
+				Name: "todos",
+				Type: &graphql.NonNull{OfType: connection},
+				Args: []*graphql.Argument{
+					{Name: "first", Type: graphql.Int, DefaultValue: h.cfg.DefaultPageSize},
+					{Name: "after", Type: graphql.String},
+				},
+				Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+					first := p.Args["first"].(int)
+					if first < 0 || first > h.cfg.MaxPageSize {
+						return nil, badUserInput("first must be between 0 and %d", h.cfg.MaxPageSize)
+					}
+					var prevID int64
+					if after, ok := p.Args["after"].(string); ok {
+						id, err := decodeCursor(after)
+						if err != nil {
+							return nil, badUserInput("invalid cursor: %q", after)
+						}
+						prevID = id
+					}
+					// NOTE: Reads one more TODO to tell whether the next page exists.
+					todos, err := h.svc.ReadTODO(ctx, prevID, int64(first)+1)
+					if err != nil {
+						return nil, h.resolverError(ctx, err)
+					}
+					c := &todoConnection{todos: todos}
+					if len(todos) > first {
+						c.todos, c.hasNextPage = todos[:first], true
+					}
+					return c, nil
+				},
+				Complexity: func(args map[string]interface{}, child int) int {
+					first, _ := args["first"].(int)
+					return 1 + max(first, 1)*child
+				},
+			},
+		},
+	}
+
+	mutation := &graphql.Object{
+		Name: "Mutation",
+		Fields: []*graphql.Field{
+			{
+				Name: "createTODO",
+				Type: todo,
+				Args: []*graphql.Argument{
+					{Name: "subject", Type: &graphql.NonNull{OfType: graphql.String}},
+					{Name: "description", Type: graphql.String},
+				},
+				Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+					req := &model.CreateTODORequest{Subject: p.Args["subject"].(string)}
+					req.Description, _ = p.Args["description"].(string)
+					if !validCreate(req) {
+						return nil, badUserInput("subject is required")
+					}
+					todo, err := h.svc.CreateTODO(ctx, req.Subject, req.Description)
+					if err != nil {
+						return nil, h.resolverError(ctx, err)
+					}
+					return todo, nil
+				},
+			},
+			{
+				Name: "updateTODO",
+				Type: todo,
+				Args: []*graphql.Argument{
+					{Name: "id", Type: &graphql.NonNull{OfType: graphql.ID}},
+					{Name: "subject", Type: &graphql.NonNull{OfType: graphql.String}},
+					{Name: "description", Type: graphql.String},
+				},
+				Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+					id, err := parseGraphQLID(p.Args["id"])
+					if err != nil {
+						return nil, err
+					}
+					req := &model.UpdateTODORequest{ID: id, Subject: p.Args["subject"].(string)}
+					req.Description, _ = p.Args["description"].(string)
+					if !validUpdate(req) {
+						return nil, badUserInput("subject is required")
+					}
+					todo, err := h.svc.UpdateTODO(ctx, req.ID, req.Subject, req.Description)
+					if err != nil {
+						return nil, h.resolverError(ctx, err)
+					}
+					return todo, nil
+				},
+			},
+			{
+				Name: "deleteTODOs",
+				Type: &graphql.List{OfType: &graphql.NonNull{OfType: graphql.ID}},
+				Args: []*graphql.Argument{
+					{Name: "ids", Type: &graphql.NonNull{OfType: &graphql.List{OfType: &graphql.NonNull{OfType: graphql.ID}}}},
+				},
+				Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+					req := &model.DeleteTODORequest{}
+					for _, v := range p.Args["ids"].([]interface{}) {
+						id, err := parseGraphQLID(v)
+						if err != nil {
+							return nil, err
+						}
+						req.IDs = append(req.IDs, id)
+					}
+					if !validDelete(req) {
+						return nil, badUserInput("ids are required")
+					}
+					if err := h.svc.DeleteTODO(ctx, req.IDs); err != nil {
+						return nil, h.resolverError(ctx, err)
+					}
+					return req.IDs, nil
+				},
+			},
+		},
+	}
+
+	eventField := func(name string, typ graphql.Type, fn func(e model.TODOEvent) interface{}) *graphql.Field {
+		return &graphql.Field{
+			Name: name,
+			Type: typ,
+			Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+				return fn(p.Source.(model.TODOEvent)), nil
+			},
+		}
+	}
+	event := &graphql.Object{
+		Name: "TODOEvent",
+		Fields: []*graphql.Field{
+			eventField("type", &graphql.NonNull{OfType: graphql.String}, func(e model.TODOEvent) interface{} { return e.Type }),
+			eventField("todo", todo, func(e model.TODOEvent) interface{} { return e.TODO }),
+			eventField("ids", &graphql.List{OfType: &graphql.NonNull{OfType: graphql.ID}}, func(e model.TODOEvent) interface{} { return e.IDs }),
+			eventField("user", graphql.String, func(e model.TODOEvent) interface{} {
+				if e.User == "" {
+					return nil
+				}
+				return e.User
+			}),
+		},
+	}
+	subscription := &graphql.Object{
+		Name: "Subscription",
+		Fields: []*graphql.Field{
+			{
+				Name: "todoEvents",
+				Type: &graphql.NonNull{OfType: event},
+				Args: []*graphql.Argument{
+					{Name: "users", Type: &graphql.List{OfType: &graphql.NonNull{OfType: graphql.String}}},
+				},
+				Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(pubsub.Event).Data, nil
+				},
+				Subscribe: h.subscribeTODOEvents,
+			},
+		},
+	}
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:        query,
+		Mutation:     mutation,
+		Subscription: subscription,
+	})
+}
+
+// subscribeTODOEvents sends the events published to the broker until ctx is done or
+// the subscription is closed because the client could not keep up.
+func (h *GraphQLHandler) subscribeTODOEvents(ctx context.Context, args map[string]interface{}) (<-chan interface{}, error) {
+	var users []string
+	if v, ok := args["users"].([]interface{}); ok {
+		for _, u := range v {
+			users = append(users, u.(string))
+		}
+	}
+	sub := h.broker.Subscribe(0, userFilter(users))
+
+	events := make(chan interface{})
+	go func() {
+		defer close(events)
+		defer sub.Close()
+		for {
+			select {
+			case e := <-sub.C():
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+			case <-sub.Done():
+				h.logger.InfoContext(ctx, "graphql subscription closed", slog.Any("err", sub.Err()))
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// resolverError returns the error shown to clients, hiding and logging unexpected errors.
+func (h *GraphQLHandler) resolverError(ctx context.Context, err error) error {
+	var nerr *model.ErrNotFound
+	if errors.As(err, &nerr) {
+		return &graphql.Error{Message: "not found", Extensions: map[string]interface{}{"code": GraphQLErrorNotFound}}
+	}
+	h.logger.WarnContext(ctx, "could not resolve graphql field", slog.Any("err", err))
+	return &graphql.Error{Message: "internal server error", Extensions: map[string]interface{}{"code": GraphQLErrorInternal}}
+}
+
+// badUserInput returns the error of invalid arguments.
+func badUserInput(format string, args ...interface{}) error {
+	return &graphql.Error{Message: fmt.Sprintf(format, args...), Extensions: map[string]interface{}{"code": GraphQLErrorBadUserInput}}
+}
+
+// parseGraphQLID parses the ID of a TODO.
+func parseGraphQLID(v interface{}) (int64, error) {
+	s, _ := v.(string)
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, badUserInput("invalid id: %q", s)
+	}
+	return id, nil
+}
+
+// cursorPrefix distinguishes the cursors of todos, which are opaque to clients.
+const cursorPrefix = "todo:"
+
+// encodeCursor returns the cursor after the TODO of id, which is passed as prev_id to TODOService.ReadTODO.
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.FormatInt(id, 10)))
+}
+
+// decodeCursor returns the ID of the TODO encoded by encodeCursor.
+func decodeCursor(cursor string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	s, ok := strings.CutPrefix(string(b), cursorPrefix)
+	if !ok {
+		return 0, errors.New("unknown cursor")
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
@@ -0,0 +1,414 @@
+package handler_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/db"
+	"github.com/TechBowl-japan/go-stations/handler"
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/pkg/pubsub"
+	"github.com/TechBowl-japan/go-stations/service"
+	"github.com/google/go-cmp/cmp"
+)
+
+// brokerPublisher は、TODOの変更をブローカーに配信する [service.Publisher] である。
+//
+// 変更元の接続を除外できるよう、 ctx の [pubsub.SourceFromContext] を設定する。
+type brokerPublisher struct {
+	broker *pubsub.Broker
+}
+
+func (p *brokerPublisher) Publish(ctx context.Context, e model.TODOEvent) {
+	p.broker.Publish(pubsub.Event{Type: e.Type, User: e.User, Source: pubsub.SourceFromContext(ctx), Data: e})
+}
+
+// newGraphQLServer は、一時的なDBを使用する /api/graphql 及び /api/graphql/stream のサーバを返す。
+func newGraphQLServer(t *testing.T, cfg handler.GraphQLConfig) *httptest.Server {
+	t.Helper()
+
+	todoDB, err := db.NewDB(filepath.Join(t.TempDir(), "graphql_test.db"))
+	if err != nil {
+		t.Fatal("DBの作成に失敗しました:", err)
+	}
+	t.Cleanup(func() {
+		todoDB.Close()
+	})
+
+	broker := pubsub.NewBroker(pubsub.Config{})
+	svc := service.NewTODOService(todoDB, service.WithPublisher(&brokerPublisher{broker: broker}))
+	h := handler.NewGraphQLHandler(svc, broker, cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/graphql", h)
+	mux.Handle("/api/graphql/stream", h.StreamHandler())
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// graphQLResponse は、GraphQLのレスポンスである。
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+// code は、最初のエラーの extensions.code を返す。
+func (r *graphQLResponse) code() string {
+	if len(r.Errors) == 0 {
+		return ""
+	}
+	code, _ := r.Errors[0].Extensions["code"].(string)
+	return code
+}
+
+// postGraphQL は、 query を POST で実行し、レスポンスの data を data に読み込む。
+func postGraphQL(t *testing.T, srv *httptest.Server, query string, variables map[string]interface{}, data interface{}) *graphQLResponse {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(srv.URL+"/api/graphql", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("期待していないステータスコードです, got = %d", resp.StatusCode)
+	}
+
+	var res graphQLResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if data != nil && len(res.Data) > 0 {
+		if err := json.Unmarshal(res.Data, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &res
+}
+
+// createTODOs は、 subjects のTODOを順に作成する。
+func createTODOs(t *testing.T, srv *httptest.Server, subjects ...string) {
+	t.Helper()
+
+	for _, s := range subjects {
+		res := postGraphQL(t, srv, `mutation ($s: String!) { createTODO(subject: $s) { id } }`, map[string]interface{}{"s": s}, nil)
+		if len(res.Errors) > 0 {
+			t.Fatalf("TODOの作成に失敗しました: %+v", res.Errors)
+		}
+	}
+}
+
+func TestGraphQLTODOsPagination(t *testing.T) {
+	t.Parallel()
+
+	srv := newGraphQLServer(t, handler.GraphQLConfig{})
+	createTODOs(t, srv, "1", "2", "3", "4", "5")
+
+	const query = `query ($after: String) {
+		todos(first: 2, after: $after) {
+			totalCount
+			edges { cursor node { id } }
+			pageInfo { hasNextPage endCursor }
+		}
+	}`
+	type page struct {
+		TODOs struct {
+			TotalCount int `json:"totalCount"`
+			Edges      []struct {
+				Cursor string `json:"cursor"`
+				Node   struct {
+					ID string `json:"id"`
+				} `json:"node"`
+			} `json:"edges"`
+			PageInfo struct {
+				HasNextPage bool    `json:"hasNextPage"`
+				EndCursor   *string `json:"endCursor"`
+			} `json:"pageInfo"`
+		} `json:"todos"`
+	}
+
+	var got [][]string
+	var after interface{}
+	for i := 0; i < 4; i++ {
+		var p page
+		res := postGraphQL(t, srv, query, map[string]interface{}{"after": after}, &p)
+		if len(res.Errors) > 0 {
+			t.Fatalf("エラーが返されました: %+v", res.Errors)
+		}
+		if p.TODOs.TotalCount != 5 {
+			t.Errorf("totalCount が一致しません, got = %d", p.TODOs.TotalCount)
+		}
+
+		var ids []string
+		for _, e := range p.TODOs.Edges {
+			ids = append(ids, e.Node.ID)
+		}
+		got = append(got, ids)
+		if n := len(p.TODOs.Edges); n > 0 {
+			if end := p.TODOs.PageInfo.EndCursor; end == nil || *end != p.TODOs.Edges[n-1].Cursor {
+				t.Errorf("endCursor が最後の要素のカーソルではありません, got = %v", end)
+			}
+		}
+		if !p.TODOs.PageInfo.HasNextPage {
+			break
+		}
+		after = *p.TODOs.PageInfo.EndCursor
+	}
+
+	// NOTE: GET /api/todos と同様に新しい順に返し、カーソルより前(prev_id 未満)のTODOを続けて返す。
+	want := [][]string{{"5", "4"}, {"3", "2"}, {"1"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("期待していないページです (-want +got):\n%s", diff)
+	}
+}
+
+func TestGraphQLTODOsFirst(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		first       int
+		wantCode    string
+		wantIDs     []string
+		hasNextPage bool
+	}{
+		"Zero": {
+			first:       0,
+			wantIDs:     []string{},
+			hasNextPage: true,
+		},
+		"Maximum": {
+			first:   3,
+			wantIDs: []string{"2", "1"},
+		},
+		"Negative": {
+			first:    -1,
+			wantCode: handler.GraphQLErrorBadUserInput,
+		},
+		"Over Maximum": {
+			first:    4,
+			wantCode: handler.GraphQLErrorBadUserInput,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := newGraphQLServer(t, handler.GraphQLConfig{MaxPageSize: 3})
+			createTODOs(t, srv, "1", "2")
+
+			var data struct {
+				TODOs struct {
+					Nodes []struct {
+						ID string `json:"id"`
+					} `json:"nodes"`
+					PageInfo struct {
+						HasNextPage bool `json:"hasNextPage"`
+					} `json:"pageInfo"`
+				} `json:"todos"`
+			}
+			res := postGraphQL(t, srv, `query ($first: Int) { todos(first: $first) { nodes { id } pageInfo { hasNextPage } } }`,
+				map[string]interface{}{"first": c.first}, &data)
+			if got := res.code(); got != c.wantCode {
+				t.Fatalf("エラーのコードが一致しません, got = %q, want = %q", got, c.wantCode)
+			}
+			if c.wantCode != "" {
+				return
+			}
+
+			ids := []string{}
+			for _, n := range data.TODOs.Nodes {
+				ids = append(ids, n.ID)
+			}
+			if diff := cmp.Diff(c.wantIDs, ids); diff != "" {
+				t.Errorf("期待していないTODOです (-want +got):\n%s", diff)
+			}
+			if data.TODOs.PageInfo.HasNextPage != c.hasNextPage {
+				t.Errorf("hasNextPage が一致しません, got = %t", data.TODOs.PageInfo.HasNextPage)
+			}
+		})
+	}
+}
+
+func TestGraphQLErrors(t *testing.T) {
+	t.Parallel()
+
+	srv := newGraphQLServer(t, handler.GraphQLConfig{})
+	createTODOs(t, srv, "1")
+
+	cases := map[string]struct {
+		query    string
+		wantCode string
+	}{
+		"Not Found": {
+			query:    `mutation { updateTODO(id: 99, subject: "x") { id } }`,
+			wantCode: handler.GraphQLErrorNotFound,
+		},
+		"Empty Subject": {
+			query:    `mutation { createTODO(subject: "") { id } }`,
+			wantCode: handler.GraphQLErrorBadUserInput,
+		},
+		"Invalid ID": {
+			query:    `{ todo(id: "x") { id } }`,
+			wantCode: handler.GraphQLErrorBadUserInput,
+		},
+		"Invalid Cursor": {
+			query:    `{ todos(after: "x") { nodes { id } } }`,
+			wantCode: handler.GraphQLErrorBadUserInput,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			res := postGraphQL(t, srv, c.query, nil, nil)
+			if got := res.code(); got != c.wantCode {
+				t.Errorf("エラーのコードが一致しません, got = %q, want = %q, errors = %+v", got, c.wantCode, res.Errors)
+			}
+		})
+	}
+}
+
+func TestGraphQLHTTP(t *testing.T) {
+	t.Parallel()
+
+	srv := newGraphQLServer(t, handler.GraphQLConfig{MaxRequestSize: 1 << 10})
+
+	get := func(query string) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/graphql?"+url.Values{"query": {query}}.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+	post := func(body string) *http.Request {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/graphql", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req
+	}
+
+	cases := map[string]struct {
+		req  *http.Request
+		want int
+	}{
+		"GET Query": {
+			req:  get(`{ todos { totalCount } }`),
+			want: http.StatusOK,
+		},
+		"GET Mutation": {
+			req:  get(`mutation { createTODO(subject: "get") { id } }`),
+			want: http.StatusMethodNotAllowed,
+		},
+		"POST Mutation": {
+			req:  post(`{"query": "mutation { createTODO(subject: \"post\") { id } }"}`),
+			want: http.StatusOK,
+		},
+		"Invalid Body": {
+			req:  post(`query`),
+			want: http.StatusBadRequest,
+		},
+		"Missing Query": {
+			req:  post(`{}`),
+			want: http.StatusBadRequest,
+		},
+		"Too Large": {
+			req:  post(`{"query": "{ todos { totalCount } }` + strings.Repeat(" ", 1<<10) + `"}`),
+			want: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			resp, err := http.DefaultClient.Do(c.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != c.want {
+				t.Errorf("期待していないステータスコードです, got = %d, want = %d", resp.StatusCode, c.want)
+			}
+		})
+	}
+}
+
+func TestGraphQLStream(t *testing.T) {
+	t.Parallel()
+
+	srv := newGraphQLServer(t, handler.GraphQLConfig{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	q := url.Values{"query": {`subscription { todoEvents { type todo { subject } } }`}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/graphql/stream?"+q.Encode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("イベントストリームではありません, Content-Type = %s", ct)
+	}
+
+	// NOTE: レスポンスヘッダを受け取った時点で購読しているため、以降の変更は配信される。
+	createTODOs(t, srv, "streamed")
+
+	sc := bufio.NewScanner(resp.Body)
+	var got []string
+	for sc.Scan() && len(got) < 2 {
+		if line := sc.Text(); line != "" {
+			got = append(got, line)
+		}
+	}
+	want := []string{
+		"event: next",
+		`data: {"data":{"todoEvents":{"type":"created","todo":{"subject":"streamed"}}}}`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("期待していないイベントです (-want +got):\n%s", diff)
+	}
+}
+
+func TestGraphQLStreamRejectsQuery(t *testing.T) {
+	t.Parallel()
+
+	srv := newGraphQLServer(t, handler.GraphQLConfig{})
+	resp, err := http.Post(srv.URL+"/api/graphql/stream", "application/json", strings.NewReader(`{"query": "{ todos { totalCount } }"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("期待していないステータスコードです, got = %d", resp.StatusCode)
+	}
+}
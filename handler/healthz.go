@@ -2,18 +2,37 @@ package handler
 
 import (
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
 
 	"github.com/TechBowl-japan/go-stations/model"
 )
 
 // A HealthzHandler implements health check endpoint.
-type HealthzHandler struct{}
+type HealthzHandler struct {
+	logger    *slog.Logger
+	buildInfo BuildInfoFunc
+}
 
 // NewHealthzHandler returns HealthzHandler based http.Handler.
 func NewHealthzHandler() *HealthzHandler {
-	return &HealthzHandler{}
+	return NewHealthzHandlerWithLogger(slog.Default())
+}
+
+// NewHealthzHandlerWithLogger returns HealthzHandler which writes logs to logger.
+func NewHealthzHandlerWithLogger(logger *slog.Logger) *HealthzHandler {
+	return &HealthzHandler{
+		logger: logger,
+	}
+}
+
+// NewHealthzHandlerWithBuildInfo returns HealthzHandler which reports the build information
+// when the verbose query parameter is given.
+func NewHealthzHandlerWithBuildInfo(info BuildInfoFunc, logger *slog.Logger) *HealthzHandler {
+	return &HealthzHandler{
+		logger:    logger,
+		buildInfo: info,
+	}
 }
 
 // ServeHTTP implements http.Handler interface.
@@ -21,9 +40,12 @@ func (h *HealthzHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	res := &model.HealthzResponse{
 		Message: "OK",
 	}
+	if _, verbose := r.URL.Query()["verbose"]; verbose && h.buildInfo != nil {
+		res.Build = h.buildInfo(r.Context())
+	}
 
 	e := json.NewEncoder(w)
 	if err := e.Encode(res); err != nil {
-		log.Println("handler/healthz: could not encode response, err =", err)
+		h.logger.ErrorContext(r.Context(), "could not encode response", slog.Any("err", err))
 	}
 }
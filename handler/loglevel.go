@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/pkg/httperror"
+	"github.com/TechBowl-japan/go-stations/pkg/logging"
+)
+
+// A LogLevelHandler implements the endpoint to read and change the log level at runtime.
+//
+// The change is not persisted, and the configured level is restored on restart or reload.
+type LogLevelHandler struct {
+	level  *slog.LevelVar
+	logger *slog.Logger
+}
+
+// NewLogLevelHandler returns LogLevelHandler based http.Handler.
+func NewLogLevelHandler(level *slog.LevelVar) *LogLevelHandler {
+	return NewLogLevelHandlerWithLogger(level, slog.Default())
+}
+
+// NewLogLevelHandlerWithLogger returns LogLevelHandler which writes logs to logger.
+func NewLogLevelHandlerWithLogger(level *slog.LevelVar, logger *slog.Logger) *LogLevelHandler {
+	return &LogLevelHandler{
+		level:  level,
+		logger: logger,
+	}
+}
+
+// ServeHTTP implements http.Handler interface.
+func (h *LogLevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPut:
+		var req model.UpdateLogLevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httperror.Write(w, r, http.StatusBadRequest)
+			return
+		}
+		level, err := logging.ParseLevel(req.Level)
+		if err != nil {
+			httperror.Write(w, r, http.StatusBadRequest)
+			return
+		}
+		old := h.level.Level()
+		h.level.Set(level)
+		// NOTE: Logged at warn level so that the change is recorded regardless of the new level.
+		h.logger.WarnContext(r.Context(), "log level is changed",
+			slog.String("old", old.String()), slog.String("new", level.String()))
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	res := model.LogLevelResponse{Level: strings.ToLower(h.level.Level().String())}
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		h.logger.ErrorContext(r.Context(), "could not encode response", slog.Any("err", err))
+	}
+}
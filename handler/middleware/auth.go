@@ -1,31 +1,64 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/TechBowl-japan/go-stations/pkg/basicauth"
+	"github.com/TechBowl-japan/go-stations/pkg/httperror"
 )
 
+type authContextKey string
+
+const AuthContextKeyUser = authContextKey("user")
+
+// Authenticator は、Basic認証の認証及びチャレンジレスポンスの生成を行う。
+//
+// [basicauth.BasicAuthInfo] 及び [basicauth.Store] が実装する。
+type Authenticator interface {
+	Authenticate(r *http.Request) error
+	Challenge(w http.ResponseWriter)
+}
+
 type basicAuthMiddleware struct {
-	bai basicauth.BasicAuthInfo
+	auth Authenticator
 }
 
 // NewBasicAuthMiddleware は、Basic認証によるアクセス制限を行うミドルウェアを返す。
 func NewBasicAuthMiddleware(bai basicauth.BasicAuthInfo) *basicAuthMiddleware {
+	return NewBasicAuthMiddlewareWithAuthenticator(&bai)
+}
+
+// NewBasicAuthMiddlewareWithAuthenticator は、 auth で認証を行うミドルウェアを返す。
+//
+// 実行中に認証情報を差し替える場合は、 [basicauth.Store] を指定する。
+func NewBasicAuthMiddlewareWithAuthenticator(auth Authenticator) *basicAuthMiddleware {
 	return &basicAuthMiddleware{
-		bai: bai,
+		auth: auth,
 	}
 }
 
 // ServeNext は、Basic認証によるアクセス制限を行う。
+//
+// 認証に成功した場合、 [AuthContextKeyUser] をキーとしてユーザIDを保存し、アクセスログにも記録する。
+// 外側のミドルウェア(e.g. [NewClientCertMiddleware])で認証済みの場合は、Basic認証を行わない。
 func (m *basicAuthMiddleware) ServeNext(h http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		if err := m.bai.Authenticate(r); err != nil {
-			m.bai.Challenge(w)
-			w.WriteHeader(http.StatusUnauthorized)
+		if uid, ok := r.Context().Value(AuthContextKeyUser).(string); ok && uid != "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if err := m.auth.Authenticate(r); err != nil {
+			setAuthFailed(r.Context())
+			m.auth.Challenge(w)
+			httperror.Write(w, r, http.StatusUnauthorized)
 			return
 		}
-		h.ServeHTTP(w, r)
+		uid, _, _ := r.BasicAuth()
+		setUser(r.Context(), uid)
+		ctx := context.WithValue(r.Context(), AuthContextKeyUser, uid)
+
+		h.ServeHTTP(w, r.WithContext(ctx))
 	}
 	return http.HandlerFunc(fn)
 }
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+type clientCertMiddleware struct {
+	principals map[string]string
+}
+
+// NewClientCertMiddleware は、検証済みのクライアント証明書のサブジェクトをユーザIDとして認証するミドルウェアを返す。
+//
+// principals は、サブジェクトの識別名(e.g. CN=alice,O=Example)からユーザIDへの対応である。
+// 空の場合は、サブジェクトの CN をユーザIDとする。
+func NewClientCertMiddleware(principals map[string]string) *clientCertMiddleware {
+	return &clientCertMiddleware{
+		principals: principals,
+	}
+}
+
+// ServeNext は、クライアント証明書に対応するユーザIDを [AuthContextKeyUser] をキーとして保存し、アクセスログにも記録する。
+//
+// 対応するユーザIDが存在しない場合は何もしないため、内側にBasic認証を行うミドルウェアを設定する事で、
+// クライアント証明書とBasic認証のいずれかによる認証を要求できる。
+func (m *clientCertMiddleware) ServeNext(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if uid := m.principal(r); uid != "" {
+			setUser(r.Context(), uid)
+			r = r.WithContext(context.WithValue(r.Context(), AuthContextKeyUser, uid))
+		}
+		h.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func (m *clientCertMiddleware) principal(r *http.Request) string {
+	// NOTE: VerifiedChains は、 [crypto/tls.Config.ClientCAs] で検証できた場合のみ設定される。
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	subject := r.TLS.VerifiedChains[0][0].Subject
+	if len(m.principals) == 0 {
+		return subject.CommonName
+	}
+	return m.principals[subject.String()]
+}
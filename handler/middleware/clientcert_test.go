@@ -0,0 +1,88 @@
+package middleware_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/handler/middleware"
+	"github.com/TechBowl-japan/go-stations/pkg/basicauth"
+)
+
+func TestClientCert(t *testing.T) {
+	alice := &x509.Certificate{Subject: pkix.Name{CommonName: "alice", Organization: []string{"Example"}}}
+
+	testcases := map[string]struct {
+		principals map[string]string
+		tls        *tls.ConnectionState
+		basicAuth  bool
+		wantStatus int
+		wantUser   string
+	}{
+		"Common name": {
+			tls:        &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{alice}}},
+			wantStatus: http.StatusOK,
+			wantUser:   "alice",
+		},
+		"Mapped subject": {
+			principals: map[string]string{"CN=alice,O=Example": "admin"},
+			tls:        &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{alice}}},
+			wantStatus: http.StatusOK,
+			wantUser:   "admin",
+		},
+		"Unmapped subject": {
+			principals: map[string]string{"CN=bob,O=Example": "bob"},
+			tls:        &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{alice}}},
+			wantStatus: http.StatusUnauthorized,
+		},
+		"Unverified certificate": {
+			tls:        &tls.ConnectionState{PeerCertificates: []*x509.Certificate{alice}},
+			wantStatus: http.StatusUnauthorized,
+		},
+		"Fallback to basic auth": {
+			principals: map[string]string{"CN=bob,O=Example": "bob"},
+			tls:        &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{alice}}},
+			basicAuth:  true,
+			wantStatus: http.StatusOK,
+			wantUser:   "user",
+		},
+	}
+
+	bai, err := basicauth.NewBasicAuthInfo("user", "pass")
+	if err != nil {
+		t.Fatalf("認証情報の作成に失敗しました: %v", err)
+	}
+
+	for name, tc := range testcases {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			var gotUser string
+			h := middleware.With(
+				http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					gotUser, _ = r.Context().Value(middleware.AuthContextKeyUser).(string)
+				}),
+				middleware.NewBasicAuthMiddlewareWithAuthenticator(bai),
+				middleware.NewClientCertMiddleware(tc.principals),
+			)
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.TLS = tc.tls
+			if tc.basicAuth {
+				r.SetBasicAuth("user", "pass")
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tc.wantStatus {
+				t.Errorf("期待していない HTTP status code です, got = %d, want = %d", w.Code, tc.wantStatus)
+			}
+			if gotUser != tc.wantUser {
+				t.Errorf("期待していないユーザIDです, got = %s, want = %s", gotUser, tc.wantUser)
+			}
+		})
+	}
+}
@@ -0,0 +1,478 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/TechBowl-japan/go-stations/pkg/httperror"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	defaultCompressionMinSize      = 1024
+	defaultMaxDecompressedBodySize = 10 << 20
+	encodingGzip                   = "gzip"
+	encodingBrotli                 = "br"
+	encodingZstd                   = "zstd"
+	encodingIdentity               = "identity"
+	zstdMaxWindowSize              = 8 << 20
+)
+
+// Encoder は、レスポンスの圧縮方式である。
+//
+// gzip、brotli 及び zstd 以外の圧縮方式は、このインターフェースを実装して [CompressionConfig] に指定する。
+type Encoder interface {
+	// Encoding は、Content-Encoding の値(e.g. gzip)を返す。
+	Encoding() string
+	// NewWriter は、 w に圧縮したデータを書き込む EncoderWriter を返す。
+	NewWriter(w io.Writer) EncoderWriter
+}
+
+// EncoderWriter は、圧縮したデータを書き込む Writer である。
+//
+// Flush は、ストリーミングのため書き込み済みのデータを圧縮して出力する。Close は、圧縮を終了する。
+type EncoderWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// resetWriter は、出力先を変更して再利用できる EncoderWriter である。
+type resetWriter interface {
+	EncoderWriter
+	Reset(w io.Writer)
+}
+
+// pooledEncoder は、圧縮の状態を確保するコストを抑えるため、 resetWriter をプールして再利用する Encoder である。
+type pooledEncoder struct {
+	encoding string
+	pool     sync.Pool
+}
+
+func newPooledEncoder(encoding string, newWriter func() resetWriter) *pooledEncoder {
+	e := &pooledEncoder{encoding: encoding}
+	e.pool.New = func() interface{} {
+		return newWriter()
+	}
+	return e
+}
+
+func (e *pooledEncoder) Encoding() string {
+	return e.encoding
+}
+
+func (e *pooledEncoder) NewWriter(w io.Writer) EncoderWriter {
+	zw := e.pool.Get().(resetWriter)
+	zw.Reset(w)
+	return &pooledWriter{resetWriter: zw, pool: &e.pool}
+}
+
+// pooledWriter は、Close 時に resetWriter をプールに戻す。
+type pooledWriter struct {
+	resetWriter
+	pool *sync.Pool
+}
+
+func (w *pooledWriter) Close() error {
+	err := w.resetWriter.Close()
+	// NOTE: プールに残る間、レスポンスへの参照を保持しない。
+	w.resetWriter.Reset(io.Discard)
+	w.pool.Put(w.resetWriter)
+	return err
+}
+
+// NewGzipEncoder は、 level の圧縮率でgzip圧縮する Encoder を返す。
+//
+// level には [compress/gzip] の圧縮率(e.g. [compress/gzip.DefaultCompression])を指定する。
+func NewGzipEncoder(level int) (Encoder, error) {
+	if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+		return nil, err
+	}
+	return newPooledEncoder(encodingGzip, func() resetWriter {
+		zw, _ := gzip.NewWriterLevel(io.Discard, level)
+		return zw
+	}), nil
+}
+
+// NewBrotliEncoder は、 level の圧縮率でbrotli圧縮する Encoder を返す。
+//
+// level には0(最速)から11(最小)を指定する。動的なレスポンスには4程度が圧縮率と速度の釣り合いが良い。
+func NewBrotliEncoder(level int) (Encoder, error) {
+	if level < brotli.BestSpeed || level > brotli.BestCompression {
+		return nil, fmt.Errorf("brotliの圧縮率には%dから%dを指定する必要があります: %d", brotli.BestSpeed, brotli.BestCompression, level)
+	}
+	return newPooledEncoder(encodingBrotli, func() resetWriter {
+		return brotli.NewWriterLevel(io.Discard, level)
+	}), nil
+}
+
+// NewZstdEncoder は、 level の圧縮率でzstd圧縮する Encoder を返す。
+//
+// level には zstd コマンドと同様に1(最速)から22(最小)を指定し、近い圧縮率で圧縮する。
+func NewZstdEncoder(level int) (Encoder, error) {
+	if level < 1 || level > 22 {
+		return nil, fmt.Errorf("zstdの圧縮率には1から22を指定する必要があります: %d", level)
+	}
+	opts := []zstd.EOption{
+		zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)),
+		// NOTE: 並行して処理するリクエスト毎に圧縮するため、1つのレスポンスの圧縮は並列化しない。
+		zstd.WithEncoderConcurrency(1),
+		// NOTE: ブラウザは8MiBを超えるウィンドウサイズのレスポンスを展開できない(RFC 9659)。
+		zstd.WithWindowSize(zstdMaxWindowSize),
+	}
+	if _, err := zstd.NewWriter(nil, opts...); err != nil {
+		return nil, err
+	}
+	return newPooledEncoder(encodingZstd, func() resetWriter {
+		zw, _ := zstd.NewWriter(nil, opts...)
+		return zw
+	}), nil
+}
+
+// CompressionConfig は、 [NewCompressionMiddleware] に与える設定を表す。
+type CompressionConfig struct {
+	// Encoders は、優先順の圧縮方式である。空の場合は [compress/gzip.DefaultCompression] のgzipのみを使用する。
+	Encoders []Encoder
+	// MinSize は、圧縮するレスポンスの最小のバイト数である。0の場合は1024とする。
+	MinSize int
+	// MaxDecompressedBodySize は、gzip圧縮されたリクエストボディを展開した後の最大のバイト数である。0の場合は10MiBとする。
+	MaxDecompressedBodySize int64
+}
+
+type compressionMiddleware struct {
+	encoders  []Encoder
+	minSize   int
+	maxBody   int64
+	encodings map[string]Encoder
+}
+
+// NewCompressionMiddleware は、レスポンスの圧縮及びリクエストボディの展開を行うミドルウェアを返す。
+func NewCompressionMiddleware(cfg CompressionConfig) (*compressionMiddleware, error) {
+	m := &compressionMiddleware{
+		encoders:  cfg.Encoders,
+		minSize:   cfg.MinSize,
+		maxBody:   cfg.MaxDecompressedBodySize,
+		encodings: make(map[string]Encoder),
+	}
+	if len(m.encoders) == 0 {
+		gz, err := NewGzipEncoder(gzip.DefaultCompression)
+		if err != nil {
+			return nil, err
+		}
+		m.encoders = []Encoder{gz}
+	}
+	for _, e := range m.encoders {
+		enc := strings.ToLower(e.Encoding())
+		if enc == "" || enc == encodingIdentity || m.encodings[enc] != nil {
+			return nil, fmt.Errorf("圧縮方式が不正または重複しています: %q", e.Encoding())
+		}
+		m.encodings[enc] = e
+	}
+	if m.minSize < 0 || m.maxBody < 0 {
+		return nil, errors.New("圧縮の最小のサイズ及び展開後の最大のサイズには0以上の値を指定する必要があります")
+	}
+	if m.minSize == 0 {
+		m.minSize = defaultCompressionMinSize
+	}
+	if m.maxBody == 0 {
+		m.maxBody = defaultMaxDecompressedBodySize
+	}
+	return m, nil
+}
+
+// ServeNext は、Accept-Encoding に従ってレスポンスを圧縮し、Content-Encoding: gzip のリクエストボディを展開する。
+//
+// MinSize 未満のレスポンス、既に圧縮されたレスポンス(Content-Encoding を設定済み、または画像等の圧縮済みの Content-Type)は圧縮しない。
+// 圧縮の有無はレスポンスの先頭 MinSize バイトで判定するため、それまでは書き込みをバッファする。
+// [net/http.Flusher] で明示的にフラッシュした場合は、その時点で判定する。
+//
+// 展開後のリクエストボディが MaxDecompressedBodySize を超える場合、読み込みはエラーとなる。
+// gzip 以外の Content-Encoding のリクエストには、status 415 を返す。
+func (m *compressionMiddleware) ServeNext(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if ce := r.Header.Get("Content-Encoding"); ce != "" {
+			if !strings.EqualFold(ce, encodingGzip) {
+				w.Header().Set("Accept-Encoding", encodingGzip)
+				httperror.Write(w, r, http.StatusUnsupportedMediaType)
+				return
+			}
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				httperror.Write(w, r, http.StatusBadRequest)
+				return
+			}
+			r = r.Clone(r.Context())
+			r.Body = &decompressedBody{
+				ReadCloser: http.MaxBytesReader(w, zr, m.maxBody),
+				body:       r.Body,
+			}
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+		}
+
+		// NOTE: 共有キャッシュが異なる Accept-Encoding のクライアントにレスポンスを再利用しないよう、圧縮の有無に関わらず付与する。
+		w.Header().Add("Vary", "Accept-Encoding")
+		enc := m.negotiate(r.Header.Get("Accept-Encoding"))
+		if enc == nil || r.Method == http.MethodHead {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressResponseWriter{
+			ResponseWriter: w,
+			encoder:        enc,
+			minSize:        m.minSize,
+			status:         http.StatusOK,
+		}
+		// NOTE: panic時は、RecoveryMiddleware がエラーレスポンスを返すため、バッファしたレスポンスを書き込まない。
+		h.ServeHTTP(cw, r)
+		cw.close()
+	}
+	return http.HandlerFunc(fn)
+}
+
+// negotiate は、 accept(Accept-Encoding)で許可された圧縮方式のうち、q値が最大のものを返す。
+//
+// q値が等しい場合は、 Encoders の順で優先する。圧縮しない場合は nil を返す。
+func (m *compressionMiddleware) negotiate(accept string) Encoder {
+	if accept == "" {
+		return nil
+	}
+	qs := make(map[string]float64)
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		for _, p := range strings.Split(params, ";") {
+			k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+			if ok && strings.EqualFold(k, "q") {
+				f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				if err != nil {
+					f = 0
+				}
+				q = f
+			}
+		}
+		if name != "" {
+			qs[name] = q
+		}
+	}
+
+	var best Encoder
+	bestQ := 0.0
+	for _, e := range m.encoders {
+		q, ok := qs[strings.ToLower(e.Encoding())]
+		if !ok {
+			q, ok = qs["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+	return best
+}
+
+// decompressedBody は、展開したリクエストボディを読み込み、Close 時に元のリクエストボディも閉じる。
+type decompressedBody struct {
+	io.ReadCloser
+	body io.Closer
+}
+
+func (b *decompressedBody) Close() error {
+	return errors.Join(b.ReadCloser.Close(), b.body.Close())
+}
+
+// compressResponseWriter は、レスポンスを圧縮するために、デフォルトの [net/http.ResponseWriter] を拡張した構造体である。
+//
+// 圧縮の有無を判定するまでは、ステータスの書き込みも遅延する。
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoder Encoder
+	minSize int
+
+	status      int
+	wroteHeader bool
+	buf         []byte
+	// decided は、圧縮の有無を判定済みかである。判定後は、 zw が nil の場合に圧縮せずに書き込む。
+	decided bool
+	zw      EncoderWriter
+}
+
+func (w *compressResponseWriter) WriteHeader(status int) {
+	// NOTE: 1xx は最終的なレスポンスではないため、遅延せずに書き込む。
+	if status >= 100 && status <= 199 && status != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if w.wroteHeader {
+		return
+	}
+	w.status = status
+	w.wroteHeader = true
+	if !bodyAllowed(status) {
+		w.decide(false)
+	}
+}
+
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		if !w.compressible() {
+			w.decide(false)
+		} else if cl, err := strconv.Atoi(w.Header().Get("Content-Length")); err == nil && cl < w.minSize {
+			w.decide(false)
+		} else {
+			w.buf = append(w.buf, b...)
+			if len(w.buf) >= w.minSize {
+				if err := w.decide(true); err != nil {
+					return 0, err
+				}
+			}
+			return len(b), nil
+		}
+	}
+	if w.zw != nil {
+		return w.zw.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush は、 [net/http.Flusher] を実装する。
+//
+// 圧縮の有無を判定していない場合、バッファしたレスポンスのサイズに関わらず、圧縮可能な Content-Type であれば圧縮する。
+func (w *compressResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.decided {
+		if err := w.decide(w.compressible()); err != nil {
+			return
+		}
+	}
+	if w.zw != nil {
+		if err := w.zw.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack は、 [net/http.Hijacker] を実装する。
+func (w *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("compressResponseWriter: underlying ResponseWriter does not implement http.Hijacker")
+	}
+	w.decided = true
+	return h.Hijack()
+}
+
+// Unwrap は、 [net/http.ResponseController] が元の [net/http.ResponseWriter] を参照するために使用する。
+func (w *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// compressible は、ヘッダから圧縮できるレスポンスであるかを返す。
+func (w *compressResponseWriter) compressible() bool {
+	hdr := w.Header()
+	if hdr.Get("Content-Encoding") != "" || !bodyAllowed(w.status) {
+		return false
+	}
+	ct := hdr.Get("Content-Type")
+	if ct == "" {
+		// NOTE: [net/http] が圧縮後のデータから Content-Type を推測しないよう、圧縮前のデータから推測して設定する。
+		if len(w.buf) == 0 {
+			return true
+		}
+		ct = http.DetectContentType(w.buf)
+		hdr.Set("Content-Type", ct)
+	}
+	return compressibleType(ct)
+}
+
+// decide は、圧縮の有無を確定し、ステータス及びバッファしたレスポンスを書き込む。
+func (w *compressResponseWriter) decide(compress bool) error {
+	w.decided = true
+	// NOTE: バッファしたレスポンスから Content-Type を推測する。
+	if compress && !w.compressible() {
+		compress = false
+	}
+	if compress {
+		hdr := w.Header()
+		hdr.Set("Content-Encoding", strings.ToLower(w.encoder.Encoding()))
+		hdr.Del("Content-Length")
+		// NOTE: 圧縮後のバイト列に対する範囲指定はできないため、Range リクエストの受け入れを取り消す。
+		hdr.Del("Accept-Ranges")
+		if etag := hdr.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			hdr.Set("ETag", "W/"+etag)
+		}
+		w.ResponseWriter.WriteHeader(w.status)
+		w.zw = w.encoder.NewWriter(w.ResponseWriter)
+		if len(w.buf) > 0 {
+			if _, err := w.zw.Write(w.buf); err != nil {
+				return err
+			}
+		}
+	} else {
+		if w.wroteHeader {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+		if len(w.buf) > 0 {
+			if _, err := w.ResponseWriter.Write(w.buf); err != nil {
+				return err
+			}
+		}
+	}
+	w.buf = nil
+	return nil
+}
+
+// close は、バッファしたレスポンスを書き込み、圧縮を終了する。
+func (w *compressResponseWriter) close() {
+	if !w.decided {
+		// NOTE: MinSize に満たないレスポンスは、圧縮しない。
+		w.decide(false)
+	}
+	if w.zw != nil {
+		w.zw.Close()
+	}
+}
+
+// bodyAllowed は、 status のレスポンスがボディを持てるかを返す。
+func bodyAllowed(status int) bool {
+	return status != http.StatusNoContent && status != http.StatusNotModified && (status < 100 || status > 199)
+}
+
+// compressibleType は、 contentType が圧縮の効果があるメディアタイプであるかを返す。
+func compressibleType(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mt, "text/"),
+		mt == "application/json",
+		mt == "application/javascript",
+		mt == "application/xml",
+		mt == "application/x-ndjson",
+		mt == "image/svg+xml",
+		strings.HasSuffix(mt, "+json"),
+		strings.HasSuffix(mt, "+xml"):
+		return true
+	}
+	return false
+}
@@ -0,0 +1,579 @@
+package middleware_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/handler/middleware"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCompression(t *testing.T) {
+	t.Parallel()
+
+	large := strings.Repeat(`{"subject":"todo"}`, 100)
+
+	cases := map[string]struct {
+		acceptEncoding string
+		status         int
+		contentType    string
+		header         map[string]string
+		body           string
+		wantEncoding   string
+	}{
+		"Gzip": {
+			acceptEncoding: "gzip, deflate, br",
+			contentType:    "application/json; charset=utf-8",
+			body:           large,
+			wantEncoding:   "gzip",
+		},
+		"Status is kept": {
+			acceptEncoding: "gzip",
+			status:         http.StatusCreated,
+			contentType:    "application/json",
+			body:           large,
+			wantEncoding:   "gzip",
+		},
+		"Wildcard": {
+			acceptEncoding: "*",
+			contentType:    "text/plain",
+			body:           large,
+			wantEncoding:   "gzip",
+		},
+		"Detected content type": {
+			acceptEncoding: "gzip",
+			body:           large,
+			wantEncoding:   "gzip",
+		},
+		"Not accepted": {
+			contentType: "application/json",
+			body:        large,
+		},
+		"Rejected by q=0": {
+			acceptEncoding: "gzip;q=0, identity",
+			contentType:    "application/json",
+			body:           large,
+		},
+		"Small body": {
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			body:           `{"subject":"todo"}`,
+		},
+		"Small Content-Length": {
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			header:         map[string]string{"Content-Length": "2"},
+			body:           "{}",
+		},
+		"Already encoded": {
+			acceptEncoding: "gzip",
+			contentType:    "application/json",
+			header:         map[string]string{"Content-Encoding": "br"},
+			body:           large,
+			wantEncoding:   "br",
+		},
+		"Compressed content type": {
+			acceptEncoding: "gzip",
+			contentType:    "image/png",
+			body:           large,
+		},
+		"No content": {
+			acceptEncoding: "gzip",
+			status:         http.StatusNoContent,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			m, err := middleware.NewCompressionMiddleware(middleware.CompressionConfig{})
+			if err != nil {
+				t.Fatalf("ミドルウェアの作成に失敗しました: %v", err)
+			}
+			h := m.ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if c.contentType != "" {
+					w.Header().Set("Content-Type", c.contentType)
+				}
+				for k, v := range c.header {
+					w.Header().Set(k, v)
+				}
+				if c.status != 0 {
+					w.WriteHeader(c.status)
+				}
+				// NOTE: 複数回に分けて書き込んでも、先頭から判定する。
+				for i := 0; i < len(c.body); i += 100 {
+					io.WriteString(w, c.body[i:min(i+100, len(c.body))])
+				}
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/api/todos", nil)
+			if c.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", c.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			wantStatus := c.status
+			if wantStatus == 0 {
+				wantStatus = http.StatusOK
+			}
+			if w.Code != wantStatus {
+				t.Errorf("期待していない HTTP status code です, got = %d, want = %d", w.Code, wantStatus)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != c.wantEncoding {
+				t.Errorf("期待していない Content-Encoding です, got = %q, want = %q", got, c.wantEncoding)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Errorf("期待していない Vary ヘッダです, got = %q", got)
+			}
+
+			body := w.Body.Bytes()
+			if c.wantEncoding == "gzip" {
+				if w.Header().Get("Content-Length") != "" {
+					t.Error("圧縮したレスポンスに Content-Length が設定されています")
+				}
+				if w.Header().Get("Content-Type") == "application/x-gzip" {
+					t.Error("圧縮後のデータから Content-Type が推測されています")
+				}
+				body = gunzip(t, body)
+			}
+			if string(body) != c.body {
+				t.Errorf("期待していないレスポンスです, got = %q", body)
+			}
+		})
+	}
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	t.Parallel()
+
+	body := strings.Repeat(`{"subject":"todo"}`, 100)
+
+	cases := map[string]struct {
+		acceptEncoding string
+		wantEncoding   string
+	}{
+		"Browser":               {acceptEncoding: "gzip, deflate, br, zstd", wantEncoding: "br"},
+		"Without brotli":        {acceptEncoding: "gzip, zstd", wantEncoding: "zstd"},
+		"Gzip only":             {acceptEncoding: "gzip", wantEncoding: "gzip"},
+		"Higher q-value":        {acceptEncoding: "br;q=0.5, gzip;q=1", wantEncoding: "gzip"},
+		"Fractional q-values":   {acceptEncoding: "zstd;q=0.8, gzip;q=0.9, br;q=0.1", wantEncoding: "gzip"},
+		"Wildcard":              {acceptEncoding: "br;q=0, *", wantEncoding: "zstd"},
+		"Case insensitive":      {acceptEncoding: "ZSTD;Q=1", wantEncoding: "zstd"},
+		"All rejected":          {acceptEncoding: "br;q=0, zstd;q=0, gzip;q=0"},
+		"Unsupported":           {acceptEncoding: "deflate, compress"},
+		"Invalid q-value":       {acceptEncoding: "br;q=x, gzip", wantEncoding: "gzip"},
+		"Identity only":         {acceptEncoding: "identity"},
+		"Wildcard with q-value": {acceptEncoding: "*;q=0.5, gzip;q=0.1", wantEncoding: "br"},
+	}
+
+	br, err := middleware.NewBrotliEncoder(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zstd, err := middleware.NewZstdEncoder(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz, err := middleware.NewGzipEncoder(gzip.DefaultCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := middleware.NewCompressionMiddleware(middleware.CompressionConfig{
+		Encoders: []middleware.Encoder{br, zstd, gz},
+	})
+	if err != nil {
+		t.Fatalf("ミドルウェアの作成に失敗しました: %v", err)
+	}
+	h := m.ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// NOTE: プールした圧縮の状態を再利用しても、レスポンス毎に正しく圧縮する。
+		for i := 0; i < len(body); i += 100 {
+			io.WriteString(w, body[i:min(i+100, len(body))])
+		}
+	}))
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r := httptest.NewRequest(http.MethodGet, "/api/todos", nil)
+			r.Header.Set("Accept-Encoding", c.acceptEncoding)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if got := w.Header().Get("Content-Encoding"); got != c.wantEncoding {
+				t.Fatalf("期待していない Content-Encoding です, got = %q, want = %q", got, c.wantEncoding)
+			}
+			if got := decode(t, c.wantEncoding, w.Body.Bytes()); string(got) != body {
+				t.Errorf("期待していないレスポンスです, got = %q", got)
+			}
+		})
+	}
+}
+
+func TestCompressionEncoderLevels(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		newEncoder func() (middleware.Encoder, error)
+		wantErr    bool
+	}{
+		"Brotli fastest":  {newEncoder: func() (middleware.Encoder, error) { return middleware.NewBrotliEncoder(0) }},
+		"Brotli smallest": {newEncoder: func() (middleware.Encoder, error) { return middleware.NewBrotliEncoder(11) }},
+		"Brotli invalid":  {newEncoder: func() (middleware.Encoder, error) { return middleware.NewBrotliEncoder(12) }, wantErr: true},
+		"Zstd fastest":    {newEncoder: func() (middleware.Encoder, error) { return middleware.NewZstdEncoder(1) }},
+		"Zstd smallest":   {newEncoder: func() (middleware.Encoder, error) { return middleware.NewZstdEncoder(22) }},
+		"Zstd invalid":    {newEncoder: func() (middleware.Encoder, error) { return middleware.NewZstdEncoder(0) }, wantErr: true},
+		"Gzip invalid":    {newEncoder: func() (middleware.Encoder, error) { return middleware.NewGzipEncoder(10) }, wantErr: true},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			e, err := c.newEncoder()
+			if (err != nil) != c.wantErr {
+				t.Fatalf("期待していないエラーです, got = %v, wantErr = %v", err, c.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			const data = "streamed data"
+			var buf bytes.Buffer
+			zw := e.NewWriter(&buf)
+			io.WriteString(zw, data)
+			// NOTE: Flush した時点までのデータは、圧縮の終了を待たずに展開できる。
+			if err := zw.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := decodePartial(t, e.Encoding(), buf.Bytes(), len(data)); string(got) != data {
+				t.Errorf("Flush したデータを展開できません, got = %q", got)
+			}
+			if err := zw.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if got := decode(t, e.Encoding(), buf.Bytes()); string(got) != data {
+				t.Errorf("期待していないデータです, got = %q", got)
+			}
+		})
+	}
+}
+
+func TestCompressionFlush(t *testing.T) {
+	t.Parallel()
+
+	m, err := middleware.NewCompressionMiddleware(middleware.CompressionConfig{})
+	if err != nil {
+		t.Fatalf("ミドルウェアの作成に失敗しました: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	flushed := make(chan []byte)
+	done := make(chan struct{})
+	h := m.ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: 1\n\n")
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("フラッシュに失敗しました: %v", err)
+		}
+		flushed <- nil
+		<-done
+		io.WriteString(w, "data: 2\n\n")
+	}))
+	go func() {
+		<-flushed
+		// NOTE: フラッシュ時点で、MinSize 未満でも圧縮したデータを読み込める。
+		zr, err := gzip.NewReader(bytes.NewReader(w.Body.Bytes()))
+		if err != nil {
+			t.Errorf("gzipの展開に失敗しました: %v", err)
+		} else {
+			buf := make([]byte, 64)
+			n, _ := zr.Read(buf)
+			if got := string(buf[:n]); got != "data: 1\n\n" {
+				t.Errorf("期待していないレスポンスです, got = %q", got)
+			}
+		}
+		close(done)
+	}()
+	r := httptest.NewRequest(http.MethodGet, "/events", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	h.ServeHTTP(w, r)
+
+	if !w.Flushed {
+		t.Error("レスポンスがフラッシュされていません")
+	}
+	if got := string(gunzip(t, w.Body.Bytes())); got != "data: 1\n\ndata: 2\n\n" {
+		t.Errorf("期待していないレスポンスです, got = %q", got)
+	}
+}
+
+func TestCompressionWithAccessLog(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	m, err := middleware.NewCompressionMiddleware(middleware.CompressionConfig{})
+	if err != nil {
+		t.Fatalf("ミドルウェアの作成に失敗しました: %v", err)
+	}
+	h := middleware.With(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, strings.Repeat("a", 4096))
+	}), m, middleware.NewAccessLogMiddlewareWithWriter(&buf))
+
+	r := httptest.NewRequest(http.MethodPost, "/api/todos", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	var got struct {
+		Status        int   `json:"status"`
+		ResponseBytes int64 `json:"response_bytes"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("アクセスログの読み込みに失敗しました: %v", err)
+	}
+	if got.Status != http.StatusCreated {
+		t.Errorf("期待していないstatusが記録されています, got = %d, want = %d", got.Status, http.StatusCreated)
+	}
+	if got.ResponseBytes != int64(w.Body.Len()) {
+		t.Errorf("圧縮後のサイズが記録されていません, got = %d, want = %d", got.ResponseBytes, w.Body.Len())
+	}
+}
+
+func TestCompressionRequestBody(t *testing.T) {
+	t.Parallel()
+
+	const payload = `{"subject":"imported"}`
+
+	cases := map[string]struct {
+		contentEncoding string
+		body            []byte
+		maxSize         int64
+		wantStatus      int
+		wantBody        string
+	}{
+		"Gzip": {
+			contentEncoding: "gzip",
+			body:            gzipBytes(t, payload),
+			wantStatus:      http.StatusOK,
+			wantBody:        payload,
+		},
+		"Identity": {
+			body:       []byte(payload),
+			wantStatus: http.StatusOK,
+			wantBody:   payload,
+		},
+		"Too large": {
+			contentEncoding: "gzip",
+			body:            gzipBytes(t, strings.Repeat("a", 1024)),
+			maxSize:         100,
+			wantStatus:      http.StatusRequestEntityTooLarge,
+		},
+		"Invalid gzip": {
+			contentEncoding: "gzip",
+			body:            []byte(payload),
+			wantStatus:      http.StatusBadRequest,
+		},
+		"Unsupported": {
+			contentEncoding: "br",
+			body:            []byte(payload),
+			wantStatus:      http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			m, err := middleware.NewCompressionMiddleware(middleware.CompressionConfig{MaxDecompressedBodySize: c.maxSize})
+			if err != nil {
+				t.Fatalf("ミドルウェアの作成に失敗しました: %v", err)
+			}
+			h := m.ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, err := io.ReadAll(r.Body)
+				var maxErr *http.MaxBytesError
+				if errors.As(err, &maxErr) {
+					w.WriteHeader(http.StatusRequestEntityTooLarge)
+					return
+				}
+				if r.Header.Get("Content-Encoding") != "" {
+					t.Error("展開したリクエストに Content-Encoding が残っています")
+				}
+				w.Write(b)
+			}))
+
+			r := httptest.NewRequest(http.MethodPost, "/api/todos/import", bytes.NewReader(c.body))
+			if c.contentEncoding != "" {
+				r.Header.Set("Content-Encoding", c.contentEncoding)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != c.wantStatus {
+				t.Errorf("期待していない HTTP status code です, got = %d, want = %d", w.Code, c.wantStatus)
+			}
+			if c.wantBody != "" && w.Body.String() != c.wantBody {
+				t.Errorf("期待していないリクエストボディです, got = %q, want = %q", w.Body.String(), c.wantBody)
+			}
+		})
+	}
+}
+
+func BenchmarkCompression(b *testing.B) {
+	todos := make([]map[string]interface{}, 500)
+	for i := range todos {
+		todos[i] = map[string]interface{}{
+			"id":          i + 1,
+			"subject":     "subject of the todo",
+			"description": "description of the todo",
+			"created_at":  "2024-08-01T00:00:00+09:00",
+			"updated_at":  "2024-08-01T00:00:00+09:00",
+		}
+	}
+	body, err := json.Marshal(map[string]interface{}{"todos": todos})
+	if err != nil {
+		b.Fatal(err)
+	}
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(body)
+	})
+
+	m, err := middleware.NewCompressionMiddleware(middleware.CompressionConfig{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	fastest, err := middleware.NewGzipEncoder(gzip.BestSpeed)
+	if err != nil {
+		b.Fatal(err)
+	}
+	fast, err := middleware.NewCompressionMiddleware(middleware.CompressionConfig{Encoders: []middleware.Encoder{fastest}})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		handler        http.Handler
+		acceptEncoding string
+	}{
+		"Uncompressed":  {handler: h},
+		"NotAccepted":   {handler: m.ServeNext(h)},
+		"Gzip":          {handler: m.ServeNext(h), acceptEncoding: "gzip"},
+		"GzipBestSpeed": {handler: fast.ServeNext(h), acceptEncoding: "gzip"},
+	}
+	for name, c := range cases {
+		b.Run(name, func(b *testing.B) {
+			r := httptest.NewRequest(http.MethodGet, "/api/todos", nil)
+			if c.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", c.acceptEncoding)
+			}
+			var size int
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w := httptest.NewRecorder()
+				c.handler.ServeHTTP(w, r)
+				size = w.Body.Len()
+			}
+			b.ReportMetric(float64(size), "resp_bytes/op")
+		})
+	}
+}
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(zw, s); err != nil {
+		t.Fatalf("gzipの圧縮に失敗しました: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzipの圧縮に失敗しました: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// decode は、 encoding で圧縮された b を展開する。
+func decode(t *testing.T, encoding string, b []byte) []byte {
+	t.Helper()
+	var r io.Reader
+	switch encoding {
+	case "":
+		return b
+	case "gzip":
+		return gunzip(t, b)
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(b))
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("zstdの展開に失敗しました: %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		t.Fatalf("未対応の圧縮方式です: %s", encoding)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("%sの展開に失敗しました: %v", encoding, err)
+	}
+	return out
+}
+
+// decodePartial は、 encoding で圧縮された終端のない b から n バイトを展開する。
+func decodePartial(t *testing.T, encoding string, b []byte, n int) []byte {
+	t.Helper()
+	var r io.Reader
+	switch encoding {
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("gzipの展開に失敗しました: %v", err)
+		}
+		r = zr
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(b))
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("zstdの展開に失敗しました: %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	out := make([]byte, n)
+	if _, err := io.ReadFull(r, out); err != nil {
+		t.Fatalf("%sの展開に失敗しました: %v", encoding, err)
+	}
+	return out
+}
+
+func gunzip(t *testing.T, b []byte) []byte {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("gzipの展開に失敗しました: %v", err)
+	}
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("gzipの展開に失敗しました: %v", err)
+	}
+	return out
+}
@@ -0,0 +1,280 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// CORSAllowAll は、全てのオリジンを許可する [CORSConfig.AllowedOrigins] の値である。
+const CORSAllowAll = "*"
+
+// CORSConfig は、 [NewCORSMiddleware] に与える設定を表す。
+type CORSConfig struct {
+	// AllowedOrigins は、許可するオリジンである。空の場合、CORSのヘッダを付与せずに後続のハンドラに委譲する。
+	//
+	// 完全一致(e.g. https://example.com)、サブドメインのワイルドカード(e.g. https://*.example.com)、
+	// または全てのオリジンを許可する [CORSAllowAll] を指定できる。ワイルドカードは、 https://example.com 自体には一致しない。
+	AllowedOrigins []string
+	// AllowedMethods は、プリフライトで許可するHTTPメソッドである。GET, HEAD 及び POST は常に許可される。
+	AllowedMethods []string
+	// AllowedHeaders は、プリフライトで許可するリクエストヘッダである。 * の場合は全てのヘッダを許可する。
+	AllowedHeaders []string
+	// AllowCredentials は、Cookie及びAuthorizationヘッダ等の資格情報を含むリクエストを許可するかである。
+	// [CORSAllowAll] とは併用できない。
+	AllowCredentials bool
+	// MaxAge は、ブラウザがプリフライトの結果をキャッシュする時間である。0の場合はヘッダを付与しない。
+	MaxAge time.Duration
+}
+
+type corsPolicy struct {
+	allowAll         bool
+	origins          map[string]bool
+	wildcards        []corsWildcard
+	methods          map[string]bool
+	allowedMethods   string
+	headers          map[string]bool
+	allowAnyHeader   bool
+	allowedHeaders   string
+	allowCredentials bool
+	maxAge           string
+}
+
+// corsWildcard は、 scheme://*.example.com[:port] を prefix(scheme://) と suffix(.example.com[:port]) で表す。
+type corsWildcard struct {
+	prefix string
+	suffix string
+}
+
+type corsMiddleware struct {
+	policy atomic.Pointer[corsPolicy]
+}
+
+// NewCORSMiddleware は、ブラウザからの異なるオリジンのリクエストを cfg に従って許可するミドルウェアを返す。
+func NewCORSMiddleware(cfg CORSConfig) (*corsMiddleware, error) {
+	m := &corsMiddleware{}
+	if err := m.Reload(cfg); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload は、CORSの設定を cfg に差し替える。 cfg が不正な場合はエラーを返し、元の設定を維持する。
+func (m *corsMiddleware) Reload(cfg CORSConfig) error {
+	p, err := newCORSPolicy(cfg)
+	if err != nil {
+		return err
+	}
+	m.policy.Store(p)
+	return nil
+}
+
+func newCORSPolicy(cfg CORSConfig) (*corsPolicy, error) {
+	p := &corsPolicy{
+		origins:          make(map[string]bool),
+		methods:          map[string]bool{http.MethodGet: true, http.MethodHead: true, http.MethodPost: true},
+		headers:          make(map[string]bool),
+		allowCredentials: cfg.AllowCredentials,
+	}
+
+	var errs []error
+	for _, o := range cfg.AllowedOrigins {
+		if o == CORSAllowAll {
+			p.allowAll = true
+			continue
+		}
+		w, err := parseCORSOrigin(o)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if w != nil {
+			p.wildcards = append(p.wildcards, *w)
+		} else {
+			p.origins[strings.ToLower(o)] = true
+		}
+	}
+	if p.allowAll && cfg.AllowCredentials {
+		errs = append(errs, errors.New("資格情報を許可する場合、全てのオリジン(*)は許可できません"))
+	}
+
+	methods := make([]string, 0, len(cfg.AllowedMethods))
+	for _, method := range cfg.AllowedMethods {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if method == "" {
+			continue
+		}
+		p.methods[method] = true
+		methods = append(methods, method)
+	}
+	p.allowedMethods = strings.Join(methods, ", ")
+
+	headers := make([]string, 0, len(cfg.AllowedHeaders))
+	for _, header := range cfg.AllowedHeaders {
+		header = strings.TrimSpace(header)
+		if header == "*" {
+			p.allowAnyHeader = true
+			continue
+		}
+		if header == "" {
+			continue
+		}
+		p.headers[strings.ToLower(header)] = true
+		headers = append(headers, http.CanonicalHeaderKey(header))
+	}
+	p.allowedHeaders = strings.Join(headers, ", ")
+
+	if cfg.MaxAge < 0 {
+		errs = append(errs, fmt.Errorf("プリフライトのキャッシュ時間には0以上の時間を指定する必要があります: %s", cfg.MaxAge))
+	} else if cfg.MaxAge > 0 {
+		p.maxAge = strconv.FormatInt(int64(cfg.MaxAge/time.Second), 10)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// parseCORSOrigin は、 o を検証し、サブドメインのワイルドカードの場合はそれを返す。
+func parseCORSOrigin(o string) (*corsWildcard, error) {
+	invalid := fmt.Errorf("オリジンには scheme://host[:port] の形式を指定する必要があります: %s", o)
+
+	scheme, host, ok := strings.Cut(strings.ToLower(o), "://")
+	if !ok {
+		return nil, invalid
+	}
+	wildcard := strings.HasPrefix(host, "*.")
+	if wildcard {
+		host = "x" + host[1:]
+	}
+	u, err := url.Parse(scheme + "://" + host)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host != host || u.Hostname() == "" || strings.Contains(host, "*") {
+		return nil, invalid
+	}
+	if !wildcard {
+		return nil, nil
+	}
+	return &corsWildcard{
+		prefix: scheme + "://",
+		suffix: host[1:],
+	}, nil
+}
+
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if p.allowAll {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if !strings.HasPrefix(origin, w.prefix) || !strings.HasSuffix(origin, w.suffix) {
+			continue
+		}
+		sub := origin[len(w.prefix) : len(origin)-len(w.suffix)]
+		if sub != "" && !strings.ContainsAny(sub, ":/@") && !strings.HasPrefix(sub, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowOrigin は、 origin が AllowedOrigins に含まれるかを返す。
+//
+// CORSの対象外のリクエスト(e.g. WebSocketのハンドシェイク)でOriginを検証するために使用する。
+// ブラウザはそれらのリクエストに常に資格情報を含めるため、 [CORSAllowAll] の場合も個別に指定したオリジン以外は許可しない。
+func (m *corsMiddleware) AllowOrigin(origin string) bool {
+	p := m.policy.Load()
+	if !p.allowAll {
+		return p.allowOrigin(origin)
+	}
+	allowAll := *p
+	allowAll.allowAll = false
+	return allowAll.allowOrigin(origin)
+}
+
+// allowHeaders は、 requested(Access-Control-Request-Headers) が全て許可されているかを返す。
+func (p *corsPolicy) allowHeaders(requested string) bool {
+	if p.allowAnyHeader {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if header != "" && !p.headers[header] {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *corsPolicy) setAllowOrigin(hdr http.Header, origin string) {
+	// NOTE: 資格情報を許可する場合、ブラウザは * を受け付けないため、リクエストのオリジンを返す。
+	if p.allowAll && !p.allowCredentials {
+		hdr.Set("Access-Control-Allow-Origin", CORSAllowAll)
+	} else {
+		hdr.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.allowCredentials {
+		hdr.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// ServeNext は、許可したオリジンからのリクエストにCORSのヘッダを付与する。
+//
+// プリフライトリクエスト(Access-Control-Request-Method を含む OPTIONS)には、後続のハンドラに委譲せずにstatus 204を返す。
+// ブラウザはプリフライトに資格情報を含めないため、認証を行うミドルウェアより先に評価する必要がある。
+// 許可しないオリジン、メソッド及びヘッダの場合もstatus 204を返すが、CORSのヘッダを付与しない事でブラウザに拒否させる。
+func (m *corsMiddleware) ServeNext(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		p := m.policy.Load()
+		if len(p.origins) == 0 && len(p.wildcards) == 0 && !p.allowAll {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		hdr := w.Header()
+		// NOTE: 共有キャッシュが他のオリジンへの応答を再利用しないよう、Originヘッダの有無に関わらず付与する。
+		hdr.Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		reqMethod := r.Header.Get("Access-Control-Request-Method")
+		if r.Method != http.MethodOptions || reqMethod == "" {
+			if p.allowOrigin(origin) {
+				p.setAllowOrigin(hdr, origin)
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		hdr.Add("Vary", "Access-Control-Request-Method")
+		hdr.Add("Vary", "Access-Control-Request-Headers")
+		reqHeaders := r.Header.Get("Access-Control-Request-Headers")
+		if p.allowOrigin(origin) && p.methods[strings.ToUpper(reqMethod)] && p.allowHeaders(reqHeaders) {
+			p.setAllowOrigin(hdr, origin)
+			if p.allowedMethods != "" {
+				hdr.Set("Access-Control-Allow-Methods", p.allowedMethods)
+			}
+			if p.allowAnyHeader && reqHeaders != "" {
+				hdr.Set("Access-Control-Allow-Headers", reqHeaders)
+			} else if p.allowedHeaders != "" {
+				hdr.Set("Access-Control-Allow-Headers", p.allowedHeaders)
+			}
+			if p.maxAge != "" {
+				hdr.Set("Access-Control-Max-Age", p.maxAge)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return http.HandlerFunc(fn)
+}
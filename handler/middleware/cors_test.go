@@ -0,0 +1,311 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/handler/middleware"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCORS(t *testing.T) {
+	t.Parallel()
+
+	cfg := middleware.CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
+		AllowedHeaders:   []string{"Authorization", "content-type"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+
+	cases := map[string]struct {
+		cfg        *middleware.CORSConfig
+		method     string
+		header     map[string]string
+		wantStatus int
+		wantHeader map[string]string
+		wantVary   []string
+		wantNext   bool
+	}{
+		"Same origin": {
+			method:     http.MethodGet,
+			wantStatus: http.StatusOK,
+			wantVary:   []string{"Origin"},
+			wantNext:   true,
+		},
+		"Allowed origin": {
+			method:     http.MethodGet,
+			header:     map[string]string{"Origin": "https://app.example.com"},
+			wantStatus: http.StatusOK,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+			},
+			wantVary: []string{"Origin"},
+			wantNext: true,
+		},
+		"Disallowed origin": {
+			method:     http.MethodGet,
+			header:     map[string]string{"Origin": "https://evil.example.com"},
+			wantStatus: http.StatusOK,
+			wantVary:   []string{"Origin"},
+			wantNext:   true,
+		},
+		"Wildcard subdomain": {
+			method:     http.MethodGet,
+			header:     map[string]string{"Origin": "https://a.b.example.org"},
+			wantStatus: http.StatusOK,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "https://a.b.example.org",
+				"Access-Control-Allow-Credentials": "true",
+			},
+			wantVary: []string{"Origin"},
+			wantNext: true,
+		},
+		"Wildcard does not match apex": {
+			method:     http.MethodGet,
+			header:     map[string]string{"Origin": "https://example.org"},
+			wantStatus: http.StatusOK,
+			wantVary:   []string{"Origin"},
+			wantNext:   true,
+		},
+		"Wildcard does not match other scheme": {
+			method:     http.MethodGet,
+			header:     map[string]string{"Origin": "http://app.example.org"},
+			wantStatus: http.StatusOK,
+			wantVary:   []string{"Origin"},
+			wantNext:   true,
+		},
+		"Preflight": {
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "PUT",
+				"Access-Control-Request-Headers": "authorization, content-type",
+			},
+			wantStatus: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Allow-Methods":     "GET, POST, PUT, DELETE",
+				"Access-Control-Allow-Headers":     "Authorization, Content-Type",
+				"Access-Control-Max-Age":           "600",
+			},
+			wantVary: []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		"Preflight with disallowed method": {
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "PATCH",
+			},
+			wantStatus: http.StatusNoContent,
+			wantVary:   []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		"Preflight with disallowed header": {
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                         "https://app.example.com",
+				"Access-Control-Request-Method":  "GET",
+				"Access-Control-Request-Headers": "x-custom",
+			},
+			wantStatus: http.StatusNoContent,
+			wantVary:   []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		"Preflight from disallowed origin": {
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                        "https://evil.example.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			wantStatus: http.StatusNoContent,
+			wantVary:   []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		"OPTIONS without preflight": {
+			method:     http.MethodOptions,
+			header:     map[string]string{"Origin": "https://app.example.com"},
+			wantStatus: http.StatusOK,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+			},
+			wantVary: []string{"Origin"},
+			wantNext: true,
+		},
+		"Allow all origins": {
+			cfg: &middleware.CORSConfig{
+				AllowedOrigins: []string{middleware.CORSAllowAll},
+				AllowedHeaders: []string{"*"},
+			},
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                         "https://any.example.net",
+				"Access-Control-Request-Method":  "POST",
+				"Access-Control-Request-Headers": "x-custom",
+			},
+			wantStatus: http.StatusNoContent,
+			wantHeader: map[string]string{
+				"Access-Control-Allow-Origin":  "*",
+				"Access-Control-Allow-Headers": "x-custom",
+			},
+			wantVary: []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+		},
+		"Disabled": {
+			cfg:    &middleware.CORSConfig{},
+			method: http.MethodOptions,
+			header: map[string]string{
+				"Origin":                        "https://app.example.com",
+				"Access-Control-Request-Method": "GET",
+			},
+			wantStatus: http.StatusOK,
+			wantNext:   true,
+		},
+	}
+
+	corsHeaders := []string{
+		"Access-Control-Allow-Origin",
+		"Access-Control-Allow-Credentials",
+		"Access-Control-Allow-Methods",
+		"Access-Control-Allow-Headers",
+		"Access-Control-Max-Age",
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cc := cfg
+			if c.cfg != nil {
+				cc = *c.cfg
+			}
+			m, err := middleware.NewCORSMiddleware(cc)
+			if err != nil {
+				t.Fatalf("ミドルウェアの作成に失敗しました: %v", err)
+			}
+			var next bool
+			h := m.ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next = true
+			}))
+
+			r := httptest.NewRequest(c.method, "/api/todos", nil)
+			for k, v := range c.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != c.wantStatus {
+				t.Errorf("期待していない HTTP status code です, got = %d, want = %d", w.Code, c.wantStatus)
+			}
+			if next != c.wantNext {
+				t.Errorf("後続のハンドラの呼び出しが期待と異なります, got = %t, want = %t", next, c.wantNext)
+			}
+			got := make(map[string]string)
+			for _, k := range corsHeaders {
+				if v := w.Header().Get(k); v != "" {
+					got[k] = v
+				}
+			}
+			want := c.wantHeader
+			if want == nil {
+				want = map[string]string{}
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("期待していないヘッダです (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(c.wantVary, w.Header().Values("Vary")); diff != "" {
+				t.Errorf("期待していない Vary ヘッダです (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCORSConfigError(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]middleware.CORSConfig{
+		"Path":                      {AllowedOrigins: []string{"https://example.com/"}},
+		"Without scheme":            {AllowedOrigins: []string{"example.com"}},
+		"Unsupported scheme":        {AllowedOrigins: []string{"ftp://example.com"}},
+		"Wildcard in the middle":    {AllowedOrigins: []string{"https://app.*.example.com"}},
+		"Allow all with credential": {AllowedOrigins: []string{middleware.CORSAllowAll}, AllowCredentials: true},
+		"Negative max age":          {AllowedOrigins: []string{"https://example.com"}, MaxAge: -time.Second},
+	}
+
+	for name, cfg := range cases {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := middleware.NewCORSMiddleware(cfg); err == nil {
+				t.Error("不正な設定でエラーが返されませんでした")
+			}
+		})
+	}
+}
+
+func TestCORSReload(t *testing.T) {
+	t.Parallel()
+
+	m, err := middleware.NewCORSMiddleware(middleware.CORSConfig{AllowedOrigins: []string{"https://a.example.com"}})
+	if err != nil {
+		t.Fatalf("ミドルウェアの作成に失敗しました: %v", err)
+	}
+	h := m.ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	allowed := func(origin string) bool {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Header().Get("Access-Control-Allow-Origin") == origin
+	}
+
+	if err := m.Reload(middleware.CORSConfig{AllowedOrigins: []string{"https://b.example.com"}}); err != nil {
+		t.Fatalf("設定の再読み込みに失敗しました: %v", err)
+	}
+	if allowed("https://a.example.com") || !allowed("https://b.example.com") {
+		t.Error("再読み込みした設定が適用されていません")
+	}
+
+	if err := m.Reload(middleware.CORSConfig{AllowedOrigins: []string{"invalid"}}); err == nil {
+		t.Error("不正な設定でエラーが返されませんでした")
+	}
+	if !allowed("https://b.example.com") {
+		t.Error("不正な設定で元の設定が維持されていません")
+	}
+}
+
+func TestCORSAllowOrigin(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		origins []string
+		origin  string
+		want    bool
+	}{
+		"Exact":                   {origins: []string{"https://app.example.com"}, origin: "https://app.example.com", want: true},
+		"Wildcard":                {origins: []string{"https://*.example.org"}, origin: "https://a.example.org", want: true},
+		"Not allowed":             {origins: []string{"https://app.example.com"}, origin: "https://evil.example.com"},
+		"Allow all":               {origins: []string{middleware.CORSAllowAll}, origin: "https://evil.example.com"},
+		"Allow all with explicit": {origins: []string{middleware.CORSAllowAll, "https://app.example.com"}, origin: "https://app.example.com", want: true},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			m, err := middleware.NewCORSMiddleware(middleware.CORSConfig{AllowedOrigins: c.origins})
+			if err != nil {
+				t.Fatalf("ミドルウェアの作成に失敗しました: %v", err)
+			}
+			if got := m.AllowOrigin(c.origin); got != c.want {
+				t.Errorf("期待していない結果です, got = %v, want = %v", got, c.want)
+			}
+		})
+	}
+}
@@ -1,11 +1,15 @@
 package middleware
 
-import "io"
+import (
+	"io"
+	"log/slog"
+
+	"github.com/TechBowl-japan/go-stations/pkg/logging"
+)
 
 type AccessLog = accessLog
 
 func NewAccessLogMiddlewareWithWriter(w io.Writer) *accessLogMiddleware {
-	return &accessLogMiddleware{
-		w: w,
-	}
+	logger, _ := logging.New(w, logging.FormatJSON, slog.LevelInfo)
+	return NewAccessLogMiddlewareWithLogger(logger)
 }
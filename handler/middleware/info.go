@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+type requestInfoContextKey struct{}
+
+// requestInfo は、内側のミドルウェアから外側のミドルウェアへリクエストの処理結果を伝えるための構造体である。
+//
+// [context.Context] は内側から外側へ値を伝搬できないため、外側のミドルウェアが保存したポインタを共有する。
+// 外側のミドルウェアが存在しない場合、内側のミドルウェアによる記録は無視される。
+type requestInfo struct {
+	mu         sync.Mutex
+	user       string
+	authFailed bool
+	timedOut   bool
+	// panicID は、リカバリしたpanicのIDである。panicが発生していない場合は空文字とする。
+	panicID string
+	// aborted は、レスポンスの送信後にpanicが発生し、コネクションを切断する必要があるかである。
+	aborted bool
+}
+
+// withRequestInfo は、 [requestInfo] を保存したリクエストを返す。既に保存されている場合は、それを共有する。
+func withRequestInfo(r *http.Request) (*http.Request, *requestInfo) {
+	if info := requestInfoFrom(r.Context()); info != nil {
+		return r, info
+	}
+	info := &requestInfo{}
+	return r.WithContext(context.WithValue(r.Context(), requestInfoContextKey{}, info)), info
+}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoContextKey{}).(*requestInfo)
+	return info
+}
+
+func (i *requestInfo) update(fn func(i *requestInfo)) {
+	if i == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	fn(i)
+}
+
+// snapshot は、記録された値のコピーを返す。
+func (i *requestInfo) snapshot() requestInfo {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return requestInfo{
+		user:       i.user,
+		authFailed: i.authFailed,
+		timedOut:   i.timedOut,
+		panicID:    i.panicID,
+		aborted:    i.aborted,
+	}
+}
+
+// setUser は、認証済みのユーザIDを記録する。
+func setUser(ctx context.Context, user string) {
+	requestInfoFrom(ctx).update(func(i *requestInfo) { i.user = user })
+}
+
+// setPanicked は、panicからリカバリした事をpanicのIDと共に記録する。
+func setPanicked(ctx context.Context, id string) {
+	requestInfoFrom(ctx).update(func(i *requestInfo) { i.panicID = id })
+}
+
+// setAborted は、コネクションを切断する必要がある事を記録する。
+func setAborted(ctx context.Context) {
+	requestInfoFrom(ctx).update(func(i *requestInfo) { i.aborted = true })
+}
+
+// setAuthFailed は、認証に失敗した事を記録する。
+func setAuthFailed(ctx context.Context) {
+	requestInfoFrom(ctx).update(func(i *requestInfo) { i.authFailed = true })
+}
+
+// setTimedOut は、処理時間の上限を超えた事を記録する。
+func setTimedOut(ctx context.Context) {
+	requestInfoFrom(ctx).update(func(i *requestInfo) { i.timedOut = true })
+}
@@ -1,74 +1,378 @@
 package middleware
 
 import (
-	"encoding/json"
+	"bufio"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/TechBowl-japan/go-stations/pkg/logging"
+	"github.com/TechBowl-japan/go-stations/pkg/realip"
+	"github.com/TechBowl-japan/go-stations/pkg/requestid"
+	"github.com/TechBowl-japan/go-stations/pkg/tracing"
+)
+
+const (
+	// AccessLogFormatJSON は、アクセスログをJSON形式のログレコードとして出力する事を表す。
+	AccessLogFormatJSON = logging.FormatJSON
+	// AccessLogFormatText は、アクセスログを key=value 形式のログレコードとして出力する事を表す。
+	AccessLogFormatText = logging.FormatText
+	// AccessLogFormatCombined は、アクセスログを Combined Log Format で出力する事を表す。
+	//
+	// Ref: https://httpd.apache.org/docs/2.4/logs.html#combined
+	AccessLogFormatCombined = "combined"
 )
 
+const redactedQueryValue = "REDACTED"
+
 // accessLog は、日時、処理時間等のアクセスログを表す構造体である。
+//
+// JSON形式で出力した際のフィールド名は、 json タグの値となる。
 type accessLog struct {
-	Timestamp time.Time
-	Latency   int64
-	Path      string
-	OS        string
-	Status    int
+	Timestamp time.Time `json:"timestamp"`
+	// Latency は、処理時間(マイクロ秒)である。
+	Latency        int64  `json:"latency_us"`
+	Method         string `json:"method"`
+	Path           string `json:"path"`
+	Query          string `json:"query"`
+	Proto          string `json:"proto"`
+	Status         int    `json:"status"`
+	RequestBytes   int64  `json:"request_bytes"`
+	ResponseBytes  int64  `json:"response_bytes"`
+	RemoteIP       string `json:"remote_ip"`
+	User           string `json:"user"`
+	Referer        string `json:"referer"`
+	UserAgent      string `json:"user_agent"`
+	OS             string `json:"os"`
+	Browser        string `json:"browser"`
+	BrowserVersion string `json:"browser_version"`
+	RequestID      string `json:"request_id"`
+	TraceID        string `json:"trace_id,omitempty"`
+	SpanID         string `json:"span_id,omitempty"`
+	// TimedOut は、処理時間の上限を超えたかである。上限を超えた場合のみ出力する。
+	TimedOut bool `json:"timed_out,omitempty"`
+	// PanicID は、リカバリしたpanicのIDである。panicが発生した場合のみ出力する。
+	PanicID string `json:"panic_id,omitempty"`
+}
+
+// attrs は、アクセスログを [log/slog.Attr] に変換する。
+//
+// request_id, trace_id 及び span_id は、 [logging.New] が返す Logger によって付与される。
+func (al *accessLog) attrs() []slog.Attr {
+	attrs := []slog.Attr{
+		slog.Time("timestamp", al.Timestamp),
+		slog.Int64("latency_us", al.Latency),
+		slog.String("method", al.Method),
+		slog.String("path", al.Path),
+		slog.String("query", al.Query),
+		slog.String("proto", al.Proto),
+		slog.Int("status", al.Status),
+		slog.Int64("request_bytes", al.RequestBytes),
+		slog.Int64("response_bytes", al.ResponseBytes),
+		slog.String("remote_ip", al.RemoteIP),
+		slog.String("user", al.User),
+		slog.String("referer", al.Referer),
+		slog.String("user_agent", al.UserAgent),
+		slog.String("os", al.OS),
+		slog.String("browser", al.Browser),
+		slog.String("browser_version", al.BrowserVersion),
+	}
+	if al.TimedOut {
+		attrs = append(attrs, slog.Bool("timed_out", true))
+	}
+	if al.PanicID != "" {
+		attrs = append(attrs, slog.String("panic_id", al.PanicID))
+	}
+	return attrs
+}
+
+// combined は、アクセスログを Combined Log Format の1行に変換する。
+func (al *accessLog) combined() string {
+	target := al.Path
+	if al.Query != "" {
+		target += "?" + al.Query
+	}
+	bytes := "-"
+	if al.ResponseBytes > 0 {
+		bytes = strconv.FormatInt(al.ResponseBytes, 10)
+	}
+	return fmt.Sprintf("%s - %s [%s] %s %d %s %s %s\n",
+		orHyphen(al.RemoteIP),
+		orHyphen(al.User),
+		al.Timestamp.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(al.Method+" "+target+" "+al.Proto),
+		al.Status,
+		bytes,
+		quoteOrHyphen(al.Referer),
+		quoteOrHyphen(al.UserAgent),
+	)
+}
+
+func orHyphen(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(s, " ", "_")
+}
+
+func quoteOrHyphen(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	return strconv.Quote(s)
+}
+
+// AccessLogConfig は、 [NewAccessLogMiddlewareWithConfig] に与える設定を表す。
+type AccessLogConfig struct {
+	// Output は、アクセスログの書き込み先である。nil の場合は標準出力とする。
+	Output io.Writer
+	// Format は、アクセスログの出力形式である。空文字の場合は [AccessLogFormatJSON] とする。
+	Format string
+	// RedactQueryParams は、値を秘匿するクエリパラメータ名である。大文字小文字は区別しない。
+	RedactQueryParams []string
+	// TrustedProxies は、クライアントのIPアドレスの解決に X-Forwarded-For/X-Real-IP ヘッダを信頼するプロキシである。
+	TrustedProxies []string
 }
 
 type accessLogMiddleware struct {
-	w io.Writer
+	logger   *slog.Logger
+	resolver *realip.Resolver
+	redact   map[string]struct{}
+
+	// NOTE: Combined Log Format の場合のみ使用する。
+	mu       sync.Mutex
+	combined io.Writer
 }
 
 // NewAccessLogMiddleware は、 書き込み先として標準出力を指定したミドルウェアを返す。
+//
+// アクセスログはJSON形式で出力される。
 func NewAccessLogMiddleware() *accessLogMiddleware {
+	logger, _ := logging.New(os.Stdout, logging.FormatJSON, slog.LevelInfo)
+	return NewAccessLogMiddlewareWithLogger(logger)
+}
+
+// NewAccessLogMiddlewareWithLogger は、 書き込み先として logger を指定したミドルウェアを返す。
+//
+// アクセスログはInfoレベルで出力される。
+func NewAccessLogMiddlewareWithLogger(logger *slog.Logger) *accessLogMiddleware {
+	resolver, _ := realip.NewResolver(nil)
 	return &accessLogMiddleware{
-		w: os.Stdout,
+		logger:   logger,
+		resolver: resolver,
+		redact:   map[string]struct{}{},
 	}
 }
 
+// NewAccessLogMiddlewareWithConfig は、 出力形式等を指定したミドルウェアを返す。
+func NewAccessLogMiddlewareWithConfig(cfg AccessLogConfig) (*accessLogMiddleware, error) {
+	out := cfg.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	format := cfg.Format
+	if format == "" {
+		format = AccessLogFormatJSON
+	}
+
+	m := &accessLogMiddleware{
+		redact: make(map[string]struct{}, len(cfg.RedactQueryParams)),
+	}
+	for _, p := range cfg.RedactQueryParams {
+		m.redact[strings.ToLower(p)] = struct{}{}
+	}
+
+	var err error
+	m.resolver, err = realip.NewResolver(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == AccessLogFormatCombined {
+		m.combined = out
+		// NOTE: 出力されない事を除き、Combined Log Format でも Logger の用途(Debugログ)は変わらない。
+		m.logger = logging.Discard()
+		return m, nil
+	}
+	m.logger, err = logging.New(out, format, slog.LevelInfo)
+	if err != nil {
+		return nil, fmt.Errorf("アクセスログの出力形式には %s/%s/%s のいずれかを指定する必要があります: %s",
+			AccessLogFormatJSON, AccessLogFormatText, AccessLogFormatCombined, format)
+	}
+	return m, nil
+}
+
 // statusResponseWriter は、HTTPステータスをログに記録するために、デフォルトの [net/http.ResponseWriter] を拡張した構造体である
 //
+// [net/http.Flusher] 及び [net/http.Hijacker] は、元の [net/http.ResponseWriter] が実装している場合に限り機能する。
+//
 // Ref: https://tutuz-tech.hatenablog.com/entry/2020/06/14/191416
 type statusResponseWriter struct {
 	http.ResponseWriter
-	status int
+	status      int
+	bytes       int64
+	wroteHeader bool
 }
 
 func (w *statusResponseWriter) WriteHeader(status int) {
-	w.status = status
+	// NOTE: 2回目以降の呼び出しは [net/http] により無視されるため、最初のstatusのみを記録する。
+	// 1xx は最終的なレスポンスではないため、記録しない。
+	if !w.wroteHeader && (status < 100 || status > 199 || status == http.StatusSwitchingProtocols) {
+		w.status = status
+		w.wroteHeader = true
+	}
 	w.ResponseWriter.WriteHeader(status)
 }
 
+func (w *statusResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush は、 [net/http.Flusher] を実装する。
+func (w *statusResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.wroteHeader = true
+		f.Flush()
+	}
+}
+
+// Hijack は、 [net/http.Hijacker] を実装する。
+func (w *statusResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("statusResponseWriter: underlying ResponseWriter does not implement http.Hijacker")
+	}
+	// NOTE: 乗っ取った後のコネクションにはレスポンスを書き込めない。
+	// コネクションの乗っ取りはプロトコルの切り替え(e.g. WebSocket)に使用するため、status 101として記録する。
+	if !w.wroteHeader {
+		w.status = http.StatusSwitchingProtocols
+	}
+	w.wroteHeader = true
+	return h.Hijack()
+}
+
+// Unwrap は、 [net/http.ResponseController] が元の [net/http.ResponseWriter] を参照するために使用する。
+func (w *statusResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// countingReadCloser は、リクエストボディのサイズを記録するために [io.ReadCloser] を拡張した構造体である。
+type countingReadCloser struct {
+	io.ReadCloser
+	bytes int64
+}
+
+func (r *countingReadCloser) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
 // ServeNext は、 h の前後で取得した情報を元に、 アクセスログを記録する。
+//
+// Debugレベルが有効な場合、リクエストヘッダも記録する。
 func (m *accessLogMiddleware) ServeNext(h http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		sw := &statusResponseWriter{
 			ResponseWriter: w,
 			status:         http.StatusOK,
 		}
+		var body *countingReadCloser
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &countingReadCloser{ReadCloser: r.Body}
+			r.Body = body
+		}
+		r, info := withRequestInfo(r)
+
 		now := time.Now()
 		h.ServeHTTP(sw, r)
+		latency := time.Since(now)
 
-		// NOTE: OS情報がContextに記録されている事を前提とする。
+		// NOTE:
+		// OS情報がContextに記録されている事を前提とする。
+		// 記録されていない場合もアクセスログ自体は出力されるため、ログレベルはDebugとする。
 		os, ok := r.Context().Value(UAContextKeyOS).(string)
 		if !ok {
-			log.Printf("AccessLogMiddleware: os can not be fetched\n")
+			m.logger.DebugContext(r.Context(), "os can not be fetched")
 		}
+		browser, _ := r.Context().Value(UAContextKeyBrowser).(string)
+		browserVersion, _ := r.Context().Value(UAContextKeyBrowserVersion).(string)
+
+		recorded := info.snapshot()
 
 		al := accessLog{
-			Timestamp: now,
-			Latency:   time.Since(now).Milliseconds(),
-			Path:      r.URL.Path,
-			OS:        os,
-			Status:    sw.status,
+			Timestamp:      now,
+			Latency:        latency.Microseconds(),
+			Method:         r.Method,
+			Path:           r.URL.Path,
+			Query:          m.redactQuery(r.URL.RawQuery),
+			Proto:          r.Proto,
+			Status:         sw.status,
+			ResponseBytes:  sw.bytes,
+			RemoteIP:       m.resolver.ClientIP(r),
+			User:           recorded.user,
+			Referer:        r.Referer(),
+			UserAgent:      r.UserAgent(),
+			OS:             os,
+			Browser:        browser,
+			BrowserVersion: browserVersion,
+			RequestID:      requestid.FromContext(r.Context()),
+			TimedOut:       recorded.timedOut,
+			PanicID:        recorded.panicID,
+		}
+		if sc := tracing.SpanContextFromContext(r.Context()); sc.IsValid() {
+			al.TraceID = sc.TraceID.String()
+			al.SpanID = sc.SpanID.String()
 		}
-		if err := json.NewEncoder(m.w).Encode(al); err != nil {
-			log.Printf("AccessLogMiddleware: could not write access log, err =%v\n", err)
+		if body != nil {
+			al.RequestBytes = body.bytes
+		}
+
+		if m.combined != nil {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			// NOTE: 書き込み先の障害でリクエストの処理を失敗させないため、エラーは無視する。
+			_, _ = io.WriteString(m.combined, al.combined())
 			return
 		}
+
+		attrs := al.attrs()
+		if m.logger.Enabled(r.Context(), slog.LevelDebug) {
+			attrs = append(attrs, slog.Any("headers", logging.Headers(r.Header)))
+		}
+		m.logger.LogAttrs(r.Context(), slog.LevelInfo, "access", attrs...)
 	}
 	return http.HandlerFunc(fn)
 }
+
+// redactQuery は、秘匿対象のクエリパラメータの値を置き換える。
+//
+// クエリパラメータの順序を保つため、 [net/url.Values] は使用しない。
+func (m *accessLogMiddleware) redactQuery(raw string) string {
+	if raw == "" || len(m.redact) == 0 {
+		return raw
+	}
+	params := strings.Split(raw, "&")
+	for i, p := range params {
+		k, _, hasValue := strings.Cut(p, "=")
+		key, err := url.QueryUnescape(k)
+		if err != nil {
+			key = k
+		}
+		if _, ok := m.redact[strings.ToLower(key)]; ok && hasValue {
+			params[i] = k + "=" + redactedQueryValue
+		}
+	}
+	return strings.Join(params, "&")
+}
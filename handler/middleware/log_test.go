@@ -4,11 +4,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
 
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+
 	"github.com/TechBowl-japan/go-stations/handler/middleware"
+	"github.com/TechBowl-japan/go-stations/pkg/basicauth"
+	"github.com/TechBowl-japan/go-stations/pkg/requestid"
 )
 
 func TestAccessLog(t *testing.T) {
@@ -19,7 +27,9 @@ func TestAccessLog(t *testing.T) {
 	m := middleware.NewAccessLogMiddlewareWithWriter(&buf)
 
 	wantOS := "macOS"
+	wantRequestID := "request-id"
 	ctx := context.WithValue(r.Context(), middleware.UAContextKeyOS, wantOS)
+	ctx = requestid.NewContext(ctx, wantRequestID)
 	r = r.WithContext(ctx)
 	h := m.ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 	}))
@@ -37,6 +47,10 @@ func TestAccessLog(t *testing.T) {
 		t.Errorf("正しいOS情報が記録されていません, got = %v, want = %v", gotOS, wantOS)
 
 	}
+	gotRequestID := al.RequestID
+	if gotRequestID != wantRequestID {
+		t.Errorf("正しいリクエストIDが記録されていません, got = %v, want = %v", gotRequestID, wantRequestID)
+	}
 }
 
 func TestAccessLogWithoutOSInfo(t *testing.T) {
@@ -66,3 +80,141 @@ func TestAccessLogWithoutOSInfo(t *testing.T) {
 
 	}
 }
+
+func TestAccessLogDetails(t *testing.T) {
+	var buf bytes.Buffer
+	m, err := middleware.NewAccessLogMiddlewareWithConfig(middleware.AccessLogConfig{
+		Output:            &buf,
+		RedactQueryParams: []string{"token"},
+	})
+	if err != nil {
+		t.Fatalf("ミドルウェアの作成に失敗しました: %v", err)
+	}
+	bai, err := basicauth.NewBasicAuthInfo("user", "pass")
+	if err != nil {
+		t.Fatalf("認証情報の作成に失敗しました: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodDelete, "/api/todos?size=3&Token=secret", strings.NewReader(`{"ids":[1]}`))
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("Referer", "http://example.com/")
+	r.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 6.1; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/59.0.3071.115 Safari/537.36")
+	r.SetBasicAuth("user", "pass")
+	w := httptest.NewRecorder()
+	h := middleware.With(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte("accepted"))
+		}),
+		middleware.NewBasicAuthMiddleware(*bai),
+		m,
+		middleware.NewUserAgentRecordMiddleware(),
+	)
+	h.ServeHTTP(w, r)
+
+	var al middleware.AccessLog
+	if err := json.NewDecoder(&buf).Decode(&al); err != nil {
+		t.Fatalf("アクセスログの読み込みに失敗しました: %v", err)
+	}
+	want := middleware.AccessLog{
+		Method:         http.MethodDelete,
+		Path:           "/api/todos",
+		Query:          "size=3&Token=REDACTED",
+		Proto:          "HTTP/1.1",
+		Status:         http.StatusAccepted,
+		RequestBytes:   int64(len(`{"ids":[1]}`)),
+		ResponseBytes:  int64(len("accepted")),
+		RemoteIP:       "192.0.2.1",
+		User:           "user",
+		Referer:        "http://example.com/",
+		UserAgent:      r.UserAgent(),
+		OS:             "Windows",
+		Browser:        "Chrome",
+		BrowserVersion: "59.0.3071.115",
+	}
+	if diff := cmp.Diff(want, al, cmpopts.IgnoreFields(middleware.AccessLog{}, "Timestamp", "Latency")); diff != "" {
+		t.Error("期待していないアクセスログです\n", diff)
+	}
+}
+
+func TestAccessLogCombinedFormat(t *testing.T) {
+	var buf bytes.Buffer
+	m, err := middleware.NewAccessLogMiddlewareWithConfig(middleware.AccessLogConfig{
+		Output: &buf,
+		Format: middleware.AccessLogFormatCombined,
+	})
+	if err != nil {
+		t.Fatalf("ミドルウェアの作成に失敗しました: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/todos?size=1", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("User-Agent", "curl/8.0")
+	h := m.ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	re := regexp.MustCompile(`^192\.0\.2\.1 - - \[[^\]]+\] "GET /todos\?size=1 HTTP/1\.1" 200 2 "-" "curl/8\.0"\n$`)
+	if got := buf.String(); !re.MatchString(got) {
+		t.Errorf("期待していないアクセスログです, got = %q", got)
+	}
+}
+
+func TestAccessLogPreservesOptionalInterfaces(t *testing.T) {
+	m := middleware.NewAccessLogMiddlewareWithWriter(io.Discard)
+	h := m.ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("http.Flusher が実装されていません")
+		}
+		if _, ok := w.(http.Hijacker); !ok {
+			t.Error("http.Hijacker が実装されていません")
+		}
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Flushに失敗しました: %v", err)
+		}
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !w.Flushed {
+		t.Error("元の ResponseWriter がFlushされていません")
+	}
+}
+
+func TestAccessLogHijacked(t *testing.T) {
+	var buf bytes.Buffer
+	m := middleware.NewAccessLogMiddlewareWithWriter(&buf)
+	done := make(chan struct{})
+	h := m.ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			t.Errorf("コネクションを乗っ取れません: %v", err)
+			return
+		}
+		defer conn.Close()
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: test\r\n\r\n")
+		brw.Flush()
+	}))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	res, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	<-done
+
+	var al middleware.AccessLog
+	if err := json.NewDecoder(&buf).Decode(&al); err != nil {
+		t.Fatalf("アクセスログの読み込みに失敗しました: %v", err)
+	}
+	if al.Status != http.StatusSwitchingProtocols {
+		t.Errorf("期待していないstatusです, got = %d", al.Status)
+	}
+}
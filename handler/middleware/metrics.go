@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/pkg/metrics"
+)
+
+// knownMethods は、メトリクスのラベルとして記録するHTTPメソッドである。
+//
+// 任意のメソッドを記録すると系列数が際限なく増えるため、それ以外は "OTHER" として記録する。
+var knownMethods = map[string]struct{}{
+	http.MethodGet:     {},
+	http.MethodHead:    {},
+	http.MethodPost:    {},
+	http.MethodPut:     {},
+	http.MethodPatch:   {},
+	http.MethodDelete:  {},
+	http.MethodOptions: {},
+}
+
+type metricsMiddleware struct {
+	route func(r *http.Request) string
+
+	requests     *metrics.CounterVec
+	duration     *metrics.HistogramVec
+	inFlight     *metrics.GaugeVec
+	panics       *metrics.CounterVec
+	authFailures *metrics.CounterVec
+	timeouts     *metrics.CounterVec
+}
+
+// NewMetricsMiddleware は、HTTPリクエストに関するメトリクスを reg に記録するミドルウェアを返す。
+//
+// route は、リクエストに対応するルート(e.g. [net/http.ServeMux] のパターン)を返す関数である。
+// パスをそのままラベルにすると系列数が際限なく増えるため、ルーティングの定義に基づいた値を返す必要がある。
+func NewMetricsMiddleware(reg *metrics.Registry, route func(r *http.Request) string) *metricsMiddleware {
+	m := &metricsMiddleware{
+		route: route,
+		requests: metrics.NewCounterVec(
+			"http_requests_total",
+			"The total number of HTTP requests.",
+			"route", "method", "status",
+		),
+		duration: metrics.NewHistogramVec(
+			"http_request_duration_seconds",
+			"The HTTP request latencies in seconds.",
+			metrics.DefBuckets,
+			"route", "method", "status",
+		),
+		inFlight: metrics.NewGaugeVec(
+			"http_requests_in_flight",
+			"The number of HTTP requests currently being served.",
+		),
+		panics: metrics.NewCounterVec(
+			"http_panics_recovered_total",
+			"The total number of panics recovered while serving HTTP requests.",
+		),
+		authFailures: metrics.NewCounterVec(
+			"http_auth_failures_total",
+			"The total number of HTTP requests rejected by authentication.",
+		),
+		timeouts: metrics.NewCounterVec(
+			"http_request_timeouts_total",
+			"The total number of HTTP requests which exceeded the time budget.",
+			"route", "method",
+		),
+	}
+	// NOTE: 同じ reg で複数回作成してもpanicしないよう、登録済みのメトリクスは共有する。
+	m.requests = registerOrGet(reg, m.requests)
+	m.duration = registerOrGet(reg, m.duration)
+	m.inFlight = registerOrGet(reg, m.inFlight)
+	m.panics = registerOrGet(reg, m.panics)
+	m.authFailures = registerOrGet(reg, m.authFailures)
+	m.timeouts = registerOrGet(reg, m.timeouts)
+
+	// NOTE: 一度も発生していない場合も 0 として出力されるよう、ラベルの無い系列を初期化しておく。
+	m.inFlight.WithLabelValues()
+	m.panics.WithLabelValues()
+	m.authFailures.WithLabelValues()
+	return m
+}
+
+// registerOrGet は、 c を reg に登録して返す。同じ名前のメトリクスが登録済みの場合は、登録済みのものを返す。
+//
+// 同じ名前で型の異なるメトリクスが登録済みの場合はプログラムの誤りであるため、panicする。
+func registerOrGet[T metrics.Collector](reg *metrics.Registry, c T) T {
+	got, ok := reg.RegisterOrGet(c).(T)
+	if !ok {
+		name, _, _ := c.Describe()
+		panic(fmt.Sprintf("middleware: %s is already registered as a different type", name))
+	}
+	return got
+}
+
+// WithRoute は、 m とメトリクスを共有し、 route でルートを判定するミドルウェアを返す。
+//
+// 同じ名前のメトリクスは一度しか登録できないため、複数のHTTPハンドラ(e.g. 公開用と管理用)で記録する場合に使用する。
+func (m *metricsMiddleware) WithRoute(route func(r *http.Request) string) *metricsMiddleware {
+	m2 := *m
+	m2.route = route
+	return &m2
+}
+
+// ServeNext は、 h の処理時間、HTTPステータス等を記録する。
+//
+// panic、認証失敗及びタイムアウトの回数を記録するため、リカバリ、認証及びタイムアウトを行うミドルウェアより先に評価する必要がある。
+func (m *metricsMiddleware) ServeNext(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusResponseWriter{
+			ResponseWriter: w,
+			status:         http.StatusOK,
+		}
+		r, info := withRequestInfo(r)
+
+		inFlight := m.inFlight.WithLabelValues()
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		now := time.Now()
+		h.ServeHTTP(sw, r)
+		latency := time.Since(now)
+
+		method := r.Method
+		if _, ok := knownMethods[method]; !ok {
+			method = "OTHER"
+		}
+		route := m.route(r)
+		labels := []string{route, method, strconv.Itoa(sw.status)}
+		m.requests.WithLabelValues(labels...).Inc()
+		m.duration.WithLabelValues(labels...).Observe(latency.Seconds())
+
+		recorded := info.snapshot()
+		if recorded.panicID != "" {
+			m.panics.WithLabelValues().Inc()
+		}
+		if recorded.authFailed {
+			m.authFailures.WithLabelValues().Inc()
+		}
+		if recorded.timedOut {
+			m.timeouts.WithLabelValues(route, method).Inc()
+		}
+	}
+	return http.HandlerFunc(fn)
+}
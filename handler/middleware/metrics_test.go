@@ -0,0 +1,106 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/handler/middleware"
+	"github.com/TechBowl-japan/go-stations/pkg/basicauth"
+	"github.com/TechBowl-japan/go-stations/pkg/logging"
+	"github.com/TechBowl-japan/go-stations/pkg/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	bai, err := basicauth.NewBasicAuthInfo("user", "pass")
+	if err != nil {
+		t.Fatalf("認証情報の作成に失敗しました: %v", err)
+	}
+
+	reg := metrics.NewRegistry()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("test")
+	})
+	mux.Handle("/auth", middleware.With(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		middleware.NewBasicAuthMiddleware(*bai),
+	))
+	route := func(r *http.Request) string {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			return pattern
+		}
+		return "unmatched"
+	}
+	h := middleware.With(
+		mux,
+		middleware.NewRecoveryMiddlewareWithLogger(logging.Discard()),
+		middleware.NewMetricsMiddleware(reg, route),
+	)
+
+	requests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/ok"},
+		{http.MethodPost, "/ok"},
+		{"PROPFIND", "/ok"},
+		{http.MethodGet, "/panic"},
+		{http.MethodGet, "/auth"},
+		{http.MethodGet, "/unknown/1"},
+	}
+	for _, req := range requests {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+	}
+
+	var b strings.Builder
+	if err := reg.WriteText(&b); err != nil {
+		t.Fatalf("メトリクスの書き込みに失敗しました: %v", err)
+	}
+	got := b.String()
+
+	wants := []string{
+		`http_requests_total{method="POST",route="/ok",status="201"} 2`,
+		`http_requests_total{method="OTHER",route="/ok",status="201"} 1`,
+		`http_requests_total{method="GET",route="/panic",status="500"} 1`,
+		`http_requests_total{method="GET",route="/auth",status="401"} 1`,
+		`http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`http_request_duration_seconds_count{method="POST",route="/ok",status="201"} 2`,
+		`http_requests_in_flight 0`,
+		`http_panics_recovered_total 1`,
+		`http_auth_failures_total 1`,
+	}
+	for _, want := range wants {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("期待しているメトリクスが出力されていません, want = %s\ngot:\n%s", want, got)
+		}
+	}
+}
+
+func TestMetricsWithRoute(t *testing.T) {
+	reg := metrics.NewRegistry()
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	public := middleware.NewMetricsMiddleware(reg, func(r *http.Request) string { return "/public" })
+	// NOTE: メトリクスを共有するため、二重に登録されない。
+	admin := public.WithRoute(func(r *http.Request) string { return "/admin" })
+
+	public.ServeNext(noop).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	admin.ServeNext(noop).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var b strings.Builder
+	if err := reg.WriteText(&b); err != nil {
+		t.Fatalf("メトリクスの出力に失敗しました: %v", err)
+	}
+	for _, want := range []string{
+		`http_requests_total{method="GET",route="/public",status="200"} 1`,
+		`http_requests_total{method="GET",route="/admin",status="200"} 1`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("%s が出力されていません, got = %s", want, b.String())
+		}
+	}
+}
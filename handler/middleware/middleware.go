@@ -14,8 +14,12 @@ type HTTPMiddleware interface {
 // With は、[HTTPMiddleware] を合成する関数である。
 //
 // h 及び hms は、引数で与えられた順とは逆順で評価される。
+// 設定により適用しないミドルウェアを表現できるよう、 nil の hms は無視する。
 func With(h http.Handler, hms ...HTTPMiddleware) http.Handler {
 	for _, hm := range hms {
+		if hm == nil {
+			continue
+		}
 		h = hm.ServeNext(h)
 	}
 	return h
@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/pkg/httperror"
+	"github.com/TechBowl-japan/go-stations/pkg/ratelimit"
+	"github.com/TechBowl-japan/go-stations/pkg/realip"
+)
+
+const defaultRateLimitIdleTimeout = 10 * time.Minute
+
+// RateLimitRule は、パス及びHTTPメソッド毎のレート制限を表す。
+type RateLimitRule struct {
+	// Method は、制限対象のHTTPメソッドである。空文字の場合は全てのメソッドを対象とする。
+	Method string
+	// Path は、制限対象のパスの前方一致条件である。
+	Path string
+	// Rate は、1秒あたりに許可するリクエスト数である。
+	Rate float64
+	// Burst は、瞬間的に許可するリクエスト数の上限である。
+	Burst int
+}
+
+// RateLimitConfig は、 [NewRateLimitMiddleware] に与える設定を表す。
+type RateLimitConfig struct {
+	// Rules は先頭から評価され、最初にマッチしたルールが適用される。
+	// いずれのルールにもマッチしないリクエストは制限されない。
+	Rules []RateLimitRule
+	// TrustedProxies は、X-Forwarded-For/X-Real-IP ヘッダを信頼するプロキシのIPアドレス、またはCIDRである。
+	TrustedProxies []string
+	// IdleTimeout は、アクセスの無いクライアントのバケットを破棄するまでの時間である。
+	IdleTimeout time.Duration
+	// Clock は、レート計算に使用する時刻の取得元である。nil の場合はシステム時刻を使用する。
+	Clock ratelimit.Clock
+}
+
+type rateLimitRule struct {
+	RateLimitRule
+	limiter *ratelimit.Limiter
+}
+
+type rateLimitMiddleware struct {
+	rules    atomic.Pointer[[]rateLimitRule]
+	resolver *realip.Resolver
+	idle     time.Duration
+	clock    ratelimit.Clock
+
+	// mu は、 Reload の同時実行を防ぐ。
+	mu sync.Mutex
+}
+
+// NewRateLimitMiddleware は、クライアント毎にトークンバケットによるレート制限を行うミドルウェアを返す。
+func NewRateLimitMiddleware(cfg RateLimitConfig) (*rateLimitMiddleware, error) {
+	resolver, err := realip.NewResolver(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	idle := cfg.IdleTimeout
+	if idle == 0 {
+		idle = defaultRateLimitIdleTimeout
+	}
+
+	m := &rateLimitMiddleware{
+		resolver: resolver,
+		idle:     idle,
+		clock:    cfg.Clock,
+	}
+	if err := m.Reload(cfg.Rules); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload は、レート制限のルールを rules に差し替える。
+//
+// 変更のないルールはクライアント毎の状態を引き継ぎ、変更したルールは状態を初期化する。
+// rules が不正な場合はエラーを返し、元のルールを維持する。
+func (m *rateLimitMiddleware) Reload(rules []RateLimitRule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var old []rateLimitRule
+	if p := m.rules.Load(); p != nil {
+		old = *p
+	}
+
+	next := make([]rateLimitRule, 0, len(rules))
+	for _, rule := range rules {
+		l := findLimiter(old, rule)
+		if l == nil {
+			var err error
+			if m.clock == nil {
+				l, err = ratelimit.NewLimiter(rule.Rate, rule.Burst, m.idle)
+			} else {
+				l, err = ratelimit.NewLimiterWithClock(rule.Rate, rule.Burst, m.idle, m.clock)
+			}
+			if err != nil {
+				return fmt.Errorf("%s %s: %w", rule.Method, rule.Path, err)
+			}
+		}
+		next = append(next, rateLimitRule{
+			RateLimitRule: rule,
+			limiter:       l,
+		})
+	}
+	m.rules.Store(&next)
+	return nil
+}
+
+func findLimiter(rules []rateLimitRule, rule RateLimitRule) *ratelimit.Limiter {
+	for _, r := range rules {
+		if r.RateLimitRule == rule {
+			return r.limiter
+		}
+	}
+	return nil
+}
+
+// ServeNext は、クライアント毎のリクエスト数が上限を超えた場合に、ユーザにstatus 429を返す。
+//
+// クライアントは、認証済みのユーザID、クライアントのIPアドレスの優先順で識別する。
+// 認証済みのユーザ毎に制限する場合は、認証を行うミドルウェアより後に評価する必要がある。
+// 認証より前に評価した場合はIPアドレス毎の制限となり、資格情報の総当たりを制限できる。
+func (m *rateLimitMiddleware) ServeNext(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		rule := m.match(r)
+		if rule == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		res := rule.limiter.Allow(m.clientKey(r))
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.FormatInt(ceilSeconds(res.Reset), 10))
+		if !res.Allowed {
+			w.Header().Set("Retry-After", strconv.FormatInt(ceilSeconds(res.RetryAfter), 10))
+			httperror.Write(w, r, http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func (m *rateLimitMiddleware) match(r *http.Request) *rateLimitRule {
+	rules := *m.rules.Load()
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Method != "" && !strings.EqualFold(rule.Method, r.Method) {
+			continue
+		}
+		if strings.HasPrefix(r.URL.Path, rule.Path) {
+			return rule
+		}
+	}
+	return nil
+}
+
+func (m *rateLimitMiddleware) clientKey(r *http.Request) string {
+	if uid, ok := r.Context().Value(AuthContextKeyUser).(string); ok && uid != "" {
+		return "user:" + uid
+	}
+	// NOTE: 検証されていない資格情報(e.g. Authorization ヘッダのトークン)をキーとすると、値を変える事で
+	// 制限を回避できるため、未認証のリクエストはIPアドレスで識別する。
+	return "ip:" + m.resolver.ClientIP(r)
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
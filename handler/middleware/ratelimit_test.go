@@ -0,0 +1,246 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/handler/middleware"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestRateLimit(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)}
+	m, err := middleware.NewRateLimitMiddleware(middleware.RateLimitConfig{
+		Rules: []middleware.RateLimitRule{
+			{Method: http.MethodPost, Path: "/api/todos", Rate: 1, Burst: 1},
+			{Path: "/api/", Rate: 1, Burst: 2},
+		},
+		Clock: clock,
+	})
+	if err != nil {
+		t.Fatalf("ミドルウェアの作成に失敗しました: %v", err)
+	}
+	h := m.ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	steps := []struct {
+		method     string
+		path       string
+		advance    time.Duration
+		wantStatus int
+	}{
+		{method: http.MethodPost, path: "/api/todos", wantStatus: http.StatusOK},
+		{method: http.MethodPost, path: "/api/todos", wantStatus: http.StatusTooManyRequests},
+		{method: http.MethodGet, path: "/api/todos", wantStatus: http.StatusOK},
+		{method: http.MethodGet, path: "/api/todos", wantStatus: http.StatusOK},
+		{method: http.MethodGet, path: "/api/todos", wantStatus: http.StatusTooManyRequests},
+		{method: http.MethodGet, path: "/healthz", wantStatus: http.StatusOK},
+		{method: http.MethodPost, path: "/api/todos", advance: time.Second, wantStatus: http.StatusOK},
+	}
+	for i, s := range steps {
+		clock.now = clock.now.Add(s.advance)
+		r := httptest.NewRequest(s.method, s.path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != s.wantStatus {
+			t.Errorf("step %d: 期待していない HTTP status code です, got = %d, want = %d", i, w.Code, s.wantStatus)
+		}
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)}
+	m, err := middleware.NewRateLimitMiddleware(middleware.RateLimitConfig{
+		Rules: []middleware.RateLimitRule{
+			{Path: "/", Rate: 0.5, Burst: 1},
+		},
+		Clock: clock,
+	})
+	if err != nil {
+		t.Fatalf("ミドルウェアの作成に失敗しました: %v", err)
+	}
+	h := m.ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	want := map[string]string{
+		"Retry-After":         "2",
+		"RateLimit-Limit":     "1",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "2",
+	}
+	for k, v := range want {
+		if got := w.Header().Get(k); got != v {
+			t.Errorf("期待していない %s ヘッダです, got = %q, want = %q", k, got, v)
+		}
+	}
+}
+
+func TestRateLimitReload(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)}
+	m, err := middleware.NewRateLimitMiddleware(middleware.RateLimitConfig{
+		Rules: []middleware.RateLimitRule{
+			{Path: "/a", Rate: 1, Burst: 1},
+			{Path: "/b", Rate: 1, Burst: 1},
+		},
+		Clock: clock,
+	})
+	if err != nil {
+		t.Fatalf("ミドルウェアの作成に失敗しました: %v", err)
+	}
+	h := m.ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(path string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+	serve("/a")
+	serve("/b")
+
+	// NOTE: 不正なルールは拒否され、元のルールが維持される。
+	if err := m.Reload([]middleware.RateLimitRule{{Path: "/a", Rate: 0, Burst: 1}}); err == nil {
+		t.Error("不正なルールでエラーが発生していません")
+	}
+	if got := serve("/a"); got != http.StatusTooManyRequests {
+		t.Errorf("元のルールが維持されていません, got = %d", got)
+	}
+
+	if err := m.Reload([]middleware.RateLimitRule{
+		{Path: "/a", Rate: 1, Burst: 1},
+		{Path: "/b", Rate: 1, Burst: 2},
+	}); err != nil {
+		t.Fatalf("ルールの差し替えに失敗しました: %v", err)
+	}
+	// NOTE: 変更のないルールは状態を引き継ぎ、変更したルールは状態を初期化する。
+	if got := serve("/a"); got != http.StatusTooManyRequests {
+		t.Errorf("変更のないルールの状態が引き継がれていません, got = %d", got)
+	}
+	for i := 0; i < 2; i++ {
+		if got := serve("/b"); got != http.StatusOK {
+			t.Errorf("%d: 変更したルールが適用されていません, got = %d", i, got)
+		}
+	}
+}
+
+func TestRateLimitClientKey(t *testing.T) {
+	testcases := map[string]struct {
+		trusted []string
+		first   func(r *http.Request) *http.Request
+		second  func(r *http.Request) *http.Request
+		// wantLimited は、2回目のリクエストが1回目と同一クライアントとして制限されるかを表す。
+		wantLimited bool
+	}{
+		"Different users": {
+			first:  withUser("alice"),
+			second: withUser("bob"),
+		},
+		"Same user from different IPs": {
+			first:       chain(withUser("alice"), withRemoteAddr("192.0.2.1:1234")),
+			second:      chain(withUser("alice"), withRemoteAddr("192.0.2.2:1234")),
+			wantLimited: true,
+		},
+		"Unverified tokens": {
+			first:       withHeader("Authorization", "Bearer token-1"),
+			second:      withHeader("Authorization", "Bearer token-2"),
+			wantLimited: true,
+		},
+		"Forwarded header from untrusted client": {
+			first:       withHeader("X-Forwarded-For", "198.51.100.1"),
+			second:      withHeader("X-Forwarded-For", "198.51.100.2"),
+			wantLimited: true,
+		},
+		"Forwarded header from trusted proxy": {
+			trusted: []string{"192.0.2.0/24"},
+			first:   withHeader("X-Forwarded-For", "198.51.100.1"),
+			second:  withHeader("X-Forwarded-For", "198.51.100.2"),
+		},
+		"Forwarded header from untrusted unix socket peer": {
+			first:       chain(withRemoteAddr("@"), withHeader("X-Forwarded-For", "198.51.100.1")),
+			second:      chain(withRemoteAddr("@"), withHeader("X-Forwarded-For", "198.51.100.2")),
+			wantLimited: true,
+		},
+		"Forwarded header from trusted unix socket peer": {
+			trusted: []string{"unix"},
+			first:   chain(withRemoteAddr("@"), withHeader("X-Forwarded-For", "198.51.100.1")),
+			second:  chain(withRemoteAddr("@"), withHeader("X-Forwarded-For", "198.51.100.2")),
+		},
+		"Spoofed forwarded header behind trusted proxy": {
+			trusted:     []string{"192.0.2.0/24"},
+			first:       withHeader("X-Forwarded-For", "203.0.113.1, 198.51.100.1"),
+			second:      withHeader("X-Forwarded-For", "203.0.113.2, 198.51.100.1"),
+			wantLimited: true,
+		},
+	}
+
+	for name, tc := range testcases {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			m, err := middleware.NewRateLimitMiddleware(middleware.RateLimitConfig{
+				Rules:          []middleware.RateLimitRule{{Path: "/", Rate: 1, Burst: 1}},
+				TrustedProxies: tc.trusted,
+				Clock:          &fakeClock{now: time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)},
+			})
+			if err != nil {
+				t.Fatalf("ミドルウェアの作成に失敗しました: %v", err)
+			}
+			h := m.ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			h.ServeHTTP(httptest.NewRecorder(), tc.first(newRemoteRequest()))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, tc.second(newRemoteRequest()))
+
+			got := w.Code == http.StatusTooManyRequests
+			if got != tc.wantLimited {
+				t.Errorf("期待していない判定です, got = %v, want = %v", got, tc.wantLimited)
+			}
+		})
+	}
+}
+
+func newRemoteRequest() *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "192.0.2.100:1234"
+	return r
+}
+
+func withUser(uid string) func(r *http.Request) *http.Request {
+	return func(r *http.Request) *http.Request {
+		return r.WithContext(context.WithValue(r.Context(), middleware.AuthContextKeyUser, uid))
+	}
+}
+
+func withRemoteAddr(addr string) func(r *http.Request) *http.Request {
+	return func(r *http.Request) *http.Request {
+		r.RemoteAddr = addr
+		return r
+	}
+}
+
+func withHeader(key, value string) func(r *http.Request) *http.Request {
+	return func(r *http.Request) *http.Request {
+		r.Header.Set(key, value)
+		return r
+	}
+}
+
+func chain(fs ...func(r *http.Request) *http.Request) func(r *http.Request) *http.Request {
+	return func(r *http.Request) *http.Request {
+		for _, f := range fs {
+			r = f(r)
+		}
+		return r
+	}
+}
@@ -9,20 +9,28 @@ import (
 
 type uaContextKey string
 
-const UAContextKeyOS = uaContextKey("os")
+const (
+	UAContextKeyOS             = uaContextKey("os")
+	UAContextKeyBrowser        = uaContextKey("browser")
+	UAContextKeyBrowserVersion = uaContextKey("browser_version")
+)
 
 type userAgentRecordMiddleware struct{}
 
-// NewUserAgentRecordMiddleware は、 [context.Context] にリクエストのOS情報をセットするミドルウェアを返す。
+// NewUserAgentRecordMiddleware は、 [context.Context] にリクエストのOS及びブラウザ情報をセットするミドルウェアを返す。
 func NewUserAgentRecordMiddleware() *userAgentRecordMiddleware {
 	return &userAgentRecordMiddleware{}
 }
 
 // ServeNext は、[UAContextKeyOS] をキーとしてリクエストのOS情報を保存する。
+//
+// 同様に、 [UAContextKeyBrowser] 及び [UAContextKeyBrowserVersion] をキーとしてブラウザの名前とバージョンを保存する。
 func (m *userAgentRecordMiddleware) ServeNext(h http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		ua := useragent.Parse(r.UserAgent())
 		ctx := context.WithValue(r.Context(), UAContextKeyOS, ua.OS)
+		ctx = context.WithValue(ctx, UAContextKeyBrowser, ua.Name)
+		ctx = context.WithValue(ctx, UAContextKeyBrowserVersion, ua.Version)
 
 		h.ServeHTTP(w, r.WithContext(ctx))
 	}
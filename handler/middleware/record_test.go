@@ -11,24 +11,38 @@ import (
 
 func TestUserAgentRecord(t *testing.T) {
 	testcases := map[string]struct {
-		userAgent string
-		wantOS    string
+		userAgent          string
+		wantOS             string
+		wantBrowser        string
+		wantBrowserVersion string
 	}{
 		useragent.MacOS: {
 			userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/603.3.8 (KHTML, like Gecko) Version/10.1.2 Safari/603.3.8",
 			wantOS:    useragent.MacOS,
+
+			wantBrowser:        useragent.Safari,
+			wantBrowserVersion: "10.1.2",
 		},
 		useragent.Windows: {
 			userAgent: "Mozilla/5.0 (Windows NT 6.1; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/59.0.3071.115 Safari/537.36",
 			wantOS:    useragent.Windows,
+
+			wantBrowser:        useragent.Chrome,
+			wantBrowserVersion: "59.0.3071.115",
 		},
 		useragent.IOS: {
 			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 10_3_2 like Mac OS X) AppleWebKit/603.2.4 (KHTML, like Gecko) Version/10.0 Mobile/14F89 Safari/602.1",
 			wantOS:    useragent.IOS,
+
+			wantBrowser:        useragent.Safari,
+			wantBrowserVersion: "10.0",
 		},
 		useragent.Android: {
 			userAgent: "Mozilla/5.0 (Linux; Android 4.3; GT-I9300 Build/JSS15J) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/55.0.2883.91 Mobile Safari/537.36 OPR/42.9.2246.119956",
 			wantOS:    useragent.Android,
+
+			wantBrowser:        useragent.Opera,
+			wantBrowserVersion: "42.9.2246.119956",
 		},
 	}
 
@@ -46,6 +60,12 @@ func TestUserAgentRecord(t *testing.T) {
 			if got != want {
 				t.Errorf("Contextに正しいOS情報がセットされていません, got = %v, want = %v", got, want)
 			}
+			if got, want := r.Context().Value(middleware.UAContextKeyBrowser), tc.wantBrowser; got != want {
+				t.Errorf("Contextに正しいブラウザ情報がセットされていません, got = %v, want = %v", got, want)
+			}
+			if got, want := r.Context().Value(middleware.UAContextKeyBrowserVersion), tc.wantBrowserVersion; got != want {
+				t.Errorf("Contextに正しいブラウザのバージョンがセットされていません, got = %v, want = %v", got, want)
+			}
 		}))
 		h.ServeHTTP(w, r)
 	}
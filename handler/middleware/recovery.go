@@ -1,30 +1,121 @@
 package middleware
 
 import (
-	"log"
+	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/pkg/httperror"
+	"github.com/TechBowl-japan/go-stations/pkg/panicreport"
+	"github.com/TechBowl-japan/go-stations/pkg/requestid"
 )
 
-type recoveryMiddleware struct{}
+// recoveryContextKey は、外側に RecoveryMiddleware がある事を示す [context.Context] のキーである。
+type recoveryContextKey struct{}
+
+type recoveryMiddleware struct {
+	logger   *slog.Logger
+	reporter panicreport.Reporter
+}
 
 // NewRecoveryMiddleware は、 panicが発生した際のリカバリ処理を追加するミドルウェアを返す。
+//
+// panicの内容は [log/slog.Default] に出力される。
 func NewRecoveryMiddleware() *recoveryMiddleware {
-	return &recoveryMiddleware{}
+	return NewRecoveryMiddlewareWithLogger(slog.Default())
+}
+
+// NewRecoveryMiddlewareWithLogger は、panicの内容の出力先として logger を指定したミドルウェアを返す。
+func NewRecoveryMiddlewareWithLogger(logger *slog.Logger) *recoveryMiddleware {
+	return NewRecoveryMiddlewareWithReporter(logger, nil)
+}
+
+// NewRecoveryMiddlewareWithReporter は、 logger への出力に加えて、 reporter にpanicを通知するミドルウェアを返す。
+//
+// reporter が nil の場合は通知しない。
+func NewRecoveryMiddlewareWithReporter(logger *slog.Logger, reporter panicreport.Reporter) *recoveryMiddleware {
+	return &recoveryMiddleware{
+		logger:   logger,
+		reporter: reporter,
+	}
 }
 
-// ServeNext は、h でpanicが発生した際にリカバリ処理を行い、ユーザにstatus 500を返す。
+// ServeNext は、h でpanicが発生した際にリカバリ処理を行い、ユーザにpanicのIDを含むstatus 500を返す。
 //
-// panic発生前に [net/http.ResponseWriter] の WriteHeader が呼ばれていた場合、statusは上書きされない。
-// [net/http.ResponseWriter] の WriteHeader がpanic発生前に呼ばれない事を保証するのは利用側の責務とする。
+// panicの内容はスタックトレース及びpanicのIDと共に出力する。
+// [net/http.ErrAbortHandler] によるpanicは、 [net/http] がコネクションを切断できるよう、そのまま再度panicさせる。
+//
+// panic発生前にレスポンスの送信を開始していた場合、statusを上書きできないため、コネクションを切断して
+// クライアントに不完全なレスポンスである事を伝える。
+// 外側に別の RecoveryMiddleware がある場合、間のミドルウェア(e.g. AccessLogMiddleware)が記録できるよう、
+// 切断は最も外側の RecoveryMiddleware が行う。
 func (m *recoveryMiddleware) ServeNext(h http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
+		outermost := r.Context().Value(recoveryContextKey{}) == nil
+		if outermost {
+			r = r.WithContext(context.WithValue(r.Context(), recoveryContextKey{}, struct{}{}))
+		}
+		r, info := withRequestInfo(r)
+		sw := &statusResponseWriter{
+			ResponseWriter: w,
+			status:         http.StatusOK,
+		}
 		defer func() {
-			if p := recover(); p != nil {
-				log.Printf("recovery: panic =%v\n", p)
-				w.WriteHeader(http.StatusInternalServerError)
+			p := recover()
+			if p == nil {
+				if outermost && info.snapshot().aborted {
+					panic(http.ErrAbortHandler)
+				}
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			id := m.recover(r, p)
+			if !sw.wroteHeader {
+				// NOTE: panic前に設定された Content-Length はエラーレスポンスと一致しないため削除する。
+				w.Header().Del("Content-Length")
+				res := httperror.New(r, http.StatusInternalServerError)
+				res.PanicID = id
+				httperror.WriteResponse(w, http.StatusInternalServerError, res)
+				return
+			}
+			if outermost {
+				panic(http.ErrAbortHandler)
 			}
+			setAborted(r.Context())
 		}()
-		h.ServeHTTP(w, r)
+		h.ServeHTTP(sw, r)
 	}
 	return http.HandlerFunc(fn)
 }
+
+// recover は、panicの内容を記録及び通知し、panicのIDを返す。
+func (m *recoveryMiddleware) recover(r *http.Request, p interface{}) string {
+	// NOTE: リクエストIDと同じ形式のランダムなIDを使用する。
+	id := requestid.New()
+	stack := string(debug.Stack())
+	setPanicked(r.Context(), id)
+
+	m.logger.ErrorContext(r.Context(), "recovered from panic",
+		slog.String("panic_id", id),
+		slog.Any("panic", p),
+		slog.String("stack", stack),
+	)
+	if m.reporter != nil {
+		m.reporter.Report(panicreport.Report{
+			ID:        id,
+			Time:      time.Now(),
+			Panic:     fmt.Sprint(p),
+			Stack:     stack,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			RequestID: requestid.FromContext(r.Context()),
+		})
+	}
+	return id
+}
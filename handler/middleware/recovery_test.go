@@ -1,11 +1,21 @@
 package middleware_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/TechBowl-japan/go-stations/handler/middleware"
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/pkg/panicreport"
+	"github.com/TechBowl-japan/go-stations/pkg/requestid"
 )
 
 func TestRecovery(t *testing.T) {
@@ -21,3 +31,165 @@ func TestRecovery(t *testing.T) {
 		t.Errorf("期待していない HTTP status code です, got = %d, want = %d", w.Code, http.StatusInternalServerError)
 	}
 }
+
+func TestRecoveryWithRequestID(t *testing.T) {
+	wantID := "request-id"
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(requestid.NewContext(r.Context(), wantID))
+	w := httptest.NewRecorder()
+	m := middleware.NewRecoveryMiddleware()
+	h := m.ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("test")
+	}))
+	h.ServeHTTP(w, r)
+
+	var res model.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("レスポンスの読み込みに失敗しました: %v", err)
+	}
+	if res.RequestID != wantID {
+		t.Errorf("正しいリクエストIDが返されていません, got = %v, want = %v", res.RequestID, wantID)
+	}
+}
+
+// reporter は、通知された panicreport.Report を記録する。
+type reporter struct {
+	mu      sync.Mutex
+	reports []panicreport.Report
+}
+
+func (r *reporter) Report(report panicreport.Report) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reports = append(r.reports, report)
+}
+
+func TestRecoveryPanicID(t *testing.T) {
+	var buf bytes.Buffer
+	rep := &reporter{}
+	m := middleware.NewRecoveryMiddlewareWithReporter(slog.New(slog.NewJSONHandler(&buf, nil)), rep)
+	h := m.ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		panic("test")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/todos", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("期待していない HTTP status code です, got = %d, want = %d", w.Code, http.StatusInternalServerError)
+	}
+	if got := w.Header().Get("Content-Length"); got != "" {
+		t.Errorf("panic前の Content-Length が残っています, got = %s", got)
+	}
+	var res model.ErrorResponse
+	if err := json.NewDecoder(w.Body).Decode(&res); err != nil {
+		t.Fatalf("レスポンスの読み込みに失敗しました: %v", err)
+	}
+	if res.PanicID == "" {
+		t.Fatal("panicのIDが返されていません")
+	}
+
+	var logged struct {
+		PanicID string `json:"panic_id"`
+		Panic   string `json:"panic"`
+		Stack   string `json:"stack"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &logged); err != nil {
+		t.Fatalf("ログの読み込みに失敗しました: %v", err)
+	}
+	if logged.PanicID != res.PanicID || logged.Panic != "test" {
+		t.Errorf("期待していないログです, got = %+v, want panic_id = %s", logged, res.PanicID)
+	}
+	if !strings.Contains(logged.Stack, "recovery_test.go") {
+		t.Errorf("スタックトレースにpanicの発生箇所が含まれていません:\n%s", logged.Stack)
+	}
+
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	if len(rep.reports) != 1 {
+		t.Fatalf("通知の数が正しくありません, got = %d, want = 1", len(rep.reports))
+	}
+	if got := rep.reports[0]; got.ID != res.PanicID || got.Path != "/api/todos" || got.Stack != logged.Stack {
+		t.Errorf("期待していない通知です, got = %+v", got)
+	}
+}
+
+func TestRecoveryAfterResponseStarted(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		// outer は、アクセスログの外側に RecoveryMiddleware を設定するかである。
+		outer bool
+	}{
+		"Single":     {outer: false},
+		"With outer": {outer: true},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			logger := slog.New(slog.NewJSONHandler(io.Discard, nil))
+			ms := []middleware.HTTPMiddleware{
+				middleware.NewRecoveryMiddlewareWithLogger(logger),
+				middleware.NewAccessLogMiddlewareWithWriter(&buf),
+			}
+			if c.outer {
+				ms = append(ms, middleware.NewRecoveryMiddlewareWithLogger(logger))
+			}
+			h := middleware.With(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "partial")
+				w.(http.Flusher).Flush()
+				panic("test")
+			}), ms...)
+			srv := httptest.NewServer(h)
+			// NOTE: net/http が切断時に出力するログを抑制する。
+			srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+			t.Cleanup(srv.Close)
+
+			res, err := srv.Client().Get(srv.URL)
+			if err != nil {
+				t.Fatalf("リクエストに失敗しました: %v", err)
+			}
+			defer res.Body.Close()
+			if _, err := io.ReadAll(res.Body); err == nil {
+				t.Error("不完全なレスポンスが完全なレスポンスとして返されました")
+			}
+
+			// NOTE: 外側に RecoveryMiddleware がある場合のみ、切断前にアクセスログを記録できる。
+			if !c.outer {
+				return
+			}
+			srv.Close()
+			var al struct {
+				PanicID string `json:"panic_id"`
+			}
+			if err := json.Unmarshal(buf.Bytes(), &al); err != nil {
+				t.Fatalf("アクセスログの読み込みに失敗しました: %v", err)
+			}
+			if al.PanicID == "" {
+				t.Error("panicのIDがアクセスログに記録されていません")
+			}
+		})
+	}
+}
+
+func TestRecoveryErrAbortHandler(t *testing.T) {
+	var buf bytes.Buffer
+	m := middleware.NewRecoveryMiddlewareWithLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	h := m.ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("http.ErrAbortHandler が再度panicされていません, got = %v", p)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("http.ErrAbortHandler がログに出力されました: %s", buf.String())
+		}
+	}()
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/TechBowl-japan/go-stations/pkg/requestid"
+)
+
+type requestIDMiddleware struct{}
+
+// NewRequestIDMiddleware は、 [context.Context] にリクエストIDをセットするミドルウェアを返す。
+func NewRequestIDMiddleware() *requestIDMiddleware {
+	return &requestIDMiddleware{}
+}
+
+// ServeNext は、リクエストIDを [context.Context] に保存し、レスポンスヘッダに付与する。
+//
+// クライアントから妥当な X-Request-ID ヘッダが送られた場合はその値を引き継ぎ、それ以外の場合は新たに生成する。
+// 保存したリクエストIDは、 [requestid.FromContext] で取得できる。
+func (m *requestIDMiddleware) ServeNext(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+		w.Header().Set(requestid.Header, id)
+		ctx := requestid.NewContext(r.Context(), id)
+
+		h.ServeHTTP(w, r.WithContext(ctx))
+	}
+	return http.HandlerFunc(fn)
+}
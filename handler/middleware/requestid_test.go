@@ -0,0 +1,62 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/handler/middleware"
+	"github.com/TechBowl-japan/go-stations/pkg/requestid"
+)
+
+func TestRequestID(t *testing.T) {
+	testcases := map[string]struct {
+		header string
+		// wantSame は、クライアントから送られたIDが引き継がれるかを表す。
+		wantSame bool
+	}{
+		"Without header": {
+			header: "",
+		},
+		"Valid header": {
+			header:   "0123456789abcdef",
+			wantSame: true,
+		},
+		"Header containing space": {
+			header: "id with space",
+		},
+		"Too long header": {
+			header: strings.Repeat("a", 129),
+		},
+	}
+
+	for name, tc := range testcases {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.header != "" {
+				r.Header.Set(requestid.Header, tc.header)
+			}
+			w := httptest.NewRecorder()
+
+			var got string
+			m := middleware.NewRequestIDMiddleware()
+			h := m.ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = requestid.FromContext(r.Context())
+			}))
+			h.ServeHTTP(w, r)
+
+			if got == "" {
+				t.Fatal("ContextにリクエストIDが保存されていません")
+			}
+			if echoed := w.Header().Get(requestid.Header); echoed != got {
+				t.Errorf("レスポンスヘッダに正しいリクエストIDがセットされていません, got = %v, want = %v", echoed, got)
+			}
+			if (got == tc.header) != tc.wantSame {
+				t.Errorf("期待していないリクエストIDです, got = %v, header = %v", got, tc.header)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SecurityHeadersConfig は、 [NewSecurityHeadersMiddleware] に与える設定を表す。空文字及び0のヘッダは付与しない。
+type SecurityHeadersConfig struct {
+	// HSTSMaxAge は、Strict-Transport-Security の max-age である。HTTPSのリクエストにのみ付与する。
+	HSTSMaxAge time.Duration
+	// HSTSIncludeSubdomains は、Strict-Transport-Security をサブドメインにも適用するかである。
+	HSTSIncludeSubdomains bool
+	// ContentSecurityPolicy は、Content-Security-Policy の値である。
+	ContentSecurityPolicy string
+	// ReferrerPolicy は、Referrer-Policy の値である。
+	ReferrerPolicy string
+}
+
+type securityHeadersMiddleware struct {
+	hsts   string
+	csp    string
+	policy string
+}
+
+// NewSecurityHeadersMiddleware は、ブラウザの保護機能を有効にするレスポンスヘッダを付与するミドルウェアを返す。
+func NewSecurityHeadersMiddleware(cfg SecurityHeadersConfig) *securityHeadersMiddleware {
+	m := &securityHeadersMiddleware{
+		csp:    cfg.ContentSecurityPolicy,
+		policy: cfg.ReferrerPolicy,
+	}
+	if cfg.HSTSMaxAge > 0 {
+		m.hsts = "max-age=" + strconv.FormatInt(int64(cfg.HSTSMaxAge/time.Second), 10)
+		if cfg.HSTSIncludeSubdomains {
+			m.hsts += "; includeSubDomains"
+		}
+	}
+	return m
+}
+
+// ServeNext は、後続のハンドラの前にセキュリティ関連のヘッダを付与する。後続のハンドラは、ヘッダを上書きできる。
+//
+// X-Content-Type-Options: nosniff は常に付与する。
+// Strict-Transport-Security は、HTTPでは中間者により改竄され得るため、HTTPSのリクエストにのみ付与する。
+func (m *securityHeadersMiddleware) ServeNext(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		hdr := w.Header()
+		hdr.Set("X-Content-Type-Options", "nosniff")
+		if m.hsts != "" && r.TLS != nil {
+			hdr.Set("Strict-Transport-Security", m.hsts)
+		}
+		if m.csp != "" {
+			hdr.Set("Content-Security-Policy", m.csp)
+		}
+		if m.policy != "" {
+			hdr.Set("Referrer-Policy", m.policy)
+		}
+		h.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+type noStoreMiddleware struct{}
+
+// NewNoStoreMiddleware は、レスポンスをキャッシュさせないミドルウェアを返す。
+func NewNoStoreMiddleware() *noStoreMiddleware {
+	return &noStoreMiddleware{}
+}
+
+// ServeNext は、後続のハンドラの前に Cache-Control: no-store を付与する。
+//
+// 認証が必要なレスポンスが、ブラウザ及び共有キャッシュに保存される事を防ぐ。
+func (m *noStoreMiddleware) ServeNext(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		h.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
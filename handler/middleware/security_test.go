@@ -0,0 +1,102 @@
+package middleware_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/handler/middleware"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	t.Parallel()
+
+	full := middleware.SecurityHeadersConfig{
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		ContentSecurityPolicy: "default-src 'none'",
+		ReferrerPolicy:        "no-referrer",
+	}
+
+	cases := map[string]struct {
+		cfg  middleware.SecurityHeadersConfig
+		tls  bool
+		want map[string]string
+	}{
+		"HTTPS": {
+			cfg: full,
+			tls: true,
+			want: map[string]string{
+				"X-Content-Type-Options":    "nosniff",
+				"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+				"Content-Security-Policy":   "default-src 'none'",
+				"Referrer-Policy":           "no-referrer",
+			},
+		},
+		"HTTP": {
+			cfg: full,
+			want: map[string]string{
+				"X-Content-Type-Options":  "nosniff",
+				"Content-Security-Policy": "default-src 'none'",
+				"Referrer-Policy":         "no-referrer",
+			},
+		},
+		"HSTS without subdomains": {
+			cfg: middleware.SecurityHeadersConfig{HSTSMaxAge: time.Hour},
+			tls: true,
+			want: map[string]string{
+				"X-Content-Type-Options":    "nosniff",
+				"Strict-Transport-Security": "max-age=3600",
+			},
+		},
+		"Empty": {
+			tls: true,
+			want: map[string]string{
+				"X-Content-Type-Options": "nosniff",
+			},
+		},
+	}
+
+	names := []string{"X-Content-Type-Options", "Strict-Transport-Security", "Content-Security-Policy", "Referrer-Policy"}
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			h := middleware.NewSecurityHeadersMiddleware(c.cfg).ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			r := httptest.NewRequest(http.MethodGet, "/api/todos", nil)
+			if c.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			got := make(map[string]string)
+			for _, k := range names {
+				if v := w.Header().Get(k); v != "" {
+					got[k] = v
+				}
+			}
+			if diff := cmp.Diff(c.want, got); diff != "" {
+				t.Errorf("期待していないヘッダです (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNoStore(t *testing.T) {
+	t.Parallel()
+
+	h := middleware.NewNoStoreMiddleware().ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/todos", nil))
+
+	if got := w.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("期待していない Cache-Control ヘッダです, got = %q, want = %q", got, "no-store")
+	}
+}
@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/pkg/httperror"
+)
+
+// TimeoutRule は、パス及びHTTPメソッド毎の処理時間の上限を表す。
+type TimeoutRule struct {
+	// Method は、対象のHTTPメソッドである。空文字の場合は全てのメソッドを対象とする。
+	Method string
+	// Path は、対象のパスの前方一致条件である。
+	Path string
+	// Timeout は、処理時間の上限である。0の場合は上限を設けない(e.g. ストリーミング)。
+	Timeout time.Duration
+}
+
+// TimeoutConfig は、 [NewTimeoutMiddleware] に与える設定を表す。
+type TimeoutConfig struct {
+	// Rules は先頭から評価され、最初にマッチしたルールが適用される。
+	Rules []TimeoutRule
+	// Default は、いずれのルールにもマッチしないリクエストの処理時間の上限である。0の場合は上限を設けない。
+	Default time.Duration
+	// Status は、上限を超えた場合に返すstatusであり、503または504を指定できる。0の場合は503とする。
+	Status int
+}
+
+type timeoutMiddleware struct {
+	rules  []TimeoutRule
+	def    time.Duration
+	status int
+}
+
+// NewTimeoutMiddleware は、リクエスト毎に処理時間の上限を設けるミドルウェアを返す。
+func NewTimeoutMiddleware(cfg TimeoutConfig) (*timeoutMiddleware, error) {
+	m := &timeoutMiddleware{
+		rules:  cfg.Rules,
+		def:    cfg.Default,
+		status: cfg.Status,
+	}
+	if m.status == 0 {
+		m.status = http.StatusServiceUnavailable
+	}
+	var errs []error
+	if m.status != http.StatusServiceUnavailable && m.status != http.StatusGatewayTimeout {
+		errs = append(errs, fmt.Errorf("タイムアウト時のstatusには503または504を指定する必要があります: %d", m.status))
+	}
+	if m.def < 0 {
+		errs = append(errs, fmt.Errorf("処理時間の上限には0以上の時間を指定する必要があります: %s", m.def))
+	}
+	for _, rule := range m.rules {
+		if rule.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("%s %s: 処理時間の上限には0以上の時間を指定する必要があります: %s", rule.Method, rule.Path, rule.Timeout))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// timeout は、 r に適用する処理時間の上限を返す。
+func (m *timeoutMiddleware) timeout(r *http.Request) time.Duration {
+	for _, rule := range m.rules {
+		if rule.Method != "" && !strings.EqualFold(rule.Method, r.Method) {
+			continue
+		}
+		if strings.HasPrefix(r.URL.Path, rule.Path) {
+			return rule.Timeout
+		}
+	}
+	return m.def
+}
+
+// ServeNext は、 r.Context() に処理時間の上限を設定し、上限を超えた場合はレスポンスを Status のエラーレスポンスに置き換える。
+//
+// 後続のハンドラは、 r.Context() の終了時に処理を中断する必要がある(e.g. [database/sql.DB.QueryContext] に渡す)。
+// レスポンスを置き換えられるよう、後続のハンドラが終了するまでレスポンスをバッファする。
+// [net/http.Flusher] でフラッシュしたレスポンスは置き換えられないため、上限を超えた事の記録のみを行う。
+//
+// 上限を超えた事をアクセスログ及びメトリクスに記録するため、それらを記録するミドルウェアより後に評価する必要がある。
+func (m *timeoutMiddleware) ServeNext(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		d := m.timeout(r)
+		if d <= 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+
+		tw := &timeoutResponseWriter{
+			w:      w,
+			header: make(http.Header),
+		}
+		// NOTE: panic時は、RecoveryMiddleware がエラーレスポンスを返すため、バッファしたレスポンスを書き込まない。
+		h.ServeHTTP(tw, r.WithContext(ctx))
+
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			tw.commit()
+			return
+		}
+		setTimedOut(r.Context())
+		if tw.committed {
+			return
+		}
+		// NOTE: クライアントが再試行の間隔を判断できるよう、上限の時間を目安として返す。
+		w.Header().Set("Retry-After", strconv.FormatInt(ceilSeconds(d), 10))
+		httperror.Write(w, r, m.status)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// timeoutResponseWriter は、レスポンスを置き換えるために、ヘッダ、status及びボディをバッファする [net/http.ResponseWriter] である。
+type timeoutResponseWriter struct {
+	w         http.ResponseWriter
+	header    http.Header
+	status    int
+	buf       bytes.Buffer
+	committed bool
+}
+
+func (w *timeoutResponseWriter) Header() http.Header {
+	if w.committed {
+		return w.w.Header()
+	}
+	return w.header
+}
+
+func (w *timeoutResponseWriter) WriteHeader(status int) {
+	if w.committed {
+		w.w.WriteHeader(status)
+		return
+	}
+	// NOTE: 1xx は最終的なレスポンスではないため、バッファしない。
+	if status >= 100 && status <= 199 && status != http.StatusSwitchingProtocols {
+		return
+	}
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *timeoutResponseWriter) Write(b []byte) (int, error) {
+	if w.committed {
+		return w.w.Write(b)
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.buf.Write(b)
+}
+
+// Flush は、 [net/http.Flusher] を実装する。バッファしたレスポンスを書き込み、以降はバッファしない。
+func (w *timeoutResponseWriter) Flush() {
+	w.commit()
+	if f, ok := w.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack は、 [net/http.Hijacker] を実装する。
+func (w *timeoutResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("timeoutResponseWriter: underlying ResponseWriter does not implement http.Hijacker")
+	}
+	w.commit()
+	return h.Hijack()
+}
+
+// Unwrap は、 [net/http.ResponseController] が元の [net/http.ResponseWriter] を参照するために使用する。
+func (w *timeoutResponseWriter) Unwrap() http.ResponseWriter {
+	return w.w
+}
+
+// commit は、バッファしたレスポンスを書き込む。
+func (w *timeoutResponseWriter) commit() {
+	if w.committed {
+		return
+	}
+	w.committed = true
+	dst := w.w.Header()
+	for k, v := range w.header {
+		dst[k] = v
+	}
+	if w.status != 0 {
+		w.w.WriteHeader(w.status)
+	}
+	if w.buf.Len() > 0 {
+		// NOTE: 書き込みに失敗するのはクライアントとの接続が切れた場合であり、サーバ側で対処できないため無視する。
+		_, _ = w.w.Write(w.buf.Bytes())
+	}
+	w.buf = bytes.Buffer{}
+}
@@ -0,0 +1,200 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/handler/middleware"
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/pkg/metrics"
+)
+
+func TestTimeout(t *testing.T) {
+	t.Parallel()
+
+	rules := []middleware.TimeoutRule{
+		{Path: "/api/stream", Timeout: 0},
+		{Method: http.MethodPost, Path: "/api/todos", Timeout: 10 * time.Millisecond},
+	}
+
+	cases := map[string]struct {
+		method     string
+		path       string
+		status     int
+		sleep      time.Duration
+		flush      bool
+		wantStatus int
+		wantBody   string
+		wantHeader map[string]string
+	}{
+		"Completed": {
+			method:     http.MethodGet,
+			path:       "/api/todos",
+			wantStatus: http.StatusCreated,
+			wantBody:   "ok",
+			wantHeader: map[string]string{"X-Handler": "1"},
+		},
+		"Timed out": {
+			method:     http.MethodPost,
+			path:       "/api/todos",
+			sleep:      time.Second,
+			wantStatus: http.StatusServiceUnavailable,
+			wantHeader: map[string]string{"Retry-After": "1", "X-Handler": ""},
+		},
+		"Timed out with 504": {
+			method:     http.MethodPost,
+			path:       "/api/todos",
+			status:     http.StatusGatewayTimeout,
+			sleep:      time.Second,
+			wantStatus: http.StatusGatewayTimeout,
+		},
+		"Default": {
+			method:     http.MethodGet,
+			path:       "/api/todos",
+			sleep:      time.Second,
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		"No timeout": {
+			method:     http.MethodGet,
+			path:       "/api/stream",
+			wantStatus: http.StatusCreated,
+			wantBody:   "ok",
+		},
+		"Flushed before timeout": {
+			method:     http.MethodPost,
+			path:       "/api/todos",
+			sleep:      time.Second,
+			flush:      true,
+			wantStatus: http.StatusCreated,
+			wantBody:   "ok",
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			m, err := middleware.NewTimeoutMiddleware(middleware.TimeoutConfig{
+				Rules:   rules,
+				Default: 20 * time.Millisecond,
+				Status:  c.status,
+			})
+			if err != nil {
+				t.Fatalf("ミドルウェアの作成に失敗しました: %v", err)
+			}
+			h := m.ServeNext(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, ok := r.Context().Deadline(); !ok && c.path != "/api/stream" {
+					t.Error("context に期限が設定されていません")
+				}
+				w.Header().Set("X-Handler", "1")
+				if c.flush {
+					w.WriteHeader(http.StatusCreated)
+					io.WriteString(w, "ok")
+					w.(http.Flusher).Flush()
+				}
+				// NOTE: context の終了時に処理を中断するハンドラを想定する。
+				select {
+				case <-time.After(c.sleep):
+				case <-r.Context().Done():
+					if !c.flush {
+						http.Error(w, r.Context().Err().Error(), http.StatusBadRequest)
+					}
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+				io.WriteString(w, "ok")
+			}))
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(c.method, c.path, nil))
+
+			if w.Code != c.wantStatus {
+				t.Errorf("期待していない HTTP status code です, got = %d, want = %d", w.Code, c.wantStatus)
+			}
+			for k, v := range c.wantHeader {
+				if got := w.Header().Get(k); got != v {
+					t.Errorf("期待していない %s ヘッダです, got = %q, want = %q", k, got, v)
+				}
+			}
+			if c.wantStatus == http.StatusServiceUnavailable || c.wantStatus == http.StatusGatewayTimeout {
+				var res model.ErrorResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+					t.Fatalf("エラーレスポンスの読み込みに失敗しました: %v, body = %q", err, w.Body.String())
+				}
+				if res.Message != http.StatusText(c.wantStatus) {
+					t.Errorf("期待していないメッセージです, got = %q", res.Message)
+				}
+				return
+			}
+			if w.Body.String() != c.wantBody {
+				t.Errorf("期待していないレスポンスです, got = %q, want = %q", w.Body.String(), c.wantBody)
+			}
+		})
+	}
+}
+
+func TestTimeoutConfigError(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]middleware.TimeoutConfig{
+		"Invalid status":   {Status: http.StatusInternalServerError},
+		"Negative default": {Default: -time.Second},
+		"Negative rule":    {Rules: []middleware.TimeoutRule{{Path: "/", Timeout: -time.Second}}},
+	}
+	for name, cfg := range cases {
+		cfg := cfg
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := middleware.NewTimeoutMiddleware(cfg); err == nil {
+				t.Error("不正な設定でエラーが返されませんでした")
+			}
+		})
+	}
+}
+
+func TestTimeoutRecorded(t *testing.T) {
+	t.Parallel()
+
+	m, err := middleware.NewTimeoutMiddleware(middleware.TimeoutConfig{Default: time.Millisecond})
+	if err != nil {
+		t.Fatalf("ミドルウェアの作成に失敗しました: %v", err)
+	}
+	reg := metrics.NewRegistry()
+	var buf bytes.Buffer
+	h := middleware.With(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}),
+		m,
+		middleware.NewAccessLogMiddlewareWithWriter(&buf),
+		middleware.NewMetricsMiddleware(reg, func(r *http.Request) string { return "/api/todos" }),
+	)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/todos", nil))
+
+	var got struct {
+		Status   int  `json:"status"`
+		TimedOut bool `json:"timed_out"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("アクセスログの読み込みに失敗しました: %v", err)
+	}
+	if got.Status != http.StatusServiceUnavailable || !got.TimedOut {
+		t.Errorf("タイムアウトがアクセスログに記録されていません, got = %+v", got)
+	}
+
+	var out bytes.Buffer
+	if err := reg.WriteText(&out); err != nil {
+		t.Fatalf("メトリクスの出力に失敗しました: %v", err)
+	}
+	want := `http_request_timeouts_total{method="GET",route="/api/todos"} 1`
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("タイムアウトがメトリクスに記録されていません, want = %s\n%s", want, out.String())
+	}
+}
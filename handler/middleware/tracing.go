@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/TechBowl-japan/go-stations/pkg/tracing"
+)
+
+type tracingMiddleware struct {
+	tracer *tracing.Tracer
+	route  func(r *http.Request) string
+}
+
+// NewTracingMiddleware は、HTTPリクエスト毎にサーバスパンを作成するミドルウェアを返す。
+//
+// route は、スパン名に使用するルートを返す関数である。 [NewMetricsMiddleware] と同様の値を想定している。
+func NewTracingMiddleware(tracer *tracing.Tracer, route func(r *http.Request) string) *tracingMiddleware {
+	return &tracingMiddleware{
+		tracer: tracer,
+		route:  route,
+	}
+}
+
+// ServeNext は、traceparent ヘッダで伝搬されたスパンを親としてサーバスパンを作成し、 [context.Context] に保存する。
+//
+// 保存したスパンの識別情報は、 [tracing.SpanContextFromContext] で取得できる。
+// アクセスログにトレースIDを記録するため、アクセスログを記録するミドルウェアより先に評価する必要がある。
+func (m *tracingMiddleware) ServeNext(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if parent, ok := tracing.Extract(r.Header); ok {
+			ctx = tracing.ContextWithRemoteSpanContext(ctx, parent)
+		}
+		ctx, span := m.tracer.Start(ctx, r.Method, tracing.SpanKindServer,
+			tracing.String("http.request.method", r.Method),
+			tracing.String("url.path", r.URL.Path),
+			tracing.String("url.scheme", scheme(r)),
+			tracing.String("user_agent.original", r.UserAgent()),
+		)
+		defer span.End()
+
+		sw := &statusResponseWriter{
+			ResponseWriter: w,
+			status:         http.StatusOK,
+		}
+		r = r.WithContext(ctx)
+		h.ServeHTTP(sw, r)
+
+		route := m.route(r)
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(
+			tracing.String("http.route", route),
+			tracing.Int("http.response.status_code", sw.status),
+		)
+		// NOTE: クライアントの誤りである4xxは、サーバスパンのエラーとしない。
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(tracing.StatusError, http.StatusText(sw.status))
+		}
+	}
+	return http.HandlerFunc(fn)
+}
+
+func scheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
@@ -0,0 +1,85 @@
+package middleware_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/handler/middleware"
+	"github.com/TechBowl-japan/go-stations/pkg/tracing"
+)
+
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (r *spanRecorder) ExportSpans(ctx context.Context, spans []tracing.SpanData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func TestTracing(t *testing.T) {
+	const (
+		traceID  = "4bf92f3577b34da6a3ce929d0e0e4736"
+		parentID = "00f067aa0ba902b7"
+	)
+
+	rec := &spanRecorder{}
+	tracer := tracing.NewTracer(tracing.Config{Exporter: rec})
+
+	var buf bytes.Buffer
+	h := middleware.With(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}),
+		middleware.NewAccessLogMiddlewareWithWriter(&buf),
+		middleware.NewTracingMiddleware(tracer, func(r *http.Request) string {
+			return "/todos"
+		}),
+	)
+
+	r := httptest.NewRequest(http.MethodGet, "/todos?size=1", nil)
+	r.Header.Set(tracing.TraceparentHeader, "00-"+traceID+"-"+parentID+"-01")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("予期しないエラーが発生しました: %v", err)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.spans) != 1 {
+		t.Fatalf("期待していないスパンの数です, got = %d, want = 1", len(rec.spans))
+	}
+	span := rec.spans[0]
+	if span.Name != "GET /todos" {
+		t.Errorf("期待していないスパン名です, got = %s", span.Name)
+	}
+	if span.Kind != tracing.SpanKindServer {
+		t.Errorf("期待していないスパンの種類です, got = %d", span.Kind)
+	}
+	if span.SpanContext.TraceID.String() != traceID || span.Parent.SpanID.String() != parentID {
+		t.Errorf("traceparent ヘッダのスパンが親になっていません, got = %+v", span)
+	}
+	if span.StatusCode != tracing.StatusError {
+		t.Errorf("5xxのスパンがエラーになっていません, got = %d", span.StatusCode)
+	}
+
+	var al middleware.AccessLog
+	if err := json.NewDecoder(&buf).Decode(&al); err != nil {
+		t.Fatalf("アクセスログの読み込みに失敗しました: %v", err)
+	}
+	if al.TraceID != traceID {
+		t.Errorf("正しいトレースIDが記録されていません, got = %s, want = %s", al.TraceID, traceID)
+	}
+	if al.SpanID != span.SpanContext.SpanID.String() {
+		t.Errorf("正しいスパンIDが記録されていません, got = %s, want = %s", al.SpanID, span.SpanContext.SpanID)
+	}
+}
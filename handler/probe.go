@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/pkg/health"
+)
+
+const (
+	probeStatusOK     = "ok"
+	probeStatusFailed = "failed"
+)
+
+// A ProbeHandler implements liveness and readiness probe endpoints.
+type ProbeHandler struct {
+	registry *health.Registry
+	logger   *slog.Logger
+}
+
+// NewProbeHandler returns ProbeHandler which runs the checks registered in registry.
+func NewProbeHandler(registry *health.Registry) *ProbeHandler {
+	return NewProbeHandlerWithLogger(registry, slog.Default())
+}
+
+// NewProbeHandlerWithLogger returns ProbeHandler which writes logs to logger.
+func NewProbeHandlerWithLogger(registry *health.Registry, logger *slog.Logger) *ProbeHandler {
+	return &ProbeHandler{
+		registry: registry,
+		logger:   logger,
+	}
+}
+
+// ServeHTTP implements http.Handler interface.
+//
+// It responds with 503 if any check fails. The reasons of failures are included
+// only when the verbose query parameter is given, since they may reveal internal details.
+func (h *ProbeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	_, verbose := r.URL.Query()["verbose"]
+
+	results := h.registry.Run(r.Context())
+	res := &model.ProbeResponse{
+		Status: probeStatusOK,
+		Checks: make([]*model.ProbeCheck, 0, len(results)),
+	}
+	for _, result := range results {
+		check := &model.ProbeCheck{
+			Name:      result.Name,
+			Status:    probeStatusOK,
+			LatencyMS: float64(result.Latency) / float64(time.Millisecond),
+		}
+		if result.Err != nil {
+			res.Status = probeStatusFailed
+			check.Status = probeStatusFailed
+			if verbose {
+				check.Error = result.Err.Error()
+			}
+			h.logger.WarnContext(r.Context(), "check failed", slog.String("check", result.Name), slog.Any("err", result.Err))
+		}
+		res.Checks = append(res.Checks, check)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if res.Status != probeStatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	e := json.NewEncoder(w)
+	if err := e.Encode(res); err != nil {
+		h.logger.ErrorContext(r.Context(), "could not encode response", slog.Any("err", err))
+	}
+}
@@ -1,12 +1,29 @@
 package router
 
 import (
+	"context"
 	"database/sql"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/http/pprof"
+	"strings"
+	"time"
 
+	"github.com/TechBowl-japan/go-stations/db"
 	"github.com/TechBowl-japan/go-stations/handler"
 	"github.com/TechBowl-japan/go-stations/handler/middleware"
+	"github.com/TechBowl-japan/go-stations/model"
 	"github.com/TechBowl-japan/go-stations/pkg/basicauth"
+	"github.com/TechBowl-japan/go-stations/pkg/buildinfo"
+	"github.com/TechBowl-japan/go-stations/pkg/health"
+	"github.com/TechBowl-japan/go-stations/pkg/logging"
+	"github.com/TechBowl-japan/go-stations/pkg/metrics"
+	"github.com/TechBowl-japan/go-stations/pkg/outbox"
+	"github.com/TechBowl-japan/go-stations/pkg/panicreport"
+	"github.com/TechBowl-japan/go-stations/pkg/pubsub"
+	"github.com/TechBowl-japan/go-stations/pkg/tracing"
+	"github.com/TechBowl-japan/go-stations/pkg/websocket"
 	"github.com/TechBowl-japan/go-stations/service"
 )
 
@@ -22,6 +39,8 @@ func NewRouter(todoDB *sql.DB) *http.ServeMux {
 			middleware.NewRecoveryMiddleware(),
 			middleware.NewAccessLogMiddleware(),
 			middleware.NewUserAgentRecordMiddleware(),
+			middleware.NewRecoveryMiddleware(),
+			middleware.NewRequestIDMiddleware(),
 		),
 	)
 	mux.Handle("/do-panic",
@@ -30,19 +49,411 @@ func NewRouter(todoDB *sql.DB) *http.ServeMux {
 			middleware.NewRecoveryMiddleware(),
 			middleware.NewAccessLogMiddleware(),
 			middleware.NewUserAgentRecordMiddleware(),
+			middleware.NewRecoveryMiddleware(),
+			middleware.NewRequestIDMiddleware(),
 		),
 	)
 
 	return mux
 }
 
+// BasicAuthRealm は、/api 以下のパスのBasic認証のレルムである。
+const BasicAuthRealm = "go-stations-api"
+
+// Option は、 [NewHandler] 及び [NewHandlerWithBasicAuth] が返すHTTPハンドラの設定を変更する。
+type Option func(*options)
+
+type options struct {
+	rateLimit       middleware.HTTPMiddleware
+	ipRateLimit     middleware.HTTPMiddleware
+	accessLog       middleware.HTTPMiddleware
+	logger          *slog.Logger
+	metrics         *metrics.Registry
+	metricsEndpoint bool
+	tracer          *tracing.Tracer
+	liveness        *health.Registry
+	readiness       *health.Registry
+	config          func() map[string]string
+	pageSize        int64
+	clientCert      middleware.HTTPMiddleware
+	cors            middleware.HTTPMiddleware
+	securityHeaders middleware.HTTPMiddleware
+	compression     middleware.HTTPMiddleware
+	timeout         middleware.HTTPMiddleware
+	panicReporter   panicreport.Reporter
+	events          *pubsub.Broker
+	heartbeat       time.Duration
+	webSocket       handler.WebSocketConfig
+	graphQL         handler.GraphQLConfig
+	webhooks        *service.WebhookService
+	outbox          *outbox.Relay
+	logLevel        *slog.LevelVar
+	// httpMetrics は、最初に作成したメトリクスを記録するミドルウェアとメトリクスを共有するミドルウェアを返す。
+	httpMetrics func(route func(r *http.Request) string) middleware.HTTPMiddleware
+
+	routes *routes
+	// admin は、管理用のHTTPハンドラのルーティングである。公開用と同じハンドラで提供する場合は nil とする。
+	admin *routes
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		accessLog: middleware.NewAccessLogMiddleware(),
+		events:    pubsub.NewBroker(pubsub.Config{}),
+		heartbeat: handler.DefaultHeartbeatInterval,
+		logger:    slog.Default(),
+		liveness:  health.NewRegistry(),
+		pageSize:  handler.DefaultPageSize,
+		readiness: health.NewRegistry(),
+		routes:    newRoutes(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// metricsMiddleware は、 rt のメトリクスを記録するミドルウェアを返す。メトリクスを記録しない場合は nil を返す。
+func (o *options) metricsMiddleware(rt *routes) middleware.HTTPMiddleware {
+	if o.metrics == nil {
+		return nil
+	}
+	if o.httpMetrics != nil {
+		return o.httpMetrics(rt.routeOf)
+	}
+	m := middleware.NewMetricsMiddleware(o.metrics, rt.routeOf)
+	o.httpMetrics = func(route func(r *http.Request) string) middleware.HTTPMiddleware {
+		return m.WithRoute(route)
+	}
+	return m
+}
+
+// recoveryMiddleware は、panicからリカバリし、 [WithPanicReporter] の通知先に通知するミドルウェアを返す。
+func (o *options) recoveryMiddleware() middleware.HTTPMiddleware {
+	return middleware.NewRecoveryMiddlewareWithReporter(logging.Package(o.logger, "handler/middleware"), o.panicReporter)
+}
+
+// tracingMiddleware は、 rt のスパンを作成するミドルウェアを返す。トレーシングが無効な場合は nil を返す。
+func (o *options) tracingMiddleware(rt *routes) middleware.HTTPMiddleware {
+	if o.tracer == nil {
+		return nil
+	}
+	return middleware.NewTracingMiddleware(o.tracer, rt.routeOf)
+}
+
+// routes は、ルーティングの定義を保持する。
+type routes struct {
+	mux *http.ServeMux
+	// api は、/api 以下のパスのルーティングである。
+	api *http.ServeMux
+}
+
+func newRoutes() *routes {
+	return &routes{
+		mux: http.NewServeMux(),
+		api: http.NewServeMux(),
+	}
+}
+
+// routeOf は、リクエストに対応する [net/http.ServeMux] のパターンを返す。
+func (rt *routes) routeOf(r *http.Request) string {
+	_, pattern := rt.mux.Handler(r)
+	if pattern == "/api/" {
+		// NOTE: /api 以下のパスは [net/http.StripPrefix] でルーティングを委譲しているため、同様にパスを変換して参照する。
+		r2 := new(http.Request)
+		*r2 = *r
+		u := *r.URL
+		u.Path = strings.TrimPrefix(r.URL.Path, "/api")
+		r2.URL = &u
+		if _, p := rt.api.Handler(r2); p != "" {
+			return "/api" + p
+		}
+	}
+	if pattern == "" {
+		return "unmatched"
+	}
+	return pattern
+}
+
+// WithRateLimit は、/api 以下のパスにレート制限を行うミドルウェアを設定する。
+func WithRateLimit(m middleware.HTTPMiddleware) Option {
+	return func(o *options) {
+		o.rateLimit = m
+	}
+}
+
+// WithIPRateLimit は、/api 以下のパスに認証の前に評価するレート制限のミドルウェアを設定する。
+//
+// 認証に失敗したリクエストも制限されるため、資格情報の総当たりを防ぐ事ができる。
+func WithIPRateLimit(m middleware.HTTPMiddleware) Option {
+	return func(o *options) {
+		o.ipRateLimit = m
+	}
+}
+
+// WithLogger は、ハンドラ、ミドルウェア及びサービスが使用する Logger を設定する。
+//
+// 各パッケージには、パッケージ名を属性として付与した Logger が渡される。
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithAccessLog は、アクセスログを記録するミドルウェアを設定する。
+//
+// 設定しない場合、アクセスログは標準出力にJSON形式で出力される。
+func WithAccessLog(m middleware.HTTPMiddleware) Option {
+	return func(o *options) {
+		o.accessLog = m
+	}
+}
+
+// WithMetrics は、HTTPリクエスト、DB等に関するメトリクスを reg に記録する。
+func WithMetrics(reg *metrics.Registry) Option {
+	return func(o *options) {
+		o.metrics = reg
+	}
+}
+
+// WithMetricsEndpoint は、 [WithMetrics] で記録したメトリクスを /metrics で公開する。
+//
+// [NewHandlerWithBasicAuth] の場合、/metrics にもBasic認証を設定する。
+// 認証なしで公開する場合は、 [NewHandlersWithAuthenticator] の管理用のHTTPハンドラを使用する事。
+// 管理用のHTTPハンドラは、この設定に関わらず /metrics を公開する。
+func WithMetricsEndpoint() Option {
+	return func(o *options) {
+		o.metricsEndpoint = true
+	}
+}
+
+// WithTracer は、HTTPリクエスト及びSQLの実行毎にスパンを作成する。
+func WithTracer(tracer *tracing.Tracer) Option {
+	return func(o *options) {
+		o.tracer = tracer
+	}
+}
+
+// WithLiveness は、/livez で実行するチェックを設定する。
+//
+// プロセスの再起動で回復する障害のみを登録する事。依存先の障害を登録すると、不要な再起動を招く。
+func WithLiveness(reg *health.Registry) Option {
+	return func(o *options) {
+		o.liveness = reg
+	}
+}
+
+// WithReadiness は、/readyz で実行するチェックを設定する。
+//
+// reg には、DBへの接続及びスキーマの適用状況のチェックが追加で登録される。
+func WithReadiness(reg *health.Registry) Option {
+	return func(o *options) {
+		o.readiness = reg
+	}
+}
+
+// WithConfig は、/version で公開する設定を指定する。秘匿情報は [buildinfo.MaskSecrets] で置き換えて公開する。
+func WithConfig(config map[string]string) Option {
+	config = buildinfo.MaskSecrets(config)
+	return WithConfigFunc(func() map[string]string {
+		return config
+	})
+}
+
+// WithConfigFunc は、/version で公開する設定を返す関数を指定する。設定を再読み込みする場合に使用する。
+//
+// 秘匿情報は [buildinfo.MaskSecrets] で置き換えて公開する。
+func WithConfigFunc(fn func() map[string]string) Option {
+	return func(o *options) {
+		o.config = func() map[string]string {
+			return buildinfo.MaskSecrets(fn())
+		}
+	}
+}
+
+// WithDefaultPageSize は、size パラメータを省略した場合に返すTODOの数を設定する。
+func WithDefaultPageSize(size int64) Option {
+	return func(o *options) {
+		o.pageSize = size
+	}
+}
+
+// WithClientCert は、/api 以下のパスで、検証済みのクライアント証明書による認証を許可する。
+//
+// principals については [middleware.NewClientCertMiddleware] を参照。
+// クライアント証明書で認証できない場合は、Basic認証を行う。
+func WithClientCert(principals map[string]string) Option {
+	return func(o *options) {
+		o.clientCert = middleware.NewClientCertMiddleware(principals)
+	}
+}
+
+// WithCORS は、/api 以下のパスで、異なるオリジンからのリクエストを許可するミドルウェアを設定する。
+//
+// プリフライトリクエストには認証を行わずに応答する。
+func WithCORS(m middleware.HTTPMiddleware) Option {
+	return func(o *options) {
+		o.cors = m
+	}
+}
+
+// WithSecurityHeaders は、公開用のHTTPハンドラの全てのレスポンスにセキュリティ関連のヘッダを付与するミドルウェアを設定する。
+//
+// 管理用のHTTPハンドラには適用しない(e.g. /debug/pprof/ のHTML)。
+func WithSecurityHeaders(m middleware.HTTPMiddleware) Option {
+	return func(o *options) {
+		o.securityHeaders = m
+	}
+}
+
+// WithCompression は、公開用及び管理用のHTTPハンドラで、レスポンスの圧縮及びリクエストボディの展開を行うミドルウェアを設定する。
+func WithCompression(m middleware.HTTPMiddleware) Option {
+	return func(o *options) {
+		o.compression = m
+	}
+}
+
+// WithTimeout は、/api 以下のパスで、リクエスト毎に処理時間の上限を設けるミドルウェアを設定する。
+func WithTimeout(m middleware.HTTPMiddleware) Option {
+	return func(o *options) {
+		o.timeout = m
+	}
+}
+
+// WithPanicReporter は、リカバリしたpanicの通知先を設定する。
+func WithPanicReporter(r panicreport.Reporter) Option {
+	return func(o *options) {
+		o.panicReporter = r
+	}
+}
+
+// WithTODOEvents は、/api/todos/events で配信するTODOの変更のブローカー及びハートビートの間隔を設定する。
+//
+// 指定しない場合は、デフォルトの設定のブローカーを使用する。
+func WithTODOEvents(b *pubsub.Broker, heartbeat time.Duration) Option {
+	return func(o *options) {
+		o.events = b
+		o.heartbeat = heartbeat
+	}
+}
+
+// WithWebSocket は、/api/ws のWebSocketの設定を行う。
+//
+// cfg.CheckOrigin が nil の場合、同一オリジン及び [WithCORS] で許可したオリジンからの接続を許可する。
+func WithWebSocket(cfg handler.WebSocketConfig) Option {
+	return func(o *options) {
+		o.webSocket = cfg
+	}
+}
+
+// WithGraphQL は、/api/graphql 及び /api/graphql/stream のGraphQLの設定を行う。
+//
+// cfg.DefaultPageSize 及び cfg.Heartbeat が0の場合、 [WithDefaultPageSize] 及び [WithTODOEvents] の設定を使用する。
+func WithGraphQL(cfg handler.GraphQLConfig) Option {
+	return func(o *options) {
+		o.graphQL = cfg
+	}
+}
+
+// WithWebhooks は、/api/webhooks でWebhookを管理し、TODOの変更をWebhookの送信予定として svc に保存する。
+//
+// Webhookの送信予定は、 svc を Sink とする [WithOutbox] のリレーが保存する。
+// 保存したWebhookの送信には、 svc を Store とする webhook.Dispatcher を起動する必要がある。
+func WithWebhooks(svc *service.WebhookService) Option {
+	return func(o *options) {
+		o.webhooks = svc
+	}
+}
+
+// WithOutbox は、TODOの変更を r で配信する。変更をコミットする毎に r に通知し、ポーリングを待たずに配信させる。
+//
+// 設定した場合、/api/todos/events、/api/ws 及び /api/graphql/stream のブローカーには、 r の [service.BrokerSink] が配信する。
+// 設定しない場合は、変更をコミットした後にブローカーに直接配信する。
+func WithOutbox(r *outbox.Relay) Option {
+	return func(o *options) {
+		o.outbox = r
+	}
+}
+
+// checkOrigin は、WebSocketのハンドシェイクのOriginヘッダを検証する。
+//
+// ブラウザはWebSocketのハンドシェイクに資格情報を含めるため、別のオリジンのサイトから接続されないよう検証する必要がある。
+func (o *options) checkOrigin(r *http.Request) bool {
+	if websocket.SameOrigin(r) {
+		return true
+	}
+	c, ok := o.cors.(interface{ AllowOrigin(origin string) bool })
+	return ok && c.AllowOrigin(r.Header.Get("Origin"))
+}
+
+// WithLogLevel は、管理用のHTTPハンドラの /loglevel で、 level を参照及び変更できるようにする。
+func WithLogLevel(level *slog.LevelVar) Option {
+	return func(o *options) {
+		o.logLevel = level
+	}
+}
+
+// authMiddleware は、 auth による認証を行うミドルウェアを h に適用する。
+func (o *options) authMiddleware(h http.Handler, auth middleware.Authenticator) http.Handler {
+	if auth == nil {
+		return h
+	}
+	return middleware.With(h,
+		middleware.NewBasicAuthMiddlewareWithAuthenticator(auth),
+		o.clientCert,
+	)
+}
+
+// NewAdminHandler は、運用者向けのエンドポイントを設定したHTTPハンドラを返す。
+//
+// 認証を設定しないため、外部から到達できないアドレスで公開する必要がある。
+//
+// Deprecated: /metrics 以外の運用者向けのエンドポイントも提供する [NewHandlersWithAuthenticator] を使用して下さい。
+func NewAdminHandler(reg *metrics.Registry) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler(reg))
+	return mux
+}
+
+// NewHTTPSRedirectHandler は、全てのリクエストを httpsAddr で待ち受けるHTTPSサーバへリダイレクトするHTTPハンドラを返す。
+//
+// リダイレクト先のホスト名にはリクエストの Host ヘッダを使用し、ポート番号には httpsAddr のものを使用する。
+func NewHTTPSRedirectHandler(httpsAddr string) (http.Handler, error) {
+	_, port, err := net.SplitHostPort(httpsAddr)
+	if err != nil {
+		return nil, err
+	}
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		host := strings.TrimSuffix(strings.TrimPrefix(r.Host, "["), "]")
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		// NOTE: GET/HEAD 以外はメソッド及びボディを維持してリダイレクトさせるため、308を使用する。
+		code := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			code = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+	}
+	return http.HandlerFunc(fn), nil
+}
+
 // NewHandler は、ルーティングを設定したHTTPハンドラを返す。
-func NewHandler(todoDB *sql.DB) http.Handler {
+func NewHandler(todoDB *sql.DB, opts ...Option) http.Handler {
+	o := newOptions(opts)
 	return newHandler(todoDB,
 		nil,
-		middleware.NewAccessLogMiddleware(),
+		o,
+		o.accessLog,
 		middleware.NewUserAgentRecordMiddleware(),
-		middleware.NewRecoveryMiddleware(),
+		o.recoveryMiddleware(),
+		o.metricsMiddleware(o.routes),
+		o.tracingMiddleware(o.routes),
+		o.recoveryMiddleware(),
+		middleware.NewRequestIDMiddleware(),
 	)
 }
 
@@ -50,59 +461,305 @@ func NewHandler(todoDB *sql.DB) http.Handler {
 func NewHandlerWithBasicAuth(
 	todoDB *sql.DB,
 	userID, password string,
+	opts ...Option,
 ) (http.Handler, error) {
 	bai, err := basicauth.NewBasicAuthInfoWithRealm(
 		userID,
 		password,
-		"go-stations-api",
+		BasicAuthRealm,
 	)
 	if err != nil {
 		return nil, err
 	}
+	return NewHandlerWithAuthenticator(todoDB, bai, opts...), nil
+}
 
+// NewHandlerWithAuthenticator は、/api 以下のパスに auth による認証を設定したHTTPハンドラを返す。
+//
+// 実行中に認証情報を差し替える場合は、 auth に [basicauth.Store] を指定する。
+func NewHandlerWithAuthenticator(
+	todoDB *sql.DB,
+	auth middleware.Authenticator,
+	opts ...Option,
+) http.Handler {
+	return newAuthHandler(todoDB, auth, newOptions(opts))
+}
+
+// NewHandlersWithAuthenticator は、TODOのAPIのみを提供する公開用のHTTPハンドラと、
+// 運用者向けのエンドポイントを提供する管理用のHTTPハンドラを返す。
+//
+// 管理用のHTTPハンドラは、/metrics、/debug/pprof/、ヘルスチェック(/healthz, /livez, /readyz)、/version、
+// /loglevel( [WithLogLevel] を設定した場合)及び /do-panic を提供する。
+// 認証を設定しないため、外部から到達できないアドレス(e.g. localhost)で公開する必要がある。
+func NewHandlersWithAuthenticator(
+	todoDB *sql.DB,
+	auth middleware.Authenticator,
+	opts ...Option,
+) (public, admin http.Handler) {
+	o := newOptions(opts)
+	o.admin = newRoutes()
+	public = newAuthHandler(todoDB, auth, o)
+	// NOTE: 運用者向けのエンドポイントはトレースの対象としない(e.g. メトリクスの収集によるスパンを作成しない)。
+	admin = middleware.With(
+		o.admin.mux,
+		o.compression,
+		o.recoveryMiddleware(),
+		o.metricsMiddleware(o.admin),
+		o.accessLog,
+		middleware.NewUserAgentRecordMiddleware(),
+		o.recoveryMiddleware(),
+		middleware.NewRequestIDMiddleware(),
+	)
+	return public, admin
+}
+
+func newAuthHandler(todoDB *sql.DB, auth middleware.Authenticator, o *options) http.Handler {
 	// NOTE:
-	// RecoveryMiddleware より先に AccessLogMiddleware を評価する事で、
-	// panic発生時にもログを記録できる。
+	// RecoveryMiddleware より先に AccessLogMiddleware/MetricsMiddleware を評価する事で、
+	// panic発生時にもログ及びメトリクスを記録できる。
 	//
-	// AccessLogMiddleware/UserAgentRecordMiddleware で発生したpanicは、
-	// [net/http] のデフォルトのリカバリで処理される事に留意する。
+	// AccessLogMiddleware/UserAgentRecordMiddleware/TracingMiddleware で発生したpanicは、外側の RecoveryMiddleware で処理する。
+	// リクエストIDをエラーレスポンスに含めるため、RequestIDMiddleware のみ外側に残る。
 	return newHandler(todoDB,
-		bai,
-		middleware.NewRecoveryMiddleware(),
-		middleware.NewAccessLogMiddleware(),
+		auth,
+		o,
+		o.recoveryMiddleware(),
+		o.metricsMiddleware(o.routes),
+		o.accessLog,
 		middleware.NewUserAgentRecordMiddleware(),
-	), nil
+		o.tracingMiddleware(o.routes),
+		o.recoveryMiddleware(),
+		middleware.NewRequestIDMiddleware(),
+	)
 }
 
 func newHandler(
 	todoDB *sql.DB,
-	bai *basicauth.BasicAuthInfo,
+	auth middleware.Authenticator,
+	o *options,
 	ms ...middleware.HTTPMiddleware,
 ) http.Handler {
-	mux := http.NewServeMux()
+	handlerLogger := logging.Package(o.logger, "handler")
+	svcOpts := []service.Option{
+		service.WithLogger(logging.Package(o.logger, "service")),
+		service.WithTracer(o.tracer),
+		service.WithEventMetadata(todoEventMetadata),
+	}
+	if o.outbox != nil {
+		svcOpts = append(svcOpts, service.WithOutboxNotify(o.outbox.Notify))
+	} else {
+		svcOpts = append(svcOpts, service.WithPublisher(&todoEventPublisher{broker: o.events}))
+	}
+	svc := service.NewTODOService(todoDB, svcOpts...)
 
-	mux.Handle("/healthz", handler.NewHealthzHandler())
+	mux := o.routes.mux
+	// NOTE: 管理用のHTTPハンドラを分ける場合、運用者向けのエンドポイントは公開用のHTTPハンドラに設定しない。
+	ops := mux
+	if o.admin != nil {
+		ops = o.admin.mux
+	}
+
+	buildInfo := newBuildInfoFunc(todoDB, o.config, handlerLogger)
+	ops.Handle("/healthz", handler.NewHealthzHandlerWithBuildInfo(buildInfo, handlerLogger))
+	ops.Handle("/version", handler.NewVersionHandlerWithLogger(buildInfo, handlerLogger))
+
+	o.readiness.Register("db", health.PingDB(todoDB), 0)
+	o.readiness.Register("schema", health.CheckerFunc(func(ctx context.Context) error {
+		return db.CheckSchema(ctx, todoDB)
+	}), 0)
+	ops.Handle("/livez", handler.NewProbeHandlerWithLogger(o.liveness, handlerLogger))
+	ops.Handle("/readyz", handler.NewProbeHandlerWithLogger(o.readiness, handlerLogger))
 
 	// NOTE: 初級編の課題のテストが /todos に依存しているため、下記のパスは残したままとする
-	mux.Handle("/todos", handler.NewTODOHandler(service.NewTODOService(todoDB)))
+	mux.Handle("/todos", handler.NewTODOHandlerWithPageSize(svc, o.pageSize, handlerLogger))
 
 	// NOTE: 認証の範囲を限定する(e.g. ヘルスチェックには認証を設定したくない)ため、/api 以下のパスにのみ認証を設定する。
 	//
 	// Ref: https://forum.golangbridge.org/t/is-it-possible-to-combine-http-servemux/7495/4
-	api := http.NewServeMux()
-	api.Handle("/todos", handler.NewTODOHandler(service.NewTODOService(todoDB)))
-	api.Handle("/do-panic", handler.NewPanicHandler())
+	api := o.routes.api
+	api.Handle("/todos", handler.NewTODOHandlerWithPageSize(svc, o.pageSize, handlerLogger))
+	api.Handle("/todos/events", handler.NewTODOEventsHandlerWithHeartbeat(o.events, o.heartbeat, handlerLogger))
+	wsCfg := o.webSocket
+	if wsCfg.CheckOrigin == nil {
+		wsCfg.CheckOrigin = o.checkOrigin
+	}
+	api.Handle("/ws", handler.NewTODOWebSocketHandler(svc, o.events, wsCfg, handlerLogger))
+	gqlCfg := o.graphQL
+	if gqlCfg.DefaultPageSize == 0 {
+		gqlCfg.DefaultPageSize = int(o.pageSize)
+	}
+	if gqlCfg.Heartbeat == 0 {
+		gqlCfg.Heartbeat = o.heartbeat
+	}
+	gql := handler.NewGraphQLHandler(svc, o.events, gqlCfg, handlerLogger)
+	api.Handle("/graphql", gql)
+	api.Handle("/graphql/stream", gql.StreamHandler())
+	if o.webhooks != nil {
+		api.Handle("/webhooks", handler.NewWebhookHandler(o.webhooks, handlerLogger))
+		api.Handle("/webhooks/deliveries", handler.NewWebhookDeliveryHandler(o.webhooks, handlerLogger))
+	}
+	if o.admin == nil {
+		api.Handle("/do-panic", handler.NewPanicHandler())
+	}
 	h := http.StripPrefix("/api", api)
-	if bai != nil {
-		h = middleware.With(h, middleware.NewBasicAuthMiddleware(*bai))
+	// NOTE: 認証及びレート制限で拒否したリクエストには上限を設けない。
+	// ルールにはプレフィックスを除く前のパスを指定できるよう、 StripPrefix の前に評価する。
+	if o.timeout != nil {
+		h = middleware.With(h, o.timeout)
+	}
+	// NOTE: 認証済みのユーザ毎に制限できるよう、レート制限は認証の後に評価する。
+	if o.rateLimit != nil {
+		h = middleware.With(h, o.rateLimit)
+	}
+	// NOTE: ブラウザはプリフライトリクエストに資格情報を含めないため、CORSは認証の前に評価する。
+	// 認証情報を含むレスポンスはキャッシュさせない。
+	// 認証に失敗したリクエストも制限できるよう、IPアドレス毎のレート制限は認証の前に評価する。
+	mux.Handle("/api/", middleware.With(o.authMiddleware(h, auth), o.ipRateLimit, o.cors, middleware.NewNoStoreMiddleware()))
+
+	if o.metrics != nil {
+		registerMetrics(o.metrics, todoDB, svc, o.events, logging.Package(o.logger, "handler/router"))
+		if o.metricsEndpoint && o.admin == nil {
+			mux.Handle("/metrics", o.authMiddleware(metrics.Handler(o.metrics), auth))
+		}
+	}
+
+	if o.admin != nil {
+		registerAdminRoutes(o.admin.mux, o, handlerLogger)
 	}
-	mux.Handle("/api/", h)
 
 	// *http.ServeMux は http.Handler インターフェースを満たすため、他のハンドラ同様ミドルウェアが適用できる。
 	//
 	// Ref: https://blog.afoolishmanifesto.com/posts/nesting-middleware-in-golang/
+	//
+	// NOTE:
+	// セキュリティ関連のヘッダは、ヘッダを共有する RecoveryMiddleware のエラーレスポンスにも付与される。
+	// 圧縮はハンドラに最も近い位置で行い、アクセスログ及びメトリクスには圧縮後のサイズを記録する。
 	return middleware.With(
-		mux,
+		middleware.With(mux, o.compression, o.securityHeaders),
 		ms...,
 	)
 }
+
+// registerAdminRoutes は、運用者向けのエンドポイントのうち、ヘルスチェック等の公開用と共通のもの以外を mux に設定する。
+func registerAdminRoutes(mux *http.ServeMux, o *options, logger *slog.Logger) {
+	mux.Handle("/do-panic", handler.NewPanicHandler())
+	if o.metrics != nil {
+		mux.Handle("/metrics", metrics.Handler(o.metrics))
+	}
+	if o.logLevel != nil {
+		mux.Handle("/loglevel", handler.NewLogLevelHandlerWithLogger(o.logLevel, logger))
+	}
+
+	// NOTE: net/http/pprof は http.DefaultServeMux にも登録するが、サーバでは使用しない。
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
+// newBuildInfoFunc は、ビルド情報にDBのスキーマのバージョン等の実行時の情報を加えて返す関数を返す。
+func newBuildInfoFunc(todoDB *sql.DB, config func() map[string]string, logger *slog.Logger) handler.BuildInfoFunc {
+	info := buildinfo.Read()
+	return func(ctx context.Context) *model.BuildInfo {
+		version, err := db.ReadSchemaVersion(ctx, todoDB)
+		if err != nil {
+			logger.WarnContext(ctx, "could not read schema version", slog.Any("err", err))
+		}
+		return &model.BuildInfo{
+			Version:       info.Version,
+			Revision:      info.Revision,
+			Dirty:         info.Dirty,
+			GoVersion:     info.GoVersion,
+			StartTime:     info.StartTime,
+			UptimeSeconds: info.Uptime().Seconds(),
+			SchemaVersion: version,
+			Config:        configOf(config),
+		}
+	}
+}
+
+// registerMetrics は、DB、TODO及びビルド情報に関するメトリクスを reg に登録する。
+//
+// 同じ reg で複数回ハンドラを作成してもpanicしないよう、登録済みのメトリクスは置き換える。
+// そのため、最後に作成したハンドラのDB及びサービスの値を出力する。
+func registerMetrics(reg *metrics.Registry, todoDB *sql.DB, svc *service.TODOService, events *pubsub.Broker, logger *slog.Logger) {
+	const countTimeout = time.Second
+
+	for _, c := range metrics.NewDBStatsCollectors(todoDB) {
+		reg.Replace(c)
+	}
+
+	info := buildinfo.Read()
+	reg.Replace(metrics.NewCollectorFunc(
+		"build_info",
+		"A metric with a constant '1' value labeled by version, revision and goversion from which the server was built.",
+		metrics.TypeGauge,
+		func() []metrics.Sample {
+			return []metrics.Sample{{
+				Labels: metrics.Labels{
+					"version":   info.Version,
+					"revision":  info.Revision,
+					"goversion": info.GoVersion,
+				},
+				Value: 1,
+			}}
+		},
+	))
+	reg.Replace(metrics.NewCollectorFunc(
+		"todos",
+		"The number of TODOs.",
+		metrics.TypeGauge,
+		func() []metrics.Sample {
+			ctx, cancel := context.WithTimeout(context.Background(), countTimeout)
+			defer cancel()
+
+			num, err := svc.CountTODO(ctx)
+			if err != nil {
+				// NOTE: 値を取得できない場合は、古い値を出力しないよう系列ごと出力しない。
+				logger.Warn("could not count todos", slog.Any("err", err))
+				return nil
+			}
+			return []metrics.Sample{{Value: float64(num)}}
+		},
+	))
+	reg.Replace(metrics.NewCollectorFunc(
+		"todo_event_subscribers",
+		"The number of clients receiving TODO events from /api/todos/events, /api/ws or /api/graphql/stream.",
+		metrics.TypeGauge,
+		func() []metrics.Sample {
+			return []metrics.Sample{{Value: float64(events.Subscribers())}}
+		},
+	))
+	reg.Replace(metrics.NewCollectorFunc(
+		"todo_event_slow_subscribers_total",
+		"The total number of TODO event subscriptions closed because the client could not keep up.",
+		metrics.TypeCounter,
+		func() []metrics.Sample {
+			return []metrics.Sample{{Value: float64(events.Dropped())}}
+		},
+	))
+}
+
+// todoEventMetadata は、TODOを変更したユーザのID及び接続の識別子を返す。
+func todoEventMetadata(ctx context.Context) (user, source string) {
+	user, _ = ctx.Value(middleware.AuthContextKeyUser).(string)
+	return user, pubsub.SourceFromContext(ctx)
+}
+
+// todoEventPublisher は、TODOの変更を、変更したユーザのIDと共にブローカーに配信する。
+type todoEventPublisher struct {
+	broker *pubsub.Broker
+}
+
+// Publish は、 [service.Publisher] を実装する。
+func (p *todoEventPublisher) Publish(ctx context.Context, e model.TODOEvent) {
+	p.broker.Publish(pubsub.Event{Type: e.Type, User: e.User, Source: pubsub.SourceFromContext(ctx), Data: e})
+}
+
+func configOf(fn func() map[string]string) map[string]string {
+	if fn == nil {
+		return nil
+	}
+	return fn()
+}
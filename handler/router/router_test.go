@@ -0,0 +1,125 @@
+package router_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/db"
+	"github.com/TechBowl-japan/go-stations/handler/router"
+	"github.com/TechBowl-japan/go-stations/pkg/basicauth"
+	"github.com/TechBowl-japan/go-stations/pkg/metrics"
+)
+
+func TestNewHandlerSharedMetrics(t *testing.T) {
+	t.Parallel()
+
+	reg := metrics.NewRegistry()
+	var handlers []http.Handler
+	// NOTE: 同じ Registry で複数回ハンドラを作成してもpanicしない。
+	for _, name := range []string{"first.db", "second.db"} {
+		todoDB, err := db.NewDB(filepath.Join(t.TempDir(), name))
+		if err != nil {
+			t.Fatal("DBの作成に失敗しました:", err)
+		}
+		t.Cleanup(func() {
+			todoDB.Close()
+		})
+		handlers = append(handlers, router.NewHandler(todoDB, router.WithMetrics(reg)))
+	}
+
+	for _, h := range handlers {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	}
+
+	var b strings.Builder
+	if err := reg.WriteText(&b); err != nil {
+		t.Fatalf("メトリクスの出力に失敗しました: %v", err)
+	}
+	for _, want := range []string{
+		// NOTE: HTTPリクエストのメトリクスは、ハンドラ間で共有する。
+		`http_requests_total{method="GET",route="/healthz",status="200"} 2`,
+		"\ntodos 0\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("%q が出力されていません, got = %s", want, b.String())
+		}
+	}
+	if n := strings.Count(b.String(), "# TYPE todos "); n != 1 {
+		t.Errorf("メトリクスが重複して出力されています, got = %d", n)
+	}
+}
+
+func TestNewHandlersWithAuthenticatorSplitsAdminRoutes(t *testing.T) {
+	t.Parallel()
+
+	todoDB, err := db.NewDB(filepath.Join(t.TempDir(), "router_test.db"))
+	if err != nil {
+		t.Fatal("DBの作成に失敗しました:", err)
+	}
+	t.Cleanup(func() {
+		todoDB.Close()
+	})
+	auth, err := basicauth.NewBasicAuthInfoWithRealm("user", "pass", router.BasicAuthRealm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, admin := router.NewHandlersWithAuthenticator(todoDB, auth,
+		router.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		router.WithAccessLog(nil),
+		router.WithMetrics(metrics.NewRegistry()),
+		router.WithMetricsEndpoint(),
+		router.WithLogLevel(new(slog.LevelVar)),
+	)
+
+	cases := map[string]struct {
+		method     string
+		path       string
+		wantPublic int
+		wantAdmin  int
+	}{
+		"Metrics":          {method: http.MethodGet, path: "/metrics", wantPublic: http.StatusNotFound, wantAdmin: http.StatusOK},
+		"Pprof":            {method: http.MethodGet, path: "/debug/pprof/", wantPublic: http.StatusNotFound, wantAdmin: http.StatusOK},
+		"Log Level":        {method: http.MethodGet, path: "/loglevel", wantPublic: http.StatusNotFound, wantAdmin: http.StatusOK},
+		"Log Level Post":   {method: http.MethodPost, path: "/loglevel", wantPublic: http.StatusNotFound, wantAdmin: http.StatusMethodNotAllowed},
+		"Healthz":          {method: http.MethodGet, path: "/healthz", wantPublic: http.StatusNotFound, wantAdmin: http.StatusOK},
+		"Livez":            {method: http.MethodGet, path: "/livez", wantPublic: http.StatusNotFound, wantAdmin: http.StatusOK},
+		"Readyz":           {method: http.MethodGet, path: "/readyz", wantPublic: http.StatusNotFound, wantAdmin: http.StatusOK},
+		"Readyz Post":      {method: http.MethodPost, path: "/readyz", wantPublic: http.StatusNotFound, wantAdmin: http.StatusMethodNotAllowed},
+		"Version":          {method: http.MethodGet, path: "/version", wantPublic: http.StatusNotFound, wantAdmin: http.StatusOK},
+		"API Do Panic":     {method: http.MethodGet, path: "/api/do-panic", wantPublic: http.StatusNotFound, wantAdmin: http.StatusNotFound},
+		"TODOs":            {method: http.MethodGet, path: "/api/todos", wantPublic: http.StatusOK, wantAdmin: http.StatusNotFound},
+		"Legacy TODOs":     {method: http.MethodGet, path: "/todos", wantPublic: http.StatusOK, wantAdmin: http.StatusNotFound},
+		"Do Panic":         {method: http.MethodGet, path: "/do-panic", wantPublic: http.StatusNotFound, wantAdmin: http.StatusInternalServerError},
+		"Unknown API Path": {method: http.MethodGet, path: "/api/metrics", wantPublic: http.StatusNotFound, wantAdmin: http.StatusNotFound},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			for _, h := range []struct {
+				name    string
+				handler http.Handler
+				want    int
+			}{
+				{name: "public", handler: public, want: c.wantPublic},
+				{name: "admin", handler: admin, want: c.wantAdmin},
+			} {
+				req := httptest.NewRequest(c.method, c.path, nil)
+				// NOTE: 認証で拒否されず、ルーティングの結果を確認できるよう、資格情報を付与する。
+				req.SetBasicAuth("user", "pass")
+				rec := httptest.NewRecorder()
+				h.handler.ServeHTTP(rec, req)
+				if rec.Code != h.want {
+					t.Errorf("%s: 期待していないステータスコードです, got = %d, want = %d", h.name, rec.Code, h.want)
+				}
+			}
+		})
+	}
+}
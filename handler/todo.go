@@ -4,23 +4,43 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/pkg/httperror"
 	"github.com/TechBowl-japan/go-stations/service"
 )
 
+// DefaultPageSize is the number of TODOs returned when the size parameter is omitted.
+const DefaultPageSize = 5
+
 // A TODOHandler implements handling REST endpoints.
 type TODOHandler struct {
-	svc *service.TODOService
+	svc         *service.TODOService
+	logger      *slog.Logger
+	defaultSize int64
 }
 
 // NewTODOHandler returns TODOHandler based http.Handler.
 func NewTODOHandler(svc *service.TODOService) *TODOHandler {
+	return NewTODOHandlerWithLogger(svc, slog.Default())
+}
+
+// NewTODOHandlerWithLogger returns TODOHandler which writes logs to logger.
+func NewTODOHandlerWithLogger(svc *service.TODOService, logger *slog.Logger) *TODOHandler {
+	return NewTODOHandlerWithPageSize(svc, DefaultPageSize, logger)
+}
+
+// NewTODOHandlerWithPageSize returns TODOHandler which returns size TODOs
+// when the size parameter is omitted.
+func NewTODOHandlerWithPageSize(svc *service.TODOService, size int64, logger *slog.Logger) *TODOHandler {
 	return &TODOHandler{
-		svc: svc,
+		svc:         svc,
+		logger:      logger,
+		defaultSize: size,
 	}
 }
 
@@ -34,16 +54,16 @@ func (h *TODOHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if q.Get("prev_id") != "" {
 			prevID, err = strconv.ParseInt(q.Get("prev_id"), 10, 64)
 			if err != nil {
-				w.WriteHeader(http.StatusBadRequest)
+				httperror.Write(w, r, http.StatusBadRequest)
 				return
 			}
 		}
 
-		size = 5
+		size = h.defaultSize
 		if q.Get("size") != "" {
 			size, err = strconv.ParseInt(q.Get("size"), 10, 64)
 			if err != nil {
-				w.WriteHeader(http.StatusBadRequest)
+				httperror.Write(w, r, http.StatusBadRequest)
 				return
 			}
 		}
@@ -54,7 +74,8 @@ func (h *TODOHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 		todoRes, err := h.Read(r.Context(), &todoReq)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			h.logger.WarnContext(r.Context(), "could not read todos", slog.Any("err", err))
+			httperror.Write(w, r, http.StatusBadRequest)
 			return
 		}
 
@@ -65,14 +86,15 @@ func (h *TODOHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		var todoReq model.CreateTODORequest
 		json.NewDecoder(r.Body).Decode(&todoReq)
 
-		if todoReq.Subject == "" {
-			w.WriteHeader(http.StatusBadRequest)
+		if !validCreate(&todoReq) {
+			httperror.Write(w, r, http.StatusBadRequest)
 			return
 		}
 
 		todoRes, err := h.Create(r.Context(), &todoReq)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
+			h.logger.WarnContext(r.Context(), "could not create todo", slog.Any("err", err))
+			httperror.Write(w, r, http.StatusBadRequest)
 			return
 		}
 
@@ -83,21 +105,19 @@ func (h *TODOHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		var todoReq model.UpdateTODORequest
 		json.NewDecoder(r.Body).Decode(&todoReq)
 
-		if todoReq.Subject == "" || todoReq.ID == 0 {
-			w.WriteHeader(http.StatusBadRequest)
+		if !validUpdate(&todoReq) {
+			httperror.Write(w, r, http.StatusBadRequest)
 			return
 		}
 
 		todoRes, err := h.Update(r.Context(), &todoReq)
 		if err != nil {
-			var verr model.ErrNotFound
-			if errors.Is(err, &verr) {
-				w.WriteHeader(http.StatusNotFound)
-				return
-			} else {
-				w.WriteHeader(http.StatusBadRequest)
-				return
+			status := errorStatus(err)
+			if status != http.StatusNotFound {
+				h.logger.WarnContext(r.Context(), "could not update todo", slog.Any("err", err))
 			}
+			httperror.Write(w, r, status)
+			return
 		}
 
 		if err := json.NewEncoder(w).Encode(todoRes); err != nil {
@@ -107,26 +127,27 @@ func (h *TODOHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		var todoReq model.DeleteTODORequest
 		json.NewDecoder(r.Body).Decode(&todoReq)
 
-		if len(todoReq.IDs) == 0 {
-			w.WriteHeader(http.StatusBadRequest)
+		if !validDelete(&todoReq) {
+			httperror.Write(w, r, http.StatusBadRequest)
 			return
 		}
 
 		todoRes, err := h.Delete(r.Context(), &todoReq)
 		if err != nil {
-			var verr model.ErrNotFound
-			if errors.Is(err, &verr) {
-				w.WriteHeader(http.StatusNotFound)
-				return
-			} else {
-				w.WriteHeader(http.StatusBadRequest)
-				return
+			status := errorStatus(err)
+			if status != http.StatusNotFound {
+				h.logger.WarnContext(r.Context(), "could not delete todos", slog.Any("err", err))
 			}
+			httperror.Write(w, r, status)
+			return
 		}
 
 		if err := json.NewEncoder(w).Encode(todoRes); err != nil {
 			w.WriteHeader(http.StatusBadRequest)
 		}
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+		httperror.Write(w, r, http.StatusMethodNotAllowed)
 	}
 }
 
@@ -170,3 +191,27 @@ func (h *TODOHandler) Delete(ctx context.Context, req *model.DeleteTODORequest)
 	}
 	return &model.DeleteTODOResponse{}, nil
 }
+
+// validCreate reports whether req has the required fields.
+func validCreate(req *model.CreateTODORequest) bool {
+	return req.Subject != ""
+}
+
+// validUpdate reports whether req has the required fields.
+func validUpdate(req *model.UpdateTODORequest) bool {
+	return req.Subject != "" && req.ID != 0
+}
+
+// validDelete reports whether req has the required fields.
+func validDelete(req *model.DeleteTODORequest) bool {
+	return len(req.IDs) != 0
+}
+
+// errorStatus returns the status of the error returned by TODOService.
+func errorStatus(err error) int {
+	var nerr *model.ErrNotFound
+	if errors.As(err, &nerr) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
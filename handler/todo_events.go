@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/pkg/httperror"
+	"github.com/TechBowl-japan/go-stations/pkg/pubsub"
+	"github.com/TechBowl-japan/go-stations/pkg/shutdown"
+)
+
+// DefaultHeartbeatInterval is the interval of comments keeping idle event streams alive through proxies.
+const DefaultHeartbeatInterval = 15 * time.Second
+
+// eventWriteTimeout is the maximum time to write each event, which disconnects clients not reading the stream.
+const eventWriteTimeout = 10 * time.Second
+
+// A TODOEventsHandler streams the changes of TODOs as Server-Sent Events.
+//
+// Ref: https://html.spec.whatwg.org/multipage/server-sent-events.html
+type TODOEventsHandler struct {
+	broker    *pubsub.Broker
+	heartbeat time.Duration
+	logger    *slog.Logger
+}
+
+// NewTODOEventsHandler returns TODOEventsHandler streaming the events published to broker.
+func NewTODOEventsHandler(broker *pubsub.Broker, logger *slog.Logger) *TODOEventsHandler {
+	return NewTODOEventsHandlerWithHeartbeat(broker, DefaultHeartbeatInterval, logger)
+}
+
+// NewTODOEventsHandlerWithHeartbeat returns TODOEventsHandler which sends a heartbeat every interval.
+func NewTODOEventsHandlerWithHeartbeat(broker *pubsub.Broker, interval time.Duration, logger *slog.Logger) *TODOEventsHandler {
+	return &TODOEventsHandler{
+		broker:    broker,
+		heartbeat: interval,
+		logger:    logger,
+	}
+}
+
+// ServeHTTP streams the events until the client disconnects or the server shuts down.
+//
+// Clients resume from the Last-Event-ID header, which browsers send on reconnection.
+// A reset event tells that some events are no longer available and the TODOs must be read again.
+// The user query parameter, which may be repeated or comma separated, limits the events to the changes by those users.
+func (h *TODOEventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		httperror.Write(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var after uint64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			httperror.Write(w, r, http.StatusBadRequest)
+			return
+		}
+		after = id
+	}
+
+	sub := h.broker.Subscribe(after, userFilter(r.URL.Query()["user"]))
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	// NOTE: Disables buffering by reverse proxies such as nginx.
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	write := newStreamWriter(w)
+	// NOTE: Flushes the headers so that the client knows the stream has started before the first event.
+	if err := write(func(io.Writer) error { return nil }); err != nil {
+		return
+	}
+
+	if sub.Lost {
+		if err := write(func(w io.Writer) error {
+			_, err := io.WriteString(w, "event: reset\ndata: {}\n\n")
+			return err
+		}); err != nil {
+			return
+		}
+	}
+	for _, e := range sub.Replay {
+		if err := write(func(w io.Writer) error { return writeEvent(w, e) }); err != nil {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(h.heartbeat)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case e := <-sub.C():
+			err = write(func(w io.Writer) error { return writeEvent(w, e) })
+		case <-ticker.C:
+			err = write(func(w io.Writer) error {
+				_, err := io.WriteString(w, ": heartbeat\n\n")
+				return err
+			})
+		case <-sub.Done():
+			// NOTE: The client reconnects and resumes from the replay buffer.
+			h.logger.InfoContext(r.Context(), "event stream closed", slog.Any("err", sub.Err()))
+			return
+		case <-shutdown.Done(r.Context()):
+			return
+		case <-r.Context().Done():
+			return
+		}
+		if err != nil {
+			h.logger.DebugContext(r.Context(), "could not write event", slog.Any("err", err))
+			return
+		}
+	}
+}
+
+// newStreamWriter returns the function writing to the event stream w by fn and flushing it.
+func newStreamWriter(w http.ResponseWriter) func(fn func(w io.Writer) error) error {
+	rc := http.NewResponseController(w)
+	return func(fn func(w io.Writer) error) error {
+		// NOTE: Streams outlive the server write timeout, so the deadline is extended for each write.
+		if err := rc.SetWriteDeadline(time.Now().Add(eventWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		if err := fn(w); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+}
+
+// writeEvent writes e in the event stream format.
+func writeEvent(w io.Writer, e pubsub.Event) error {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
+
+// userFilter returns the filter of the events by the users, or nil to receive all events.
+func userFilter(values []string) func(pubsub.Event) bool {
+	users := make(map[string]bool)
+	for _, v := range values {
+		for _, u := range strings.Split(v, ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				users[u] = true
+			}
+		}
+	}
+	if len(users) == 0 {
+		return nil
+	}
+	return func(e pubsub.Event) bool {
+		return users[e.User]
+	}
+}
@@ -0,0 +1,347 @@
+package handler_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/handler"
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/pkg/pubsub"
+	"github.com/TechBowl-japan/go-stations/pkg/shutdown"
+	"github.com/google/go-cmp/cmp"
+)
+
+// eventsServer は、 /api/todos/events のテスト用のサーバである。
+type eventsServer struct {
+	*httptest.Server
+	broker   *pubsub.Broker
+	notifier *shutdown.Notifier
+}
+
+func newEventsServer(t *testing.T, cfg pubsub.Config, heartbeat time.Duration) *eventsServer {
+	t.Helper()
+
+	broker := pubsub.NewBroker(cfg)
+	h := handler.NewTODOEventsHandlerWithHeartbeat(broker, heartbeat, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	n := shutdown.NewNotifier()
+	srv := httptest.NewUnstartedServer(h)
+	n.Register(srv.Config)
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return &eventsServer{Server: srv, broker: broker, notifier: n}
+}
+
+// publish は、 user による type の [model.TODOEvent] を配信する。
+func (s *eventsServer) publish(typ, user string) pubsub.Event {
+	return s.broker.Publish(pubsub.Event{Type: typ, User: user, Data: model.TODOEvent{Type: typ, User: user}})
+}
+
+// sseFrame は、イベントストリームの1つのフレームである。
+type sseFrame struct {
+	ID      string
+	Event   string
+	Data    string
+	Comment string
+}
+
+// sseStream は、テスト用のイベントストリームのクライアントである。
+type sseStream struct {
+	resp *http.Response
+	br   *bufio.Reader
+}
+
+// getEvents は、 query 及び Last-Event-ID の lastEventID で購読を開始する。 lastEventID が空の場合は送信しない。
+func getEvents(t *testing.T, srv *eventsServer, query, lastEventID string) *sseStream {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		resp.Body.Close()
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("期待していないステータスコードです, got = %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("期待していない Content-Type です, got = %s", got)
+	}
+	return &sseStream{resp: resp, br: bufio.NewReader(resp.Body)}
+}
+
+// next は、次のフレームを返す。
+func (s *sseStream) next(t *testing.T) sseFrame {
+	t.Helper()
+
+	type result struct {
+		f   sseFrame
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		var f sseFrame
+		for {
+			line, err := s.br.ReadString('\n')
+			if err != nil {
+				ch <- result{err: err}
+				return
+			}
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				ch <- result{f: f}
+				return
+			}
+			switch {
+			case strings.HasPrefix(line, ":"):
+				f.Comment = strings.TrimSpace(line[1:])
+			case strings.HasPrefix(line, "id: "):
+				f.ID = line[len("id: "):]
+			case strings.HasPrefix(line, "event: "):
+				f.Event = line[len("event: "):]
+			case strings.HasPrefix(line, "data: "):
+				f.Data = line[len("data: "):]
+			}
+		}
+	}()
+
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			t.Fatal("フレームの受信に失敗しました:", r.err)
+		}
+		return r.f
+	case <-time.After(5 * time.Second):
+		s.resp.Body.Close()
+		t.Fatal("フレームを受信できませんでした")
+		return sseFrame{}
+	}
+}
+
+// nextEvent は、ハートビートを読み飛ばして次のイベントを返す。
+func (s *sseStream) nextEvent(t *testing.T) sseFrame {
+	t.Helper()
+
+	for {
+		if f := s.next(t); f.Comment == "" {
+			return f
+		}
+	}
+}
+
+func TestTODOEventsLastEventID(t *testing.T) {
+	t.Parallel()
+
+	// NOTE: ReplaySize が2のため、4つのイベントを配信した後は3番目以降のみ再送できる。
+	cases := map[string]struct {
+		lastEventID string
+		want        []sseFrame
+	}{
+		"Replay": {
+			lastEventID: "2",
+			want: []sseFrame{
+				{ID: "3", Event: model.TODOEventUpdated, Data: `{"type":"updated","user":"3"}`},
+				{ID: "4", Event: model.TODOEventDeleted, Data: `{"type":"deleted","user":"4"}`},
+			},
+		},
+		"Up To Date": {
+			lastEventID: "4",
+		},
+		"Out Of Replay Buffer": {
+			lastEventID: "1",
+			want:        []sseFrame{{Event: "reset", Data: "{}"}},
+		},
+		"Before Restart": {
+			lastEventID: "100",
+			want:        []sseFrame{{Event: "reset", Data: "{}"}},
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := newEventsServer(t, pubsub.Config{ReplaySize: 2}, time.Hour)
+			srv.publish(model.TODOEventCreated, "1")
+			srv.publish(model.TODOEventCreated, "2")
+			srv.publish(model.TODOEventUpdated, "3")
+			srv.publish(model.TODOEventDeleted, "4")
+
+			stream := getEvents(t, srv, "/", c.lastEventID)
+			// NOTE: 購読の開始後に配信したイベントが再送の直後に届く事で、余分なフレームが無い事を確認する。
+			srv.publish(model.TODOEventCreated, "5")
+			want := append(c.want, sseFrame{ID: "5", Event: model.TODOEventCreated, Data: `{"type":"created","user":"5"}`})
+
+			var got []sseFrame
+			for range want {
+				got = append(got, stream.nextEvent(t))
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("期待していないフレームです (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTODOEventsInvalidRequest(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		method      string
+		lastEventID string
+		wantStatus  int
+		wantAllow   string
+	}{
+		"Non Numeric Last-Event-ID": {
+			method:      http.MethodGet,
+			lastEventID: "abc",
+			wantStatus:  http.StatusBadRequest,
+		},
+		"Negative Last-Event-ID": {
+			method:      http.MethodGet,
+			lastEventID: "-1",
+			wantStatus:  http.StatusBadRequest,
+		},
+		"POST": {
+			method:     http.MethodPost,
+			wantStatus: http.StatusMethodNotAllowed,
+			wantAllow:  "GET",
+		},
+		"DELETE": {
+			method:     http.MethodDelete,
+			wantStatus: http.StatusMethodNotAllowed,
+			wantAllow:  "GET",
+		},
+	}
+
+	srv := newEventsServer(t, pubsub.Config{}, time.Hour)
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			req, err := http.NewRequest(c.method, srv.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", c.lastEventID)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != c.wantStatus {
+				t.Errorf("期待していないステータスコードです, got = %d, want = %d", resp.StatusCode, c.wantStatus)
+			}
+			if got := resp.Header.Get("Allow"); got != c.wantAllow {
+				t.Errorf("期待していない Allow ヘッダです, got = %q, want = %q", got, c.wantAllow)
+			}
+			var res model.ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+				t.Fatal("エラーレスポンスではありません:", err)
+			}
+		})
+	}
+}
+
+func TestTODOEventsUserFilter(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		query string
+		want  []string
+	}{
+		"Repeated": {
+			query: "/?user=a&user=b",
+			want:  []string{"a", "b"},
+		},
+		"Comma Separated": {
+			query: "/?user=a,%20b",
+			want:  []string{"a", "b"},
+		},
+		"Empty": {
+			query: "/?user=",
+			want:  []string{"a", "c", "b"},
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := newEventsServer(t, pubsub.Config{}, time.Hour)
+			stream := getEvents(t, srv, c.query, "")
+			for _, u := range []string{"a", "c", "b"} {
+				srv.publish(model.TODOEventCreated, u)
+			}
+
+			var got []string
+			for range c.want {
+				var e model.TODOEvent
+				if err := json.Unmarshal([]byte(stream.nextEvent(t).Data), &e); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, e.User)
+			}
+			if diff := cmp.Diff(c.want, got); diff != "" {
+				t.Errorf("期待していないユーザのイベントです (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTODOEventsHeartbeat(t *testing.T) {
+	t.Parallel()
+
+	srv := newEventsServer(t, pubsub.Config{}, 10*time.Millisecond)
+	stream := getEvents(t, srv, "/", "")
+
+	if f := stream.next(t); f.Comment != "heartbeat" {
+		t.Errorf("ハートビートではありません, got = %+v", f)
+	}
+}
+
+func TestTODOEventsShutdown(t *testing.T) {
+	t.Parallel()
+
+	srv := newEventsServer(t, pubsub.Config{}, time.Hour)
+	stream := getEvents(t, srv, "/", "")
+	srv.notifier.Notify()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.Discard, stream.br)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("ストリームが正常に終了していません: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("シャットダウンの開始後もストリームが終了しません")
+	}
+	if n := srv.broker.Subscribers(); n != 0 {
+		t.Errorf("購読が解除されていません, got = %d", n)
+	}
+}
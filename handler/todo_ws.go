@@ -0,0 +1,363 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/pkg/httperror"
+	"github.com/TechBowl-japan/go-stations/pkg/pubsub"
+	"github.com/TechBowl-japan/go-stations/pkg/requestid"
+	"github.com/TechBowl-japan/go-stations/pkg/shutdown"
+	"github.com/TechBowl-japan/go-stations/pkg/websocket"
+	"github.com/TechBowl-japan/go-stations/service"
+)
+
+// A WebSocketConfig configures TODOWebSocketHandler. Zero values are replaced with the defaults.
+type WebSocketConfig struct {
+	// MaxMessageSize is the maximum size of each command in bytes. Defaults to 64KiB.
+	MaxMessageSize int64
+	// PingInterval is the interval of pings keeping idle connections alive. Defaults to 30s.
+	PingInterval time.Duration
+	// PongTimeout is the maximum time without any message or pong from the client. Defaults to twice PingInterval.
+	PongTimeout time.Duration
+	// SendBuffer is the number of messages queued for each client. Slower clients are disconnected. Defaults to 64.
+	SendBuffer int
+	// CommandTimeout is the maximum processing time of each command. Defaults to 10s.
+	CommandTimeout time.Duration
+	// CheckOrigin reports whether the handshake from the Origin is allowed. Defaults to websocket.SameOrigin.
+	CheckOrigin func(r *http.Request) bool
+}
+
+// A TODOWebSocketHandler lets clients edit TODOs and receive the changes by others over a WebSocket.
+type TODOWebSocketHandler struct {
+	todo   *TODOHandler
+	broker *pubsub.Broker
+	cfg    WebSocketConfig
+	logger *slog.Logger
+}
+
+// NewTODOWebSocketHandler returns TODOWebSocketHandler which changes TODOs by svc and
+// sends the events published to broker.
+func NewTODOWebSocketHandler(svc *service.TODOService, broker *pubsub.Broker, cfg WebSocketConfig, logger *slog.Logger) *TODOWebSocketHandler {
+	if cfg.MaxMessageSize <= 0 {
+		cfg.MaxMessageSize = websocket.DefaultMaxMessageSize
+	}
+	if cfg.PingInterval <= 0 {
+		cfg.PingInterval = 30 * time.Second
+	}
+	if cfg.PongTimeout <= 0 {
+		cfg.PongTimeout = 2 * cfg.PingInterval
+	}
+	if cfg.SendBuffer <= 0 {
+		cfg.SendBuffer = 64
+	}
+	if cfg.CommandTimeout <= 0 {
+		cfg.CommandTimeout = 10 * time.Second
+	}
+	return &TODOWebSocketHandler{
+		todo:   NewTODOHandlerWithLogger(svc, logger),
+		broker: broker,
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// ServeHTTP upgrades the connection and processes the commands until either side closes it.
+//
+// Commands are processed in order, and each is answered by an ack or an error with the same ID.
+// After a subscribe command, the changes by other connections are sent as events. The changes made
+// through this connection are only acknowledged.
+func (h *TODOWebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Upgrade(w, r, websocket.Config{
+		MaxMessageSize: h.cfg.MaxMessageSize,
+		CheckOrigin:    h.cfg.CheckOrigin,
+	})
+	if err != nil {
+		h.logger.DebugContext(r.Context(), "could not upgrade to websocket", slog.Any("err", err))
+		return
+	}
+	defer conn.Close()
+
+	s := &wsSession{
+		h: h,
+		r: r,
+		// NOTE: The connection outlives the deadline of the request (e.g. TimeoutMiddleware), and is closed
+		// by the client or on shutdown instead.
+		ctx:     context.WithoutCancel(r.Context()),
+		conn:    conn,
+		source:  requestid.New(),
+		send:    make(chan *model.WebSocketMessage, h.cfg.SendBuffer),
+		closing: make(chan *websocket.CloseError, 1),
+		done:    make(chan struct{}),
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.writeLoop()
+	}()
+
+	err = s.readLoop()
+	close(s.done)
+	s.unsubscribe()
+	// NOTE: Unblocks the writer waiting for a client which stopped reading.
+	conn.Close()
+	wg.Wait()
+
+	var ce *websocket.CloseError
+	if errors.As(err, &ce) {
+		h.logger.DebugContext(r.Context(), "websocket closed", slog.Int("code", ce.Code), slog.String("reason", ce.Reason))
+	} else {
+		h.logger.DebugContext(r.Context(), "websocket disconnected", slog.Any("err", err))
+	}
+}
+
+// wsSession is the state of a WebSocket connection.
+type wsSession struct {
+	h    *TODOWebSocketHandler
+	r    *http.Request
+	ctx  context.Context
+	conn *websocket.Conn
+	// source identifies the changes through this connection in the events.
+	source string
+	send   chan *model.WebSocketMessage
+	// closing requests the writer to send a close frame. Only the first request is sent.
+	closing chan *websocket.CloseError
+	// done is closed when the reader stops.
+	done chan struct{}
+
+	mu  sync.Mutex
+	sub *pubsub.Subscription
+}
+
+// readLoop processes the commands until the connection is closed.
+func (s *wsSession) readLoop() error {
+	extend := func() {
+		_ = s.conn.SetReadDeadline(time.Now().Add(s.h.cfg.PongTimeout))
+	}
+	extend()
+	s.conn.SetPongHandler(extend)
+
+	for {
+		typ, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		extend()
+		if typ != websocket.TextMessage {
+			s.close(websocket.CloseUnsupportedData, "binary messages are not supported")
+			continue
+		}
+
+		var cmd model.WebSocketCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			s.reply(&cmd, http.StatusBadRequest, nil)
+			continue
+		}
+		s.handle(&cmd)
+	}
+}
+
+// handle processes cmd and replies to it.
+func (s *wsSession) handle(cmd *model.WebSocketCommand) {
+	ctx, cancel := context.WithTimeout(pubsub.ContextWithSource(s.ctx, s.source), s.h.cfg.CommandTimeout)
+	defer cancel()
+
+	var res interface{}
+	var err error
+	switch cmd.Type {
+	case model.WebSocketCommandSubscribe:
+		s.subscribe(cmd)
+		s.reply(cmd, http.StatusOK, nil)
+		return
+	case model.WebSocketCommandUnsubscribe:
+		s.unsubscribe()
+		s.reply(cmd, http.StatusOK, nil)
+		return
+	case model.WebSocketCommandCreate:
+		var req model.CreateTODORequest
+		if json.Unmarshal(cmd.Data, &req) != nil || !validCreate(&req) {
+			s.reply(cmd, http.StatusBadRequest, nil)
+			return
+		}
+		res, err = s.h.todo.Create(ctx, &req)
+	case model.WebSocketCommandUpdate:
+		var req model.UpdateTODORequest
+		if json.Unmarshal(cmd.Data, &req) != nil || !validUpdate(&req) {
+			s.reply(cmd, http.StatusBadRequest, nil)
+			return
+		}
+		res, err = s.h.todo.Update(ctx, &req)
+	case model.WebSocketCommandDelete:
+		var req model.DeleteTODORequest
+		if json.Unmarshal(cmd.Data, &req) != nil || !validDelete(&req) {
+			s.reply(cmd, http.StatusBadRequest, nil)
+			return
+		}
+		res, err = s.h.todo.Delete(ctx, &req)
+	default:
+		s.reply(cmd, http.StatusBadRequest, nil)
+		return
+	}
+
+	if err != nil {
+		status := errorStatus(err)
+		if status != http.StatusNotFound {
+			s.h.logger.WarnContext(ctx, "could not process websocket command", slog.String("type", cmd.Type), slog.Any("err", err))
+		}
+		s.reply(cmd, status, nil)
+		return
+	}
+	s.reply(cmd, http.StatusOK, res)
+}
+
+// reply queues the ack or the error of cmd.
+func (s *wsSession) reply(cmd *model.WebSocketCommand, status int, data interface{}) {
+	m := &model.WebSocketMessage{
+		Type:   model.WebSocketMessageAck,
+		ID:     cmd.ID,
+		Status: status,
+		Data:   data,
+	}
+	if status >= http.StatusBadRequest {
+		m.Type = model.WebSocketMessageError
+		m.Error = httperror.New(s.r, status)
+	}
+	s.queue(m)
+}
+
+// subscribe replaces the subscription with the one requested by cmd.
+func (s *wsSession) subscribe(cmd *model.WebSocketCommand) {
+	users := userFilter(cmd.Users)
+	filter := func(e pubsub.Event) bool {
+		return e.Source != s.source && (users == nil || users(e))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sub != nil {
+		s.sub.Close()
+	}
+	sub := s.h.broker.Subscribe(cmd.LastEventID, filter)
+	s.sub = sub
+
+	// NOTE: The replayed events are queued before the ack, so that the client knows it is up to date on the ack.
+	if sub.Lost {
+		s.queue(&model.WebSocketMessage{Type: model.WebSocketMessageReset})
+	}
+	for _, e := range sub.Replay {
+		s.queue(eventMessage(e))
+	}
+	go s.forward(sub)
+}
+
+// unsubscribe stops the events if subscribed.
+func (s *wsSession) unsubscribe() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sub != nil {
+		s.sub.Close()
+		s.sub = nil
+	}
+}
+
+// forward queues the events of sub until it is closed.
+func (s *wsSession) forward(sub *pubsub.Subscription) {
+	for {
+		select {
+		case e := <-sub.C():
+			s.queue(eventMessage(e))
+		case <-sub.Done():
+			if err := sub.Err(); err != nil {
+				// NOTE: The client reconnects and resumes from the replay buffer.
+				s.h.logger.InfoContext(s.ctx, "websocket subscription closed", slog.Any("err", err))
+				s.close(websocket.CloseTryAgainLater, "too slow to receive events")
+			}
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func eventMessage(e pubsub.Event) *model.WebSocketMessage {
+	return &model.WebSocketMessage{
+		Type:    model.WebSocketMessageEvent,
+		EventID: e.ID,
+		Data:    e.Data,
+	}
+}
+
+// queue sends m without blocking. The connection is closed if the client does not keep up with the messages.
+func (s *wsSession) queue(m *model.WebSocketMessage) {
+	select {
+	case s.send <- m:
+	default:
+		s.close(websocket.CloseTryAgainLater, "too slow to receive messages")
+	}
+}
+
+// close requests the writer to close the connection with code.
+func (s *wsSession) close(code int, reason string) {
+	select {
+	case s.closing <- &websocket.CloseError{Code: code, Reason: reason}:
+	default:
+	}
+}
+
+// writeLoop writes the queued messages and pings until the connection is closed.
+func (s *wsSession) writeLoop() {
+	ticker := time.NewTicker(s.h.cfg.PingInterval)
+	defer ticker.Stop()
+
+	write := func(fn func() error) bool {
+		// NOTE: Disconnects clients which stopped reading instead of blocking forever.
+		if err := s.conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout)); err != nil {
+			return false
+		}
+		if err := fn(); err != nil {
+			s.h.logger.DebugContext(s.ctx, "could not write websocket message", slog.Any("err", err))
+			s.conn.Close()
+			return false
+		}
+		return true
+	}
+	closeWith := func(ce *websocket.CloseError) {
+		_ = s.conn.WriteClose(ce.Code, ce.Reason)
+		// NOTE: The reader waits for the close frame from the client, but not forever.
+		_ = s.conn.SetReadDeadline(time.Now().Add(eventWriteTimeout))
+	}
+
+	for {
+		select {
+		case m := <-s.send:
+			data, err := json.Marshal(m)
+			if err != nil {
+				s.h.logger.ErrorContext(s.ctx, "could not encode websocket message", slog.Any("err", err))
+				closeWith(&websocket.CloseError{Code: websocket.CloseInternalError})
+				return
+			}
+			if !write(func() error { return s.conn.WriteMessage(websocket.TextMessage, data) }) {
+				return
+			}
+		case <-ticker.C:
+			if !write(func() error { return s.conn.WritePing(nil) }) {
+				return
+			}
+		case ce := <-s.closing:
+			closeWith(ce)
+			return
+		case <-shutdown.Done(s.ctx):
+			closeWith(&websocket.CloseError{Code: websocket.CloseGoingAway, Reason: "server shutting down"})
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
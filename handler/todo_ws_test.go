@@ -0,0 +1,498 @@
+package handler_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/db"
+	"github.com/TechBowl-japan/go-stations/handler"
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/pkg/pubsub"
+	"github.com/TechBowl-japan/go-stations/pkg/websocket"
+	"github.com/TechBowl-japan/go-stations/service"
+)
+
+// wsServer は、一時的なDBを使用する /todos 及び /api/ws のテスト用のサーバである。
+type wsServer struct {
+	*httptest.Server
+	broker *pubsub.Broker
+}
+
+func newWSServer(t *testing.T, cfg handler.WebSocketConfig) *wsServer {
+	t.Helper()
+
+	todoDB, err := db.NewDB(filepath.Join(t.TempDir(), "todo_ws_test.db"))
+	if err != nil {
+		t.Fatal("DBの作成に失敗しました:", err)
+	}
+	t.Cleanup(func() {
+		todoDB.Close()
+	})
+
+	broker := pubsub.NewBroker(pubsub.Config{})
+	svc := service.NewTODOService(todoDB, service.WithPublisher(&brokerPublisher{broker: broker}))
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	mux := http.NewServeMux()
+	mux.Handle("/todos", handler.NewTODOHandlerWithLogger(svc, logger))
+	mux.Handle("/api/ws", handler.NewTODOWebSocketHandler(svc, broker, cfg, logger))
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return &wsServer{Server: srv, broker: broker}
+}
+
+// wsMessage は、 [model.WebSocketMessage] の Data を遅延して読み込むための型である。
+type wsMessage struct {
+	Type    string               `json:"type"`
+	ID      string               `json:"id"`
+	EventID uint64               `json:"event_id"`
+	Status  int                  `json:"status"`
+	Data    json.RawMessage      `json:"data"`
+	Error   *model.ErrorResponse `json:"error"`
+}
+
+// wsClient は、テスト用のWebSocketクライアントである。
+type wsClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// dialWS は、 /api/ws に接続する。
+func dialWS(t *testing.T, srv *wsServer) *wsClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("期待していないステータスコードです, got = %d", res.StatusCode)
+	}
+	return &wsClient{conn: conn, br: br}
+}
+
+// writeFrame は、マスクしたフレームを送信する。 op はopcodeである。
+func (c *wsClient) writeFrame(t *testing.T, op byte, payload []byte) {
+	t.Helper()
+
+	frame := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, 0x80|byte(n))
+	case n <= 0xffff:
+		frame = binary.BigEndian.AppendUint16(append(frame, 0x80|126), uint16(n))
+	default:
+		frame = binary.BigEndian.AppendUint64(append(frame, 0x80|127), uint64(n))
+	}
+	mask := [4]byte{1, 2, 3, 4}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFrame は、サーバからのフレームを受信し、opcodeとペイロードを返す。
+func (c *wsClient) readFrame() (byte, []byte, error) {
+	var b [2]byte
+	if _, err := io.ReadFull(c.br, b[:]); err != nil {
+		return 0, nil, err
+	}
+	n := uint64(b[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return 0, nil, err
+	}
+	return b[0] & 0x0f, payload, nil
+}
+
+// send は、 cmd をテキストメッセージとして送信する。
+func (c *wsClient) send(t *testing.T, cmd model.WebSocketCommand) {
+	t.Helper()
+
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.writeFrame(t, 0x1, data)
+}
+
+// next は、pingを読み飛ばして次のメッセージを返す。
+func (c *wsClient) next(t *testing.T) *wsMessage {
+	t.Helper()
+
+	for {
+		op, payload, err := c.readFrame()
+		if err != nil {
+			t.Fatal("メッセージの受信に失敗しました:", err)
+		}
+		switch op {
+		case 0x9:
+			continue
+		case 0x1:
+			var m wsMessage
+			if err := json.Unmarshal(payload, &m); err != nil {
+				t.Fatal(err)
+			}
+			return &m
+		default:
+			t.Fatalf("期待していないフレームです, op = %#x, payload = %q", op, payload)
+		}
+	}
+}
+
+// do は、 cmd を送信し、応答を返す。
+func (c *wsClient) do(t *testing.T, cmd model.WebSocketCommand) *wsMessage {
+	t.Helper()
+
+	c.send(t, cmd)
+	m := c.next(t)
+	if m.ID != cmd.ID {
+		t.Fatalf("コマンドのIDが返されていません, got = %q, want = %q", m.ID, cmd.ID)
+	}
+	return m
+}
+
+// closeCode は、クローズフレームを受信するまで読み進め、そのステータスコードを返す。
+func (c *wsClient) closeCode(t *testing.T) int {
+	t.Helper()
+
+	for {
+		op, payload, err := c.readFrame()
+		if err != nil {
+			t.Fatal("クローズフレームを受信する前に切断されました:", err)
+		}
+		if op != 0x8 {
+			continue
+		}
+		if len(payload) < 2 {
+			return 0
+		}
+		return int(binary.BigEndian.Uint16(payload))
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) json.RawMessage {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestTODOWebSocketCommands(t *testing.T) {
+	t.Parallel()
+
+	srv := newWSServer(t, handler.WebSocketConfig{})
+	c := dialWS(t, srv)
+
+	m := c.do(t, model.WebSocketCommand{
+		ID:   "c1",
+		Type: model.WebSocketCommandCreate,
+		Data: mustMarshal(t, model.CreateTODORequest{Subject: "subject", Description: "description"}),
+	})
+	if m.Type != model.WebSocketMessageAck || m.Status != http.StatusOK {
+		t.Fatalf("作成のackではありません, got = %+v", m)
+	}
+	var created model.CreateTODOResponse
+	if err := json.Unmarshal(m.Data, &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.TODO == nil || created.TODO.Subject != "subject" || created.TODO.Description != "description" {
+		t.Fatalf("作成したTODOが返されていません, got = %s", m.Data)
+	}
+
+	m = c.do(t, model.WebSocketCommand{
+		ID:   "u1",
+		Type: model.WebSocketCommandUpdate,
+		Data: mustMarshal(t, model.UpdateTODORequest{ID: created.TODO.ID, Subject: "updated"}),
+	})
+	if m.Type != model.WebSocketMessageAck || m.Status != http.StatusOK {
+		t.Fatalf("更新のackではありません, got = %+v", m)
+	}
+	var updated model.UpdateTODOResponse
+	if err := json.Unmarshal(m.Data, &updated); err != nil {
+		t.Fatal(err)
+	}
+	if updated.TODO == nil || updated.TODO.ID != created.TODO.ID || updated.TODO.Subject != "updated" {
+		t.Fatalf("更新したTODOが返されていません, got = %s", m.Data)
+	}
+
+	m = c.do(t, model.WebSocketCommand{
+		ID:   "d1",
+		Type: model.WebSocketCommandDelete,
+		Data: mustMarshal(t, model.DeleteTODORequest{IDs: []int64{created.TODO.ID}}),
+	})
+	if m.Type != model.WebSocketMessageAck || m.Status != http.StatusOK {
+		t.Fatalf("削除のackではありません, got = %+v", m)
+	}
+
+	// NOTE: 削除済みのため、RESTと同様に見つからない。
+	m = c.do(t, model.WebSocketCommand{
+		ID:   "d2",
+		Type: model.WebSocketCommandDelete,
+		Data: mustMarshal(t, model.DeleteTODORequest{IDs: []int64{created.TODO.ID}}),
+	})
+	if m.Type != model.WebSocketMessageError || m.Status != http.StatusNotFound {
+		t.Errorf("削除済みのTODOの削除がエラーになりません, got = %+v", m)
+	}
+}
+
+func TestTODOWebSocketErrorStatus(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		method  string
+		body    interface{}
+		cmdType string
+	}{
+		"Update Not Found": {
+			method:  http.MethodPut,
+			body:    model.UpdateTODORequest{ID: 999, Subject: "subject"},
+			cmdType: model.WebSocketCommandUpdate,
+		},
+		"Delete Not Found": {
+			method:  http.MethodDelete,
+			body:    model.DeleteTODORequest{IDs: []int64{999}},
+			cmdType: model.WebSocketCommandDelete,
+		},
+		"Create Empty Subject": {
+			method:  http.MethodPost,
+			body:    model.CreateTODORequest{},
+			cmdType: model.WebSocketCommandCreate,
+		},
+		"Update Empty Subject": {
+			method:  http.MethodPut,
+			body:    model.UpdateTODORequest{ID: 1},
+			cmdType: model.WebSocketCommandUpdate,
+		},
+		"Delete Empty IDs": {
+			method:  http.MethodDelete,
+			body:    model.DeleteTODORequest{},
+			cmdType: model.WebSocketCommandDelete,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := newWSServer(t, handler.WebSocketConfig{})
+			body := mustMarshal(t, c.body)
+
+			req, err := http.NewRequest(c.method, srv.URL+"/todos", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode < http.StatusBadRequest {
+				t.Fatalf("RESTがエラーを返していません, got = %d", resp.StatusCode)
+			}
+
+			m := dialWS(t, srv).do(t, model.WebSocketCommand{ID: "1", Type: c.cmdType, Data: body})
+			if m.Type != model.WebSocketMessageError {
+				t.Errorf("エラーが返されていません, got = %+v", m)
+			}
+			if m.Status != resp.StatusCode {
+				t.Errorf("RESTと異なるステータスです, got = %d, want = %d", m.Status, resp.StatusCode)
+			}
+			if m.Error == nil || m.Error.Message != http.StatusText(resp.StatusCode) {
+				t.Errorf("エラーの内容がRESTと異なります, got = %+v", m.Error)
+			}
+		})
+	}
+}
+
+func TestTODOWebSocketSubscribe(t *testing.T) {
+	t.Parallel()
+
+	srv := newWSServer(t, handler.WebSocketConfig{})
+	a := dialWS(t, srv)
+	b := dialWS(t, srv)
+
+	for _, c := range []*wsClient{a, b} {
+		if m := c.do(t, model.WebSocketCommand{ID: "s", Type: model.WebSocketCommandSubscribe}); m.Type != model.WebSocketMessageAck {
+			t.Fatalf("購読のackではありません, got = %+v", m)
+		}
+	}
+
+	create := func(c *wsClient, id, subject string) {
+		t.Helper()
+
+		m := c.do(t, model.WebSocketCommand{
+			ID:   id,
+			Type: model.WebSocketCommandCreate,
+			Data: mustMarshal(t, model.CreateTODORequest{Subject: subject}),
+		})
+		if m.Type != model.WebSocketMessageAck {
+			t.Fatalf("作成のackではありません, got = %+v", m)
+		}
+	}
+	event := func(c *wsClient) model.TODOEvent {
+		t.Helper()
+
+		m := c.next(t)
+		if m.Type != model.WebSocketMessageEvent || m.EventID == 0 {
+			t.Fatalf("イベントではありません, got = %+v", m)
+		}
+		var e model.TODOEvent
+		if err := json.Unmarshal(m.Data, &e); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	create(b, "c1", "by b")
+	if e := event(a); e.Type != model.TODOEventCreated || e.TODO == nil || e.TODO.Subject != "by b" {
+		t.Errorf("他の接続の変更が配信されていません, got = %+v", e)
+	}
+
+	// NOTE: b への次のメッセージが a の変更である事で、 b 自身の変更が配信されていない事を確認する。
+	create(a, "c2", "by a")
+	if e := event(b); e.TODO == nil || e.TODO.Subject != "by a" {
+		t.Errorf("自身の変更が配信されています, got = %+v", e)
+	}
+}
+
+func TestTODOWebSocketMaxMessageSize(t *testing.T) {
+	t.Parallel()
+
+	srv := newWSServer(t, handler.WebSocketConfig{MaxMessageSize: 1024})
+	c := dialWS(t, srv)
+
+	c.send(t, model.WebSocketCommand{
+		ID:   "1",
+		Type: model.WebSocketCommandCreate,
+		Data: mustMarshal(t, model.CreateTODORequest{Subject: strings.Repeat("a", 2048)}),
+	})
+	if code := c.closeCode(t); code != websocket.CloseMessageTooBig {
+		t.Errorf("期待していないクローズコードです, got = %d, want = %d", code, websocket.CloseMessageTooBig)
+	}
+}
+
+func TestTODOWebSocketKeepalive(t *testing.T) {
+	t.Parallel()
+
+	cfg := handler.WebSocketConfig{
+		PingInterval: 20 * time.Millisecond,
+		PongTimeout:  100 * time.Millisecond,
+	}
+
+	t.Run("Pong", func(t *testing.T) {
+		t.Parallel()
+
+		c := dialWS(t, newWSServer(t, cfg))
+
+		// NOTE: PongTimeout を超える間、pingにpongを返し続ける。
+		deadline := time.Now().Add(3 * cfg.PongTimeout)
+		for time.Now().Before(deadline) {
+			op, payload, err := c.readFrame()
+			if err != nil {
+				t.Fatal("pongを返しているのに切断されました:", err)
+			}
+			if op != 0x9 {
+				t.Fatalf("pingではありません, op = %#x", op)
+			}
+			c.writeFrame(t, 0xa, payload)
+		}
+
+		if m := c.do(t, model.WebSocketCommand{ID: "1", Type: model.WebSocketCommandSubscribe}); m.Type != model.WebSocketMessageAck {
+			t.Errorf("ackではありません, got = %+v", m)
+		}
+	})
+
+	t.Run("No Pong", func(t *testing.T) {
+		t.Parallel()
+
+		c := dialWS(t, newWSServer(t, cfg))
+
+		for {
+			op, _, err := c.readFrame()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				t.Fatal("切断されていません:", err)
+			}
+			if op != 0x9 {
+				t.Fatalf("pingではありません, op = %#x", op)
+			}
+		}
+	})
+}
+
+func TestTODOWebSocketSlowConsumer(t *testing.T) {
+	t.Parallel()
+
+	srv := newWSServer(t, handler.WebSocketConfig{SendBuffer: 1})
+	c := dialWS(t, srv)
+	if m := c.do(t, model.WebSocketCommand{ID: "s", Type: model.WebSocketCommandSubscribe}); m.Type != model.WebSocketMessageAck {
+		t.Fatalf("購読のackではありません, got = %+v", m)
+	}
+
+	// NOTE: 読み込まないクライアントへの書き込みがブロックするよう、ソケットのバッファを超える量を配信する。
+	data := strings.Repeat("a", 512<<10)
+	for i := 0; i < 32; i++ {
+		srv.broker.Publish(pubsub.Event{Type: model.TODOEventCreated, Data: data})
+	}
+
+	if code := c.closeCode(t); code != websocket.CloseTryAgainLater {
+		t.Errorf("期待していないクローズコードです, got = %d, want = %d", code, websocket.CloseTryAgainLater)
+	}
+}
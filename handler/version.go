@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/TechBowl-japan/go-stations/model"
+)
+
+// A BuildInfoFunc returns the build and runtime information of the server.
+type BuildInfoFunc func(ctx context.Context) *model.BuildInfo
+
+// A VersionHandler implements build information endpoint.
+type VersionHandler struct {
+	info   BuildInfoFunc
+	logger *slog.Logger
+}
+
+// NewVersionHandler returns VersionHandler based http.Handler.
+func NewVersionHandler(info BuildInfoFunc) *VersionHandler {
+	return NewVersionHandlerWithLogger(info, slog.Default())
+}
+
+// NewVersionHandlerWithLogger returns VersionHandler which writes logs to logger.
+func NewVersionHandlerWithLogger(info BuildInfoFunc, logger *slog.Logger) *VersionHandler {
+	return &VersionHandler{
+		info:   info,
+		logger: logger,
+	}
+}
+
+// ServeHTTP implements http.Handler interface.
+func (h *VersionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	e := json.NewEncoder(w)
+	if err := e.Encode(h.info(r.Context())); err != nil {
+		h.logger.ErrorContext(r.Context(), "could not encode response", slog.Any("err", err))
+	}
+}
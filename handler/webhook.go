@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/pkg/httperror"
+	"github.com/TechBowl-japan/go-stations/service"
+)
+
+const (
+	// DefaultDeliveryPageSize is the number of deliveries returned when the size parameter is omitted.
+	DefaultDeliveryPageSize = 20
+	// MaxDeliveryPageSize is the maximum of the size parameter, which bounds the response
+	// even for a webhook with a long history of failed deliveries.
+	MaxDeliveryPageSize = 100
+)
+
+// A WebhookHandler implements handling REST endpoints of webhooks.
+type WebhookHandler struct {
+	svc    *service.WebhookService
+	logger *slog.Logger
+}
+
+// NewWebhookHandler returns WebhookHandler which writes logs to logger.
+func NewWebhookHandler(svc *service.WebhookService, logger *slog.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		svc:    svc,
+		logger: logger,
+	}
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch strings.ToUpper(r.Method) {
+	case http.MethodGet:
+		webhooks, err := h.svc.ReadWebhooks(r.Context())
+		if err != nil {
+			h.logger.WarnContext(r.Context(), "could not read webhooks", slog.Any("err", err))
+			httperror.Write(w, r, http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, &model.ReadWebhookResponse{Webhooks: webhooks})
+	case http.MethodPost:
+		var req model.CreateWebhookRequest
+		if json.NewDecoder(r.Body).Decode(&req) != nil || !validWebhook(req.URL, req.EventTypes) {
+			httperror.Write(w, r, http.StatusBadRequest)
+			return
+		}
+
+		webhook, err := h.svc.CreateWebhook(r.Context(), req.URL, req.Secret, req.EventTypes)
+		if err != nil {
+			h.logger.WarnContext(r.Context(), "could not create webhook", slog.Any("err", err))
+			httperror.Write(w, r, http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, &model.CreateWebhookResponse{Webhook: webhook})
+	case http.MethodPut:
+		var req model.UpdateWebhookRequest
+		if json.NewDecoder(r.Body).Decode(&req) != nil || req.ID == 0 || !validWebhook(req.URL, req.EventTypes) {
+			httperror.Write(w, r, http.StatusBadRequest)
+			return
+		}
+
+		webhook, err := h.svc.UpdateWebhook(r.Context(), req.ID, req.URL, req.Secret, req.EventTypes)
+		if err != nil {
+			status := errorStatus(err)
+			if status != http.StatusNotFound {
+				h.logger.WarnContext(r.Context(), "could not update webhook", slog.Any("err", err))
+			}
+			httperror.Write(w, r, status)
+			return
+		}
+		writeJSON(w, &model.UpdateWebhookResponse{Webhook: webhook})
+	case http.MethodDelete:
+		var req model.DeleteWebhookRequest
+		if json.NewDecoder(r.Body).Decode(&req) != nil || len(req.IDs) == 0 {
+			httperror.Write(w, r, http.StatusBadRequest)
+			return
+		}
+
+		if err := h.svc.DeleteWebhooks(r.Context(), req.IDs); err != nil {
+			status := errorStatus(err)
+			if status != http.StatusNotFound {
+				h.logger.WarnContext(r.Context(), "could not delete webhooks", slog.Any("err", err))
+			}
+			httperror.Write(w, r, status)
+			return
+		}
+		writeJSON(w, &model.DeleteWebhookResponse{})
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT, DELETE")
+		httperror.Write(w, r, http.StatusMethodNotAllowed)
+	}
+}
+
+// A WebhookDeliveryHandler implements handling the delivery history of webhooks.
+//
+// GET lists the deliveries, filtered by the webhook_id parameter and paginated by prev_id and size
+// like GET /api/todos. size must be between 1 and MaxDeliveryPageSize.
+// POST redelivers the payload of the delivery in the body.
+type WebhookDeliveryHandler struct {
+	svc    *service.WebhookService
+	logger *slog.Logger
+}
+
+// NewWebhookDeliveryHandler returns WebhookDeliveryHandler which writes logs to logger.
+func NewWebhookDeliveryHandler(svc *service.WebhookService, logger *slog.Logger) *WebhookDeliveryHandler {
+	return &WebhookDeliveryHandler{
+		svc:    svc,
+		logger: logger,
+	}
+}
+
+func (h *WebhookDeliveryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch strings.ToUpper(r.Method) {
+	case http.MethodGet:
+		req := model.ReadWebhookDeliveryRequest{Size: DefaultDeliveryPageSize}
+		q := r.URL.Query()
+		for _, p := range []struct {
+			name string
+			v    *int64
+		}{
+			{"webhook_id", &req.WebhookID},
+			{"prev_id", &req.PrevID},
+			{"size", &req.Size},
+		} {
+			if q.Get(p.name) == "" {
+				continue
+			}
+			v, err := strconv.ParseInt(q.Get(p.name), 10, 64)
+			if err != nil {
+				httperror.Write(w, r, http.StatusBadRequest)
+				return
+			}
+			*p.v = v
+		}
+		if req.Size < 1 || req.Size > MaxDeliveryPageSize {
+			httperror.Write(w, r, http.StatusBadRequest)
+			return
+		}
+
+		res, err := h.Read(r.Context(), &req)
+		if err != nil {
+			h.logger.WarnContext(r.Context(), "could not read webhook deliveries", slog.Any("err", err))
+			httperror.Write(w, r, http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, res)
+	case http.MethodPost:
+		var req model.RedeliverWebhookRequest
+		if json.NewDecoder(r.Body).Decode(&req) != nil || req.ID == 0 {
+			httperror.Write(w, r, http.StatusBadRequest)
+			return
+		}
+
+		d, err := h.svc.Redeliver(r.Context(), req.ID)
+		if err != nil {
+			status := errorStatus(err)
+			if status != http.StatusNotFound {
+				h.logger.WarnContext(r.Context(), "could not redeliver webhook", slog.Any("err", err))
+			}
+			httperror.Write(w, r, status)
+			return
+		}
+		writeJSON(w, &model.RedeliverWebhookResponse{Delivery: d})
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		httperror.Write(w, r, http.StatusMethodNotAllowed)
+	}
+}
+
+// Read handles the endpoint that reads the deliveries.
+func (h *WebhookDeliveryHandler) Read(ctx context.Context, req *model.ReadWebhookDeliveryRequest) (*model.ReadWebhookDeliveryResponse, error) {
+	deliveries, err := h.svc.ReadDeliveries(ctx, req.WebhookID, req.PrevID, req.Size)
+	if err != nil {
+		return nil, err
+	}
+	return &model.ReadWebhookDeliveryResponse{
+		Deliveries: deliveries,
+	}, nil
+}
+
+// validWebhook reports whether rawURL is an absolute http(s) URL and eventTypes are known TODOEvent types.
+func validWebhook(rawURL string, eventTypes []string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+	for _, t := range eventTypes {
+		switch t {
+		case model.TODOEventCreated, model.TODOEventUpdated, model.TODOEventDeleted:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// writeJSON writes v as the response body.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
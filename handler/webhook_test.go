@@ -0,0 +1,311 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/db"
+	"github.com/TechBowl-japan/go-stations/handler"
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/service"
+)
+
+// webhookServer は、一時的なDBを使用する /api/webhooks 及び /api/webhooks/deliveries のサーバである。
+type webhookServer struct {
+	*httptest.Server
+	todos    *service.TODOService
+	outbox   *service.OutboxService
+	webhooks *service.WebhookService
+}
+
+func newWebhookServer(t *testing.T) *webhookServer {
+	t.Helper()
+
+	todoDB, err := db.NewDB(filepath.Join(t.TempDir(), "webhook_test.db"))
+	if err != nil {
+		t.Fatal("DBの作成に失敗しました:", err)
+	}
+	t.Cleanup(func() {
+		todoDB.Close()
+	})
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := &webhookServer{
+		todos:    service.NewTODOService(todoDB),
+		outbox:   service.NewOutboxService(todoDB),
+		webhooks: service.NewWebhookServiceWithLogger(todoDB, logger),
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/api/webhooks", handler.NewWebhookHandler(s.webhooks, logger))
+	mux.Handle("/api/webhooks/deliveries", handler.NewWebhookDeliveryHandler(s.webhooks, logger))
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// do は、 body を送信し、レスポンスのステータスコードを返す。2xxの場合はボディを v に読み込む。
+func (s *webhookServer) do(t *testing.T, method, path, body string, v interface{}) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, s.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 && v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// relay は、 outbox のイベントをWebhookの送信として登録する。
+func (s *webhookServer) relay(t *testing.T) {
+	t.Helper()
+
+	ctx := context.Background()
+	events, err := s.outbox.Read(ctx, s.webhooks.Name(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.webhooks.Send(ctx, events); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) > 0 {
+		if err := s.outbox.Commit(ctx, s.webhooks.Name(), events[len(events)-1].ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWebhookHandlerCreate(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		body       string
+		wantStatus int
+	}{
+		"Success": {
+			body:       `{"url": "https://example.com/hook", "event_types": ["created", "deleted"]}`,
+			wantStatus: http.StatusOK,
+		},
+		"All Event Types": {
+			body:       `{"url": "http://example.com/hook", "secret": "secret"}`,
+			wantStatus: http.StatusOK,
+		},
+		"Invalid Scheme": {
+			body:       `{"url": "ftp://example.com/hook"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		"Relative URL": {
+			body:       `{"url": "/hook"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		"Unknown Event Type": {
+			body:       `{"url": "https://example.com/hook", "event_types": ["archived"]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		"Invalid Body": {
+			body:       `{"url":`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			srv := newWebhookServer(t)
+			var created model.CreateWebhookResponse
+			if got := srv.do(t, http.MethodPost, "/api/webhooks", c.body, &created); got != c.wantStatus {
+				t.Fatalf("期待していないステータスコードです, got = %d, want = %d", got, c.wantStatus)
+			}
+			if c.wantStatus != http.StatusOK {
+				return
+			}
+			if created.Webhook.ID == 0 || created.Webhook.Secret == "" {
+				t.Errorf("作成したWebhookが返されていません, got = %+v", created.Webhook)
+			}
+
+			var listed model.ReadWebhookResponse
+			if got := srv.do(t, http.MethodGet, "/api/webhooks", "", &listed); got != http.StatusOK {
+				t.Fatalf("期待していないステータスコードです, got = %d", got)
+			}
+			if len(listed.Webhooks) != 1 || listed.Webhooks[0].ID != created.Webhook.ID || listed.Webhooks[0].Secret != "" {
+				t.Errorf("一覧が期待と異なります, got = %+v", listed.Webhooks)
+			}
+		})
+	}
+}
+
+func TestWebhookDeliveryHandler(t *testing.T) {
+	t.Parallel()
+
+	srv := newWebhookServer(t)
+	var hooks [2]model.CreateWebhookResponse
+	for i, body := range []string{
+		`{"url": "https://example.com/all"}`,
+		`{"url": "https://example.com/deleted", "event_types": ["deleted"]}`,
+	} {
+		if got := srv.do(t, http.MethodPost, "/api/webhooks", body, &hooks[i]); got != http.StatusOK {
+			t.Fatalf("Webhookの作成に失敗しました, got = %d", got)
+		}
+	}
+
+	ctx := context.Background()
+	todo, err := srv.todos.CreateTODO(ctx, "subject", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.todos.DeleteTODO(ctx, []int64{todo.ID}); err != nil {
+		t.Fatal(err)
+	}
+	srv.relay(t)
+
+	var all model.ReadWebhookDeliveryResponse
+	if got := srv.do(t, http.MethodGet, "/api/webhooks/deliveries", "", &all); got != http.StatusOK || len(all.Deliveries) != 3 {
+		t.Fatalf("送信履歴を取得できません, got = %d, %+v", got, all.Deliveries)
+	}
+
+	cases := map[string]struct {
+		query      string
+		wantStatus int
+		wantTypes  []string
+	}{
+		"All": {
+			wantStatus: http.StatusOK,
+			wantTypes:  []string{model.TODOEventDeleted, model.TODOEventDeleted, model.TODOEventCreated},
+		},
+		"Webhook": {
+			query:      "?webhook_id=" + strconv.FormatInt(hooks[1].Webhook.ID, 10),
+			wantStatus: http.StatusOK,
+			wantTypes:  []string{model.TODOEventDeleted},
+		},
+		"Size": {
+			query:      "?size=1",
+			wantStatus: http.StatusOK,
+			wantTypes:  []string{model.TODOEventDeleted},
+		},
+		"Prev ID": {
+			query:      "?size=1&prev_id=" + strconv.FormatInt(all.Deliveries[0].ID, 10),
+			wantStatus: http.StatusOK,
+			wantTypes:  []string{model.TODOEventDeleted},
+		},
+		"Max Size": {
+			query:      "?size=" + strconv.Itoa(handler.MaxDeliveryPageSize),
+			wantStatus: http.StatusOK,
+			wantTypes:  []string{model.TODOEventDeleted, model.TODOEventDeleted, model.TODOEventCreated},
+		},
+		"Too Large Size": {
+			query:      "?size=" + strconv.Itoa(handler.MaxDeliveryPageSize+1),
+			wantStatus: http.StatusBadRequest,
+		},
+		// NOTE: SQLiteの LIMIT は負の場合に制限しないため、拒否する。
+		"Negative Size": {
+			query:      "?size=-1",
+			wantStatus: http.StatusBadRequest,
+		},
+		"Zero Size": {
+			query:      "?size=0",
+			wantStatus: http.StatusBadRequest,
+		},
+		"Invalid Webhook ID": {
+			query:      "?webhook_id=x",
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var res model.ReadWebhookDeliveryResponse
+			if got := srv.do(t, http.MethodGet, "/api/webhooks/deliveries"+c.query, "", &res); got != c.wantStatus {
+				t.Fatalf("期待していないステータスコードです, got = %d, want = %d", got, c.wantStatus)
+			}
+			if c.wantStatus != http.StatusOK {
+				return
+			}
+			var types []string
+			for _, d := range res.Deliveries {
+				types = append(types, d.EventType)
+			}
+			if strings.Join(types, ",") != strings.Join(c.wantTypes, ",") {
+				t.Errorf("送信履歴が一致しません, got = %v, want = %v", types, c.wantTypes)
+			}
+		})
+	}
+}
+
+func TestWebhookDeliveryHandlerRedeliver(t *testing.T) {
+	t.Parallel()
+
+	srv := newWebhookServer(t)
+	var hook model.CreateWebhookResponse
+	if got := srv.do(t, http.MethodPost, "/api/webhooks", `{"url": "https://example.com/hook"}`, &hook); got != http.StatusOK {
+		t.Fatalf("Webhookの作成に失敗しました, got = %d", got)
+	}
+	if _, err := srv.todos.CreateTODO(context.Background(), "subject", ""); err != nil {
+		t.Fatal(err)
+	}
+	srv.relay(t)
+
+	var history model.ReadWebhookDeliveryResponse
+	if got := srv.do(t, http.MethodGet, "/api/webhooks/deliveries", "", &history); got != http.StatusOK || len(history.Deliveries) != 1 {
+		t.Fatalf("送信履歴を取得できません, got = %d, %+v", got, history.Deliveries)
+	}
+	original := history.Deliveries[0]
+
+	cases := map[string]struct {
+		body       string
+		wantStatus int
+	}{
+		"Success": {
+			body:       `{"id": ` + strconv.FormatInt(original.ID, 10) + `}`,
+			wantStatus: http.StatusOK,
+		},
+		"Not Found": {
+			body:       `{"id": 999}`,
+			wantStatus: http.StatusNotFound,
+		},
+		"Missing ID": {
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var res model.RedeliverWebhookResponse
+			if got := srv.do(t, http.MethodPost, "/api/webhooks/deliveries", c.body, &res); got != c.wantStatus {
+				t.Fatalf("期待していないステータスコードです, got = %d, want = %d", got, c.wantStatus)
+			}
+			if c.wantStatus != http.StatusOK {
+				return
+			}
+			d := res.Delivery
+			if d.ID == original.ID || d.WebhookID != hook.Webhook.ID || d.EventID != original.EventID ||
+				d.Status != model.WebhookDeliveryPending || string(d.Payload) != string(original.Payload) {
+				t.Errorf("再送が期待と異なります, got = %+v", d)
+			}
+		})
+	}
+}
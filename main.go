@@ -2,16 +2,39 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/TechBowl-japan/go-stations/config"
 	"github.com/TechBowl-japan/go-stations/db"
+	"github.com/TechBowl-japan/go-stations/handler/middleware"
 	"github.com/TechBowl-japan/go-stations/handler/router"
+	"github.com/TechBowl-japan/go-stations/pkg/basicauth"
+	"github.com/TechBowl-japan/go-stations/pkg/health"
+	"github.com/TechBowl-japan/go-stations/pkg/listener"
+	"github.com/TechBowl-japan/go-stations/pkg/logfile"
+	"github.com/TechBowl-japan/go-stations/pkg/logging"
+	"github.com/TechBowl-japan/go-stations/pkg/metrics"
+	"github.com/TechBowl-japan/go-stations/pkg/outbox"
+	"github.com/TechBowl-japan/go-stations/pkg/panicreport"
+	"github.com/TechBowl-japan/go-stations/pkg/pubsub"
+	"github.com/TechBowl-japan/go-stations/pkg/shutdown"
+	"github.com/TechBowl-japan/go-stations/pkg/tlsconfig"
+	"github.com/TechBowl-japan/go-stations/pkg/tracing"
+	"github.com/TechBowl-japan/go-stations/pkg/webhook"
+	"github.com/TechBowl-japan/go-stations/service"
 )
 
 func main() {
@@ -22,87 +45,471 @@ func main() {
 }
 
 func realMain() error {
-	// config values
-	const (
-		defaultPort   = ":8080"
-		defaultDBPath = ".sqlite3/todo.db"
-	)
+	// load config
+	cfg, opts, err := config.Load(os.Args[1:], os.Getenv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if opts.PrintConfig {
+		return cfg.Redacted().WriteYAML(os.Stdout)
+	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = defaultPort
+	// set up logger
+	// NOTE: 値は config.Load で検証済みである。
+	// ログレベルは、設定の再読み込みで変更できるよう LevelVar で保持する。
+	var level slog.LevelVar
+	if err := setLogLevel(&level, cfg); err != nil {
+		return err
 	}
+	logger, err := logging.New(os.Stderr, cfg.Log.Format, &level)
+	if err != nil {
+		return err
+	}
+	// NOTE: 依存ライブラリが [log] パッケージで出力するログも、同じ形式で出力する。
+	slog.SetDefault(logger)
+	mainLogger := logging.Package(logger, "main")
 
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = defaultDBPath
+	// NOTE:
+	// 全てのサーバのGraceful shutdownが完了した後、処理中のリクエストが使用したリソースを登録と逆の順で後処理する。
+	// 起動中にエラーで終了する場合も、それまでに登録したリソースを後処理する。
+	hooks := shutdown.NewHooks(cfg.Server.ShutdownHookTimeout)
+	defer hooks.Run(context.Background(), mainLogger)
+
+	// NOTE: アクセスログはログレベルに関わらず、標準出力またはファイルに出力する。
+	var accessLogOutput io.Writer = os.Stdout
+	var accessLogFile *logfile.Writer
+	if path := cfg.AccessLog.File; path != "" {
+		f, err := logfile.Open(logfile.Config{
+			Path:       path,
+			MaxSize:    int64(cfg.AccessLog.MaxSizeMB) << 20,
+			Daily:      cfg.AccessLog.RotateDaily,
+			MaxBackups: cfg.AccessLog.MaxBackups,
+			Compress:   cfg.AccessLog.Compress,
+		})
+		if err != nil {
+			return err
+		}
+		// NOTE: 処理中のリクエストのアクセスログが書き込まれた後に閉じるため、最後に実行する。
+		hooks.Add("close access log file", func(context.Context) error {
+			return f.Close()
+		})
+		accessLogOutput = f
+		accessLogFile = f
+	}
+	accessLog, err := middleware.NewAccessLogMiddlewareWithConfig(middleware.AccessLogConfig{
+		Output:            accessLogOutput,
+		Format:            cfg.AccessLog.Format,
+		RedactQueryParams: cfg.AccessLog.RedactQueryParams,
+		TrustedProxies:    cfg.Server.TrustedProxies,
+	})
+	if err != nil {
+		return err
 	}
 
 	// set time zone
-	var err error
-	time.Local, err = time.LoadLocation("Asia/Tokyo")
+	time.Local, err = time.LoadLocation(cfg.TimeZone)
 	if err != nil {
 		return err
 	}
 
 	// set up sqlite3
-	todoDB, err := db.NewDB(dbPath)
+	todoDB, err := db.NewDB(cfg.DB.Path)
 	if err != nil {
 		return err
 	}
-	defer todoDB.Close()
+	hooks.Add("close database", func(context.Context) error {
+		return todoDB.Close()
+	})
+	// NOTE: WALモードの場合、閉じる前にWALの内容をデータベースファイルに書き戻す。
+	hooks.Add("checkpoint database", func(ctx context.Context) error {
+		return db.Checkpoint(ctx, todoDB)
+	})
 
-	mux, err := router.NewHandlerWithBasicAuth(
-		todoDB,
-		os.Getenv("BASIC_AUTH_USER_ID"),
-		os.Getenv("BASIC_AUTH_PASSWORD"),
-	)
+	// set up webhook dispatcher
+	webhooks := service.NewWebhookServiceWithLogger(todoDB, logging.Package(logger, "service"))
+	dispatcher := webhook.NewDispatcher(webhooks, cfg.Webhook.Dispatcher(logging.Package(logger, "pkg/webhook")))
+	// NOTE: 送信中のWebhookの結果をデータベースに記録した後に停止する。
+	hooks.Add("shutdown webhook dispatcher", dispatcher.Shutdown)
+
+	// set up outbox relay
+	events := pubsub.NewBroker(pubsub.Config{
+		ReplaySize: cfg.TODO.EventReplaySize,
+		BufferSize: cfg.TODO.EventBufferSize,
+	})
+	sinks := []outbox.Sink{
+		service.NewBrokerSink(events, logging.Package(logger, "service")),
+		webhooks,
+	}
+	if cfg.Outbox.Log {
+		sinks = append(sinks, outbox.NewLogSink(logging.Package(logger, "pkg/outbox")))
+	}
+	if cfg.Outbox.File != "" {
+		fileSink, err := outbox.NewFileSink(cfg.Outbox.File)
+		if err != nil {
+			return err
+		}
+		sinks = append(sinks, fileSink)
+	}
+	relay := outbox.NewRelay(service.NewOutboxService(todoDB), sinks, cfg.Outbox.Relay(logging.Package(logger, "pkg/outbox")))
+	// NOTE: 配信中のイベントのWebhookの送信予定を保存した後、ディスパッチャより先に停止する。
+	hooks.Add("shutdown outbox relay", relay.Shutdown)
+
+	// set up tracer
+	var tracer *tracing.Tracer
+	if cfg.Tracing.Endpoint != "" {
+		exporter, err := tracing.NewOTLPExporter(tracing.OTLPConfig{
+			Endpoint:    cfg.Tracing.Endpoint,
+			ServiceName: cfg.Tracing.ServiceName,
+		})
+		if err != nil {
+			return err
+		}
+		tracer = tracing.NewTracer(tracing.Config{
+			Exporter: exporter,
+			Logger:   logging.Package(logger, "pkg/tracing"),
+		})
+		// NOTE: 処理中のリクエストのスパンが終了した後、未送信のスパンを送信して送信処理を停止する。
+		hooks.Add("shutdown tracer", tracer.Shutdown)
+	}
+
+	// set up panic reporter
+	var panicReporter panicreport.Reporter
+	if cfg.PanicReport.WebhookURL != "" {
+		reporter, err := panicreport.NewWebhook(panicreport.WebhookConfig{
+			URL:     cfg.PanicReport.WebhookURL,
+			Timeout: cfg.PanicReport.Timeout,
+			Logger:  logging.Package(logger, "pkg/panicreport"),
+		})
+		if err != nil {
+			return err
+		}
+		panicReporter = reporter
+		// NOTE: 処理中のリクエストで発生したpanicを通知した後に停止する。
+		hooks.Add("shutdown panic reporter", reporter.Shutdown)
+	}
+
+	rateLimit, err := middleware.NewRateLimitMiddleware(middleware.RateLimitConfig{
+		Rules:          cfg.RateLimit.ClientRules(),
+		TrustedProxies: cfg.Server.TrustedProxies,
+	})
 	if err != nil {
 		return err
 	}
-	server := &http.Server{
-		Addr:    port,
-		Handler: mux,
+	ipRateLimit, err := middleware.NewRateLimitMiddleware(middleware.RateLimitConfig{
+		Rules:          cfg.RateLimit.IPRules(),
+		TrustedProxies: cfg.Server.TrustedProxies,
+	})
+	if err != nil {
+		return err
 	}
 
+	cors, err := middleware.NewCORSMiddleware(cfg.CORS.Middleware())
+	if err != nil {
+		return err
+	}
+
+	compression, err := cfg.Compression.Middleware()
+	if err != nil {
+		return err
+	}
+
+	timeout, err := cfg.Timeout.Middleware()
+	if err != nil {
+		return err
+	}
+
+	bai, err := basicauth.NewBasicAuthInfoWithRealm(cfg.Auth.UserID, cfg.Auth.Password, router.BasicAuthRealm)
+	if err != nil {
+		return err
+	}
+	auth := basicauth.NewStore(bai)
+
+	// NOTE: SIGHUPで再読み込みした設定のうち、ログレベル、認証情報、レート制限及びCORSを処理中のリクエストに影響なく差し替える。
+	reloader := config.NewReloader(cfg, func() (*config.Config, error) {
+		cfg, _, err := config.Load(os.Args[1:], os.Getenv, io.Discard)
+		return cfg, err
+	})
+	reloader.OnReload(func(cfg *config.Config) error {
+		return setLogLevel(&level, cfg)
+	})
+	reloader.OnReload(func(cfg *config.Config) error {
+		bai, err := basicauth.NewBasicAuthInfoWithRealm(cfg.Auth.UserID, cfg.Auth.Password, router.BasicAuthRealm)
+		if err != nil {
+			return err
+		}
+		auth.Set(bai)
+		return nil
+	})
+	reloader.OnReload(func(cfg *config.Config) error {
+		if err := ipRateLimit.Reload(cfg.RateLimit.IPRules()); err != nil {
+			return err
+		}
+		return rateLimit.Reload(cfg.RateLimit.ClientRules())
+	})
+	reloader.OnReload(func(cfg *config.Config) error {
+		return cors.Reload(cfg.CORS.Middleware())
+	})
+
+	// NOTE: シャットダウンの開始後、ロードバランサが切り離すまでの間も処理中のリクエストは継続する。
+	draining := &health.Shutdown{}
+	readiness := health.NewRegistry()
+	readiness.Register("shutdown", draining, 0)
+	readiness.Register("disk", health.DiskSpace(filepath.Dir(cfg.DB.Path), uint64(cfg.Health.MinFreeDiskMB)<<20), 0)
+
+	// NOTE:
+	// admin.addr を指定した場合、運用者向けのエンドポイントは認証なしで別のアドレスに公開し、メインのポートではTODOのAPIのみを公開する。
+	// 指定しない場合、メインのポートで全て公開し、/metrics には認証を設定する。
+	adminAddr := cfg.Admin.Addr
+	reg := metrics.NewRegistry()
+	reg.MustRegister(reloader.Collectors()...)
+	routerOpts := []router.Option{
+		router.WithRateLimit(rateLimit),
+		router.WithIPRateLimit(ipRateLimit),
+		router.WithCORS(cors),
+		router.WithCompression(compression),
+		router.WithTimeout(timeout),
+		router.WithPanicReporter(panicReporter),
+		router.WithSecurityHeaders(middleware.NewSecurityHeadersMiddleware(cfg.SecurityHeaders.Middleware())),
+		router.WithLogger(logger),
+		router.WithAccessLog(accessLog),
+		router.WithMetrics(reg),
+		router.WithTracer(tracer),
+		router.WithReadiness(readiness),
+		router.WithConfigFunc(func() map[string]string {
+			return reloader.Current().Redacted().Map()
+		}),
+		router.WithDefaultPageSize(int64(cfg.TODO.DefaultPageSize)),
+		router.WithTODOEvents(events, cfg.TODO.EventHeartbeat),
+		router.WithOutbox(relay),
+		router.WithWebSocket(cfg.WebSocket.Handler()),
+		router.WithGraphQL(cfg.GraphQL.Handler()),
+		router.WithWebhooks(webhooks),
+		router.WithLogLevel(&level),
+	}
+	if adminAddr == "" {
+		routerOpts = append(routerOpts, router.WithMetricsEndpoint())
+	}
+
+	// set up TLS
+	var tlsCfg *tls.Config
+	var tlsCert *tlsconfig.Certificate
+	if cfg.TLS.CertFile != "" {
+		tlsCfg, tlsCert, err = tlsconfig.New(tlsconfig.Config{
+			CertFile:     cfg.TLS.CertFile,
+			KeyFile:      cfg.TLS.KeyFile,
+			MinVersion:   cfg.TLS.MinVersion,
+			CipherSuites: cfg.TLS.CipherSuites,
+			ClientAuth:   cfg.TLS.ClientAuth,
+			ClientCAFile: cfg.TLS.ClientCAFile,
+		})
+		if err != nil {
+			return err
+		}
+		if tlsCfg.ClientAuth != tls.NoClientCert {
+			routerOpts = append(routerOpts, router.WithClientCert(cfg.TLS.ClientPrincipals))
+		}
+	}
+
+	var mux, admin http.Handler
+	if adminAddr != "" {
+		mux, admin = router.NewHandlersWithAuthenticator(todoDB, auth, routerOpts...)
+	} else {
+		mux = router.NewHandlerWithAuthenticator(todoDB, auth, routerOpts...)
+	}
+	errorLog := slog.NewLogLogger(logging.Package(logger, "net/http").Handler(), slog.LevelError)
+	servers := []*http.Server{
+		{
+			Addr:      cfg.Server.Addr,
+			Handler:   mux,
+			ErrorLog:  errorLog,
+			TLSConfig: tlsCfg,
+		},
+	}
+	if addr := cfg.TLS.RedirectAddr; addr != "" {
+		h, err := router.NewHTTPSRedirectHandler(cfg.Server.Addr)
+		if err != nil {
+			return err
+		}
+		servers = append(servers, &http.Server{
+			Addr:     addr,
+			Handler:  h,
+			ErrorLog: errorLog,
+		})
+	}
+	if admin != nil {
+		servers = append(servers, &http.Server{
+			Addr:     adminAddr,
+			Handler:  admin,
+			ErrorLog: errorLog,
+		})
+	}
+
+	// NOTE: ストリーミング等の長時間のリクエストは、 shutdown.Done でシャットダウンの開始を検知して応答を終了する。
+	notifier := shutdown.NewNotifier()
+	for _, server := range servers {
+		notifier.Register(server)
+	}
+
+	// NOTE: 遅いクライアントがコネクションを占有しないよう、全てのサーバにタイムアウトを設定する。
+	for _, server := range servers {
+		cfg.Server.ApplyTimeouts(server)
+	}
+	if admin != nil {
+		// NOTE: /debug/pprof/profile 等は指定した秒数の間レスポンスを返さないため、管理用のサーバには書き込みのタイムアウトを設定しない。
+		servers[len(servers)-1].WriteTimeout = 0
+	}
+
+	// NOTE: 全てのアドレスで待ち受けられる事を確認してから、サーバを起動する。
+	socketMode, err := cfg.Server.SocketMode()
+	if err != nil {
+		return err
+	}
+	listenerCfg := listener.Config{
+		Mode:  socketMode,
+		Owner: cfg.Server.UnixSocketOwner,
+	}
+	listeners := make([]net.Listener, 0, len(servers))
+	for _, server := range servers {
+		ln, err := listener.Listen(server.Addr, listenerCfg)
+		if err != nil {
+			for _, ln := range listeners {
+				ln.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, ln)
+	}
+
+	// NOTE: Graceful shutdownの途中で再度シグナルを受け取った場合、処理中のリクエスト及び後処理を待たずに終了する。
+	// ctx の終了後に登録すると、その間に受け取ったシグナルを取りこぼすため、 ctx より先に登録しておく。
+	// ctx を終了させたシグナルも force に届くため、2つ目のシグナルで終了する。
+	force := make(chan os.Signal, 2)
+	signal.Notify(force, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(force)
+
 	ctx, stop := signal.NotifyContext(
 		context.Background(),
 		syscall.SIGINT,
 		syscall.SIGTERM,
 	)
 	defer stop()
+
+	go func() {
+		<-ctx.Done()
+		<-force
+		sig := <-force
+		mainLogger.Warn("received second signal during shutdown, exiting immediately", slog.String("signal", sig.String()))
+		os.Exit(1)
+	}()
+
+	// NOTE:
+	// logrotate 等の外部ツールによるローテーション後にもSIGHUPが送られるため、アクセスログのファイルも開き直す。
+	// サーバ証明書は変更を自動で検知するが、SIGHUPでは即座に読み込み直す。
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go func() {
+		for range hup {
+			if accessLogFile != nil {
+				if err := accessLogFile.Reopen(); err != nil {
+					mainLogger.Error("could not reopen access log file", slog.Any("err", err))
+				} else {
+					mainLogger.Info("access log file is reopened", slog.String("path", cfg.AccessLog.File))
+				}
+			}
+			if tlsCert != nil {
+				if err := tlsCert.Reload(); err != nil {
+					mainLogger.Error("could not reload TLS certificate, keeping the current certificate", slog.Any("err", err))
+				} else {
+					mainLogger.Info("TLS certificate is reloaded", slog.Time("not_after", tlsCert.Leaf().NotAfter))
+				}
+			}
+			res, err := reloader.Reload()
+			if err != nil {
+				mainLogger.Error("could not reload config, keeping the current config", slog.Any("err", err))
+				continue
+			}
+			mainLogger.Info("config is reloaded", slog.Any("applied", res.Applied))
+			if len(res.Ignored) > 0 {
+				mainLogger.Warn("changed config requires restart to take effect", slog.Any("keys", res.Ignored))
+			}
+		}
+	}()
+
 	var wg sync.WaitGroup
 
+	drain := func() {
+		draining.Begin()
+		time.Sleep(cfg.Server.ShutdownDrainDelay)
+	}
+
 	// NOTE: serverの数だけAddする
-	wg.Add(1)
-	go run(ctx, &wg, server)
+	wg.Add(len(servers))
+	for i, server := range servers {
+		go run(ctx, &wg, server, listeners[i], drain, cfg.Server.ShutdownTimeout, mainLogger)
+	}
 	wg.Wait()
 
 	return nil
 }
 
+// setLogLevel は、 cfg のログレベルを level に設定する。
+func setLogLevel(level *slog.LevelVar, cfg *config.Config) error {
+	l, err := logging.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		return err
+	}
+	level.Set(l)
+	return nil
+}
+
 // run はHTTPサーバに対するGraceful shutdownを提供する。
 //
+// srv は ln で待ち受け、 srv.TLSConfig を設定した場合はHTTPSで待ち受ける。 ln はGraceful shutdownの完了時に閉じられる。
 // [context.Context] 及び [sync.WaitGroup]を共有する事で複数サーバのGraceful shutdownを同時に制御できる。
-func run(ctx context.Context, wg *sync.WaitGroup, srv *http.Server) {
+// beforeShutdown は、 ctx の終了後、 [net/http.Server.Shutdown] の前に呼び出される(e.g. /readyz を失敗させる)。
+// timeout を過ぎても処理中のリクエストが残っている場合、残りのコネクションを強制的に閉じる。
+func run(ctx context.Context, wg *sync.WaitGroup, srv *http.Server, ln net.Listener, beforeShutdown func(), timeout time.Duration, logger *slog.Logger) {
+	conns := shutdown.TrackConns(srv)
 	go func() {
 		defer wg.Done()
 
 		<-ctx.Done()
+		logger.Info("shutdown started", slog.String("addr", srv.Addr))
+		beforeShutdown()
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
 		defer cancel()
 
 		if err := srv.Shutdown(ctx); err != nil {
-			log.Printf("main: could not gracefully shutdown the server, err =%v\n", err)
+			logger.Error("could not gracefully shutdown the server, forcing connections to close",
+				slog.String("addr", srv.Addr),
+				slog.Duration("timeout", timeout),
+				slog.Any("connections", conns.Counts()),
+				slog.Any("err", err),
+			)
+			if err := srv.Close(); err != nil {
+				logger.Error("could not close the server", slog.String("addr", srv.Addr), slog.Any("err", err))
+			}
 		} else {
-			log.Printf("main: server is completely shutdown\n")
+			logger.Info("server is completely shutdown", slog.String("addr", srv.Addr))
 		}
 	}()
 
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Printf("main: could not listen on %v, err =%v\n", srv.Addr, err)
+	logger.Info("server is listening", slog.String("addr", srv.Addr), slog.String("listener", ln.Addr().String()))
+	// NOTE: 証明書は TLSConfig.GetCertificate で取得するため、ファイルのパスは指定しない。
+	var err error
+	if srv.TLSConfig != nil {
+		err = srv.ServeTLS(ln, "", "")
+	} else {
+		err = srv.Serve(ln)
+	}
+	if err != nil && err != http.ErrServerClosed {
+		logger.Error("could not listen", slog.String("addr", srv.Addr), slog.Any("err", err))
 	} else {
-		log.Printf("main: listen port %v is closed\n", srv.Addr)
+		logger.Info("listen port is closed", slog.String("addr", srv.Addr))
 	}
 }
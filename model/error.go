@@ -5,3 +5,11 @@ type ErrNotFound struct{}
 func (*ErrNotFound) Error() string {
 	return "Not Found"
 }
+
+// An ErrorResponse expresses error message returned to clients.
+type ErrorResponse struct {
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+	// PanicID identifies the recovered panic in the server logs.
+	PanicID string `json:"panic_id,omitempty"`
+}
@@ -0,0 +1,15 @@
+package model
+
+import "encoding/json"
+
+// A GraphQLRequest expresses a GraphQL operation sent to /api/graphql.
+//
+// Ref: https://graphql.github.io/graphql-over-http/draft/#sec-Request-Parameters
+type GraphQLRequest struct {
+	Query         string `json:"query"`
+	OperationName string `json:"operationName"`
+	// Variables are decoded with json.Decoder.UseNumber, which keeps integers exact.
+	Variables map[string]interface{} `json:"variables"`
+	// Extensions are accepted for compatibility with clients and ignored.
+	Extensions json.RawMessage `json:"extensions"`
+}
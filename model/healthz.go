@@ -3,4 +3,6 @@ package model
 // A HealthzResponse expresses health check message.
 type HealthzResponse struct {
 	Message string `json:"message"`
+	// Build is reported only when requested, to keep the default response unchanged.
+	Build *BuildInfo `json:"build,omitempty"`
 }
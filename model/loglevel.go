@@ -0,0 +1,12 @@
+package model
+
+// A LogLevelResponse expresses the response of the log level endpoint.
+type LogLevelResponse struct {
+	Level string `json:"level"`
+}
+
+// An UpdateLogLevelRequest expresses the request to change the log level.
+type UpdateLogLevelRequest struct {
+	// Level is one of debug, info, warn and error.
+	Level string `json:"level"`
+}
@@ -0,0 +1,17 @@
+package model
+
+// A ProbeResponse expresses the result of liveness or readiness checks.
+type ProbeResponse struct {
+	Status string        `json:"status"`
+	Checks []*ProbeCheck `json:"checks"`
+}
+
+// A ProbeCheck expresses the result of a single check.
+type ProbeCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// LatencyMS is the time taken by the check in milliseconds.
+	LatencyMS float64 `json:"latency_ms"`
+	// Error is the reason of the failure, reported only in verbose mode.
+	Error string `json:"error,omitempty"`
+}
@@ -1,6 +1,9 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type (
 	// A TODO expresses ...
@@ -49,4 +52,66 @@ type (
 	}
 	// A DeleteTODOResponse expresses ...
 	DeleteTODOResponse struct{}
+
+	// A TODOEvent expresses a change of TODOs pushed by GET /api/todos/events.
+	TODOEvent struct {
+		Type string `json:"type"`
+		// TODO is the created or updated TODO.
+		TODO *TODO `json:"todo,omitempty"`
+		// IDs are the deleted TODOs.
+		IDs []int64 `json:"ids,omitempty"`
+		// User is the user who changed the TODOs, or empty if unauthenticated.
+		User string `json:"user,omitempty"`
+	}
+
+	// A WebSocketCommand expresses a message sent by clients of /api/ws.
+	WebSocketCommand struct {
+		// ID is chosen by the client to match the ack or the error with the command.
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		// LastEventID resumes the subscription after the event, like Last-Event-ID of /api/todos/events.
+		LastEventID uint64 `json:"last_event_id,omitempty"`
+		// Users limits the subscription to the changes by those users.
+		Users []string `json:"users,omitempty"`
+		// Data is CreateTODORequest, UpdateTODORequest or DeleteTODORequest.
+		Data json.RawMessage `json:"data,omitempty"`
+	}
+	// A WebSocketMessage expresses a message sent to clients of /api/ws.
+	WebSocketMessage struct {
+		Type string `json:"type"`
+		// ID is the ID of the acknowledged or failed command.
+		ID string `json:"id,omitempty"`
+		// EventID is passed as LastEventID on reconnection.
+		EventID uint64 `json:"event_id,omitempty"`
+		// Status is the HTTP status equivalent to the result of the command.
+		Status int `json:"status,omitempty"`
+		// Data is the response of the command or the TODOEvent.
+		Data  interface{}    `json:"data,omitempty"`
+		Error *ErrorResponse `json:"error,omitempty"`
+	}
+)
+
+// The types of TODOEvent.
+const (
+	TODOEventCreated = "created"
+	TODOEventUpdated = "updated"
+	TODOEventDeleted = "deleted"
+)
+
+// The types of WebSocketCommand.
+const (
+	WebSocketCommandSubscribe   = "subscribe"
+	WebSocketCommandUnsubscribe = "unsubscribe"
+	WebSocketCommandCreate      = "create"
+	WebSocketCommandUpdate      = "update"
+	WebSocketCommandDelete      = "delete"
+)
+
+// The types of WebSocketMessage.
+const (
+	WebSocketMessageAck   = "ack"
+	WebSocketMessageError = "error"
+	WebSocketMessageEvent = "event"
+	// WebSocketMessageReset tells that some events are lost and the TODOs must be read again.
+	WebSocketMessageReset = "reset"
 )
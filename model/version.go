@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// A BuildInfo expresses the build and runtime information of the server.
+type BuildInfo struct {
+	Version       string    `json:"version"`
+	Revision      string    `json:"revision"`
+	Dirty         bool      `json:"dirty"`
+	GoVersion     string    `json:"go_version"`
+	StartTime     time.Time `json:"start_time"`
+	UptimeSeconds float64   `json:"uptime_seconds"`
+	SchemaVersion int       `json:"schema_version"`
+	// Config is the loaded configuration whose secrets are masked.
+	Config map[string]string `json:"config,omitempty"`
+}
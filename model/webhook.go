@@ -0,0 +1,112 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type (
+	// A Webhook expresses a subscription of an external URL to TODOEvents.
+	Webhook struct {
+		ID  int64  `json:"id"`
+		URL string `json:"url"`
+		// EventTypes are the TODOEvent types sent to URL. All types are sent if empty.
+		EventTypes []string `json:"event_types"`
+		// Secret signs the deliveries. It is only returned when the webhook is created.
+		Secret    string    `json:"secret,omitempty"`
+		CreatedAt time.Time `json:"created_at"`
+		UpdatedAt time.Time `json:"updated_at"`
+	}
+
+	// A CreateWebhookRequest expresses ...
+	CreateWebhookRequest struct {
+		URL string `json:"url"`
+		// Secret is generated if empty.
+		Secret     string   `json:"secret"`
+		EventTypes []string `json:"event_types"`
+	}
+	// A CreateWebhookResponse expresses ...
+	CreateWebhookResponse struct {
+		Webhook *Webhook `json:"webhook"`
+	}
+
+	// A ReadWebhookResponse expresses ...
+	ReadWebhookResponse struct {
+		Webhooks []*Webhook `json:"webhooks"`
+	}
+
+	// A UpdateWebhookRequest expresses ...
+	UpdateWebhookRequest struct {
+		ID  int64  `json:"id"`
+		URL string `json:"url"`
+		// Secret is kept if empty.
+		Secret     string   `json:"secret"`
+		EventTypes []string `json:"event_types"`
+	}
+	// A UpdateWebhookResponse expresses ...
+	UpdateWebhookResponse struct {
+		Webhook *Webhook `json:"webhook"`
+	}
+
+	// A DeleteWebhookRequest expresses ...
+	DeleteWebhookRequest struct {
+		IDs []int64 `json:"ids"`
+	}
+	// A DeleteWebhookResponse expresses ...
+	DeleteWebhookResponse struct{}
+
+	// A WebhookDelivery expresses a request sending a WebhookPayload to a Webhook, including its retries.
+	WebhookDelivery struct {
+		ID        int64  `json:"id"`
+		WebhookID int64  `json:"webhook_id"`
+		EventID   string `json:"event_id"`
+		EventType string `json:"event_type"`
+		// Payload is the WebhookPayload sent as the request body.
+		Payload  json.RawMessage `json:"payload"`
+		Status   string          `json:"status"`
+		Attempts int             `json:"attempts"`
+		// NextAttemptAt is when the pending delivery is sent next.
+		NextAttemptAt  time.Time `json:"next_attempt_at"`
+		LastStatusCode int       `json:"last_status_code,omitempty"`
+		LastError      string    `json:"last_error,omitempty"`
+		CreatedAt      time.Time `json:"created_at"`
+		UpdatedAt      time.Time `json:"updated_at"`
+	}
+
+	// A ReadWebhookDeliveryRequest expresses ...
+	ReadWebhookDeliveryRequest struct {
+		WebhookID int64 `json:"webhook_id"`
+		PrevID    int64 `json:"prev_id"`
+		Size      int64 `json:"size"`
+	}
+	// A ReadWebhookDeliveryResponse expresses ...
+	ReadWebhookDeliveryResponse struct {
+		Deliveries []*WebhookDelivery `json:"deliveries"`
+	}
+
+	// A RedeliverWebhookRequest expresses ...
+	RedeliverWebhookRequest struct {
+		ID int64 `json:"id"`
+	}
+	// A RedeliverWebhookResponse expresses ...
+	RedeliverWebhookResponse struct {
+		Delivery *WebhookDelivery `json:"delivery"`
+	}
+
+	// A WebhookPayload expresses the request body of a WebhookDelivery.
+	WebhookPayload struct {
+		// ID identifies the event and increases in the order of the changes. It is the same on redeliveries,
+		// and receivers should use it to order the deliveries, which are sent concurrently.
+		ID        string     `json:"id"`
+		Type      string     `json:"type"`
+		CreatedAt time.Time  `json:"created_at"`
+		Data      *TODOEvent `json:"data"`
+	}
+)
+
+// The statuses of WebhookDelivery.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
@@ -0,0 +1,19 @@
+// Package backoff は、再試行までの時間を計算するジッタ付きの指数バックオフを提供する。
+package backoff
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Exponential は、 failures 回連続して失敗した後、再試行までの時間を返す。
+//
+// initial から失敗の度に倍にし、 max を上限とする。
+// 多数の処理が同時に失敗した場合や、障害の復旧直後に再試行が集中しないよう、半分をランダムにする。
+func Exponential(initial, max time.Duration, failures int) time.Duration {
+	b := max
+	if shift := failures - 1; shift >= 0 && shift < 32 && initial<<shift < b && initial<<shift > 0 {
+		b = initial << shift
+	}
+	return b/2 + time.Duration(rand.Int63n(int64(b/2)+1))
+}
@@ -0,0 +1,38 @@
+package backoff_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/pkg/backoff"
+)
+
+func TestExponential(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		failures int
+		want     time.Duration
+	}{
+		"First":    {failures: 1, want: time.Second},
+		"Second":   {failures: 2, want: 2 * time.Second},
+		"Third":    {failures: 3, want: 4 * time.Second},
+		"Capped":   {failures: 10, want: time.Minute},
+		"Overflow": {failures: 100, want: time.Minute},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// NOTE: ジッタにより、期待する時間の半分から期待する時間までとなる。
+			for i := 0; i < 100; i++ {
+				got := backoff.Exponential(time.Second, time.Minute, c.failures)
+				if got < c.want/2 || got > c.want {
+					t.Fatalf("期待していない時間です, got = %s, want = [%s, %s]", got, c.want/2, c.want)
+				}
+			}
+		})
+	}
+}
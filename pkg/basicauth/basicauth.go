@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"unicode"
 )
 
@@ -75,3 +76,32 @@ func containsControl(s string) bool {
 	}
 	return false
 }
+
+// Store は、実行中に差し替え可能な BasicAuthInfo を保持する。
+//
+// 設定の再読み込み時に認証情報を差し替えても、処理中のリクエストには影響しない。
+type Store struct {
+	bai atomic.Pointer[BasicAuthInfo]
+}
+
+// NewStore は、 bai を保持した Store を返す。
+func NewStore(bai *BasicAuthInfo) *Store {
+	s := &Store{}
+	s.Set(bai)
+	return s
+}
+
+// Set は、保持する BasicAuthInfo を bai に差し替える。
+func (s *Store) Set(bai *BasicAuthInfo) {
+	s.bai.Store(bai)
+}
+
+// Authenticate は、現在の BasicAuthInfo で認証を実施する。
+func (s *Store) Authenticate(r *http.Request) error {
+	return s.bai.Load().Authenticate(r)
+}
+
+// Challenge は、現在の BasicAuthInfo でチャレンジレスポンスを生成する。
+func (s *Store) Challenge(w http.ResponseWriter) {
+	s.bai.Load().Challenge(w)
+}
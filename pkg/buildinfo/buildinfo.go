@@ -0,0 +1,93 @@
+// Package buildinfo は、実行中のバイナリのビルド情報を提供する。
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Version は、ビルド時に設定するバージョンである。
+//
+//	go build -ldflags "-X github.com/TechBowl-japan/go-stations/pkg/buildinfo.Version=v1.0.0"
+//
+// 設定しない場合は、 [runtime/debug.ReadBuildInfo] のモジュールのバージョンを使用する。
+var Version string
+
+// startTime は、プロセスの起動時刻とみなす時刻である。
+var startTime = time.Now()
+
+const develVersion = "(devel)"
+
+// Info は、ビルド情報である。
+type Info struct {
+	Version   string
+	Revision  string
+	Dirty     bool
+	GoVersion string
+	StartTime time.Time
+}
+
+// Read は、実行中のバイナリのビルド情報を返す。
+//
+// VCSの情報は、リポジトリ内で go build した場合のみ埋め込まれる(go run 及び go test では空となる)。
+func Read() Info {
+	info := Info{
+		Version:   Version,
+		GoVersion: runtime.Version(),
+		StartTime: startTime,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" {
+			info.Version = bi.Main.Version
+		}
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Revision = s.Value
+			case "vcs.modified":
+				info.Dirty = s.Value == "true"
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = develVersion
+	}
+	return info
+}
+
+// Uptime は、起動からの経過時間を返す。
+func (i Info) Uptime() time.Duration {
+	return time.Since(i.StartTime)
+}
+
+// masked は、秘匿情報を置き換えた値である。
+const masked = "[REDACTED]"
+
+// secretKeywords は、キーに含まれる場合に値を秘匿する文字列(小文字)である。
+var secretKeywords = []string{"password", "secret", "token", "key", "header"}
+
+// MaskSecrets は、秘匿情報と思われるキーの値を置き換えた設定を返す。
+//
+// 未設定である事は秘匿する必要が無いため、空文字はそのまま返す。
+func MaskSecrets(config map[string]string) map[string]string {
+	res := make(map[string]string, len(config))
+	for k, v := range config {
+		if v != "" && isSecret(k) {
+			v = masked
+		}
+		res[k] = v
+	}
+	return res
+}
+
+func isSecret(key string) bool {
+	key = strings.ToLower(key)
+	for _, kw := range secretKeywords {
+		if strings.Contains(key, kw) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package buildinfo_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/TechBowl-japan/go-stations/pkg/buildinfo"
+)
+
+func TestRead(t *testing.T) {
+	info := buildinfo.Read()
+	if info.GoVersion != runtime.Version() {
+		t.Errorf("期待していないGoのバージョンです, got = %s, want = %s", info.GoVersion, runtime.Version())
+	}
+	if info.Version == "" {
+		t.Error("バージョンが空です")
+	}
+	if info.StartTime.IsZero() || info.Uptime() <= 0 {
+		t.Errorf("起動時刻が記録されていません, got = %v", info.StartTime)
+	}
+
+	old := buildinfo.Version
+	t.Cleanup(func() {
+		buildinfo.Version = old
+	})
+	buildinfo.Version = "v1.2.3"
+	if got := buildinfo.Read().Version; got != "v1.2.3" {
+		t.Errorf("ビルド時に設定したバージョンが使用されていません, got = %s", got)
+	}
+}
+
+func TestMaskSecrets(t *testing.T) {
+	got := buildinfo.MaskSecrets(map[string]string{
+		"PORT":                ":8080",
+		"BASIC_AUTH_USER_ID":  "user",
+		"BASIC_AUTH_PASSWORD": "pass",
+		"API_TOKEN":           "token",
+		"client_secret":       "secret",
+		"OTEL_HEADERS":        "Authorization=Bearer x",
+		"EMPTY_PASSWORD":      "",
+	})
+	want := map[string]string{
+		"PORT":                ":8080",
+		"BASIC_AUTH_USER_ID":  "user",
+		"BASIC_AUTH_PASSWORD": "[REDACTED]",
+		"API_TOKEN":           "[REDACTED]",
+		"client_secret":       "[REDACTED]",
+		"OTEL_HEADERS":        "[REDACTED]",
+		"EMPTY_PASSWORD":      "",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("期待していない値です (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,848 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Params は、操作の実行に与える値である。
+type Params struct {
+	Query string
+	// OperationName は、実行する操作の名前である。クエリが1つの操作のみを含む場合は省略できる。
+	OperationName string
+	// Variables は、変数の値である。JSON を [encoding/json.Decoder.UseNumber] で読み込んだ値を指定する。
+	Variables map[string]interface{}
+	// MaxDepth は、フィールドの入れ子の深さの上限である。0の場合は制限しない。
+	MaxDepth int
+	// MaxComplexity は、 [Field.Complexity] で計算した複雑さの上限である。0の場合は制限しない。
+	MaxComplexity int
+}
+
+// 操作の種類である。
+const (
+	OperationQuery        = "query"
+	OperationMutation     = "mutation"
+	OperationSubscription = "subscription"
+)
+
+// Operation は、構文及びスキーマを検証した、実行可能な操作である。
+type Operation struct {
+	// Kind は、操作の種類である。
+	Kind string
+	// Complexity は、操作の複雑さである。
+	Complexity int
+
+	schema *Schema
+	doc    *document
+	op     *operation
+	root   *Object
+	// vars は、変数の値である。型の検証のみを行い、引数の型への変換は使用する位置で行う。
+	vars    map[string]interface{}
+	varDefs map[string]*variableDefinition
+	// args は、フィールド毎に変換した引数である。
+	args map[*field]map[string]interface{}
+}
+
+// Prepare は、 p のクエリを構文解析し、スキーマに対して検証した操作を返す。
+//
+// エラーは [Error] または [Errors] であり、 [ErrorResult] でレスポンスに変換できる。
+func (s *Schema) Prepare(p Params) (*Operation, error) {
+	doc, err := parse(p.Query)
+	if err != nil {
+		return nil, err
+	}
+	op, err := selectOperation(doc, p.OperationName)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &Operation{
+		Kind:    op.kind,
+		schema:  s,
+		doc:     doc,
+		op:      op,
+		vars:    make(map[string]interface{}),
+		varDefs: make(map[string]*variableDefinition),
+		args:    make(map[*field]map[string]interface{}),
+	}
+	switch op.kind {
+	case OperationQuery:
+		o.root = s.query
+	case OperationMutation:
+		o.root = s.mutation
+	case OperationSubscription:
+		o.root = s.subscription
+	}
+	if o.root == nil {
+		return nil, &Error{Message: fmt.Sprintf("%s には対応していません", op.kind), Locations: []Location{op.loc}}
+	}
+	if errs := o.coerceVariables(p.Variables); len(errs) > 0 {
+		return nil, errs
+	}
+
+	v := &validator{
+		o:             o,
+		visiting:      make(map[string]bool),
+		maxDepth:      p.MaxDepth,
+		maxComplexity: p.MaxComplexity,
+	}
+	complexity, _ := v.selections(o.root, op.selections, 1)
+	if op.kind == OperationSubscription && len(v.errs) == 0 {
+		if groups := o.collectFields(o.root, op.selections); len(groups) != 1 || groups[0].fields[0].name == "__typename" {
+			v.errorf(op.loc, "subscription では1つのフィールドのみ選択できます")
+		}
+	}
+	if len(v.errs) > 0 {
+		return nil, v.errs
+	}
+	o.Complexity = complexity
+	return o, nil
+}
+
+func selectOperation(doc *document, name string) (*operation, error) {
+	if name == "" {
+		if len(doc.operations) > 1 {
+			return nil, &Error{Message: "複数の操作を含む場合は、実行する操作の名前を指定する必要があります"}
+		}
+		return doc.operations[0], nil
+	}
+	for _, op := range doc.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, &Error{Message: fmt.Sprintf("操作 %s が存在しません", name)}
+}
+
+// coerceVariables は、変数の値を定義された型に対して検証する。
+func (o *Operation) coerceVariables(given map[string]interface{}) Errors {
+	var errs Errors
+	for _, def := range o.op.variables {
+		if _, ok := o.varDefs[def.name]; ok {
+			errs = append(errs, &Error{Message: fmt.Sprintf("変数 $%s が重複しています", def.name), Locations: []Location{def.loc}})
+			continue
+		}
+		o.varDefs[def.name] = def
+
+		t, err := o.schema.resolveTypeRef(def.typ)
+		if err != nil {
+			errs = append(errs, &Error{Message: fmt.Sprintf("変数 $%s の型が不正です: %s", def.name, err), Locations: []Location{def.loc}})
+			continue
+		}
+		raw, ok := given[def.name]
+		if !ok && def.defaultValue != nil {
+			raw, err = o.literal(def.defaultValue)
+			ok = err == nil
+		}
+		if !ok {
+			if def.typ.nonNull {
+				errs = append(errs, &Error{Message: fmt.Sprintf("変数 $%s は必須です", def.name), Locations: []Location{def.loc}})
+			}
+			continue
+		}
+		if _, err := coerceValue(t, raw); err != nil {
+			errs = append(errs, &Error{Message: fmt.Sprintf("変数 $%s が不正です: %s", def.name, err), Locations: []Location{def.loc}})
+			continue
+		}
+		o.vars[def.name] = raw
+	}
+	return errs
+}
+
+// resolveTypeRef は、変数の型をスキーマの型に変換する。
+func (s *Schema) resolveTypeRef(ref *typeRef) (Type, error) {
+	var t Type
+	if ref.elem != nil {
+		elem, err := s.resolveTypeRef(ref.elem)
+		if err != nil {
+			return nil, err
+		}
+		t = &List{OfType: elem}
+	} else {
+		named, ok := s.types[ref.name]
+		if !ok || !isInputType(named) {
+			return nil, fmt.Errorf("%s は入力に使用できる型ではありません", ref.name)
+		}
+		t = named
+	}
+	if ref.nonNull {
+		t = &NonNull{OfType: t}
+	}
+	return t, nil
+}
+
+// enumLiteral は、列挙型の値である。スカラ型の値としては使用できない。
+type enumLiteral string
+
+// literal は、クエリに記述した値を、変数と同じ JSON を読み込んだ場合の値に変換する。
+func (o *Operation) literal(v *value) (interface{}, error) {
+	switch v.kind {
+	case valueVariable:
+		if _, ok := o.varDefs[v.raw]; !ok {
+			return nil, fmt.Errorf("変数 $%s が定義されていません", v.raw)
+		}
+		return o.vars[v.raw], nil
+	case valueInt, valueFloat:
+		return json.Number(v.raw), nil
+	case valueString:
+		return v.raw, nil
+	case valueBoolean:
+		return v.raw == "true", nil
+	case valueNull:
+		return nil, nil
+	case valueEnum:
+		return enumLiteral(v.raw), nil
+	case valueList:
+		list := make([]interface{}, len(v.list))
+		for i, elem := range v.list {
+			lv, err := o.literal(elem)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = lv
+		}
+		return list, nil
+	default:
+		m := make(map[string]interface{}, len(v.fields))
+		for _, f := range v.fields {
+			fv, err := o.literal(f.value)
+			if err != nil {
+				return nil, err
+			}
+			m[f.name] = fv
+		}
+		return m, nil
+	}
+}
+
+// coerceValue は、 v を型 t の値に変換する。
+//
+// Ref: https://spec.graphql.org/October2021/#sec-Input-Values
+func coerceValue(t Type, v interface{}) (interface{}, error) {
+	switch t := t.(type) {
+	case *NonNull:
+		if v == nil {
+			return nil, fmt.Errorf("%s に null は指定できません", t)
+		}
+		return coerceValue(t.OfType, v)
+	case *List:
+		if v == nil {
+			return nil, nil
+		}
+		list, ok := v.([]interface{})
+		if !ok {
+			// NOTE: リスト型にリスト以外の値を指定した場合は、1要素のリストとする。
+			list = []interface{}{v}
+		}
+		res := make([]interface{}, len(list))
+		for i, elem := range list {
+			cv, err := coerceValue(t.OfType, elem)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = cv
+		}
+		return res, nil
+	case *Scalar:
+		if v == nil {
+			return nil, nil
+		}
+		return t.ParseValue(v)
+	default:
+		return nil, fmt.Errorf("%s は入力に使用できる型ではありません", t)
+	}
+}
+
+// coerceArguments は、 args を defs の型に変換する。
+func (o *Operation) coerceArguments(defs []*Argument, args []*argument) (map[string]interface{}, error) {
+	given := make(map[string]*argument, len(args))
+	for _, a := range args {
+		if _, ok := given[a.name]; ok {
+			return nil, fmt.Errorf("引数 %s が重複しています", a.name)
+		}
+		given[a.name] = a
+	}
+
+	res := make(map[string]interface{}, len(defs))
+	for _, def := range defs {
+		a, ok := given[def.Name]
+		delete(given, def.Name)
+		if ok && a.value.kind == valueVariable {
+			vd, defined := o.varDefs[a.value.raw]
+			if !defined {
+				return nil, fmt.Errorf("変数 $%s が定義されていません", a.value.raw)
+			}
+			if err := checkVariableUsage(vd, def); err != nil {
+				return nil, err
+			}
+			// NOTE: 値が指定されなかった変数は、引数を指定しなかった場合と同じとする。
+			_, ok = o.vars[a.value.raw]
+		}
+		if !ok {
+			if def.DefaultValue != nil {
+				res[def.Name] = def.DefaultValue
+			} else if _, nonNull := def.Type.(*NonNull); nonNull {
+				return nil, fmt.Errorf("引数 %s は必須です", def.Name)
+			}
+			continue
+		}
+
+		raw, err := o.literal(a.value)
+		if err != nil {
+			return nil, err
+		}
+		v, err := coerceValue(def.Type, raw)
+		if err != nil {
+			return nil, fmt.Errorf("引数 %s が不正です: %w", def.Name, err)
+		}
+		res[def.Name] = v
+	}
+	for name := range given {
+		return nil, fmt.Errorf("引数 %s は存在しません", name)
+	}
+	return res, nil
+}
+
+// checkVariableUsage は、変数を引数 def に使用できるかを検証する。
+//
+// Ref: https://spec.graphql.org/October2021/#sec-All-Variable-Usages-Are-Allowed
+func checkVariableUsage(vd *variableDefinition, def *Argument) error {
+	_, argNonNull := def.Type.(*NonNull)
+	if argNonNull && !vd.typ.nonNull && vd.defaultValue == nil && def.DefaultValue == nil {
+		return fmt.Errorf("変数 $%s の型 %s は、引数 %s の型 %s に使用できません", vd.name, vd.typ, def.Name, def.Type)
+	}
+	if strings.ReplaceAll(vd.typ.String(), "!", "") != strings.ReplaceAll(def.Type.String(), "!", "") {
+		return fmt.Errorf("変数 $%s の型 %s は、引数 %s の型 %s に使用できません", vd.name, vd.typ, def.Name, def.Type)
+	}
+	return nil
+}
+
+// included は、 @skip 及び @include ディレクティブに従い、選択に含めるかを返す。
+func (o *Operation) included(ds []*directive) (bool, error) {
+	for _, d := range ds {
+		if d.name != "skip" && d.name != "include" {
+			return false, fmt.Errorf("ディレクティブ @%s には対応していません", d.name)
+		}
+		args, err := o.coerceArguments([]*Argument{{Name: "if", Type: &NonNull{OfType: Boolean}}}, d.arguments)
+		if err != nil {
+			return false, fmt.Errorf("@%s: %w", d.name, err)
+		}
+		if args["if"].(bool) == (d.name == "skip") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// validator は、操作の選択セットをスキーマに対して検証し、複雑さ及び深さを計算する。
+type validator struct {
+	o    *Operation
+	errs Errors
+	// visiting は、展開中のフラグメントである。循環を検出するために使用する。
+	visiting map[string]bool
+
+	maxDepth      int
+	maxComplexity int
+	// exceeded は、深さまたは複雑さが上限を超えたかを表す。
+	// NOTE: 超えた時点で検証を打ち切り、巨大なクエリの検証に時間を費やさないようにする。
+	exceeded bool
+}
+
+func (v *validator) errorf(loc Location, format string, args ...interface{}) {
+	v.errs = append(v.errs, &Error{Message: fmt.Sprintf(format, args...), Locations: []Location{loc}})
+}
+
+// exceed は、上限を超えたエラーを記録し、以降の検証を打ち切る。
+func (v *validator) exceed(format string, args ...interface{}) {
+	v.errorf(v.o.op.loc, format, args...)
+	v.exceeded = true
+}
+
+// selections は、 obj の選択セット sels を検証し、複雑さ及び最も深いフィールドの深さを返す。 depth は sels のフィールドの深さである。
+func (v *validator) selections(obj *Object, sels []selection, depth int) (complexity, maxDepth int) {
+	if v.maxDepth > 0 && depth > v.maxDepth {
+		v.exceed("クエリの深さが上限の %d を超えています", v.maxDepth)
+		return 0, depth
+	}
+	v.checkMerge(obj, sels)
+	return v.walk(obj, sels, depth, make(map[string]bool))
+}
+
+// walk は、フラグメントを展開しながら sels を検証する。 spread は、同じ選択セットで展開済みのフラグメントである。
+//
+// NOTE: 同じ選択セットで同じフラグメントを複数回展開しても、実行時には1つにまとめられる。
+// 展開済みのフラグメントを再度検証すると、フラグメントの入れ子の数に対して指数的な時間を要する。
+func (v *validator) walk(obj *Object, sels []selection, depth int, spread map[string]bool) (complexity, maxDepth int) {
+	maxDepth = depth
+	for _, sel := range sels {
+		if v.exceeded {
+			return complexity, maxDepth
+		}
+		switch sel := sel.(type) {
+		case *field:
+			if ok, err := v.o.included(sel.directives); err != nil {
+				v.errorf(sel.loc, "%s", err)
+				continue
+			} else if !ok {
+				continue
+			}
+			if sel.name == "__typename" {
+				if len(sel.selections) > 0 || len(sel.arguments) > 0 {
+					v.errorf(sel.loc, "__typename には引数及びフィールドを指定できません")
+				}
+				continue
+			}
+
+			f := obj.field(sel.name)
+			if f == nil {
+				v.errorf(sel.loc, "%s にフィールド %s は存在しません", obj.Name, sel.name)
+				continue
+			}
+			args, err := v.o.coerceArguments(f.Args, sel.arguments)
+			if err != nil {
+				v.errorf(sel.loc, "%s.%s: %s", obj.Name, f.Name, err)
+				continue
+			}
+			v.o.args[sel] = args
+
+			child, childDepth := 0, depth
+			if sub, ok := namedType(f.Type).(*Object); ok {
+				if len(sel.selections) == 0 {
+					v.errorf(sel.loc, "%s.%s の型 %s にはフィールドを選択する必要があります", obj.Name, f.Name, f.Type)
+					continue
+				}
+				child, childDepth = v.selections(sub, sel.selections, depth+1)
+				if v.exceeded {
+					return complexity, maxDepth
+				}
+			} else if len(sel.selections) > 0 {
+				v.errorf(sel.loc, "%s.%s の型 %s にはフィールドを選択できません", obj.Name, f.Name, f.Type)
+				continue
+			}
+
+			if f.Complexity != nil {
+				complexity += f.Complexity(args, child)
+			} else {
+				complexity += 1 + child
+			}
+			maxDepth = max(maxDepth, childDepth)
+			if v.maxComplexity > 0 && complexity > v.maxComplexity {
+				v.exceed("クエリの複雑さが上限の %d を超えています", v.maxComplexity)
+			}
+		case *fragmentSpread:
+			if ok, err := v.o.included(sel.directives); err != nil {
+				v.errorf(sel.loc, "%s", err)
+				continue
+			} else if !ok {
+				continue
+			}
+			fr, ok := v.o.doc.fragments[sel.name]
+			if !ok {
+				v.errorf(sel.loc, "フラグメント %s が存在しません", sel.name)
+				continue
+			}
+			if v.visiting[sel.name] {
+				v.errorf(sel.loc, "フラグメント %s が循環しています", sel.name)
+				continue
+			}
+			if fr.typeCondition != obj.Name {
+				v.errorf(sel.loc, "フラグメント %s の型 %s は %s に適用できません", sel.name, fr.typeCondition, obj.Name)
+				continue
+			}
+			if spread[sel.name] {
+				continue
+			}
+			spread[sel.name] = true
+			v.visiting[sel.name] = true
+			c, d := v.walk(obj, fr.selections, depth, spread)
+			delete(v.visiting, sel.name)
+			complexity += c
+			maxDepth = max(maxDepth, d)
+		case *inlineFragment:
+			if ok, err := v.o.included(sel.directives); err != nil {
+				v.errorf(sel.loc, "%s", err)
+				continue
+			} else if !ok {
+				continue
+			}
+			if sel.typeCondition != "" && sel.typeCondition != obj.Name {
+				v.errorf(sel.loc, "フラグメントの型 %s は %s に適用できません", sel.typeCondition, obj.Name)
+				continue
+			}
+			c, d := v.walk(obj, sel.selections, depth, spread)
+			complexity += c
+			maxDepth = max(maxDepth, d)
+		}
+		if v.maxComplexity > 0 && complexity > v.maxComplexity && !v.exceeded {
+			v.exceed("クエリの複雑さが上限の %d を超えています", v.maxComplexity)
+		}
+	}
+	return complexity, maxDepth
+}
+
+// checkMerge は、同じキーに異なるフィールドを選択していないかを検証する。
+func (v *validator) checkMerge(obj *Object, sels []selection) {
+	// NOTE: 未定義のフラグメント等は selections で検出するため、ここでは循環のみ回避する。
+	for _, g := range v.o.collectFields(obj, sels) {
+		for _, f := range g.fields[1:] {
+			if f.name != g.fields[0].name {
+				v.errorf(f.loc, "%s に異なるフィールド %s と %s を選択しています", g.key, g.fields[0].name, f.name)
+			}
+		}
+	}
+}
+
+// fieldGroup は、同じキーで選択されたフィールドである。
+type fieldGroup struct {
+	key    string
+	fields []*field
+}
+
+// collectFields は、フラグメントを展開し、 obj の選択セット sels のフィールドをキー毎に選択した順にまとめる。
+//
+// Ref: https://spec.graphql.org/October2021/#CollectFields()
+func (o *Operation) collectFields(obj *Object, sels []selection) []*fieldGroup {
+	var groups []*fieldGroup
+	index := make(map[string]*fieldGroup)
+	visited := make(map[string]bool)
+
+	var collect func(sels []selection)
+	collect = func(sels []selection) {
+		for _, sel := range sels {
+			switch sel := sel.(type) {
+			case *field:
+				if ok, _ := o.included(sel.directives); !ok {
+					continue
+				}
+				key := sel.responseKey()
+				g, ok := index[key]
+				if !ok {
+					g = &fieldGroup{key: key}
+					index[key] = g
+					groups = append(groups, g)
+				}
+				g.fields = append(g.fields, sel)
+			case *fragmentSpread:
+				if ok, _ := o.included(sel.directives); !ok || visited[sel.name] {
+					continue
+				}
+				visited[sel.name] = true
+				if fr, ok := o.doc.fragments[sel.name]; ok && fr.typeCondition == obj.Name {
+					collect(fr.selections)
+				}
+			case *inlineFragment:
+				if ok, _ := o.included(sel.directives); !ok {
+					continue
+				}
+				if sel.typeCondition == "" || sel.typeCondition == obj.Name {
+					collect(sel.selections)
+				}
+			}
+		}
+	}
+	collect(sels)
+	return groups
+}
+
+// subfields は、 fields の選択セットをまとめたフィールドを返す。
+func (o *Operation) subfields(obj *Object, fields []*field) []*fieldGroup {
+	if len(fields) == 1 {
+		return o.collectFields(obj, fields[0].selections)
+	}
+	var sels []selection
+	for _, f := range fields {
+		sels = append(sels, f.selections...)
+	}
+	return o.collectFields(obj, sels)
+}
+
+// Execute は、query または mutation を実行する。mutation のルートのフィールドは、選択した順に1つずつ実行する。
+func (o *Operation) Execute(ctx context.Context) *Result {
+	if o.Kind == OperationSubscription {
+		return ErrorResult(&Error{Message: "subscription は Subscribe で実行する必要があります"})
+	}
+	e := &executor{o: o}
+	data, _ := e.executeFields(ctx, o.root, nil, o.collectFields(o.root, o.op.selections), nil, o.Kind == OperationMutation)
+	return &Result{Data: data, Errors: e.errs, executed: true}
+}
+
+// Subscribe は、subscription を実行し、イベント毎の結果を返すチャネルを返す。
+//
+// ルートのフィールドの [Field.Subscribe] が返したイベントは、 [ResolveParams.Source] としてリゾルバに与える。
+// リゾルバが nil の場合は、イベントをそのままフィールドの値とする。
+// チャネルは、イベントのチャネルが閉じられた後、または ctx の終了時に閉じる。
+func (o *Operation) Subscribe(ctx context.Context) (<-chan *Result, error) {
+	if o.Kind != OperationSubscription {
+		return nil, &Error{Message: fmt.Sprintf("%s は Execute で実行する必要があります", o.Kind)}
+	}
+	groups := o.collectFields(o.root, o.op.selections)
+	f := groups[0].fields[0]
+	events, err := o.root.field(f.name).Subscribe(ctx, o.args[f])
+	if err != nil {
+		return nil, &Error{Message: err.Error(), Locations: []Location{f.loc}, Path: []interface{}{groups[0].key}, err: err}
+	}
+
+	results := make(chan *Result)
+	go func() {
+		defer close(results)
+		for ev := range events {
+			e := &executor{o: o}
+			data, _ := e.executeFields(ctx, o.root, ev, groups, nil, false)
+			select {
+			case results <- &Result{Data: data, Errors: e.errs, executed: true}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return results, nil
+}
+
+// typenameField は、全てのオブジェクト型で選択できる __typename フィールドである。
+var typenameField = &Field{Name: "__typename", Type: &NonNull{OfType: String}}
+
+// executor は、1回の実行の状態である。並行して使用してはならない。
+type executor struct {
+	o    *Operation
+	errs []*Error
+}
+
+// pendingField は、リゾルバを呼び出し、値を完成させる前のフィールドである。
+type pendingField struct {
+	group *fieldGroup
+	def   *Field
+	path  []interface{}
+	value interface{}
+	err   error
+}
+
+func (e *executor) addError(err error, f *field, path []interface{}) {
+	ge := &Error{Message: err.Error(), Locations: []Location{f.loc}, Path: path, err: err}
+	var re *Error
+	if errors.As(err, &re) {
+		ge.Extensions = re.Extensions
+	}
+	e.errs = append(e.errs, ge)
+}
+
+// executeFields は、 obj のフィールドを実行する。 serial が false の場合、全てのリゾルバを呼び出した後に値を完成させる。
+//
+// 非null型のフィールドが null になった場合は、 false を返す。
+func (e *executor) executeFields(ctx context.Context, obj *Object, source interface{}, groups []*fieldGroup, path []interface{}, serial bool) (*OrderedMap, bool) {
+	if !serial {
+		return e.completeFields(ctx, e.resolveFields(ctx, obj, source, groups, path))
+	}
+	m := newOrderedMap(len(groups))
+	for _, g := range groups {
+		p := e.resolveField(ctx, obj, source, g, path)
+		v, ok := e.completeField(ctx, p)
+		if !ok {
+			return nil, false
+		}
+		m.set(g.key, v)
+	}
+	return m, true
+}
+
+// resolveFields は、 obj の全てのフィールドのリゾルバを呼び出す。
+//
+// NOTE: 値を完成させる前に全てのリゾルバを呼び出す事で、 [Thunk] を返すリゾルバの読み込みをまとめられる。
+func (e *executor) resolveFields(ctx context.Context, obj *Object, source interface{}, groups []*fieldGroup, path []interface{}) []*pendingField {
+	ps := make([]*pendingField, len(groups))
+	for i, g := range groups {
+		ps[i] = e.resolveField(ctx, obj, source, g, path)
+	}
+	return ps
+}
+
+func (e *executor) resolveField(ctx context.Context, obj *Object, source interface{}, g *fieldGroup, path []interface{}) *pendingField {
+	f := g.fields[0]
+	p := &pendingField{group: g, path: append(path[:len(path):len(path)], g.key)}
+	if f.name == "__typename" {
+		p.def = typenameField
+		p.value = obj.Name
+		return p
+	}
+
+	p.def = obj.field(f.name)
+	switch {
+	case p.def.Resolve != nil:
+		p.value, p.err = p.def.Resolve(ctx, ResolveParams{Source: source, Args: e.o.args[f]})
+	case obj == e.o.schema.subscription:
+		p.value = source
+	default:
+		if m, ok := source.(map[string]interface{}); ok {
+			p.value = m[f.name]
+		}
+	}
+	return p
+}
+
+// completeFields は、リゾルバを呼び出したフィールドの値を完成させる。非null型のフィールドが null になった場合は、 false を返す。
+func (e *executor) completeFields(ctx context.Context, ps []*pendingField) (*OrderedMap, bool) {
+	m := newOrderedMap(len(ps))
+	for _, p := range ps {
+		v, ok := e.completeField(ctx, p)
+		if !ok {
+			return nil, false
+		}
+		m.set(p.group.key, v)
+	}
+	return m, true
+}
+
+// completeField は、フィールドの値を完成させる。エラーにより null になった場合、フィールドが非null型であれば false を返す。
+func (e *executor) completeField(ctx context.Context, p *pendingField) (interface{}, bool) {
+	if p.err != nil {
+		e.addError(p.err, p.group.fields[0], p.path)
+		return nil, !isNonNull(p.def.Type)
+	}
+	v, ok := e.completeValue(ctx, p.def.Type, p.group.fields, p.value, p.path)
+	if !ok && !isNonNull(p.def.Type) {
+		return nil, true
+	}
+	return v, ok
+}
+
+// completeValue は、 v を型 t の値に変換する。エラーにより null になった場合は false を返す。
+//
+// Ref: https://spec.graphql.org/October2021/#CompleteValue()
+func (e *executor) completeValue(ctx context.Context, t Type, fields []*field, v interface{}, path []interface{}) (interface{}, bool) {
+	if th, ok := v.(Thunk); ok {
+		var err error
+		if v, err = th(); err != nil {
+			e.addError(err, fields[0], path)
+			return nil, false
+		}
+	}
+
+	if nn, ok := t.(*NonNull); ok {
+		res, ok := e.completeValue(ctx, nn.OfType, fields, v, path)
+		if !ok {
+			return nil, false
+		}
+		if res == nil {
+			e.addError(errors.New("非null型のフィールドが null を返しました"), fields[0], path)
+			return nil, false
+		}
+		return res, true
+	}
+	if isNil(v) {
+		return nil, true
+	}
+
+	switch t := t.(type) {
+	case *Scalar:
+		res, err := t.Serialize(v)
+		if err != nil {
+			e.addError(err, fields[0], path)
+			return nil, false
+		}
+		return res, true
+	case *Object:
+		return e.executeFields(ctx, t, v, e.o.subfields(t, fields), path, false)
+	case *List:
+		return e.completeList(ctx, t, fields, v, path)
+	}
+	e.addError(fmt.Errorf("不明な型です: %s", t), fields[0], path)
+	return nil, false
+}
+
+// completeList は、リストの各要素の値を完成させる。
+//
+// 要素がオブジェクト型の場合、全ての要素のリゾルバを呼び出した後に値を完成させ、要素間で読み込みをまとめられるようにする。
+func (e *executor) completeList(ctx context.Context, t *List, fields []*field, v interface{}, path []interface{}) (interface{}, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		e.addError(fmt.Errorf("リストではない値を返しました: %T", v), fields[0], path)
+		return nil, false
+	}
+
+	items := make([]interface{}, rv.Len())
+	paths := make([][]interface{}, rv.Len())
+	for i := range items {
+		items[i] = rv.Index(i).Interface()
+		paths[i] = append(path[:len(path):len(path)], i)
+	}
+
+	elemNonNull := isNonNull(t.OfType)
+	res := make([]interface{}, len(items))
+	obj, isObject := namedType(t.OfType).(*Object)
+	if _, nested := unwrapNonNull(t.OfType).(*List); !isObject || nested {
+		for i, item := range items {
+			r, ok := e.completeValue(ctx, t.OfType, fields, item, paths[i])
+			if !ok && elemNonNull {
+				return nil, false
+			}
+			res[i] = r
+		}
+		return res, true
+	}
+
+	groups := e.o.subfields(obj, fields)
+	pending := make([][]*pendingField, len(items))
+	for i, item := range items {
+		if th, ok := item.(Thunk); ok {
+			var err error
+			if item, err = th(); err != nil {
+				e.addError(err, fields[0], paths[i])
+				if elemNonNull {
+					return nil, false
+				}
+				items[i] = nil
+				continue
+			}
+			items[i] = item
+		}
+		if !isNil(item) {
+			pending[i] = e.resolveFields(ctx, obj, item, groups, paths[i])
+		}
+	}
+	for i, item := range items {
+		if isNil(item) {
+			if elemNonNull {
+				e.addError(errors.New("非null型の要素が null です"), fields[0], paths[i])
+				return nil, false
+			}
+			continue
+		}
+		m, ok := e.completeFields(ctx, pending[i])
+		if !ok {
+			if elemNonNull {
+				return nil, false
+			}
+			continue
+		}
+		res[i] = m
+	}
+	return res, true
+}
+
+func isNonNull(t Type) bool {
+	_, ok := t.(*NonNull)
+	return ok
+}
+
+func unwrapNonNull(t Type) Type {
+	if nn, ok := t.(*NonNull); ok {
+		return nn.OfType
+	}
+	return t
+}
+
+// isNil は、 v が nil またはnilのポインタ等であるかを返す。
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface, reflect.Func, reflect.Chan:
+		return rv.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,392 @@
+package graphql_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/pkg/graphql"
+	"github.com/google/go-cmp/cmp"
+)
+
+type book struct {
+	ID       int
+	Title    string
+	AuthorID int
+}
+
+var books = []*book{
+	{ID: 1, Title: "Go", AuthorID: 1},
+	{ID: 2, Title: "SQL", AuthorID: 2},
+	{ID: 3, Title: "HTTP", AuthorID: 1},
+}
+
+// loaderKey は、リクエスト毎の [graphql.Loader] を保持するコンテキストのキーである。
+type loaderKey struct{}
+
+// newTestSchema は、書籍と著者のスキーマを返す。
+func newTestSchema(t *testing.T) *graphql.Schema {
+	t.Helper()
+
+	author := &graphql.Object{
+		Name: "Author",
+		Fields: []*graphql.Field{
+			{Name: "id", Type: &graphql.NonNull{OfType: graphql.ID}},
+			{Name: "name", Type: graphql.String},
+		},
+	}
+	bookType := &graphql.Object{
+		Name: "Book",
+		Fields: []*graphql.Field{
+			{
+				Name: "id",
+				Type: &graphql.NonNull{OfType: graphql.ID},
+				Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*book).ID, nil
+				},
+			},
+			{
+				Name: "title",
+				Type: &graphql.NonNull{OfType: graphql.String},
+				Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(*book).Title, nil
+				},
+			},
+			{
+				Name: "author",
+				Type: author,
+				Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+					l := ctx.Value(loaderKey{}).(*graphql.Loader[int, map[string]interface{}])
+					return l.Load(ctx, p.Source.(*book).AuthorID), nil
+				},
+			},
+			{
+				Name: "broken",
+				Type: &graphql.NonNull{OfType: graphql.String},
+				Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+					return nil, errors.New("broken")
+				},
+			},
+		},
+	}
+	booksField := &graphql.Field{
+		Name: "books",
+		Type: &graphql.NonNull{OfType: &graphql.List{OfType: &graphql.NonNull{OfType: bookType}}},
+		Args: []*graphql.Argument{
+			{Name: "first", Type: graphql.Int, DefaultValue: 10},
+		},
+		Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+			return books[:min(p.Args["first"].(int), len(books))], nil
+		},
+		Complexity: func(args map[string]interface{}, child int) int {
+			return args["first"].(int) * child
+		},
+	}
+	bookField := &graphql.Field{
+		Name: "book",
+		Type: bookType,
+		Args: []*graphql.Argument{
+			{Name: "id", Type: &graphql.NonNull{OfType: graphql.ID}},
+		},
+		Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+			for _, b := range books {
+				if p.Args["id"] == strconv.Itoa(b.ID) {
+					return b, nil
+				}
+			}
+			return (*book)(nil), nil
+		},
+	}
+
+	var mu sync.Mutex
+	var titles []string
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{
+		Query: &graphql.Object{Name: "Query", Fields: []*graphql.Field{booksField, bookField}},
+		Mutation: &graphql.Object{
+			Name: "Mutation",
+			Fields: []*graphql.Field{
+				{
+					Name: "addTitle",
+					Type: &graphql.NonNull{OfType: &graphql.List{OfType: &graphql.NonNull{OfType: graphql.String}}},
+					Args: []*graphql.Argument{
+						{Name: "title", Type: &graphql.NonNull{OfType: graphql.String}},
+					},
+					Resolve: func(ctx context.Context, p graphql.ResolveParams) (interface{}, error) {
+						mu.Lock()
+						defer mu.Unlock()
+						titles = append(titles, p.Args["title"].(string))
+						return append([]string(nil), titles...), nil
+					},
+				},
+			},
+		},
+		Subscription: &graphql.Object{
+			Name: "Subscription",
+			Fields: []*graphql.Field{
+				{
+					Name: "bookAdded",
+					Type: &graphql.NonNull{OfType: bookType},
+					Subscribe: func(ctx context.Context, args map[string]interface{}) (<-chan interface{}, error) {
+						ch := make(chan interface{})
+						go func() {
+							defer close(ch)
+							for _, b := range books {
+								select {
+								case ch <- b:
+								case <-ctx.Done():
+									return
+								}
+							}
+						}()
+						return ch, nil
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// newLoaderContext は、著者を読み込む [graphql.Loader] を保持するコンテキストを返す。
+func newLoaderContext(batches *[][]int) context.Context {
+	l := graphql.NewLoader(func(ctx context.Context, ids []int) (map[int]map[string]interface{}, error) {
+		*batches = append(*batches, ids)
+		authors := make(map[int]map[string]interface{}, len(ids))
+		for _, id := range ids {
+			authors[id] = map[string]interface{}{"id": id, "name": map[int]string{1: "Alice", 2: "Bob"}[id]}
+		}
+		return authors, nil
+	})
+	return context.WithValue(context.Background(), loaderKey{}, l)
+}
+
+func TestExecute(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		query         string
+		operationName string
+		variables     map[string]interface{}
+		want          string
+		// batches は、著者を読み込んだ回数である。
+		batches int
+	}{
+		"Alias and Variable": {
+			query:     `query Q($id: ID!) { first: book(id: $id) { title } second: book(id: "2") { title } }`,
+			variables: map[string]interface{}{"id": json.Number("1")},
+			want:      `{"data":{"first":{"title":"Go"},"second":{"title":"SQL"}}}`,
+		},
+		"Fragment": {
+			query: `
+				query { books(first: 2) { ...BookFields ... on Book { __typename } } }
+				fragment BookFields on Book { id title }
+			`,
+			want: `{"data":{"books":[{"id":"1","title":"Go","__typename":"Book"},{"id":"2","title":"SQL","__typename":"Book"}]}}`,
+		},
+		"Directive": {
+			query:     `query ($skip: Boolean!) { books(first: 1) { id title @skip(if: $skip) } }`,
+			variables: map[string]interface{}{"skip": true},
+			want:      `{"data":{"books":[{"id":"1"}]}}`,
+		},
+		"Batch": {
+			query:   `{ books { title author { name } } }`,
+			want:    `{"data":{"books":[{"title":"Go","author":{"name":"Alice"}},{"title":"SQL","author":{"name":"Bob"}},{"title":"HTTP","author":{"name":"Alice"}}]}}`,
+			batches: 1,
+		},
+		"Null": {
+			query: `{ book(id: 9) { title } }`,
+			want:  `{"data":{"book":null}}`,
+		},
+		"Null Propagation": {
+			query: `{ book(id: 1) { title broken } }`,
+			want:  `{"errors":[{"message":"broken","locations":[{"line":1,"column":23}],"path":["book","broken"]}],"data":{"book":null}}`,
+		},
+		"Operation Name": {
+			query:         `query A { book(id: 1) { title } } query B { book(id: 2) { title } }`,
+			operationName: "B",
+			want:          `{"data":{"book":{"title":"SQL"}}}`,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var batches [][]int
+			schema := newTestSchema(t)
+			op, err := schema.Prepare(graphql.Params{Query: c.query, OperationName: c.operationName, Variables: c.variables})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(op.Execute(newLoaderContext(&batches)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(c.want, string(got)); diff != "" {
+				t.Errorf("期待していない結果です (-want +got):\n%s", diff)
+			}
+			if len(batches) != c.batches {
+				t.Errorf("読み込みがまとめられていません, batches = %v", batches)
+			}
+		})
+	}
+}
+
+func TestExecuteMutationSerially(t *testing.T) {
+	t.Parallel()
+
+	schema := newTestSchema(t)
+	op, err := schema.Prepare(graphql.Params{Query: `mutation { a: addTitle(title: "a") b: addTitle(title: "b") }`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.Marshal(op.Execute(context.Background()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"data":{"a":["a"],"b":["a","b"]}}`; string(got) != want {
+		t.Errorf("mutation が順に実行されていません, got = %s, want = %s", got, want)
+	}
+}
+
+func TestPrepareError(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		params graphql.Params
+		// want は、エラーのメッセージに含まれる文字列である。
+		want string
+	}{
+		"Syntax": {
+			params: graphql.Params{Query: `{ books { title }`},
+			want:   "構文エラー",
+		},
+		"Unknown Field": {
+			params: graphql.Params{Query: `{ books { isbn } }`},
+			want:   "フィールド isbn は存在しません",
+		},
+		"Missing Argument": {
+			params: graphql.Params{Query: `{ book { title } }`},
+			want:   "引数 id は必須です",
+		},
+		"Missing Selection": {
+			params: graphql.Params{Query: `{ books }`},
+			want:   "フィールドを選択する必要があります",
+		},
+		"Invalid Variable": {
+			params: graphql.Params{Query: `query ($first: Int) { books(first: $first) { id } }`, Variables: map[string]interface{}{"first": "ten"}},
+			want:   "変数 $first が不正です",
+		},
+		"Undefined Variable": {
+			params: graphql.Params{Query: `{ books(first: $first) { id } }`},
+			want:   "変数 $first が定義されていません",
+		},
+		"Fragment Cycle": {
+			params: graphql.Params{Query: `{ books { ...A } } fragment A on Book { ...B } fragment B on Book { ...A }`},
+			want:   "循環しています",
+		},
+		"Depth": {
+			params: graphql.Params{Query: `{ books { author { name } } }`, MaxDepth: 2},
+			want:   "クエリの深さが上限の 2 を超えています",
+		},
+		"Complexity": {
+			params: graphql.Params{Query: `{ books(first: 100) { id title } }`, MaxComplexity: 100},
+			want:   "クエリの複雑さが上限の 100 を超えています",
+		},
+		"Conflict": {
+			params: graphql.Params{Query: `{ books { x: id x: title } }`},
+			want:   "異なるフィールド",
+		},
+		"Multiple Subscription Fields": {
+			params: graphql.Params{Query: `subscription { a: bookAdded { id } b: bookAdded { id } }`},
+			want:   "1つのフィールドのみ",
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := newTestSchema(t).Prepare(c.params)
+			if err == nil {
+				t.Fatal("エラーが返されませんでした")
+			}
+			if !strings.Contains(err.Error(), c.want) {
+				t.Errorf("期待していないエラーです, got = %q, want = %q", err, c.want)
+			}
+		})
+	}
+}
+
+func TestPrepareRepeatedFragments(t *testing.T) {
+	t.Parallel()
+
+	// NOTE: 各フラグメントが次のフラグメントを2回展開するため、展開の度に検証すると 2^levels 回の検証を要する。
+	const levels = 64
+	var b strings.Builder
+	b.WriteString("{ ...F0 }\n")
+	for i := 0; i < levels; i++ {
+		fmt.Fprintf(&b, "fragment F%d on Query { ...F%d ...F%d }\n", i, i+1, i+1)
+	}
+	fmt.Fprintf(&b, "fragment F%d on Query { books { id } }\n", levels)
+
+	done := make(chan error, 1)
+	go func() {
+		op, err := newTestSchema(t).Prepare(graphql.Params{Query: b.String(), MaxDepth: 10, MaxComplexity: 100})
+		if err == nil && op.Complexity != 10 {
+			err = fmt.Errorf("複雑さが一致しません, got = %d, want = 10", op.Complexity)
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("同じフラグメントの展開の検証が終わりません")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	t.Parallel()
+
+	op, err := newTestSchema(t).Prepare(graphql.Params{Query: `subscription { bookAdded { id title } }`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	results, err := op.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for r := range results {
+		b, err := json.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, string(b))
+	}
+	want := []string{
+		`{"data":{"bookAdded":{"id":"1","title":"Go"}}}`,
+		`{"data":{"bookAdded":{"id":"2","title":"SQL"}}}`,
+		`{"data":{"bookAdded":{"id":"3","title":"HTTP"}}}`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("期待していないイベントです (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,299 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// tokenKind は、字句の種類である。
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+func (k tokenKind) String() string {
+	switch k {
+	case tokenEOF:
+		return "<EOF>"
+	case tokenPunct:
+		return "punctuator"
+	case tokenName:
+		return "name"
+	case tokenInt:
+		return "int"
+	case tokenFloat:
+		return "float"
+	default:
+		return "string"
+	}
+}
+
+// token は、字句である。 value は、文字列の場合はエスケープを解除した値である。
+type token struct {
+	kind  tokenKind
+	value string
+	loc   Location
+}
+
+// lexer は、GraphQLのクエリを字句に分割する。
+//
+// Ref: https://spec.graphql.org/October2021/#sec-Language.Source-Text
+type lexer struct {
+	src  string
+	pos  int
+	line int
+	// lineStart は、現在の行の先頭の位置である。
+	lineStart int
+}
+
+func newLexer(src string) *lexer {
+	return &lexer{src: src, line: 1}
+}
+
+func (l *lexer) location() Location {
+	return Location{Line: l.line, Column: l.pos - l.lineStart + 1}
+}
+
+func (l *lexer) errorf(loc Location, format string, args ...interface{}) *Error {
+	return &Error{Message: "構文エラー: " + fmt.Sprintf(format, args...), Locations: []Location{loc}}
+}
+
+// skipIgnored は、空白、改行、カンマ及びコメントを読み飛ばす。
+func (l *lexer) skipIgnored() {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; c {
+		case ' ', '\t', ',':
+			l.pos++
+		case '\n':
+			l.pos++
+			l.line++
+			l.lineStart = l.pos
+		case '\r':
+			l.pos++
+			if l.pos < len(l.src) && l.src[l.pos] == '\n' {
+				l.pos++
+			}
+			l.line++
+			l.lineStart = l.pos
+		case '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' && l.src[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			// NOTE: UTF-8のBOMも無視する。
+			if strings.HasPrefix(l.src[l.pos:], "\uFEFF") {
+				l.pos += len("\uFEFF")
+				continue
+			}
+			return
+		}
+	}
+}
+
+// next は、次の字句を返す。
+func (l *lexer) next() (token, error) {
+	l.skipIgnored()
+	loc := l.location()
+	if l.pos >= len(l.src) {
+		return token{kind: tokenEOF, loc: loc}, nil
+	}
+
+	c := l.src[l.pos]
+	switch {
+	case strings.IndexByte("!$&():=@[]{}|", c) >= 0:
+		l.pos++
+		return token{kind: tokenPunct, value: string(c), loc: loc}, nil
+	case c == '.':
+		if !strings.HasPrefix(l.src[l.pos:], "...") {
+			return token{}, l.errorf(loc, "予期しない文字です: %q", c)
+		}
+		l.pos += 3
+		return token{kind: tokenPunct, value: "...", loc: loc}, nil
+	case c == '_' || isLetter(c):
+		start := l.pos
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || isLetter(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		return token{kind: tokenName, value: l.src[start:l.pos], loc: loc}, nil
+	case c == '-' || isDigit(c):
+		return l.number(loc)
+	case c == '"':
+		if strings.HasPrefix(l.src[l.pos:], `"""`) {
+			return l.blockString(loc)
+		}
+		return l.string(loc)
+	}
+	r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+	return token{}, l.errorf(loc, "予期しない文字です: %q", r)
+}
+
+func (l *lexer) number(loc Location) (token, error) {
+	start := l.pos
+	if l.src[l.pos] == '-' {
+		l.pos++
+	}
+	digits := func() int {
+		n := 0
+		for l.pos < len(l.src) && isDigit(l.src[l.pos]) {
+			l.pos++
+			n++
+		}
+		return n
+	}
+	intStart := l.pos
+	if digits() == 0 {
+		return token{}, l.errorf(loc, "数値が不正です: %s", l.src[start:l.pos])
+	}
+	if l.src[intStart] == '0' && l.pos-intStart > 1 {
+		return token{}, l.errorf(loc, "数値の先頭に0は指定できません: %s", l.src[start:l.pos])
+	}
+
+	kind := tokenInt
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		l.pos++
+		kind = tokenFloat
+		if digits() == 0 {
+			return token{}, l.errorf(loc, "数値が不正です: %s", l.src[start:l.pos])
+		}
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		l.pos++
+		kind = tokenFloat
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		if digits() == 0 {
+			return token{}, l.errorf(loc, "数値が不正です: %s", l.src[start:l.pos])
+		}
+	}
+	// NOTE: 数値の直後に名前または小数点が続く場合(e.g. 1x, 1.2.3)は不正とする。
+	if l.pos < len(l.src) && (l.src[l.pos] == '.' || l.src[l.pos] == '_' || isLetter(l.src[l.pos])) {
+		return token{}, l.errorf(loc, "数値が不正です: %s", l.src[start:l.pos+1])
+	}
+	return token{kind: kind, value: l.src[start:l.pos], loc: loc}, nil
+}
+
+func (l *lexer) string(loc Location) (token, error) {
+	l.pos++
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return token{kind: tokenString, value: b.String(), loc: loc}, nil
+		case c == '\n' || c == '\r':
+			return token{}, l.errorf(loc, "文字列が閉じられていません")
+		case c == '\\':
+			if l.pos+1 >= len(l.src) {
+				return token{}, l.errorf(loc, "文字列が閉じられていません")
+			}
+			esc := l.src[l.pos+1]
+			l.pos += 2
+			switch esc {
+			case '"', '\\', '/':
+				b.WriteByte(esc)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if l.pos+4 > len(l.src) {
+					return token{}, l.errorf(loc, "エスケープが不正です")
+				}
+				n, err := strconv.ParseUint(l.src[l.pos:l.pos+4], 16, 32)
+				if err != nil {
+					return token{}, l.errorf(loc, "エスケープが不正です: \\u%s", l.src[l.pos:l.pos+4])
+				}
+				l.pos += 4
+				b.WriteRune(rune(n))
+			default:
+				return token{}, l.errorf(loc, "エスケープが不正です: \\%c", esc)
+			}
+		default:
+			b.WriteByte(c)
+			l.pos++
+		}
+	}
+	return token{}, l.errorf(loc, "文字列が閉じられていません")
+}
+
+// blockString は、 """ で囲まれた文字列を読み込む。
+//
+// Ref: https://spec.graphql.org/October2021/#BlockStringValue()
+func (l *lexer) blockString(loc Location) (token, error) {
+	l.pos += 3
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		switch {
+		case strings.HasPrefix(l.src[l.pos:], `"""`):
+			l.pos += 3
+			return token{kind: tokenString, value: blockStringValue(b.String()), loc: loc}, nil
+		case strings.HasPrefix(l.src[l.pos:], `\"""`):
+			b.WriteString(`"""`)
+			l.pos += 4
+		default:
+			c := l.src[l.pos]
+			b.WriteByte(c)
+			l.pos++
+			if c == '\n' || (c == '\r' && (l.pos >= len(l.src) || l.src[l.pos] != '\n')) {
+				l.line++
+				l.lineStart = l.pos
+			}
+		}
+	}
+	return token{}, l.errorf(loc, "文字列が閉じられていません")
+}
+
+// blockStringValue は、ブロック文字列の共通のインデント及び前後の空行を取り除く。
+func blockStringValue(raw string) string {
+	lines := strings.Split(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(raw), "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		if n := len(line) - len(trimmed); indent < 0 || n < indent {
+			indent = n
+		}
+	}
+	if indent > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= indent {
+				lines[i] = lines[i][indent:]
+			} else {
+				lines[i] = ""
+			}
+		}
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[0], " \t") == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimLeft(lines[len(lines)-1], " \t") == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,73 @@
+package graphql
+
+import (
+	"context"
+	"sync"
+)
+
+// BatchFunc は、 keys の値をまとめて読み込む。存在しないキーは結果に含めない。
+type BatchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+// Loader は、1回の実行の間に読み込む値をまとめ、N+1回のクエリを避ける。
+//
+// [Loader.Load] は読み込みを予約した [Thunk] を返し、いずれかの Thunk を評価した時点で、予約された全てのキーをまとめて読み込む。
+// 読み込んだ値は保持するため、リクエスト毎に作成する。
+type Loader[K comparable, V any] struct {
+	batch BatchFunc[K, V]
+
+	mu      sync.Mutex
+	pending []K
+	results map[K]*loaderResult[V]
+}
+
+type loaderResult[V any] struct {
+	value V
+	found bool
+	err   error
+	done  bool
+}
+
+// NewLoader は、 batch で値を読み込む [Loader] を返す。
+func NewLoader[K comparable, V any](batch BatchFunc[K, V]) *Loader[K, V] {
+	return &Loader[K, V]{batch: batch, results: make(map[K]*loaderResult[V])}
+}
+
+// Load は、 key の読み込みを予約し、値を返す [Thunk] を返す。値が存在しない場合、Thunk は nil を返す。
+func (l *Loader[K, V]) Load(ctx context.Context, key K) Thunk {
+	l.mu.Lock()
+	if _, ok := l.results[key]; !ok {
+		l.results[key] = &loaderResult[V]{}
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		r := l.results[key]
+		if !r.done {
+			l.dispatch(ctx)
+		}
+		if r.err != nil || !r.found {
+			return nil, r.err
+		}
+		return r.value, nil
+	}
+}
+
+// dispatch は、予約された全てのキーを読み込む。呼び出し元でロックを取得する必要がある。
+func (l *Loader[K, V]) dispatch(ctx context.Context) {
+	keys := l.pending
+	l.pending = nil
+	values, err := l.batch(ctx, keys)
+	for _, k := range keys {
+		r := l.results[k]
+		r.done = true
+		if err != nil {
+			r.err = err
+			continue
+		}
+		r.value, r.found = values[k]
+	}
+}
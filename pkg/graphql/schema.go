@@ -0,0 +1,503 @@
+// Package graphql は、Goのコードでスキーマとリゾルバを定義するGraphQLのサーバの実装を提供する。
+//
+// 仕様のうち、オブジェクト型、スカラ型、リスト型及び非null型、フラグメント、変数、@skip/@include ディレクティブに対応する。
+// インターフェース型、ユニオン型、列挙型、入力オブジェクト型及びイントロスペクション( __typename を除く)には対応しない。
+//
+// Ref: https://spec.graphql.org/October2021/
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Type は、GraphQLの型である。 *Scalar、 *Object、 *List または *NonNull である。
+type Type interface {
+	String() string
+}
+
+// Scalar は、スカラ型である。
+type Scalar struct {
+	Name string
+	// Serialize は、リゾルバが返した値をレスポンスの値に変換する。
+	Serialize func(v interface{}) (interface{}, error)
+	// ParseValue は、引数または変数の値を変換する。
+	// 値は JSON を [encoding/json.Decoder.UseNumber] で読み込んだ場合と同じ型(e.g. 数値は [encoding/json.Number])である。
+	ParseValue func(v interface{}) (interface{}, error)
+}
+
+func (s *Scalar) String() string {
+	return s.Name
+}
+
+// Object は、オブジェクト型である。
+type Object struct {
+	Name   string
+	Fields []*Field
+
+	fields map[string]*Field
+}
+
+func (o *Object) String() string {
+	return o.Name
+}
+
+// field は、 name のフィールドを返す。存在しない場合は nil を返す。
+func (o *Object) field(name string) *Field {
+	return o.fields[name]
+}
+
+// List は、リスト型である。
+type List struct {
+	OfType Type
+}
+
+func (l *List) String() string {
+	return "[" + l.OfType.String() + "]"
+}
+
+// NonNull は、非null型である。
+type NonNull struct {
+	OfType Type
+}
+
+func (n *NonNull) String() string {
+	return n.OfType.String() + "!"
+}
+
+// ResolveParams は、 [ResolveFunc] に与える値である。
+type ResolveParams struct {
+	// Source は、親のフィールドの値である。ルートのフィールドでは nil である。subscription では配信されたイベントである。
+	Source interface{}
+	// Args は、デフォルト値を適用した引数である。指定されなかった引数は含まない。
+	Args map[string]interface{}
+}
+
+// ResolveFunc は、フィールドの値を返す。
+//
+// 値の代わりに [Thunk] を返した場合、同じ選択セットの他のフィールドのリゾルバを呼び出した後に値を評価する( [Loader] を参照)。
+type ResolveFunc func(ctx context.Context, p ResolveParams) (interface{}, error)
+
+// SubscribeFunc は、subscription のフィールドに配信するイベントのチャネルを返す。
+//
+// チャネルは ctx の終了時に閉じる必要がある。
+type SubscribeFunc func(ctx context.Context, args map[string]interface{}) (<-chan interface{}, error)
+
+// Thunk は、評価を遅延したフィールドの値である。
+type Thunk func() (interface{}, error)
+
+// Field は、オブジェクト型のフィールドである。
+type Field struct {
+	Name string
+	Type Type
+	Args []*Argument
+	// Resolve は、フィールドの値を返す。nil の場合、親の値が map[string]interface{} であれば Name のキーの値とする。
+	Resolve ResolveFunc
+	// Subscribe は、subscription のルートのフィールドにのみ指定する。
+	Subscribe SubscribeFunc
+	// Complexity は、引数及び子のフィールドの複雑さの合計から、フィールドの複雑さを返す。
+	// nil の場合は 1 + childComplexity とする。リストを返すフィールドでは、要素の数を乗じる必要がある。
+	Complexity func(args map[string]interface{}, childComplexity int) int
+}
+
+// Argument は、フィールドの引数である。
+type Argument struct {
+	Name string
+	Type Type
+	// DefaultValue は、引数が指定されなかった場合の値である。nil の場合は Args に含めない。
+	DefaultValue interface{}
+}
+
+// 組み込みのスカラ型である。
+var (
+	Int = &Scalar{
+		Name: "Int",
+		Serialize: func(v interface{}) (interface{}, error) {
+			switch v := v.(type) {
+			case int:
+				return v, nil
+			case int32:
+				return v, nil
+			case int64:
+				return v, nil
+			}
+			return nil, fmt.Errorf("Int として出力できない値です: %v", v)
+		},
+		ParseValue: func(v interface{}) (interface{}, error) {
+			if n, ok := v.(json.Number); ok {
+				// NOTE: 仕様上、Int は32ビットの符号付き整数である。
+				if i, err := strconv.ParseInt(string(n), 10, 32); err == nil {
+					return int(i), nil
+				}
+			}
+			return nil, fmt.Errorf("Int ではありません: %v", v)
+		},
+	}
+	Float = &Scalar{
+		Name: "Float",
+		Serialize: func(v interface{}) (interface{}, error) {
+			switch v := v.(type) {
+			case float64:
+				return v, nil
+			case int:
+				return float64(v), nil
+			}
+			return nil, fmt.Errorf("Float として出力できない値です: %v", v)
+		},
+		ParseValue: func(v interface{}) (interface{}, error) {
+			if n, ok := v.(json.Number); ok {
+				if f, err := n.Float64(); err == nil && !math.IsInf(f, 0) {
+					return f, nil
+				}
+			}
+			return nil, fmt.Errorf("Float ではありません: %v", v)
+		},
+	}
+	String = &Scalar{
+		Name: "String",
+		Serialize: func(v interface{}) (interface{}, error) {
+			switch v := v.(type) {
+			case string:
+				return v, nil
+			case fmt.Stringer:
+				return v.String(), nil
+			}
+			return nil, fmt.Errorf("String として出力できない値です: %v", v)
+		},
+		ParseValue: func(v interface{}) (interface{}, error) {
+			if s, ok := v.(string); ok {
+				return s, nil
+			}
+			return nil, fmt.Errorf("String ではありません: %v", v)
+		},
+	}
+	Boolean = &Scalar{
+		Name: "Boolean",
+		Serialize: func(v interface{}) (interface{}, error) {
+			if b, ok := v.(bool); ok {
+				return b, nil
+			}
+			return nil, fmt.Errorf("Boolean として出力できない値です: %v", v)
+		},
+		ParseValue: func(v interface{}) (interface{}, error) {
+			if b, ok := v.(bool); ok {
+				return b, nil
+			}
+			return nil, fmt.Errorf("Boolean ではありません: %v", v)
+		},
+	}
+	// ID は、文字列として出力する。引数には文字列及び整数を指定できる。
+	ID = &Scalar{
+		Name: "ID",
+		Serialize: func(v interface{}) (interface{}, error) {
+			switch v := v.(type) {
+			case string:
+				return v, nil
+			case int:
+				return strconv.Itoa(v), nil
+			case int64:
+				return strconv.FormatInt(v, 10), nil
+			}
+			return nil, fmt.Errorf("ID として出力できない値です: %v", v)
+		},
+		ParseValue: func(v interface{}) (interface{}, error) {
+			switch v := v.(type) {
+			case string:
+				return v, nil
+			case json.Number:
+				if _, err := v.Int64(); err == nil {
+					return string(v), nil
+				}
+			}
+			return nil, fmt.Errorf("ID ではありません: %v", v)
+		},
+	}
+)
+
+// SchemaConfig は、 [NewSchema] に与える設定を表す。
+type SchemaConfig struct {
+	Query *Object
+	// Mutation は、 mutation のルートの型である。nil の場合は mutation を実行できない。
+	Mutation *Object
+	// Subscription は、 subscription のルートの型である。nil の場合は subscription を実行できない。
+	Subscription *Object
+}
+
+// Schema は、検証済みのスキーマである。
+type Schema struct {
+	query, mutation, subscription *Object
+	// types は、名前付きの型である。変数の型の解決に使用する。
+	types map[string]Type
+}
+
+// NewSchema は、 cfg の型を検証して Schema を返す。
+func NewSchema(cfg SchemaConfig) (*Schema, error) {
+	if cfg.Query == nil {
+		return nil, errors.New("graphql: query type is required")
+	}
+	s := &Schema{
+		query:        cfg.Query,
+		mutation:     cfg.Mutation,
+		subscription: cfg.Subscription,
+		types: map[string]Type{
+			Int.Name:     Int,
+			Float.Name:   Float,
+			String.Name:  String,
+			Boolean.Name: Boolean,
+			ID.Name:      ID,
+		},
+	}
+	for _, root := range []*Object{cfg.Query, cfg.Mutation, cfg.Subscription} {
+		if root == nil {
+			continue
+		}
+		if err := s.register(root); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range s.subscriptionFields() {
+		if f.Subscribe == nil {
+			return nil, fmt.Errorf("graphql: subscription field %s has no Subscribe", f.Name)
+		}
+	}
+	return s, nil
+}
+
+func (s *Schema) subscriptionFields() []*Field {
+	if s.subscription == nil {
+		return nil
+	}
+	return s.subscription.Fields
+}
+
+// register は、 t 及び t から参照する型を登録する。
+func (s *Schema) register(t Type) error {
+	switch t := t.(type) {
+	case *List:
+		return s.register(t.OfType)
+	case *NonNull:
+		if _, ok := t.OfType.(*NonNull); ok {
+			return fmt.Errorf("graphql: %s is not a valid type", t)
+		}
+		return s.register(t.OfType)
+	case *Scalar:
+		if registered, ok := s.types[t.Name]; ok && registered != t {
+			return fmt.Errorf("graphql: duplicate type %s", t.Name)
+		}
+		s.types[t.Name] = t
+		return nil
+	case *Object:
+		if registered, ok := s.types[t.Name]; ok {
+			if registered != t {
+				return fmt.Errorf("graphql: duplicate type %s", t.Name)
+			}
+			return nil
+		}
+		s.types[t.Name] = t
+		t.fields = make(map[string]*Field, len(t.Fields))
+		for _, f := range t.Fields {
+			if _, ok := t.fields[f.Name]; ok || strings.HasPrefix(f.Name, "__") {
+				return fmt.Errorf("graphql: invalid field %s.%s", t.Name, f.Name)
+			}
+			t.fields[f.Name] = f
+			if err := s.register(f.Type); err != nil {
+				return err
+			}
+			for _, a := range f.Args {
+				if !isInputType(a.Type) {
+					return fmt.Errorf("graphql: argument %s of %s.%s must be an input type", a.Name, t.Name, f.Name)
+				}
+				if err := s.register(a.Type); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("graphql: unknown type %T", t)
+	}
+}
+
+// isInputType は、 t が引数及び変数に使用できる型であるかを返す。
+func isInputType(t Type) bool {
+	switch t := t.(type) {
+	case *List:
+		return isInputType(t.OfType)
+	case *NonNull:
+		return isInputType(t.OfType)
+	case *Scalar:
+		return true
+	}
+	return false
+}
+
+// namedType は、リスト型及び非null型を除いた型を返す。
+func namedType(t Type) Type {
+	for {
+		switch tt := t.(type) {
+		case *List:
+			t = tt.OfType
+		case *NonNull:
+			t = tt.OfType
+		default:
+			return t
+		}
+	}
+}
+
+// Location は、クエリ中の位置である。
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// Error は、レスポンスの errors に含めるエラーである。
+//
+// Ref: https://spec.graphql.org/October2021/#sec-Errors
+type Error struct {
+	Message   string     `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+	// Path は、エラーが発生したフィールドのレスポンス中のパスである。要素はキー(string)またはリストの添字(int)である。
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+
+	// err は、リゾルバが返したエラーである。
+	err error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap は、リゾルバが返したエラーを返す。
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// Errors は、クエリの構文または検証のエラーである。
+type Errors []*Error
+
+func (es Errors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Result は、操作の実行結果である。
+type Result struct {
+	// Data は、実行した結果である。実行前にエラーが発生した場合、またはnullが伝搬した場合は nil である。
+	Data   *OrderedMap
+	Errors []*Error
+
+	// executed は、実行を開始したかを表す。実行前のエラーでは、レスポンスに data を含めない。
+	executed bool
+}
+
+// ErrorResult は、 [Schema.Prepare] 等が返したエラーを、実行前のエラーとして Result に変換する。
+func ErrorResult(err error) *Result {
+	var es Errors
+	if errors.As(err, &es) {
+		return &Result{Errors: es}
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return &Result{Errors: []*Error{e}}
+	}
+	return &Result{Errors: []*Error{{Message: err.Error(), err: err}}}
+}
+
+// MarshalJSON は、 errors 及び data の順に出力する。
+func (r *Result) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	if len(r.Errors) > 0 {
+		b, err := json.Marshal(r.Errors)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(`"errors":`)
+		buf.Write(b)
+	}
+	if r.executed {
+		if len(r.Errors) > 0 {
+			buf.WriteByte(',')
+		}
+		b, err := json.Marshal(r.Data)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(`"data":`)
+		buf.Write(b)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// OrderedMap は、キーを追加した順に JSON に出力するマップである。レスポンスのフィールドはクエリの順に出力する必要がある。
+type OrderedMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newOrderedMap(n int) *OrderedMap {
+	return &OrderedMap{keys: make([]string, 0, n), values: make(map[string]interface{}, n)}
+}
+
+func (m *OrderedMap) set(key string, v interface{}) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = v
+}
+
+// Get は、 key の値を返す。
+func (m *OrderedMap) Get(key string) (interface{}, bool) {
+	if m == nil {
+		return nil, false
+	}
+	v, ok := m.values[key]
+	return v, ok
+}
+
+// Keys は、キーを追加した順に返す。
+func (m *OrderedMap) Keys() []string {
+	if m == nil {
+		return nil
+	}
+	return m.keys
+}
+
+// MarshalJSON は、キーを追加した順に出力する。
+func (m *OrderedMap) MarshalJSON() ([]byte, error) {
+	if m == nil {
+		return []byte("null"), nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		kb, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		vb, err := json.Marshal(m.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(kb)
+		buf.WriteByte(':')
+		buf.Write(vb)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
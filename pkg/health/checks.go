@@ -0,0 +1,58 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// PingDB は、 db に接続できるかを確認する [Checker] を返す。
+func PingDB(db *sql.DB) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	})
+}
+
+// DiskSpace は、 dir を含むファイルシステムの空き容量が minFree バイト以上あるかを確認する [Checker] を返す。
+//
+// 空き容量を取得できないOSでは、常に成功する。
+func DiskSpace(dir string, minFree uint64) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		free, err := freeSpace(dir)
+		if errors.Is(err, errors.ErrUnsupported) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("free space of %s is %d bytes, want >= %d bytes", dir, free, minFree)
+		}
+		return nil
+	})
+}
+
+// ErrShuttingDown は、シャットダウンを開始した事を表す。
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// Shutdown は、シャットダウンを開始した後に失敗する [Checker] である。
+//
+// Readiness probe に登録する事で、ロードバランサがサーバを切り離してから処理中のリクエストを終了できる。
+type Shutdown struct {
+	started atomic.Bool
+}
+
+// Begin は、シャットダウンの開始を記録する。
+func (s *Shutdown) Begin() {
+	s.started.Store(true)
+}
+
+// Check は、 [Checker] を実装する。
+func (s *Shutdown) Check(ctx context.Context) error {
+	if s.started.Load() {
+		return ErrShuttingDown
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd
+
+package health
+
+import "syscall"
+
+func freeSpace(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	// NOTE: OSによってフィールドの型が異なるため、明示的に変換する。
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
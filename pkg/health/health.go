@@ -0,0 +1,90 @@
+// Package health は、Liveness/Readiness probe のための依存先のチェックを提供する。
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout は、タイムアウトを指定せずに登録したチェックのタイムアウトである。
+const DefaultTimeout = time.Second
+
+// Checker は、依存先が利用可能かを確認する。利用できない場合はエラーを返す。
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc は、関数を [Checker] として扱うための型である。
+type CheckerFunc func(ctx context.Context) error
+
+// Check は、 [Checker] を実装する。
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Result は、1つのチェックの結果である。
+type Result struct {
+	Name    string
+	Latency time.Duration
+	// Err は、チェックに失敗した場合のエラーである。成功した場合は nil となる。
+	Err error
+}
+
+type check struct {
+	name    string
+	checker Checker
+	timeout time.Duration
+}
+
+// Registry は、 [Checker] を登録順に保持する。
+type Registry struct {
+	mu     sync.RWMutex
+	checks []check
+}
+
+// NewRegistry は、空の Registry を返す。
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register は、 c を name という名前で登録する。 timeout が0以下の場合は [DefaultTimeout] を使用する。
+func (r *Registry) Register(name string, c Checker, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks = append(r.checks, check{name: name, checker: c, timeout: timeout})
+}
+
+// Run は、登録された全てのチェックを並行に実行し、登録順に結果を返す。
+func (r *Registry) Run(ctx context.Context) []Result {
+	r.mu.RLock()
+	checks := append([]check(nil), r.checks...)
+	r.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		i, c := i, c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			now := time.Now()
+			err := c.checker.Check(ctx)
+			results[i] = Result{
+				Name:    c.name,
+				Latency: time.Since(now),
+				Err:     err,
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,78 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/pkg/health"
+)
+
+func TestRun(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	reg := health.NewRegistry()
+	reg.Register("ok", health.CheckerFunc(func(ctx context.Context) error {
+		return nil
+	}), 0)
+	reg.Register("failed", health.CheckerFunc(func(ctx context.Context) error {
+		return errFailed
+	}), 0)
+	reg.Register("timeout", health.CheckerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), 10*time.Millisecond)
+
+	results := reg.Run(context.Background())
+
+	wants := []struct {
+		name string
+		err  error
+	}{
+		{"ok", nil},
+		{"failed", errFailed},
+		{"timeout", context.DeadlineExceeded},
+	}
+	if len(results) != len(wants) {
+		t.Fatalf("期待していない結果の数です, got = %d, want = %d", len(results), len(wants))
+	}
+	for i, want := range wants {
+		got := results[i]
+		if got.Name != want.name {
+			t.Errorf("登録順に結果が返されていません, got = %s, want = %s", got.Name, want.name)
+		}
+		if !errors.Is(got.Err, want.err) {
+			t.Errorf("期待していないエラーです, name = %s, got = %v, want = %v", got.Name, got.Err, want.err)
+		}
+	}
+	if results[2].Latency < 10*time.Millisecond {
+		t.Errorf("処理時間が記録されていません, got = %v", results[2].Latency)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	var s health.Shutdown
+	if err := s.Check(context.Background()); err != nil {
+		t.Errorf("シャットダウンの開始前に失敗しています: %v", err)
+	}
+	s.Begin()
+	if err := s.Check(context.Background()); !errors.Is(err, health.ErrShuttingDown) {
+		t.Errorf("シャットダウンの開始後に成功しています, got = %v", err)
+	}
+}
+
+func TestDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+	if err := health.DiskSpace(dir, 0).Check(context.Background()); err != nil {
+		t.Errorf("予期しないエラーが発生しました: %v", err)
+	}
+	// NOTE: 空き容量を取得できないOSでは常に成功するため、失敗のみを確認する。
+	if err := health.DiskSpace(dir+"/not-exist", 0).Check(context.Background()); err == nil {
+		t.Skip("空き容量を取得できないOSです")
+	}
+	if err := health.DiskSpace(dir, math.MaxUint64).Check(context.Background()); err == nil {
+		t.Error("空き容量が不足しているにも関わらず成功しています")
+	}
+}
@@ -0,0 +1,35 @@
+package httperror
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/pkg/requestid"
+)
+
+// Write は、 status 及びリクエストIDを含むエラーレスポンスを書き込む。
+//
+// エラー詳細はユーザに見せるべきではないため、メッセージには [net/http.StatusText] を使用する。
+func Write(w http.ResponseWriter, r *http.Request, status int) {
+	WriteResponse(w, status, New(r, status))
+}
+
+// New は、 status 及びリクエストIDを含むエラーレスポンスを返す。
+//
+// 任意の項目(e.g. panicのID)を追加する場合は、 [WriteResponse] で書き込む。
+func New(r *http.Request, status int) *model.ErrorResponse {
+	return &model.ErrorResponse{
+		Message:   http.StatusText(status),
+		RequestID: requestid.FromContext(r.Context()),
+	}
+}
+
+// WriteResponse は、 res をエラーレスポンスとして書き込む。
+func WriteResponse(w http.ResponseWriter, status int, res *model.ErrorResponse) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+
+	// NOTE: 書き込みに失敗するのはクライアントとの接続が切れた場合であり、サーバ側で対処できないため無視する。
+	_ = json.NewEncoder(w).Encode(res)
+}
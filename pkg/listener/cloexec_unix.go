@@ -0,0 +1,9 @@
+//go:build unix
+
+package listener
+
+import "syscall"
+
+func closeOnExec(fd int) {
+	syscall.CloseOnExec(fd)
+}
@@ -0,0 +1,3 @@
+package listener
+
+var ListenersFromEnv = listenersFromEnv
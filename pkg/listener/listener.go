@@ -0,0 +1,164 @@
+// Package listener は、アドレスの文字列からTCP、Unixドメインソケット及びsystemdのソケットアクティベーションの
+// [net.Listener] を作成する。
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// UnixPrefix は、Unixドメインソケットのパスを表すアドレスの接頭辞である(e.g. unix:/run/go-stations.sock)。
+	UnixPrefix = "unix:"
+	// SystemdPrefix は、systemdから渡されたソケットの名前を表すアドレスの接頭辞である(e.g. systemd:go-stations.socket)。
+	SystemdPrefix = "systemd:"
+)
+
+const (
+	// NetworkTCP は、TCPで待ち受ける事を表す。
+	NetworkTCP = "tcp"
+	// NetworkUnix は、Unixドメインソケットで待ち受ける事を表す。
+	NetworkUnix = "unix"
+	// NetworkSystemd は、systemdから渡されたソケットで待ち受ける事を表す。
+	NetworkSystemd = "systemd"
+)
+
+// staleCheckTimeout は、既存のソケットファイルを使用中のプロセスが存在するかを確認する際のタイムアウトである。
+const staleCheckTimeout = time.Second
+
+// Config は、Unixドメインソケットのファイルの設定を表す。TCP及びsystemdのソケットには適用しない。
+type Config struct {
+	// Mode は、ソケットファイルのパーミッションである。0 の場合は umask に従う。
+	Mode fs.FileMode
+	// Owner は、ソケットファイルの所有者(user または user:group)である。名前及び数値のIDを指定できる。
+	// 空文字の場合は変更しない。
+	Owner string
+}
+
+// ParseAddr は、 addr を待ち受ける方式( NetworkTCP 等)と、方式毎のアドレスに分解する。
+func ParseAddr(addr string) (network, address string, err error) {
+	switch {
+	case strings.HasPrefix(addr, UnixPrefix):
+		network, address = NetworkUnix, strings.TrimPrefix(addr, UnixPrefix)
+	case strings.HasPrefix(addr, SystemdPrefix):
+		network, address = NetworkSystemd, strings.TrimPrefix(addr, SystemdPrefix)
+	default:
+		network, address = NetworkTCP, addr
+	}
+	if address == "" {
+		return "", "", fmt.Errorf("待ち受けるアドレスを指定する必要があります: %q", addr)
+	}
+	return network, address, nil
+}
+
+// Listen は、 addr で待ち受ける [net.Listener] を返す。
+//
+// addr は、 host:port 形式のTCPのアドレス、 [UnixPrefix] から始まるソケットファイルのパス、
+// または [SystemdPrefix] から始まるsystemdのソケットの名前( FileDescriptorName= )である。
+//
+// Unixドメインソケットの場合、他のプロセスが使用していない古いソケットファイルは削除してから作成し、
+// cfg に従ってパーミッション及び所有者を設定する。ソケットファイルは [net.Listener.Close] で削除される。
+func Listen(addr string, cfg Config) (net.Listener, error) {
+	network, address, err := ParseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	switch network {
+	case NetworkUnix:
+		return listenUnix(address, cfg)
+	case NetworkSystemd:
+		return systemdListener(address)
+	default:
+		return net.Listen("tcp", address)
+	}
+}
+
+func listenUnix(path string, cfg Config) (net.Listener, error) {
+	if err := removeStale(path); err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// NOTE: ソケットの作成から設定までの間は umask に従ったパーミッションとなるため、umask は厳しく設定しておく事。
+	if err := configure(path, cfg); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// removeStale は、異常終了したプロセスが残したソケットファイルを削除する。
+func removeStale(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%s はソケットファイルではないため、削除できません", path)
+	}
+	conn, err := net.DialTimeout("unix", path, staleCheckTimeout)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%s は他のプロセスが使用しています", path)
+	}
+	return os.Remove(path)
+}
+
+func configure(path string, cfg Config) error {
+	if cfg.Mode != 0 {
+		if err := os.Chmod(path, cfg.Mode); err != nil {
+			return err
+		}
+	}
+	if cfg.Owner != "" {
+		uid, gid, err := lookupOwner(cfg.Owner)
+		if err != nil {
+			return err
+		}
+		if err := os.Chown(path, uid, gid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookupOwner は、 user[:group] 形式の所有者をIDに変換する。指定されていない場合は -1 (変更しない)を返す。
+func lookupOwner(owner string) (uid, gid int, err error) {
+	uid, gid = -1, -1
+	name, group, hasGroup := strings.Cut(owner, ":")
+	if name != "" {
+		if uid, err = strconv.Atoi(name); err != nil {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return 0, 0, err
+			}
+			if uid, err = strconv.Atoi(u.Uid); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	if hasGroup && group != "" {
+		if gid, err = strconv.Atoi(group); err != nil {
+			g, err := user.LookupGroup(group)
+			if err != nil {
+				return 0, 0, err
+			}
+			if gid, err = strconv.Atoi(g.Gid); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	return uid, gid, nil
+}
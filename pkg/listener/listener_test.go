@@ -0,0 +1,136 @@
+package listener_test
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/pkg/listener"
+)
+
+func TestParseAddr(t *testing.T) {
+	testcases := map[string]struct {
+		addr        string
+		wantNetwork string
+		wantAddress string
+		wantErr     bool
+	}{
+		"TCP": {
+			addr:        ":8080",
+			wantNetwork: listener.NetworkTCP,
+			wantAddress: ":8080",
+		},
+		"Unix": {
+			addr:        "unix:/run/app.sock",
+			wantNetwork: listener.NetworkUnix,
+			wantAddress: "/run/app.sock",
+		},
+		"Systemd": {
+			addr:        "systemd:app.socket",
+			wantNetwork: listener.NetworkSystemd,
+			wantAddress: "app.socket",
+		},
+		"Empty path": {
+			addr:    "unix:",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testcases {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			network, address, err := listener.ParseAddr(tc.addr)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("期待していないエラーです, got = %v, wantErr = %v", err, tc.wantErr)
+			}
+			if network != tc.wantNetwork || address != tc.wantAddress {
+				t.Errorf("期待していない値です, got = (%s, %s), want = (%s, %s)", network, address, tc.wantNetwork, tc.wantAddress)
+			}
+		})
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+	ln, err := listener.Listen(listener.UnixPrefix+path, listener.Config{
+		Mode:  0o600,
+		Owner: strconv.Itoa(os.Getuid()),
+	})
+	if err != nil {
+		t.Fatalf("待ち受けに失敗しました: %v", err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("ソケットファイルが作成されていません: %v", err)
+	}
+	if got := fi.Mode().Perm(); got != 0o600 {
+		t.Errorf("期待していないパーミッションです, got = %o", got)
+	}
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "OK")
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	c := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	res, err := c.Get("http://unix/")
+	if err != nil {
+		t.Fatalf("リクエストに失敗しました: %v", err)
+	}
+	defer res.Body.Close()
+	if b, _ := io.ReadAll(res.Body); string(b) != "OK" {
+		t.Errorf("期待していないレスポンスです, got = %s", b)
+	}
+
+	// NOTE: 使用中のソケットファイルは削除しない。
+	if _, err := listener.Listen(listener.UnixPrefix+path, listener.Config{}); err == nil {
+		t.Error("使用中のソケットファイルでエラーが発生していません")
+	}
+}
+
+func TestListenUnixStale(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.sock")
+
+	// NOTE: 異常終了したプロセスを模擬するため、ソケットファイルを残したまま閉じる。
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("待ち受けに失敗しました: %v", err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	ln.Close()
+
+	ln, err = listener.Listen(listener.UnixPrefix+path, listener.Config{})
+	if err != nil {
+		t.Fatalf("古いソケットファイルが削除されていません: %v", err)
+	}
+	ln.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("閉じた後にソケットファイルが残っています, err = %v", err)
+	}
+
+	// NOTE: ソケットファイル以外は、誤って削除しないようエラーとする。
+	regular := filepath.Join(dir, "regular")
+	if err := os.WriteFile(regular, nil, fs.FileMode(0o600)); err != nil {
+		t.Fatalf("ファイルの作成に失敗しました: %v", err)
+	}
+	if _, err := listener.Listen(listener.UnixPrefix+regular, listener.Config{}); err == nil {
+		t.Error("ソケットファイル以外でエラーが発生していません")
+	}
+	if _, err := os.Stat(regular); err != nil {
+		t.Errorf("ソケットファイル以外が削除されています, err = %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package listener
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// listenFDsStart は、systemdが渡すファイルディスクリプタの先頭の番号である。
+//
+// Ref: https://www.freedesktop.org/software/systemd/man/latest/sd_listen_fds.html
+const listenFDsStart = 3
+
+var systemd struct {
+	once      sync.Once
+	mu        sync.Mutex
+	listeners map[string]net.Listener
+	err       error
+}
+
+// systemdListener は、systemdから渡されたソケットのうち、 name に対応するものを返す。
+//
+// 名前は FileDescriptorName= (デフォルトはソケットユニット名)であり、名前が渡されない場合は 0 から始まる番号も指定できる。
+// 同じソケットは一度しか取得できない。
+func systemdListener(name string) (net.Listener, error) {
+	systemd.once.Do(func() {
+		systemd.listeners, systemd.err = listenersFromEnv(os.Getenv, os.Getpid(), listenFDsStart)
+		// NOTE: 子プロセスに引き継がないよう、環境変数は消去する。
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	})
+	if systemd.err != nil {
+		return nil, systemd.err
+	}
+
+	systemd.mu.Lock()
+	defer systemd.mu.Unlock()
+	ln, ok := systemd.listeners[name]
+	if !ok {
+		return nil, fmt.Errorf("systemdから %s という名前のソケットが渡されていません", name)
+	}
+	// NOTE: 名前及び番号の両方で取得できないよう、同じソケットのキーを全て削除する。
+	for k, v := range systemd.listeners {
+		if v == ln {
+			delete(systemd.listeners, k)
+		}
+	}
+	return ln, nil
+}
+
+// listenersFromEnv は、 LISTEN_PID, LISTEN_FDS 及び LISTEN_FDNAMES に従って、 start 番から始まる
+// ファイルディスクリプタを [net.Listener] に変換し、名前及び番号をキーとして返す。
+func listenersFromEnv(getenv func(string) string, pid, start int) (map[string]net.Listener, error) {
+	listeners := make(map[string]net.Listener)
+	// NOTE: 他のプロセスに宛てた環境変数を引き継いだ場合は無視する。
+	if p, err := strconv.Atoi(getenv("LISTEN_PID")); err != nil || p != pid {
+		return listeners, nil
+	}
+	n, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("LISTEN_FDS が不正です: %q", getenv("LISTEN_FDS"))
+	}
+	var names []string
+	if s := getenv("LISTEN_FDNAMES"); s != "" {
+		names = strings.Split(s, ":")
+	}
+
+	for i := 0; i < n; i++ {
+		fd := start + i
+		closeOnExec(fd)
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		// NOTE: net.FileListener はファイルディスクリプタを複製するため、元のファイルは閉じる。
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("systemdから渡された %d 番目のソケットを使用できません: %w", i, err)
+		}
+		listeners[strconv.Itoa(i)] = ln
+		if i < len(names) && names[i] != "" {
+			listeners[names[i]] = ln
+		}
+	}
+	return listeners, nil
+}
@@ -0,0 +1,59 @@
+//go:build unix
+
+package listener_test
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/pkg/listener"
+)
+
+func TestListenersFromEnv(t *testing.T) {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("待ち受けに失敗しました: %v", err)
+	}
+	defer tcp.Close()
+	f, err := tcp.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("ファイルディスクリプタの取得に失敗しました: %v", err)
+	}
+	defer f.Close()
+	// NOTE: systemdから渡されたファイルディスクリプタは閉じられるため、複製して渡す。
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatalf("ファイルディスクリプタの複製に失敗しました: %v", err)
+	}
+
+	env := map[string]string{
+		"LISTEN_PID":     strconv.Itoa(os.Getpid()),
+		"LISTEN_FDS":     "1",
+		"LISTEN_FDNAMES": "app.socket",
+	}
+	getenv := func(key string) string { return env[key] }
+
+	// NOTE: 他のプロセスに宛てた環境変数は無視する。
+	lns, err := listener.ListenersFromEnv(getenv, os.Getpid()+1, fd)
+	if err != nil || len(lns) != 0 {
+		t.Errorf("他のプロセス宛の環境変数が使用されています, got = %v, err = %v", lns, err)
+	}
+
+	lns, err = listener.ListenersFromEnv(getenv, os.Getpid(), fd)
+	if err != nil {
+		t.Fatalf("予期しないエラーが発生しました: %v", err)
+	}
+	for _, key := range []string{"app.socket", "0"} {
+		ln, ok := lns[key]
+		if !ok {
+			t.Fatalf("%s でソケットを取得できません", key)
+		}
+		if got, want := ln.Addr().String(), tcp.Addr().String(); got != want {
+			t.Errorf("期待していないアドレスです, got = %s, want = %s", got, want)
+		}
+	}
+	lns["0"].Close()
+}
@@ -0,0 +1,326 @@
+package logfile
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "20060102-150405"
+
+// Config は、 [Open] に与える設定を表す。
+type Config struct {
+	// Path は、ログファイルのパスである。
+	Path string
+	// MaxSize は、ローテーションを行うファイルサイズ(バイト)である。0 の場合はサイズによるローテーションを行わない。
+	MaxSize int64
+	// Daily は、日付が変わった際にローテーションを行うかを表す。
+	Daily bool
+	// MaxBackups は、保持するローテーション済みファイルの世代数である。0 の場合は全て保持する。
+	MaxBackups int
+	// Compress は、ローテーション済みファイルをgzip圧縮するかを表す。
+	Compress bool
+	// Now は、ローテーションの判定に使用する時刻の取得元である。nil の場合はシステム時刻を使用する。
+	Now func() time.Time
+}
+
+// Writer は、ローテーション機能を持つログファイルへの [io.Writer] である。
+//
+// 複数のgoroutineから同時に使用できる。
+type Writer struct {
+	cfg Config
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+	closed bool
+
+	// NOTE: 圧縮はリクエストの処理を妨げないよう、バックグラウンドで行う。
+	compressing sync.WaitGroup
+	bgMu        sync.Mutex
+}
+
+// Open は、 cfg.Path のログファイルを追記モードで開いた Writer を返す。
+func Open(cfg Config) (*Writer, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("ログファイルのパスを指定する必要があります")
+	}
+	if cfg.MaxSize < 0 || cfg.MaxBackups < 0 {
+		return nil, fmt.Errorf("ログファイルの最大サイズ及び保持世代数には、0以上を指定する必要があります")
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
+	w := &Writer{cfg: cfg}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write は、 [io.Writer] を実装する。
+//
+// 書き込み前にローテーションの条件を満たした場合、ローテーションを行ってから書き込む。
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	if w.shouldRotate(int64(len(p))) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate は、条件に関わらずローテーションを行う。
+func (w *Writer) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	return w.rotate()
+}
+
+// Reopen は、ログファイルを開き直す。
+//
+// logrotate 等の外部ツールがログファイルを移動した後に呼び出す事で、新しいファイルに書き込むようになる。
+func (w *Writer) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+// Sync は、書き込んだ内容をストレージに反映する。
+func (w *Writer) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	return w.file.Sync()
+}
+
+// Close は、書き込んだ内容をストレージに反映してファイルを閉じる。
+//
+// バックグラウンドで実行中の圧縮がある場合、その完了を待つ。
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	syncErr := w.file.Sync()
+	closeErr := w.file.Close()
+	w.mu.Unlock()
+
+	w.compressing.Wait()
+	if syncErr != nil {
+		return syncErr
+	}
+	return closeErr
+}
+
+func (w *Writer) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.cfg.Path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.cfg.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = info.Size()
+	w.opened = w.cfg.Now()
+	return nil
+}
+
+func (w *Writer) shouldRotate(n int64) bool {
+	// NOTE: 空のファイルをローテーションしても意味が無いため、1行が MaxSize を超える場合もそのまま書き込む。
+	if w.cfg.MaxSize > 0 && w.size > 0 && w.size+n > w.cfg.MaxSize {
+		return true
+	}
+	if w.cfg.Daily {
+		y1, m1, d1 := w.opened.Date()
+		y2, m2, d2 := w.cfg.Now().Date()
+		return y1 != y2 || m1 != m2 || d1 != d2
+	}
+	return false
+}
+
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	backup := w.backupName()
+	if err := os.Rename(w.cfg.Path, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+
+	w.compressing.Add(1)
+	go func() {
+		defer w.compressing.Done()
+
+		// NOTE: 圧縮中のファイルが削除されないよう、圧縮と削除は直列に行う。
+		w.bgMu.Lock()
+		defer w.bgMu.Unlock()
+		if w.cfg.Compress {
+			// NOTE: 圧縮に失敗した場合は、圧縮前のファイルを残す。
+			_ = compress(backup)
+		}
+		_ = w.cleanup()
+	}()
+	return nil
+}
+
+// backupName は、既存のファイルと重複しないローテーション済みファイルの名前を返す。
+func (w *Writer) backupName() string {
+	base := w.cfg.Path + "." + w.cfg.Now().Format(backupTimeFormat)
+	name := base
+	for i := 1; exists(name) || exists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s.%d", base, i)
+	}
+	return name
+}
+
+// cleanup は、 MaxBackups を超えた古いローテーション済みファイルを削除する。
+func (w *Writer) cleanup() error {
+	if w.cfg.MaxBackups == 0 {
+		return nil
+	}
+
+	backups, err := w.backups()
+	if err != nil {
+		return err
+	}
+	for len(backups) > w.cfg.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// backups は、ローテーション済みファイルを古い順に返す。
+//
+// [Writer.backupName] が生成する名前のファイルのみを対象とし、圧縮中の一時ファイルや
+// 利用者が置いたファイル(e.g. access.log.old)は削除しないよう対象外とする。
+func (w *Writer) backups() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Dir(w.cfg.Path))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := filepath.Base(w.cfg.Path) + "."
+	keys := make(map[string]string)
+	var backups []string
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), prefix) {
+			continue
+		}
+		key, ok := backupKey(strings.TrimPrefix(e.Name(), prefix))
+		if !ok {
+			continue
+		}
+		name := filepath.Join(filepath.Dir(w.cfg.Path), e.Name())
+		keys[name] = key
+		backups = append(backups, name)
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return keys[backups[i]] < keys[backups[j]]
+	})
+	return backups, nil
+}
+
+// backupKey は、ローテーション済みファイルの名前からログファイルのパスを除いた suffix を解析し、
+// 古い順に並べるためのキーを返す。 suffix が [Writer.backupName] の生成する形式でない場合は false を返す。
+//
+// 形式は "<日時>[.<連番>][.gz]" である。
+func backupKey(suffix string) (string, bool) {
+	suffix = strings.TrimSuffix(suffix, ".gz")
+	ts, seq, hasSeq := strings.Cut(suffix, ".")
+	if _, err := time.Parse(backupTimeFormat, ts); err != nil {
+		return "", false
+	}
+	n := 0
+	if hasSeq {
+		var err error
+		if n, err = strconv.Atoi(seq); err != nil || n < 1 || strconv.Itoa(n) != seq {
+			return "", false
+		}
+	}
+	return fmt.Sprintf("%s.%09d", ts, n), true
+}
+
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,241 @@
+package logfile_test
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/pkg/logfile"
+)
+
+func TestWriterRotatesBySize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	now := time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+	w, err := logfile.Open(logfile.Config{
+		Path:       path,
+		MaxSize:    10,
+		MaxBackups: 2,
+		Compress:   true,
+		Now:        func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("ログファイルのオープンに失敗しました: %v", err)
+	}
+
+	for _, line := range []string{"line-1\n", "line-2\n", "line-3\n", "line-4\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("書き込みに失敗しました: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("クローズに失敗しました: %v", err)
+	}
+
+	if got := readFile(t, path); got != "line-4\n" {
+		t.Errorf("期待していない内容です, got = %q, want = %q", got, "line-4\n")
+	}
+
+	backups := listBackups(t, path)
+	want := []string{"access.log.20240801-120000.1.gz", "access.log.20240801-120000.2.gz"}
+	if strings.Join(backups, ",") != strings.Join(want, ",") {
+		t.Fatalf("期待していないローテーション済みファイルです, got = %v, want = %v", backups, want)
+	}
+	if got := readGzip(t, filepath.Join(dir, backups[1])); got != "line-3\n" {
+		t.Errorf("期待していない内容です, got = %q, want = %q", got, "line-3\n")
+	}
+}
+
+func TestWriterKeepsUnrelatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	// NOTE: ローテーション済みファイルの形式でないファイルは、 MaxBackups を超えても削除しない。
+	unrelated := []string{
+		"access.log.old",
+		"access.log.bak.gz",
+		"access.log.2024",
+		"access.log.20240801-120000.x",
+		"access.log.20240801-120000.0",
+		"access.log.20240801-120000.01",
+		"access.log.20241301-120000",
+	}
+	for _, name := range unrelated {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+	w, err := logfile.Open(logfile.Config{
+		Path:       path,
+		MaxSize:    10,
+		MaxBackups: 1,
+		Now:        func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("ログファイルのオープンに失敗しました: %v", err)
+	}
+	for _, line := range []string{"line-1\n", "line-2\n", "line-3\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("書き込みに失敗しました: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("クローズに失敗しました: %v", err)
+	}
+
+	want := append([]string{"access.log.20240801-120000.1"}, unrelated...)
+	sort.Strings(want)
+	if got := listBackups(t, path); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("期待していないファイルです, got = %v, want = %v", got, want)
+	}
+}
+
+func TestWriterRotatesDaily(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	now := time.Date(2024, 8, 1, 23, 59, 0, 0, time.UTC)
+	w, err := logfile.Open(logfile.Config{
+		Path:  path,
+		Daily: true,
+		Now:   func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatalf("ログファイルのオープンに失敗しました: %v", err)
+	}
+
+	w.Write([]byte("day-1\n"))
+	now = now.Add(2 * time.Minute)
+	w.Write([]byte("day-2\n"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("クローズに失敗しました: %v", err)
+	}
+
+	if got := readFile(t, path); got != "day-2\n" {
+		t.Errorf("期待していない内容です, got = %q, want = %q", got, "day-2\n")
+	}
+	if got := readFile(t, path+".20240802-000100"); got != "day-1\n" {
+		t.Errorf("期待していない内容です, got = %q, want = %q", got, "day-1\n")
+	}
+}
+
+func TestWriterReopen(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	w, err := logfile.Open(logfile.Config{Path: path})
+	if err != nil {
+		t.Fatalf("ログファイルのオープンに失敗しました: %v", err)
+	}
+	defer w.Close()
+
+	w.Write([]byte("before\n"))
+	// NOTE: logrotate によるファイルの移動を模倣する。
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reopen(); err != nil {
+		t.Fatalf("再オープンに失敗しました: %v", err)
+	}
+	w.Write([]byte("after\n"))
+
+	if got := readFile(t, path+".1"); got != "before\n" {
+		t.Errorf("期待していない内容です, got = %q, want = %q", got, "before\n")
+	}
+	if got := readFile(t, path); got != "after\n" {
+		t.Errorf("期待していない内容です, got = %q, want = %q", got, "after\n")
+	}
+}
+
+func TestWriterConcurrentWrites(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	w, err := logfile.Open(logfile.Config{Path: path, MaxSize: 1024})
+	if err != nil {
+		t.Fatalf("ログファイルのオープンに失敗しました: %v", err)
+	}
+
+	const goroutines, lines = 8, 100
+	line := strings.Repeat("x", 31) + "\n"
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < lines; j++ {
+				w.Write([]byte(line))
+			}
+		}()
+	}
+	wg.Wait()
+	if err := w.Close(); err != nil {
+		t.Fatalf("クローズに失敗しました: %v", err)
+	}
+
+	var total int
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		content := readFile(t, filepath.Join(dir, e.Name()))
+		if len(content) > 1024 {
+			t.Errorf("最大サイズを超えています: %s", e.Name())
+		}
+		for _, l := range strings.SplitAfter(content, "\n") {
+			if l != "" && l != line {
+				t.Fatalf("行が破損しています: %q", l)
+			}
+		}
+		total += strings.Count(content, "\n")
+	}
+	if total != goroutines*lines {
+		t.Errorf("期待していない行数です, got = %d, want = %d", total, goroutines*lines)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ファイルの読み込みに失敗しました: %v", err)
+	}
+	return string(b)
+}
+
+func readGzip(t *testing.T, path string) string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("ファイルの読み込みに失敗しました: %v", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzipの展開に失敗しました: %v", err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("gzipの展開に失敗しました: %v", err)
+	}
+	return string(b)
+}
+
+func listBackups(t *testing.T, path string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, m := range matches {
+		names = append(names, filepath.Base(m))
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,131 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/TechBowl-japan/go-stations/pkg/requestid"
+	"github.com/TechBowl-japan/go-stations/pkg/tracing"
+)
+
+const (
+	// FormatJSON は、1行1レコードのJSON形式で出力する事を表す。
+	FormatJSON = "json"
+	// FormatText は、key=value 形式で出力する事を表す。
+	FormatText = "text"
+)
+
+// KeyPackage は、ログを出力したパッケージを表す属性のキーである。
+const KeyPackage = "package"
+
+// KeyRequestID は、リクエストIDを表す属性のキーである。
+const KeyRequestID = "request_id"
+
+const (
+	// KeyTraceID は、トレースIDを表す属性のキーである。
+	KeyTraceID = "trace_id"
+	// KeySpanID は、スパンIDを表す属性のキーである。
+	KeySpanID = "span_id"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys は、値を出力してはならない属性のキー(小文字)である。
+var sensitiveKeys = map[string]struct{}{
+	"authorization":       {},
+	"proxy-authorization": {},
+	"cookie":              {},
+	"set-cookie":          {},
+	"password":            {},
+	"secret":              {},
+	"token":               {},
+}
+
+// New は、 w に format 形式でログを出力する [log/slog.Logger] を返す。
+//
+// level に [log/slog.LevelVar] を指定する事で、実行中にログレベルを変更できる。
+// 返される Logger は、 *Context 系のメソッドに渡された [context.Context] からリクエストIDを付与する。
+func New(w io.Writer, format string, level slog.Leveler) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	}
+
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case FormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	case FormatText:
+		h = slog.NewTextHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("ログの出力形式には %s または %s を指定する必要があります: %s", FormatJSON, FormatText, format)
+	}
+	return slog.New(&contextHandler{Handler: h}), nil
+}
+
+// ParseLevel は、 debug/info/warn/error のいずれかの文字列をログレベルに変換する。
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return l, fmt.Errorf("ログレベルには debug/info/warn/error のいずれかを指定する必要があります: %s", s)
+	}
+	return l, nil
+}
+
+// Package は、 l にパッケージ名を表す属性を付与した Logger を返す。
+func Package(l *slog.Logger, name string) *slog.Logger {
+	return l.With(slog.String(KeyPackage, name))
+}
+
+// Discard は、何も出力しない Logger を返す。
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+}
+
+// Headers は、HTTPヘッダをログに出力するための [log/slog.Value] を返す。
+//
+// Authorization 等の機密情報を含むヘッダの値は、 [New] が返す Logger によって秘匿される。
+func Headers(h http.Header) slog.Value {
+	attrs := make([]slog.Attr, 0, len(h))
+	for k, v := range h {
+		attrs = append(attrs, slog.String(k, strings.Join(v, ", ")))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func redact(_ []string, a slog.Attr) slog.Attr {
+	if _, ok := sensitiveKeys[strings.ToLower(a.Key)]; ok {
+		return slog.String(a.Key, redacted)
+	}
+	return a
+}
+
+// contextHandler は、 [context.Context] に保存されたリクエストID及びトレースIDを属性として付与する [log/slog.Handler] である。
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestid.FromContext(ctx); id != "" {
+		r.AddAttrs(slog.String(KeyRequestID, id))
+	}
+	if sc := tracing.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String(KeyTraceID, sc.TraceID.String()),
+			slog.String(KeySpanID, sc.SpanID.String()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
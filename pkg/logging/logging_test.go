@@ -0,0 +1,90 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/pkg/logging"
+	"github.com/TechBowl-japan/go-stations/pkg/requestid"
+)
+
+func TestNewWithRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := logging.New(&buf, logging.FormatJSON, slog.LevelInfo)
+	if err != nil {
+		t.Fatalf("Loggerの作成に失敗しました: %v", err)
+	}
+
+	wantID := "request-id"
+	ctx := requestid.NewContext(context.Background(), wantID)
+	l.InfoContext(ctx, "test")
+
+	var got map[string]interface{}
+	if err := json.NewDecoder(&buf).Decode(&got); err != nil {
+		t.Fatalf("ログの読み込みに失敗しました: %v", err)
+	}
+	if got[logging.KeyRequestID] != wantID {
+		t.Errorf("正しいリクエストIDが記録されていません, got = %v, want = %v", got[logging.KeyRequestID], wantID)
+	}
+}
+
+func TestNewRedactsSensitiveValues(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := logging.New(&buf, logging.FormatJSON, slog.LevelInfo)
+	if err != nil {
+		t.Fatalf("Loggerの作成に失敗しました: %v", err)
+	}
+
+	h := http.Header{}
+	h.Set("Authorization", "Basic dXNlcjpwYXNz")
+	h.Set("User-Agent", "test")
+	l.Info("test", slog.Any("headers", logging.Headers(h)), slog.String("password", "pass"))
+
+	var got struct {
+		Headers  map[string]string `json:"headers"`
+		Password string            `json:"password"`
+	}
+	if err := json.NewDecoder(&buf).Decode(&got); err != nil {
+		t.Fatalf("ログの読み込みに失敗しました: %v", err)
+	}
+	if v := got.Headers["Authorization"]; v != "[REDACTED]" {
+		t.Errorf("Authorizationヘッダが秘匿されていません, got = %v", v)
+	}
+	if v := got.Password; v != "[REDACTED]" {
+		t.Errorf("passwordが秘匿されていません, got = %v", v)
+	}
+	if v := got.Headers["User-Agent"]; v != "test" {
+		t.Errorf("期待していない値です, got = %v, want = %v", v, "test")
+	}
+}
+
+func TestNewWithLevel(t *testing.T) {
+	var buf bytes.Buffer
+	var level slog.LevelVar
+	level.Set(slog.LevelWarn)
+	l, err := logging.New(&buf, logging.FormatText, &level)
+	if err != nil {
+		t.Fatalf("Loggerの作成に失敗しました: %v", err)
+	}
+
+	l.Info("test")
+	if buf.Len() != 0 {
+		t.Errorf("ログレベル未満のログが出力されています: %s", buf.String())
+	}
+
+	level.Set(slog.LevelInfo)
+	l.Info("test")
+	if buf.Len() == 0 {
+		t.Error("ログレベルの変更が反映されていません")
+	}
+}
+
+func TestNewWithInvalidFormat(t *testing.T) {
+	if _, err := logging.New(&bytes.Buffer{}, "xml", slog.LevelInfo); err == nil {
+		t.Error("不正な出力形式でエラーが発生していません")
+	}
+}
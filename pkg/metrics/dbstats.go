@@ -0,0 +1,32 @@
+package metrics
+
+import "database/sql"
+
+// NewDBStatsCollectors は、 [database/sql.DB.Stats] の値を出力する [Collector] を返す。
+func NewDBStatsCollectors(db *sql.DB) []Collector {
+	stat := func(name, help string, typ Type, fn func(s sql.DBStats) float64) Collector {
+		return NewCollectorFunc(name, help, typ, func() []Sample {
+			return []Sample{{Value: fn(db.Stats())}}
+		})
+	}
+	return []Collector{
+		stat("go_sql_max_open_connections", "Maximum number of open connections to the database.", TypeGauge,
+			func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }),
+		stat("go_sql_open_connections", "The number of established connections both in use and idle.", TypeGauge,
+			func(s sql.DBStats) float64 { return float64(s.OpenConnections) }),
+		stat("go_sql_in_use_connections", "The number of connections currently in use.", TypeGauge,
+			func(s sql.DBStats) float64 { return float64(s.InUse) }),
+		stat("go_sql_idle_connections", "The number of idle connections.", TypeGauge,
+			func(s sql.DBStats) float64 { return float64(s.Idle) }),
+		stat("go_sql_wait_count_total", "The total number of connections waited for.", TypeCounter,
+			func(s sql.DBStats) float64 { return float64(s.WaitCount) }),
+		stat("go_sql_wait_duration_seconds_total", "The total time blocked waiting for a new connection.", TypeCounter,
+			func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }),
+		stat("go_sql_max_idle_closed_total", "The total number of connections closed due to SetMaxIdleConns.", TypeCounter,
+			func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }),
+		stat("go_sql_max_idle_time_closed_total", "The total number of connections closed due to SetConnMaxIdleTime.", TypeCounter,
+			func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) }),
+		stat("go_sql_max_lifetime_closed_total", "The total number of connections closed due to SetConnMaxLifetime.", TypeCounter,
+			func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }),
+	}
+}
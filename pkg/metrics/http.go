@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ContentType は、Prometheusのテキスト形式のContent-Typeである。
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler は、 r に登録されたメトリクスをPrometheusのテキスト形式で返すHTTPハンドラを返す。
+//
+// Ref: https://prometheus.io/docs/instrumenting/exposition_formats/#text-based-format
+func Handler(r *Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		// NOTE: 書き込みに失敗するのはクライアントとの接続が切れた場合であり、サーバ側で対処できないため無視する。
+		_ = r.WriteText(w)
+	})
+}
+
+// WriteText は、登録されたメトリクスをPrometheusのテキスト形式で w に書き込む。
+func (r *Registry) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, c := range r.snapshot() {
+		name, help, typ := c.Describe()
+		bw.WriteString("# HELP " + name + " " + escapeHelp(help) + "\n")
+		bw.WriteString("# TYPE " + name + " " + string(typ) + "\n")
+		for _, s := range c.Collect() {
+			bw.WriteString(name + s.Suffix)
+			writeLabels(bw, s.Labels)
+			bw.WriteString(" " + formatFloat(s.Value) + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+func writeLabels(w *bufio.Writer, labels Labels) {
+	if len(labels) == 0 {
+		return
+	}
+	names := make([]string, 0, len(labels))
+	for n := range labels {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	w.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(n + `="` + escapeLabelValue(labels[n]) + `"`)
+	}
+	w.WriteByte('}')
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
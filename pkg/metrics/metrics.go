@@ -0,0 +1,438 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Type は、メトリクスの種類を表す。
+type Type string
+
+const (
+	TypeCounter   Type = "counter"
+	TypeGauge     Type = "gauge"
+	TypeHistogram Type = "histogram"
+)
+
+// DefBuckets は、HTTPリクエストの処理時間(秒)を想定したヒストグラムのデフォルトのバケットである。
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Labels は、ラベル名とラベル値の組を表す。
+type Labels map[string]string
+
+// Sample は、ある時点でのメトリクスの値を表す。
+type Sample struct {
+	// Suffix は、メトリクス名に付与する接尾辞である(e.g. ヒストグラムの _bucket)。
+	Suffix string
+	Labels Labels
+	Value  float64
+}
+
+// Collector は、 [Registry] に登録してPrometheusのテキスト形式で出力できるメトリクスを表す。
+type Collector interface {
+	// Describe は、メトリクス名、説明及び種類を返す。
+	Describe() (name, help string, typ Type)
+	// Collect は、現在の値を返す。
+	Collect() []Sample
+}
+
+// Registry は、 [Collector] を登録順に保持する。
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+	// names は、メトリクス名から collectors の添字を引く。
+	names map[string]int
+}
+
+// NewRegistry は、空の Registry を返す。
+func NewRegistry() *Registry {
+	return &Registry{
+		names: make(map[string]int),
+	}
+}
+
+// Register は、 c を登録する。同じ名前のメトリクスが登録済みの場合はエラーを返す。
+func (r *Registry) Register(c Collector) error {
+	name, _, _ := c.Describe()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.names[name]; ok {
+		return fmt.Errorf("metrics: %s is already registered", name)
+	}
+	r.names[name] = len(r.collectors)
+	r.collectors = append(r.collectors, c)
+	return nil
+}
+
+// RegisterOrGet は、 c を登録して返す。同じ名前のメトリクスが登録済みの場合は、 c を登録せずに登録済みの Collector を返す。
+//
+// 同じ Registry で複数回作成される部品が、系列を共有できるようにする事を想定している。
+func (r *Registry) RegisterOrGet(c Collector) Collector {
+	name, _, _ := c.Describe()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if i, ok := r.names[name]; ok {
+		return r.collectors[i]
+	}
+	r.names[name] = len(r.collectors)
+	r.collectors = append(r.collectors, c)
+	return c
+}
+
+// Replace は、 c を登録する。同じ名前のメトリクスが登録済みの場合は、登録順を保ったまま c に置き換える。
+func (r *Registry) Replace(c Collector) {
+	name, _, _ := c.Describe()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if i, ok := r.names[name]; ok {
+		r.collectors[i] = c
+		return
+	}
+	r.names[name] = len(r.collectors)
+	r.collectors = append(r.collectors, c)
+}
+
+// MustRegister は、 [Registry.Register] に失敗した場合にpanicする。
+//
+// メトリクス名の重複はプログラムの誤りであるため、起動時に検出する事を想定している。
+func (r *Registry) MustRegister(cs ...Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (r *Registry) snapshot() []Collector {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Collector(nil), r.collectors...)
+}
+
+// vec は、ラベル値の組毎に系列を保持する。
+type vec struct {
+	name       string
+	help       string
+	labelNames []string
+
+	mu     sync.RWMutex
+	series map[string]*seriesEntry
+	newFn  func() interface{}
+}
+
+type seriesEntry struct {
+	labelValues []string
+	metric      interface{}
+}
+
+func newVec(name, help string, labelNames []string, newFn func() interface{}) vec {
+	return vec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		series:     make(map[string]*seriesEntry),
+		newFn:      newFn,
+	}
+}
+
+func (v *vec) get(labelValues []string) interface{} {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	v.mu.RLock()
+	e, ok := v.series[key]
+	v.mu.RUnlock()
+	if ok {
+		return e.metric
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if e, ok := v.series[key]; ok {
+		return e.metric
+	}
+	e = &seriesEntry{
+		labelValues: append([]string(nil), labelValues...),
+		metric:      v.newFn(),
+	}
+	v.series[key] = e
+	return e.metric
+}
+
+// each は、系列をラベル値の辞書順に走査する。
+func (v *vec) each(fn func(labels Labels, metric interface{})) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	entries := make(map[string]*seriesEntry, len(v.series))
+	for k, e := range v.series {
+		entries[k] = e
+	}
+	v.mu.RUnlock()
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		e := entries[k]
+		labels := make(Labels, len(v.labelNames))
+		for i, n := range v.labelNames {
+			labels[n] = e.labelValues[i]
+		}
+		fn(labels, e.metric)
+	}
+}
+
+// atomicFloat は、ロックせずに更新できる float64 である。
+type atomicFloat struct {
+	bits uint64
+}
+
+func (f *atomicFloat) add(v float64) {
+	for {
+		old := atomic.LoadUint64(&f.bits)
+		n := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&f.bits, old, n) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) set(v float64) {
+	atomic.StoreUint64(&f.bits, math.Float64bits(v))
+}
+
+func (f *atomicFloat) load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&f.bits))
+}
+
+// Counter は、単調増加する値である。
+type Counter struct {
+	v atomicFloat
+}
+
+// Inc は、値を1増やす。
+func (c *Counter) Inc() {
+	c.v.add(1)
+}
+
+// Add は、値を v 増やす。 v が負の場合はpanicする。
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.v.add(v)
+}
+
+// CounterVec は、ラベル値の組毎に [Counter] を保持する。
+type CounterVec struct {
+	vec
+}
+
+// NewCounterVec は、 CounterVec を返す。
+func NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{
+		vec: newVec(name, help, labelNames, func() interface{} { return &Counter{} }),
+	}
+}
+
+// WithLabelValues は、ラベル値の組に対応する [Counter] を返す。
+func (c *CounterVec) WithLabelValues(labelValues ...string) *Counter {
+	return c.get(labelValues).(*Counter)
+}
+
+// Describe は、 [Collector] を実装する。
+func (c *CounterVec) Describe() (string, string, Type) {
+	return c.name, c.help, TypeCounter
+}
+
+// Collect は、 [Collector] を実装する。
+func (c *CounterVec) Collect() []Sample {
+	var samples []Sample
+	c.each(func(labels Labels, m interface{}) {
+		samples = append(samples, Sample{Labels: labels, Value: m.(*Counter).v.load()})
+	})
+	return samples
+}
+
+// Gauge は、増減する値である。
+type Gauge struct {
+	v atomicFloat
+}
+
+// Set は、値を v にする。
+func (g *Gauge) Set(v float64) {
+	g.v.set(v)
+}
+
+// Inc は、値を1増やす。
+func (g *Gauge) Inc() {
+	g.v.add(1)
+}
+
+// Dec は、値を1減らす。
+func (g *Gauge) Dec() {
+	g.v.add(-1)
+}
+
+// Add は、値を v 増やす。
+func (g *Gauge) Add(v float64) {
+	g.v.add(v)
+}
+
+// GaugeVec は、ラベル値の組毎に [Gauge] を保持する。
+type GaugeVec struct {
+	vec
+}
+
+// NewGaugeVec は、 GaugeVec を返す。
+func NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{
+		vec: newVec(name, help, labelNames, func() interface{} { return &Gauge{} }),
+	}
+}
+
+// WithLabelValues は、ラベル値の組に対応する [Gauge] を返す。
+func (g *GaugeVec) WithLabelValues(labelValues ...string) *Gauge {
+	return g.get(labelValues).(*Gauge)
+}
+
+// Describe は、 [Collector] を実装する。
+func (g *GaugeVec) Describe() (string, string, Type) {
+	return g.name, g.help, TypeGauge
+}
+
+// Collect は、 [Collector] を実装する。
+func (g *GaugeVec) Collect() []Sample {
+	var samples []Sample
+	g.each(func(labels Labels, m interface{}) {
+		samples = append(samples, Sample{Labels: labels, Value: m.(*Gauge).v.load()})
+	})
+	return samples
+}
+
+// Histogram は、観測値の分布を累積バケットで表す。
+type Histogram struct {
+	upperBounds []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Observe は、観測値 v を記録する。
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+// HistogramVec は、ラベル値の組毎に [Histogram] を保持する。
+type HistogramVec struct {
+	vec
+	buckets []float64
+}
+
+// NewHistogramVec は、 HistogramVec を返す。 buckets は昇順である必要がある。
+func NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("metrics: buckets of %s must be sorted", name))
+	}
+	bs := append([]float64(nil), buckets...)
+	return &HistogramVec{
+		vec: newVec(name, help, labelNames, func() interface{} {
+			return &Histogram{upperBounds: bs, counts: make([]uint64, len(bs))}
+		}),
+		buckets: bs,
+	}
+}
+
+// WithLabelValues は、ラベル値の組に対応する [Histogram] を返す。
+func (h *HistogramVec) WithLabelValues(labelValues ...string) *Histogram {
+	return h.get(labelValues).(*Histogram)
+}
+
+// Describe は、 [Collector] を実装する。
+func (h *HistogramVec) Describe() (string, string, Type) {
+	return h.name, h.help, TypeHistogram
+}
+
+// Collect は、 [Collector] を実装する。
+func (h *HistogramVec) Collect() []Sample {
+	var samples []Sample
+	h.each(func(labels Labels, m interface{}) {
+		hist := m.(*Histogram)
+		hist.mu.Lock()
+		counts := append([]uint64(nil), hist.counts...)
+		sum, count := hist.sum, hist.count
+		hist.mu.Unlock()
+
+		var cumulative uint64
+		for i, ub := range h.buckets {
+			cumulative += counts[i]
+			samples = append(samples, Sample{Suffix: "_bucket", Labels: withLabel(labels, "le", formatFloat(ub)), Value: float64(cumulative)})
+		}
+		samples = append(samples,
+			Sample{Suffix: "_bucket", Labels: withLabel(labels, "le", "+Inf"), Value: float64(count)},
+			Sample{Suffix: "_sum", Labels: labels, Value: sum},
+			Sample{Suffix: "_count", Labels: labels, Value: float64(count)},
+		)
+	})
+	return samples
+}
+
+func withLabel(labels Labels, name, value string) Labels {
+	l := make(Labels, len(labels)+1)
+	for k, v := range labels {
+		l[k] = v
+	}
+	l[name] = value
+	return l
+}
+
+// funcCollector は、出力時に値を取得する [Collector] である。
+type funcCollector struct {
+	name string
+	help string
+	typ  Type
+	fn   func() []Sample
+}
+
+// NewCollectorFunc は、出力の度に fn を呼び出して値を取得する [Collector] を返す。
+//
+// DBのコネクション数等、他のコンポーネントが保持している値を出力する事を想定している。
+func NewCollectorFunc(name, help string, typ Type, fn func() []Sample) Collector {
+	return &funcCollector{
+		name: name,
+		help: help,
+		typ:  typ,
+		fn:   fn,
+	}
+}
+
+func (c *funcCollector) Describe() (string, string, Type) {
+	return c.name, c.help, c.typ
+}
+
+func (c *funcCollector) Collect() []Sample {
+	return c.fn()
+}
@@ -0,0 +1,131 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/TechBowl-japan/go-stations/pkg/metrics"
+)
+
+func TestWriteText(t *testing.T) {
+	reg := metrics.NewRegistry()
+	c := metrics.NewCounterVec("requests_total", "The total number of requests.", "method")
+	g := metrics.NewGaugeVec("in_flight", "The number of requests\nin flight.")
+	h := metrics.NewHistogramVec("duration_seconds", "The latencies.", []float64{0.1, 1}, "path")
+	reg.MustRegister(c, g, h)
+
+	c.WithLabelValues("GET").Inc()
+	c.WithLabelValues("GET").Add(2)
+	c.WithLabelValues(`"P\OST"`).Inc()
+	g.WithLabelValues().Set(3)
+	g.WithLabelValues().Dec()
+	h.WithLabelValues("/").Observe(0.05)
+	h.WithLabelValues("/").Observe(0.5)
+	h.WithLabelValues("/").Observe(5)
+
+	var b strings.Builder
+	if err := reg.WriteText(&b); err != nil {
+		t.Fatalf("メトリクスの書き込みに失敗しました: %v", err)
+	}
+
+	want := `# HELP requests_total The total number of requests.
+# TYPE requests_total counter
+requests_total{method="\"P\\OST\""} 1
+requests_total{method="GET"} 3
+# HELP in_flight The number of requests\nin flight.
+# TYPE in_flight gauge
+in_flight 2
+# HELP duration_seconds The latencies.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{le="0.1",path="/"} 1
+duration_seconds_bucket{le="1",path="/"} 2
+duration_seconds_bucket{le="+Inf",path="/"} 3
+duration_seconds_sum{path="/"} 5.55
+duration_seconds_count{path="/"} 3
+`
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("期待していない出力です (-want +got):\n%s", diff)
+	}
+}
+
+func TestRegisterDuplicated(t *testing.T) {
+	reg := metrics.NewRegistry()
+	if err := reg.Register(metrics.NewCounterVec("dup_total", "")); err != nil {
+		t.Fatalf("予期しないエラーが発生しました: %v", err)
+	}
+	if err := reg.Register(metrics.NewGaugeVec("dup_total", "")); err == nil {
+		t.Error("同じ名前のメトリクスを登録できてしまいます")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	reg := metrics.NewRegistry()
+	reg.MustRegister(metrics.NewCollectorFunc("todos", "The number of TODOs.", metrics.TypeGauge, func() []metrics.Sample {
+		return []metrics.Sample{{Value: 5}}
+	}))
+
+	w := httptest.NewRecorder()
+	metrics.Handler(reg).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if got := w.Header().Get("Content-Type"); got != metrics.ContentType {
+		t.Errorf("期待していない Content-Type です, got = %s, want = %s", got, metrics.ContentType)
+	}
+	if !strings.Contains(w.Body.String(), "\ntodos 5\n") {
+		t.Errorf("メトリクスが出力されていません, got = %s", w.Body.String())
+	}
+}
+
+func TestRegisterOrGet(t *testing.T) {
+	reg := metrics.NewRegistry()
+	first := metrics.NewCounterVec("shared_total", "")
+	if got := reg.RegisterOrGet(first); got != first {
+		t.Errorf("未登録のメトリクスが登録されません, got = %v", got)
+	}
+	if got := reg.RegisterOrGet(metrics.NewCounterVec("shared_total", "")); got != first {
+		t.Errorf("登録済みのメトリクスが返されません, got = %v", got)
+	}
+	first.WithLabelValues().Inc()
+
+	var b strings.Builder
+	if err := reg.WriteText(&b); err != nil {
+		t.Fatalf("メトリクスの出力に失敗しました: %v", err)
+	}
+	if strings.Count(b.String(), "shared_total 1\n") != 1 {
+		t.Errorf("期待していない出力です, got = %s", b.String())
+	}
+}
+
+func TestReplace(t *testing.T) {
+	reg := metrics.NewRegistry()
+	gauge := func(name string, v float64) metrics.Collector {
+		return metrics.NewCollectorFunc(name, "Help.", metrics.TypeGauge, func() []metrics.Sample {
+			return []metrics.Sample{{Value: v}}
+		})
+	}
+	reg.MustRegister(gauge("a", 1), gauge("b", 1))
+	// NOTE: 置き換えても登録順は変わらない。
+	reg.Replace(gauge("a", 2))
+	reg.Replace(gauge("c", 3))
+
+	var b strings.Builder
+	if err := reg.WriteText(&b); err != nil {
+		t.Fatalf("メトリクスの出力に失敗しました: %v", err)
+	}
+	want := `# HELP a Help.
+# TYPE a gauge
+a 2
+# HELP b Help.
+# TYPE b gauge
+b 1
+# HELP c Help.
+# TYPE c gauge
+c 3
+`
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Errorf("期待していない出力です (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,351 @@
+// Package outbox は、データの変更と同じトランザクションで保存したイベントを、外部の配信先に中継するリレーを提供する。
+//
+// イベントは [Store] で永続化し、配信先( [Sink] )毎に配信済みの位置を記録する。
+// 配信は少なくとも1回(at-least-once)であり、配信先は同じイベントを重複して受け取る場合がある。
+// 各配信先には保存した順にイベントを配信し、配信に失敗した場合は同じイベントから再送するため、順序が入れ替わる事はない。
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/pkg/backoff"
+)
+
+// Event は、保存されたイベントである。
+type Event struct {
+	// ID は、保存した順に採番される値である。配信先は重複の判定に使用できる。
+	ID   int64
+	Type string
+	// Payload は、イベントの内容を表すJSONである。
+	Payload []byte
+	// Source は、イベントを発生させた接続等の識別子である。
+	Source    string
+	CreatedAt time.Time
+}
+
+// Store は、イベント及び配信先毎の配信済みの位置を永続化する。
+type Store interface {
+	// Read は、 sink に配信済みのイベントより後のイベントを、保存した順に最大 limit 件返す。
+	Read(ctx context.Context, sink string, limit int) ([]Event, error)
+	// Commit は、 sink に id までのイベントを配信した事を記録する。
+	Commit(ctx context.Context, sink string, id int64) error
+	// Purge は、全ての sinks に配信済みで、 retention より前に保存したイベントを削除し、削除した数を返す。
+	Purge(ctx context.Context, sinks []string, retention time.Duration) (int64, error)
+}
+
+// Sink は、イベントの配信先である。
+//
+// [io.Closer] を実装する場合、 [Relay.Shutdown] で配信を停止した後に閉じる。
+type Sink interface {
+	// Name は、配信済みの位置を記録するための名前である。再起動後も同じ値を返す必要がある。
+	Name() string
+	// Send は、 events を順に配信する。エラーを返した場合、 events の先頭から再送する。
+	Send(ctx context.Context, events []Event) error
+}
+
+// Config は、 [NewRelay] に与える設定を表す。
+type Config struct {
+	// BatchSize は、1回に配信するイベントの最大数である。0の場合は100とする。
+	BatchSize int
+	// PollInterval は、 [Relay.Notify] による通知がない場合に、未配信のイベントを確認する間隔である。0の場合は1秒とする。
+	PollInterval time.Duration
+	// InitialBackoff は、配信に失敗した後、最初の再送までの時間である。以降は再送毎に2倍にする。0の場合は1秒とする。
+	InitialBackoff time.Duration
+	// MaxBackoff は、再送までの時間の上限である。0の場合は1分とする。
+	MaxBackoff time.Duration
+	// Timeout は、1回の配信のタイムアウトである。0の場合は10秒とする。
+	Timeout time.Duration
+	// Retention は、全ての配信先に配信済みのイベントを保持する期間である。0の場合は24時間とする。
+	Retention time.Duration
+	// Logger は、配信の失敗等を出力する。nil の場合は [log/slog.Default] を使用する。
+	Logger *slog.Logger
+}
+
+// purgeInterval は、配信済みのイベントを削除する間隔である。
+const purgeInterval = 10 * time.Minute
+
+// Relay は、 [Store] に保存したイベントを、バックグラウンドで各 [Sink] に配信する。
+type Relay struct {
+	store Store
+	sinks []Sink
+	cfg   Config
+
+	// notify は、配信先毎に未配信のイベントがある事を通知する。
+	notify []chan struct{}
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewRelay は、 cfg に従って sinks への配信を開始した Relay を返す。
+//
+// 終了時には [Relay.Shutdown] を呼び出す必要がある。
+func NewRelay(store Store, sinks []Sink, cfg Config) *Relay {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Minute
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = 24 * time.Hour
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+
+	r := &Relay{
+		store:  store,
+		sinks:  sinks,
+		cfg:    cfg,
+		notify: make([]chan struct{}, len(sinks)),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	var wg sync.WaitGroup
+	for i, s := range sinks {
+		r.notify[i] = make(chan struct{}, 1)
+		wg.Add(1)
+		go func(s Sink, notify <-chan struct{}) {
+			defer wg.Done()
+			r.relay(s, notify)
+		}(s, r.notify[i])
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.purge()
+	}()
+	go func() {
+		wg.Wait()
+		r.closeSinks()
+		close(r.done)
+	}()
+	return r
+}
+
+// Notify は、新たなイベントを保存した事を通知し、 PollInterval を待たずに配信させる。ブロックしない。
+func (r *Relay) Notify() {
+	for _, ch := range r.notify {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Shutdown は、新たな配信を停止し、配信中のイベントの結果を記録するまで待つ。
+//
+// 未配信のイベントは、次に起動した際に配信される。
+func (r *Relay) Shutdown(ctx context.Context) error {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// relay は、停止するまで s に未配信のイベントを配信する。
+func (r *Relay) relay(s Sink, notify <-chan struct{}) {
+	logger := r.cfg.Logger.With(slog.String("sink", s.Name()))
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+
+	failures := 0
+	for {
+		n, err := r.relayBatch(s)
+		if err != nil {
+			failures++
+			backoff := r.backoff(failures)
+			logger.Warn("could not relay outbox events",
+				slog.Int("failures", failures),
+				slog.Duration("retry_after", backoff),
+				slog.Any("err", err),
+			)
+			// NOTE: 失敗した配信先への通知では再送せず、再送までの時間を待つ。
+			select {
+			case <-time.After(backoff):
+				continue
+			case <-r.stop:
+				return
+			}
+		}
+		failures = 0
+
+		// NOTE: 未配信のイベントが残っている場合は、間隔を空けずに配信する。
+		if n == r.cfg.BatchSize {
+			select {
+			case <-r.stop:
+				return
+			default:
+				continue
+			}
+		}
+		select {
+		case <-notify:
+		case <-ticker.C:
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// relayBatch は、 s に未配信のイベントを最大 BatchSize 件配信し、配信した数を返す。
+func (r *Relay) relayBatch(s Sink) (int, error) {
+	// NOTE: 停止中でも配信中のイベントの結果を記録できるよう、停止とは独立したタイムアウトを使用する。
+	ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+	defer cancel()
+
+	events, err := r.store.Read(ctx, s.Name(), r.cfg.BatchSize)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+	if err := s.Send(ctx, events); err != nil {
+		return 0, err
+	}
+	if err := r.store.Commit(ctx, s.Name(), events[len(events)-1].ID); err != nil {
+		return 0, err
+	}
+	return len(events), nil
+}
+
+// purge は、停止するまで定期的に配信済みのイベントを削除する。
+func (r *Relay) purge() {
+	names := make([]string, 0, len(r.sinks))
+	for _, s := range r.sinks {
+		names = append(names, s.Name())
+	}
+
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), r.cfg.Timeout)
+		n, err := r.store.Purge(ctx, names, r.cfg.Retention)
+		cancel()
+		if err != nil {
+			r.cfg.Logger.Warn("could not purge outbox events", slog.Any("err", err))
+		} else if n > 0 {
+			r.cfg.Logger.Debug("outbox events purged", slog.Int64("purged", n))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+func (r *Relay) closeSinks() {
+	for _, s := range r.sinks {
+		c, ok := s.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := c.Close(); err != nil {
+			r.cfg.Logger.Error("could not close outbox sink", slog.String("sink", s.Name()), slog.Any("err", err))
+		}
+	}
+}
+
+// backoff は、 failures 回連続して配信に失敗した後、再送までの時間を返す。
+func (r *Relay) backoff(failures int) time.Duration {
+	return backoff.Exponential(r.cfg.InitialBackoff, r.cfg.MaxBackoff, failures)
+}
+
+// LogSink は、イベントをログに出力する [Sink] である。
+type LogSink struct {
+	logger *slog.Logger
+}
+
+// NewLogSink は、イベントを logger に出力する LogSink を返す。
+func NewLogSink(logger *slog.Logger) *LogSink {
+	return &LogSink{logger: logger}
+}
+
+// Name は、 [Sink] を実装する。
+func (s *LogSink) Name() string {
+	return "log"
+}
+
+// Send は、 [Sink] を実装する。
+func (s *LogSink) Send(ctx context.Context, events []Event) error {
+	for _, e := range events {
+		s.logger.InfoContext(ctx, "outbox event",
+			slog.Int64("event_id", e.ID),
+			slog.String("event_type", e.Type),
+			slog.Any("payload", json.RawMessage(e.Payload)),
+		)
+	}
+	return nil
+}
+
+// FileSink は、イベントを1行1つのJSON(NDJSON)としてファイルに追記する [Sink] である。
+type FileSink struct {
+	f *os.File
+}
+
+// fileRecord は、 FileSink が出力する1行である。
+type fileRecord struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NewFileSink は、 path に追記する FileSink を返す。ファイルが存在しない場合は作成する。
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{f: f}, nil
+}
+
+// Name は、 [Sink] を実装する。
+func (s *FileSink) Name() string {
+	return "file"
+}
+
+// Send は、 [Sink] を実装する。配信済みとして記録する前にファイルを同期する。
+func (s *FileSink) Send(ctx context.Context, events []Event) error {
+	var buf []byte
+	for _, e := range events {
+		b, err := json.Marshal(fileRecord{ID: e.ID, Type: e.Type, Payload: e.Payload, CreatedAt: e.CreatedAt})
+		if err != nil {
+			return fmt.Errorf("outbox: could not encode event %d: %w", e.ID, err)
+		}
+		buf = append(append(buf, b...), '\n')
+	}
+	// NOTE: 書き込みの途中で失敗した場合は再送により行が重複し得るが、at-least-once の範囲とする。
+	if _, err := s.f.Write(buf); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+// Close は、ファイルを閉じる。
+func (s *FileSink) Close() error {
+	return s.f.Close()
+}
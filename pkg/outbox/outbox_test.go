@@ -0,0 +1,260 @@
+package outbox_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/pkg/outbox"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRelay(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		// failures は、配信先が最初に失敗する回数である。
+		failures int
+		// want は、配信先が受け取るイベントのIDである。
+		want []int64
+	}{
+		"Success": {
+			want: []int64{1, 2, 3, 4, 5},
+		},
+		"Retry": {
+			failures: 2,
+			// NOTE: 失敗したバッチは先頭から再送する。
+			want: []int64{1, 2, 1, 2, 1, 2, 3, 4, 5},
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			store := newMemoryStore(5)
+			sink := &recordingSink{name: "test", failures: c.failures, received: make(chan struct{}, 16)}
+			r := outbox.NewRelay(store, []outbox.Sink{sink}, outbox.Config{
+				BatchSize:      2,
+				PollInterval:   time.Hour,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     time.Millisecond,
+			})
+			sink.wait(t, len(c.want))
+			if err := r.Shutdown(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if diff := cmp.Diff(c.want, sink.ids()); diff != "" {
+				t.Errorf("期待していない順序で配信されました (-want +got):\n%s", diff)
+			}
+			if got := store.offset("test"); got != 5 {
+				t.Errorf("配信済みの位置が記録されていません, got = %d", got)
+			}
+		})
+	}
+}
+
+func TestRelayIndependentSinks(t *testing.T) {
+	t.Parallel()
+
+	store := newMemoryStore(3)
+	healthy := &recordingSink{name: "healthy", received: make(chan struct{}, 16)}
+	broken := &recordingSink{name: "broken", failures: -1, received: make(chan struct{}, 16)}
+	r := outbox.NewRelay(store, []outbox.Sink{broken, healthy}, outbox.Config{
+		PollInterval:   time.Hour,
+		InitialBackoff: time.Hour,
+		MaxBackoff:     time.Hour,
+	})
+	healthy.wait(t, 3)
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := store.offset("healthy"); got != 3 {
+		t.Errorf("失敗した配信先により配信が止まりました, offset = %d", got)
+	}
+	if got := store.offset("broken"); got != 0 {
+		t.Errorf("失敗した配信の位置が記録されました, offset = %d", got)
+	}
+}
+
+func TestRelayNotify(t *testing.T) {
+	t.Parallel()
+
+	store := newMemoryStore(0)
+	sink := &recordingSink{name: "test", received: make(chan struct{}, 16)}
+	r := outbox.NewRelay(store, []outbox.Sink{sink}, outbox.Config{PollInterval: time.Hour})
+	defer r.Shutdown(context.Background())
+
+	// NOTE: 起動時の配信を終えてから保存しないと、通知せずに配信される場合がある。
+	for store.reads() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	store.append()
+	r.Notify()
+	sink.wait(t, 1)
+}
+
+func TestFileSink(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	createdAt := time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+	for _, id := range []int64{1, 2} {
+		s, err := outbox.NewFileSink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.Send(context.Background(), []outbox.Event{
+			{ID: id, Type: "created", Payload: []byte(`{"todo":{"id":1}}`), CreatedAt: createdAt},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var got []map[string]interface{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(sc.Bytes(), &line); err != nil {
+			t.Fatalf("JSONとして読み込めない行があります: %s", sc.Text())
+		}
+		got = append(got, line)
+	}
+	want := []map[string]interface{}{
+		{"id": 1.0, "type": "created", "payload": map[string]interface{}{"todo": map[string]interface{}{"id": 1.0}}, "created_at": "2024-08-01T12:00:00Z"},
+		{"id": 2.0, "type": "created", "payload": map[string]interface{}{"todo": map[string]interface{}{"id": 1.0}}, "created_at": "2024-08-01T12:00:00Z"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("期待していないファイルの内容です (-want +got):\n%s", diff)
+	}
+}
+
+// memoryStore は、イベントをメモリ上に保持する [outbox.Store] である。
+type memoryStore struct {
+	mu      sync.Mutex
+	events  []outbox.Event
+	offsets map[string]int64
+	nreads  int
+}
+
+func newMemoryStore(n int) *memoryStore {
+	s := &memoryStore{offsets: make(map[string]int64)}
+	for i := 0; i < n; i++ {
+		s.append()
+	}
+	return s
+}
+
+func (s *memoryStore) append() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := int64(len(s.events) + 1)
+	s.events = append(s.events, outbox.Event{ID: id, Type: "created", Payload: []byte(`{}`)})
+}
+
+func (s *memoryStore) Read(ctx context.Context, sink string, limit int) ([]outbox.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nreads++
+	var events []outbox.Event
+	for _, e := range s.events {
+		if e.ID > s.offsets[sink] && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (s *memoryStore) Commit(ctx context.Context, sink string, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.offsets[sink] = id
+	return nil
+}
+
+func (s *memoryStore) Purge(ctx context.Context, sinks []string, retention time.Duration) (int64, error) {
+	return 0, nil
+}
+
+func (s *memoryStore) offset(sink string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offsets[sink]
+}
+
+func (s *memoryStore) reads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nreads
+}
+
+// recordingSink は、受け取ったイベントを記録する [outbox.Sink] である。
+type recordingSink struct {
+	name string
+	// failures は、最初に失敗する回数である。負の場合は常に失敗する。
+	failures int
+
+	mu       sync.Mutex
+	got      []int64
+	received chan struct{}
+}
+
+func (s *recordingSink) Name() string {
+	return s.name
+}
+
+func (s *recordingSink) Send(ctx context.Context, events []outbox.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range events {
+		s.got = append(s.got, e.ID)
+		s.received <- struct{}{}
+	}
+	if s.failures != 0 {
+		s.failures--
+		return errors.New("unavailable")
+	}
+	return nil
+}
+
+func (s *recordingSink) ids() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int64(nil), s.got...)
+}
+
+// wait は、 n 件のイベントを受け取るまで待つ。
+func (s *recordingSink) wait(t *testing.T, n int) {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		select {
+		case <-s.received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("イベントが配信されません, received = %d, want = %d", i, n)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package panicreport は、リクエストの処理中にリカバリしたpanicを外部へ通知する。
+package panicreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Report は、リカバリしたpanicの情報である。
+type Report struct {
+	// ID は、ログ及びエラーレスポンスと突き合わせるためのpanicのIDである。
+	ID        string    `json:"panic_id"`
+	Time      time.Time `json:"time"`
+	Panic     string    `json:"panic"`
+	Stack     string    `json:"stack"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// Reporter は、 Report の通知先である。
+//
+// Report はリクエストの処理中に呼び出されるため、通知先の障害でブロックしてはならない。
+type Reporter interface {
+	Report(r Report)
+}
+
+// WebhookConfig は、 [NewWebhook] に与える設定を表す。
+type WebhookConfig struct {
+	// URL は、 Report をJSONでPOSTする送信先である。
+	URL string
+	// Timeout は、1回の送信のタイムアウトである。0の場合は10秒とする。
+	Timeout time.Duration
+	// MaxQueueSize は、送信待ちの Report の最大数である。超えた場合、 Report は破棄する。0の場合は64とする。
+	MaxQueueSize int
+	// Client は、送信に使用するHTTPクライアントである。nil の場合は [net/http.DefaultClient] を使用する。
+	Client *http.Client
+	// Logger は、送信の失敗等を出力する。nil の場合は [log/slog.Default] を使用する。
+	Logger *slog.Logger
+}
+
+// Webhook は、 Report をバックグラウンドでJSONとしてPOSTする [Reporter] である。
+type Webhook struct {
+	url     string
+	timeout time.Duration
+	client  *http.Client
+	logger  *slog.Logger
+
+	queue    chan Report
+	dropped  atomic.Int64
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewWebhook は、 cfg に従って Webhook を返す。
+//
+// 終了時には [Webhook.Shutdown] を呼び出し、送信待ちの Report を送信する必要がある。
+func NewWebhook(cfg WebhookConfig) (*Webhook, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("panicの通知先には http(s):// から始まるURLを指定する必要があります: %s", cfg.URL)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.MaxQueueSize <= 0 {
+		cfg.MaxQueueSize = 64
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+
+	w := &Webhook{
+		url:     cfg.URL,
+		timeout: cfg.Timeout,
+		client:  cfg.Client,
+		logger:  cfg.Logger,
+		queue:   make(chan Report, cfg.MaxQueueSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.loop()
+	return w, nil
+}
+
+// Report は、 [Reporter] を実装する。
+func (w *Webhook) Report(r Report) {
+	select {
+	case <-w.stop:
+		w.dropped.Add(1)
+		return
+	default:
+	}
+	select {
+	case w.queue <- r:
+	default:
+		// NOTE: panicが多発した場合にリクエストの処理を遅延させないため、キューが一杯の場合は破棄する。
+		w.dropped.Add(1)
+	}
+}
+
+// Shutdown は、送信待ちの Report を送信し、バックグラウンドの処理を終了する。
+func (w *Webhook) Shutdown(ctx context.Context) error {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *Webhook) loop() {
+	defer close(w.done)
+
+	for {
+		select {
+		case r := <-w.queue:
+			w.send(r)
+		case <-w.stop:
+			for {
+				select {
+				case r := <-w.queue:
+					w.send(r)
+				default:
+					if n := w.dropped.Swap(0); n > 0 {
+						w.logger.Warn("panic reports are dropped", slog.Int64("count", n))
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+func (w *Webhook) send(r Report) {
+	if n := w.dropped.Swap(0); n > 0 {
+		w.logger.Warn("panic reports are dropped", slog.Int64("count", n))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	defer cancel()
+	if err := w.post(ctx, r); err != nil {
+		w.logger.Error("could not report panic", slog.String("panic_id", r.ID), slog.Any("err", err))
+	}
+}
+
+func (w *Webhook) post(ctx context.Context, r Report) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	// NOTE: コネクションを再利用するため、レスポンスボディを読み切る。
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("panicreport: unexpected status from webhook: %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package panicreport_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/pkg/panicreport"
+	"github.com/google/go-cmp/cmp"
+)
+
+// receiver は、Webhookの送信先の代替である。
+type receiver struct {
+	mu      sync.Mutex
+	reports []panicreport.Report
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var report panicreport.Report
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.reports = append(rc.reports, report)
+}
+
+func TestWebhook(t *testing.T) {
+	rc := &receiver{}
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+
+	wh, err := panicreport.NewWebhook(panicreport.WebhookConfig{URL: srv.URL})
+	if err != nil {
+		t.Fatalf("予期しないエラーが発生しました: %v", err)
+	}
+	want := []panicreport.Report{
+		{ID: "1", Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Panic: "test", Stack: "goroutine 1", Method: http.MethodGet, Path: "/api/todos", RequestID: "request-id"},
+		{ID: "2", Time: time.Date(2024, 1, 1, 0, 0, 1, 0, time.UTC), Panic: "test", Stack: "goroutine 2", Method: http.MethodPost, Path: "/api/todos"},
+	}
+	for _, r := range want {
+		wh.Report(r)
+	}
+	if err := wh.Shutdown(context.Background()); err != nil {
+		t.Fatalf("予期しないエラーが発生しました: %v", err)
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if diff := cmp.Diff(want, rc.reports); diff != "" {
+		t.Errorf("期待していない通知です (-want +got):\n%s", diff)
+	}
+
+	// NOTE: 終了後の通知は破棄する。
+	wh.Report(want[0])
+	if len(rc.reports) != len(want) {
+		t.Errorf("終了後に通知されました, got = %d", len(rc.reports))
+	}
+}
+
+func TestNewWebhookError(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"Empty":          "",
+		"Without scheme": "localhost:8080/panics",
+		"Unsupported":    "ftp://localhost/panics",
+	}
+	for name, u := range cases {
+		u := u
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := panicreport.NewWebhook(panicreport.WebhookConfig{URL: u}); err == nil {
+				t.Error("不正なURLでエラーが返されませんでした")
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+// Package pubsub は、プロセス内でイベントを配信するブローカーを提供する。
+//
+// 配信したイベントは一定数保持し、再接続した購読者は最後に受け取ったイベントの続きから受け取れる。
+package pubsub
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSlowSubscriber は、イベントの受け取りが遅れたため購読を解除された事を表す。
+var ErrSlowSubscriber = errors.New("pubsub: subscriber is too slow")
+
+// Event は、 [Broker] が配信するイベントである。
+type Event struct {
+	// ID は、 [Broker.Publish] で採番される1からの連番である。
+	ID uint64
+	// Type は、イベントの種類(e.g. created)である。
+	Type string
+	// User は、イベントを発生させたユーザのIDである。購読者毎の絞り込みに使用する。
+	User string
+	// Source は、イベントを発生させた接続等の識別子である。購読者が自身の変更を除外するために使用する。
+	Source string
+	// Data は、イベントの内容である。購読者間で共有されるため、変更してはならない。
+	Data interface{}
+	Time time.Time
+}
+
+type sourceContextKey struct{}
+
+// ContextWithSource は、 [Event.Source] として source を設定した [context.Context] を返す。
+func ContextWithSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, sourceContextKey{}, source)
+}
+
+// SourceFromContext は、 [ContextWithSource] で設定した値を返す。設定されていない場合は空文字を返す。
+func SourceFromContext(ctx context.Context) string {
+	source, _ := ctx.Value(sourceContextKey{}).(string)
+	return source
+}
+
+// Config は、 [NewBroker] に与える設定を表す。
+type Config struct {
+	// ReplaySize は、再接続した購読者に再送するために保持するイベントの数である。0の場合は256とする。
+	ReplaySize int
+	// BufferSize は、購読者毎の未受信のイベントの最大数である。超えた場合は購読を解除する。0の場合は64とする。
+	BufferSize int
+}
+
+// Broker は、 Event を購読者に配信する。
+//
+// 配信は購読者の受信を待たないため、受信が遅れた購読者がいても配信元はブロックしない。
+type Broker struct {
+	bufferSize int
+
+	mu     sync.Mutex
+	nextID uint64
+	// replay は、直近の ReplaySize 個のイベントを保持するリングバッファである。
+	replay []Event
+	head   int
+	subs   map[*Subscription]struct{}
+
+	dropped atomic.Int64
+}
+
+// NewBroker は、 cfg に従って Broker を返す。
+func NewBroker(cfg Config) *Broker {
+	if cfg.ReplaySize <= 0 {
+		cfg.ReplaySize = 256
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 64
+	}
+	return &Broker{
+		bufferSize: cfg.BufferSize,
+		nextID:     1,
+		replay:     make([]Event, 0, cfg.ReplaySize),
+		subs:       make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish は、 e に ID を採番して配信し、採番した Event を返す。
+//
+// 未受信のイベントが BufferSize に達した購読者は、購読を解除する。
+func (b *Broker) Publish(e Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e.ID = b.nextID
+	b.nextID++
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if len(b.replay) < cap(b.replay) {
+		b.replay = append(b.replay, e)
+	} else {
+		b.replay[b.head] = e
+		b.head = (b.head + 1) % len(b.replay)
+	}
+
+	for s := range b.subs {
+		if s.filter != nil && !s.filter(e) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			// NOTE: 配信元をブロックしないため、受信が遅れた購読者は切断する。
+			// 購読者は再接続し、保持しているイベントから続きを受け取れる。
+			b.remove(s, ErrSlowSubscriber)
+			b.dropped.Add(1)
+		}
+	}
+	return e
+}
+
+// Subscribe は、以降に配信される Event のうち、 filter が true を返すものを受け取る Subscription を返す。
+// filter が nil の場合は全てのイベントを受け取る。
+//
+// after が0でない場合、保持しているイベントのうち ID が after より大きいものを [Subscription.Replay] で返す。
+// 保持しているイベントより前のイベントが必要な場合は [Subscription.Lost] を true とする。
+func (b *Broker) Subscribe(after uint64, filter func(Event) bool) *Subscription {
+	s := &Subscription{
+		broker: b,
+		filter: filter,
+		c:      make(chan Event, b.bufferSize),
+		done:   make(chan struct{}),
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if after != 0 {
+		events := b.events()
+		switch {
+		case after >= b.nextID:
+			// NOTE: 再起動前のIDを指定された場合、続きを判断できない。
+			s.Lost = true
+		case len(events) > 0 && after+1 < events[0].ID:
+			s.Lost = true
+		}
+		if !s.Lost {
+			for _, e := range events {
+				if e.ID > after && (filter == nil || filter(e)) {
+					s.Replay = append(s.Replay, e)
+				}
+			}
+		}
+	}
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Subscribers は、購読者の数を返す。
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// Dropped は、受信が遅れたため購読を解除した数を返す。
+func (b *Broker) Dropped() int64 {
+	return b.dropped.Load()
+}
+
+// events は、保持しているイベントを古い順に返す。 b.mu を取得して呼び出す必要がある。
+func (b *Broker) events() []Event {
+	events := make([]Event, 0, len(b.replay))
+	events = append(events, b.replay[b.head:]...)
+	return append(events, b.replay[:b.head]...)
+}
+
+// remove は、 s の購読を解除する。 b.mu を取得して呼び出す必要がある。
+func (b *Broker) remove(s *Subscription, err error) {
+	if _, ok := b.subs[s]; !ok {
+		return
+	}
+	delete(b.subs, s)
+	s.err = err
+	close(s.done)
+}
+
+// Subscription は、 [Broker.Subscribe] による購読である。
+type Subscription struct {
+	// Replay は、再接続前に配信されたイベントである。 [Subscription.C] より先に送信する必要がある。
+	Replay []Event
+	// Lost は、再送できないイベントがある事を表す。購読者は状態を取得し直す必要がある。
+	Lost bool
+
+	broker *Broker
+	filter func(Event) bool
+	c      chan Event
+	done   chan struct{}
+	err    error
+}
+
+// C は、配信された Event を受け取るチャネルを返す。
+func (s *Subscription) C() <-chan Event {
+	return s.c
+}
+
+// Done は、購読が解除された時点で閉じられるチャネルを返す。
+//
+// 閉じられた後も、 C には解除前に配信された Event が残っている場合がある。
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err は、購読が解除された理由を返す。 [Subscription.Close] で解除した場合は nil を返す。
+func (s *Subscription) Err() error {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	return s.err
+}
+
+// Close は、購読を解除する。複数回呼び出しても良い。
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.remove(s, nil)
+}
@@ -0,0 +1,118 @@
+package pubsub_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/pkg/pubsub"
+)
+
+func TestSubscribe(t *testing.T) {
+	t.Parallel()
+
+	b := pubsub.NewBroker(pubsub.Config{})
+	all := b.Subscribe(0, nil)
+	defer all.Close()
+	alice := b.Subscribe(0, func(e pubsub.Event) bool { return e.User == "alice" })
+	defer alice.Close()
+
+	for _, user := range []string{"alice", "bob", "alice"} {
+		b.Publish(pubsub.Event{Type: "created", User: user})
+	}
+
+	if got := ids(all.C(), 3); !slices.Equal(got, []uint64{1, 2, 3}) {
+		t.Errorf("期待していないイベントです, got = %v", got)
+	}
+	if got := ids(alice.C(), 2); !slices.Equal(got, []uint64{1, 3}) {
+		t.Errorf("絞り込まれていないイベントです, got = %v", got)
+	}
+	if len(alice.C()) != 0 {
+		t.Error("絞り込みの対象外のイベントを受け取りました")
+	}
+}
+
+func TestSubscribeReplay(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		after      uint64
+		wantReplay []uint64
+		wantLost   bool
+	}{
+		"New subscriber":   {after: 0},
+		"Up to date":       {after: 5},
+		"Resume":           {after: 3, wantReplay: []uint64{4, 5}},
+		"Oldest retained":  {after: 2, wantReplay: []uint64{3, 4, 5}},
+		"Too old":          {after: 1, wantLost: true},
+		"Before a restart": {after: 100, wantLost: true},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			b := pubsub.NewBroker(pubsub.Config{ReplaySize: 3})
+			for i := 0; i < 5; i++ {
+				b.Publish(pubsub.Event{Type: "created"})
+			}
+			s := b.Subscribe(c.after, nil)
+			defer s.Close()
+
+			var got []uint64
+			for _, e := range s.Replay {
+				got = append(got, e.ID)
+			}
+			if !slices.Equal(got, c.wantReplay) {
+				t.Errorf("期待していない再送です, got = %v, want = %v", got, c.wantReplay)
+			}
+			if s.Lost != c.wantLost {
+				t.Errorf("期待していない Lost です, got = %v, want = %v", s.Lost, c.wantLost)
+			}
+		})
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	t.Parallel()
+
+	b := pubsub.NewBroker(pubsub.Config{BufferSize: 2})
+	slow := b.Subscribe(0, nil)
+	fast := b.Subscribe(0, nil)
+	defer fast.Close()
+
+	// NOTE: slow が受信しなくても Publish はブロックしない。
+	for i := 0; i < 3; i++ {
+		b.Publish(pubsub.Event{Type: "created"})
+		<-fast.C()
+	}
+
+	select {
+	case <-slow.Done():
+	default:
+		t.Fatal("受信が遅れた購読者の購読が解除されていません")
+	}
+	if !errors.Is(slow.Err(), pubsub.ErrSlowSubscriber) {
+		t.Errorf("期待していないエラーです, got = %v", slow.Err())
+	}
+	if got := ids(slow.C(), 2); !slices.Equal(got, []uint64{1, 2}) {
+		t.Errorf("解除前に配信されたイベントを受け取れません, got = %v", got)
+	}
+	if b.Subscribers() != 1 || b.Dropped() != 1 {
+		t.Errorf("期待していない購読者の数です, subscribers = %d, dropped = %d", b.Subscribers(), b.Dropped())
+	}
+
+	slow.Close()
+	if slow.Err() == nil {
+		t.Error("Close で解除の理由が上書きされました")
+	}
+}
+
+func ids(c <-chan pubsub.Event, n int) []uint64 {
+	var got []uint64
+	for i := 0; i < n; i++ {
+		got = append(got, (<-c).ID)
+	}
+	return got
+}
@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Clock は、 [Limiter] が参照する現在時刻を提供する。
+//
+// テストでは任意に時刻を進められる実装に差し替える事を想定している。
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Result は、 [Limiter.Allow] の判定結果を表す。
+type Result struct {
+	// Allowed は、リクエストが許可されたかどうかを表す。
+	Allowed bool
+	// Limit は、バケットの容量を表す。
+	Limit int
+	// Remaining は、判定後にバケットに残っているトークン数(小数点以下切り捨て)を表す。
+	Remaining int
+	// RetryAfter は、Allowed が false の場合に、次のトークンが補充されるまでの時間を表す。
+	RetryAfter time.Duration
+	// Reset は、バケットが満杯になるまでの時間を表す。
+	Reset time.Duration
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter は、キー毎にトークンバケットを保持するレートリミッタである。
+//
+// 一定時間アクセスの無いキーのバケットは破棄される。
+type Limiter struct {
+	rate        float64
+	burst       int
+	idleTimeout time.Duration
+	clock       Clock
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewLimiter は、1秒あたり rate 個のトークンを補充し、最大 burst 個のトークンを保持する Limiter を返す。
+//
+// idleTimeout の間アクセスの無いキーのバケットは破棄される。
+func NewLimiter(rate float64, burst int, idleTimeout time.Duration) (*Limiter, error) {
+	return NewLimiterWithClock(rate, burst, idleTimeout, systemClock{})
+}
+
+// NewLimiterWithClock は、時刻の取得元を指定した Limiter を返す。
+func NewLimiterWithClock(rate float64, burst int, idleTimeout time.Duration, clock Clock) (*Limiter, error) {
+	if rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+		return nil, fmt.Errorf("レート制限のrateは、正の有限値を指定する必要があります: %v", rate)
+	}
+	if burst < 1 {
+		return nil, fmt.Errorf("レート制限のburstは、1以上を指定する必要があります: %v", burst)
+	}
+
+	// NOTE:
+	// バケットが満杯になる前に破棄すると、破棄直後のアクセスで制限が緩和されてしまう。
+	// 破棄したバケットと新規のバケットを同一視できるよう、満杯になるまでの時間を下限とする。
+	l := &Limiter{
+		rate:        rate,
+		burst:       burst,
+		idleTimeout: idleTimeout,
+		clock:       clock,
+		buckets:     make(map[string]*bucket),
+	}
+	if full := l.durationFor(float64(burst)); l.idleTimeout < full {
+		l.idleTimeout = full
+	}
+	l.lastSweep = clock.Now()
+	return l, nil
+}
+
+// Allow は、 key に対応するバケットからトークンを1つ消費できるかを判定する。
+func (l *Limiter) Allow(key string) Result {
+	now := l.clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{
+			tokens: float64(l.burst),
+			last:   now,
+		}
+		l.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(float64(l.burst), b.tokens+elapsed.Seconds()*l.rate)
+		b.last = now
+	}
+
+	res := Result{
+		Limit: l.burst,
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = l.durationFor(1 - b.tokens)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = l.durationFor(float64(l.burst) - b.tokens)
+	return res
+}
+
+// Len は、現在保持しているバケットの数を返す。
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// sweep は、 idleTimeout の間アクセスの無いバケットを破棄する。
+//
+// 毎回全てのバケットを走査する事を避けるため、走査の間隔は idleTimeout 以上とする。
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.idleTimeout {
+		return
+	}
+	for k, b := range l.buckets {
+		if now.Sub(b.last) >= l.idleTimeout {
+			delete(l.buckets, k)
+		}
+	}
+	l.lastSweep = now
+}
+
+func (l *Limiter) durationFor(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens / l.rate * float64(time.Second)))
+}
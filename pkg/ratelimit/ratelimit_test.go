@@ -0,0 +1,95 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/pkg/ratelimit"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestLimiterAllow(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)}
+	l, err := ratelimit.NewLimiterWithClock(1, 2, time.Minute, clock)
+	if err != nil {
+		t.Fatalf("Limiterの作成に失敗しました: %v", err)
+	}
+
+	steps := []struct {
+		advance       time.Duration
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+	}{
+		{advance: 0, wantAllowed: true, wantRemaining: 1},
+		{advance: 0, wantAllowed: true, wantRemaining: 0},
+		{advance: 0, wantAllowed: false, wantRemaining: 0, wantRetry: time.Second},
+		{advance: 500 * time.Millisecond, wantAllowed: false, wantRemaining: 0, wantRetry: 500 * time.Millisecond},
+		{advance: 500 * time.Millisecond, wantAllowed: true, wantRemaining: 0},
+		{advance: 10 * time.Second, wantAllowed: true, wantRemaining: 1},
+	}
+	for i, s := range steps {
+		clock.Advance(s.advance)
+		got := l.Allow("client")
+		if got.Allowed != s.wantAllowed {
+			t.Errorf("step %d: 期待していない判定です, got = %v, want = %v", i, got.Allowed, s.wantAllowed)
+		}
+		if got.Remaining != s.wantRemaining {
+			t.Errorf("step %d: 期待していない残りトークン数です, got = %v, want = %v", i, got.Remaining, s.wantRemaining)
+		}
+		if got.RetryAfter != s.wantRetry {
+			t.Errorf("step %d: 期待していない待ち時間です, got = %v, want = %v", i, got.RetryAfter, s.wantRetry)
+		}
+	}
+
+	if got := l.Allow("other"); !got.Allowed {
+		t.Error("他のキーのバケットが影響を受けています")
+	}
+}
+
+func TestLimiterEvictsIdleBuckets(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)}
+	l, err := ratelimit.NewLimiterWithClock(1, 1, time.Minute, clock)
+	if err != nil {
+		t.Fatalf("Limiterの作成に失敗しました: %v", err)
+	}
+
+	l.Allow("a")
+	clock.Advance(30 * time.Second)
+	l.Allow("b")
+	if got := l.Len(); got != 2 {
+		t.Fatalf("期待していないバケット数です, got = %d, want = %d", got, 2)
+	}
+
+	clock.Advance(30 * time.Second)
+	l.Allow("b")
+	if got := l.Len(); got != 1 {
+		t.Errorf("アイドル状態のバケットが破棄されていません, got = %d, want = %d", got, 1)
+	}
+}
+
+func TestNewLimiterValidation(t *testing.T) {
+	testcases := map[string]struct {
+		rate  float64
+		burst int
+	}{
+		"Zero rate":  {rate: 0, burst: 1},
+		"Zero burst": {rate: 1, burst: 0},
+	}
+	for name, tc := range testcases {
+		if _, err := ratelimit.NewLimiter(tc.rate, tc.burst, time.Minute); err == nil {
+			t.Errorf("%s: 不正な設定でエラーが発生していません", name)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package realip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustUnix は、信頼できるプロキシとして指定する事で、Unixドメインソケットで接続したクライアントを信頼するキーワードである。
+//
+// Unixドメインソケットには、ソケットファイルのパーミッションで許可された同じホストのプロセス(e.g. nginx)のみが接続できる。
+const TrustUnix = "unix"
+
+// unixRemoteAddr は、Unixドメインソケットで接続したクライアントの [net/http.Request.RemoteAddr] である。
+const unixRemoteAddr = "@"
+
+// Resolver は、リクエスト元のクライアントのIPアドレスを解決する。
+//
+// 信頼できるプロキシから送られたリクエストに限り、 X-Forwarded-For 及び X-Real-IP ヘッダを参照する。
+// 信頼できないクライアントはヘッダを自由に設定できるため、無条件にヘッダを信用してはならない。
+type Resolver struct {
+	trusted   []*net.IPNet
+	trustUnix bool
+}
+
+// NewResolver は、信頼できるプロキシのIPアドレス、CIDR、または [TrustUnix] を指定した Resolver を返す。
+func NewResolver(trustedProxies []string) (*Resolver, error) {
+	res := &Resolver{}
+	for _, p := range trustedProxies {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if p == TrustUnix {
+			res.trustUnix = true
+			continue
+		}
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("信頼するプロキシには、IPアドレスまたはCIDRを指定する必要があります: %s", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			res.trusted = append(res.trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("信頼するプロキシには、IPアドレスまたはCIDRを指定する必要があります: %s", p)
+		}
+		res.trusted = append(res.trusted, n)
+	}
+	return res, nil
+}
+
+// ClientIP は、 r の送信元のクライアントのIPアドレスを返す。
+//
+// X-Forwarded-For は右端(直前のプロキシが追記した値)から遡り、最初に現れた信頼できないアドレスをクライアントとみなす。
+func (res *Resolver) ClientIP(r *http.Request) string {
+	remote := remoteIP(r.RemoteAddr)
+	if !res.isTrusted(remote) {
+		return remote
+	}
+
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(v, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if net.ParseIP(hops[i]) == nil {
+			// NOTE: 不正な値が含まれる場合、それより左側の値は信頼できない。
+			break
+		}
+		if !res.isTrusted(hops[i]) || i == 0 {
+			return hops[i]
+		}
+	}
+
+	if v := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(v) != nil {
+		return v
+	}
+	return remote
+}
+
+func (res *Resolver) isTrusted(addr string) bool {
+	if addr == unixRemoteAddr || addr == "" {
+		return res.trustUnix
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range res.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
@@ -0,0 +1,51 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// Header は、リクエストIDを伝搬するHTTPヘッダである。
+const Header = "X-Request-ID"
+
+const maxLength = 128
+
+type contextKey struct{}
+
+// NewContext は、リクエストIDを保存した [context.Context] を返す。
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext は、 ctx に保存されたリクエストIDを返す。保存されていない場合は空文字を返す。
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// New は、ランダムなリクエストIDを生成する。
+func New() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// NOTE: crypto/rand の読み込み失敗は想定しない。発生した場合はリクエストの処理を継続できない。
+		panic(fmt.Sprintf("requestid: could not generate id, err =%v", err))
+	}
+	return hex.EncodeToString(b)
+}
+
+// Valid は、クライアントから受け取ったリクエストIDをそのまま利用して良いかを判定する。
+//
+// ログの改ざんを防ぐため、空白及び制御文字を含まない印字可能なASCII文字列のみを許可する。
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
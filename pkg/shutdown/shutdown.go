@@ -0,0 +1,190 @@
+// Package shutdown は、Graceful shutdownの後処理、長時間のリクエストへの通知及びコネクションの追跡を提供する。
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultHookTimeout は、フック毎のタイムアウトのデフォルト値である。
+const DefaultHookTimeout = 5 * time.Second
+
+type hook struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// Hooks は、サーバの停止後に実行する後処理(e.g. バッファのフラッシュ、DBのクローズ)を保持する。
+type Hooks struct {
+	timeout time.Duration
+
+	mu    sync.Mutex
+	hooks []hook
+	ran   bool
+}
+
+// NewHooks は、フック毎に timeout で打ち切る Hooks を返す。 timeout が 0 の場合は [DefaultHookTimeout] とする。
+func NewHooks(timeout time.Duration) *Hooks {
+	if timeout == 0 {
+		timeout = DefaultHookTimeout
+	}
+	return &Hooks{
+		timeout: timeout,
+	}
+}
+
+// Add は、 name という名前で fn を登録する。
+//
+// フックは defer と同様に登録と逆の順で実行されるため、依存先のリソース(e.g. DB)を先に作成して登録する事で、
+// 依存するリソース(e.g. DBを使用するスケジューラ)を先に停止できる。
+func (h *Hooks) Add(name string, fn func(ctx context.Context) error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hooks = append(h.hooks, hook{name: name, fn: fn})
+}
+
+// Run は、登録したフックを逆順に実行し、全てのエラーを [errors.Join] で返す。2回目以降の呼び出しは何もしない。
+//
+// フックが失敗、またはタイムアウトした場合も、後続のフックは実行する。
+func (h *Hooks) Run(ctx context.Context, logger *slog.Logger) error {
+	h.mu.Lock()
+	if h.ran {
+		h.mu.Unlock()
+		return nil
+	}
+	h.ran = true
+	hooks := h.hooks
+	h.mu.Unlock()
+
+	var errs []error
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hk := hooks[i]
+		start := time.Now()
+		if err := h.run(ctx, hk); err != nil {
+			logger.Error("shutdown hook failed", slog.String("hook", hk.name), slog.Duration("elapsed", time.Since(start)), slog.Any("err", err))
+			errs = append(errs, fmt.Errorf("%s: %w", hk.name, err))
+			continue
+		}
+		logger.Info("shutdown hook completed", slog.String("hook", hk.name), slog.Duration("elapsed", time.Since(start)))
+	}
+	return errors.Join(errs...)
+}
+
+func (h *Hooks) run(ctx context.Context, hk hook) error {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	// NOTE: ctx に従わないフックでも後続のフックを実行できるよう、タイムアウト後は完了を待たない。
+	done := make(chan error, 1)
+	go func() {
+		done <- hk.fn(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Notifier は、シャットダウンの開始を長時間のリクエスト(e.g. ストリーミング)に通知する。
+type Notifier struct {
+	done chan struct{}
+	once sync.Once
+}
+
+// NewNotifier は、通知前の Notifier を返す。
+func NewNotifier() *Notifier {
+	return &Notifier{
+		done: make(chan struct{}),
+	}
+}
+
+// Notify は、シャットダウンの開始を通知する。 [net/http.Server.RegisterOnShutdown] に登録して使用する。
+func (n *Notifier) Notify() {
+	n.once.Do(func() {
+		close(n.done)
+	})
+}
+
+// Done は、シャットダウンの開始時に閉じられるチャネルを返す。
+func (n *Notifier) Done() <-chan struct{} {
+	return n.done
+}
+
+type notifierContextKey struct{}
+
+// ContextWithNotifier は、 n を保存した [context.Context] を返す。
+//
+// [net/http.Server.BaseContext] で使用する事で、全てのリクエストから [Done] で参照できる。
+func ContextWithNotifier(ctx context.Context, n *Notifier) context.Context {
+	return context.WithValue(ctx, notifierContextKey{}, n)
+}
+
+// Done は、 ctx に保存された [Notifier] の Done を返す。保存されていない場合は、閉じられない nil チャネルを返す。
+//
+// 長時間のリクエストは、このチャネルが閉じられた時点で応答を終了する必要がある。
+func Done(ctx context.Context) <-chan struct{} {
+	if n, ok := ctx.Value(notifierContextKey{}).(*Notifier); ok {
+		return n.Done()
+	}
+	return nil
+}
+
+// Register は、 srv のシャットダウンの開始を n に通知し、リクエストから参照できるようにする。
+func (n *Notifier) Register(srv *http.Server) {
+	srv.RegisterOnShutdown(n.Notify)
+	base := srv.BaseContext
+	srv.BaseContext = func(ln net.Listener) context.Context {
+		ctx := context.Background()
+		if base != nil {
+			ctx = base(ln)
+		}
+		return ContextWithNotifier(ctx, n)
+	}
+}
+
+// ConnTracker は、HTTPサーバのコネクションの数を追跡する。
+type ConnTracker struct {
+	mu    sync.Mutex
+	conns map[net.Conn]http.ConnState
+}
+
+// TrackConns は、 srv のコネクションを追跡する ConnTracker を返す。既存の srv.ConnState も引き続き呼び出す。
+func TrackConns(srv *http.Server) *ConnTracker {
+	t := &ConnTracker{
+		conns: make(map[net.Conn]http.ConnState),
+	}
+	next := srv.ConnState
+	srv.ConnState = func(c net.Conn, state http.ConnState) {
+		t.mu.Lock()
+		switch state {
+		case http.StateClosed, http.StateHijacked:
+			delete(t.conns, c)
+		default:
+			t.conns[c] = state
+		}
+		t.mu.Unlock()
+		if next != nil {
+			next(c, state)
+		}
+	}
+	return t
+}
+
+// Counts は、状態(new, active 及び idle)毎のコネクションの数を返す。
+func (t *ConnTracker) Counts() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counts := make(map[string]int)
+	for _, state := range t.conns {
+		counts[state.String()]++
+	}
+	return counts
+}
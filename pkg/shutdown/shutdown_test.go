@@ -0,0 +1,141 @@
+package shutdown_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/pkg/shutdown"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHooksRun(t *testing.T) {
+	errFailed := errors.New("failed")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// NOTE: フックは別のゴルーチンで実行される。
+	var mu sync.Mutex
+	var got []string
+	record := func(name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, name)
+	}
+	hooks := shutdown.NewHooks(10 * time.Millisecond)
+	hooks.Add("first", func(ctx context.Context) error {
+		record("first")
+		return nil
+	})
+	hooks.Add("failed", func(ctx context.Context) error {
+		record("failed")
+		return errFailed
+	})
+	hooks.Add("timeout", func(ctx context.Context) error {
+		record("timeout")
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	hooks.Add("last", func(ctx context.Context) error {
+		record("last")
+		return nil
+	})
+
+	err := hooks.Run(context.Background(), logger)
+	mu.Lock()
+	defer mu.Unlock()
+	if !errors.Is(err, errFailed) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("期待していないエラーです, err = %v", err)
+	}
+	if diff := cmp.Diff([]string{"last", "timeout", "failed", "first"}, got); diff != "" {
+		t.Errorf("期待していない実行順です (-want +got):\n%s", diff)
+	}
+
+	// NOTE: 2回目以降の呼び出しでは何も実行しない。
+	got = nil
+	if err := hooks.Run(context.Background(), logger); err != nil {
+		t.Errorf("期待していないエラーです, err = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("フックが再度実行されました, got = %v", got)
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	if shutdown.Done(context.Background()) != nil {
+		t.Error("Notifier を保存していない context で nil 以外のチャネルが返されました")
+	}
+
+	notified := make(chan struct{})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-shutdown.Done(r.Context())
+		close(notified)
+	})
+	srv := httptest.NewUnstartedServer(h)
+	n := shutdown.NewNotifier()
+	n.Register(srv.Config)
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal("リクエストに失敗しました, err =", err)
+	}
+	defer resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := srv.Config.Shutdown(ctx); err != nil {
+		t.Fatal("Graceful shutdownに失敗しました, err =", err)
+	}
+	select {
+	case <-notified:
+	default:
+		t.Error("シャットダウンの開始がリクエストに通知されませんでした")
+	}
+	select {
+	case <-n.Done():
+	default:
+		t.Error("Notifier の Done が閉じられていません")
+	}
+}
+
+func TestConnTracker(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	conns := shutdown.TrackConns(srv.Config)
+	srv.Start()
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal("接続に失敗しました, err =", err)
+	}
+
+	waitFor := func(want map[string]int) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for {
+			got := conns.Counts()
+			diff := cmp.Diff(want, got)
+			if diff == "" {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("期待していないコネクションの数です (-want +got):\n%s", diff)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitFor(map[string]int{"new": 1})
+
+	conn.Close()
+	waitFor(map[string]int{})
+}
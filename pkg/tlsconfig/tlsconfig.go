@@ -0,0 +1,259 @@
+// Package tlsconfig は、HTTPサーバのTLSの設定を組み立てる。
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCheckInterval は、証明書ファイルの変更を確認する間隔のデフォルト値である。
+const DefaultCheckInterval = 10 * time.Second
+
+const (
+	// ClientAuthNone は、クライアント証明書を要求しない事を表す。
+	ClientAuthNone = "none"
+	// ClientAuthOptional は、クライアント証明書が提示された場合のみ検証する事を表す。
+	ClientAuthOptional = "optional"
+	// ClientAuthRequire は、検証済みのクライアント証明書を必須とする事を表す。
+	ClientAuthRequire = "require"
+)
+
+// Config は、 [New] に与える設定を表す。
+type Config struct {
+	// CertFile 及び KeyFile は、PEM形式のサーバ証明書(中間証明書を含む)及び秘密鍵のパスである。
+	CertFile string
+	KeyFile  string
+	// MinVersion は、許可するTLSの最小バージョン(1.2 または 1.3)である。空文字の場合は 1.2 とする。
+	MinVersion string
+	// CipherSuites は、TLS 1.2で使用する暗号スイートの名前である。空の場合は Go のデフォルトを使用する。
+	//
+	// NOTE: TLS 1.3の暗号スイートは Go が選択し、変更できない。
+	CipherSuites []string
+	// ClientAuth は、クライアント証明書の扱い(none, optional または require)である。空文字の場合は none とする。
+	ClientAuth string
+	// ClientCAFile は、クライアント証明書を検証するPEM形式のCA証明書のパスである。
+	ClientCAFile string
+	// CheckInterval は、証明書ファイルの変更を確認する間隔である。0 の場合は [DefaultCheckInterval] とする。
+	CheckInterval time.Duration
+}
+
+// New は、 cfg に従った [crypto/tls.Config] と、その証明書を保持する Certificate を返す。
+func New(cfg Config) (*tls.Config, *Certificate, error) {
+	minVersion, err := ParseVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	suites, err := ParseCipherSuites(cfg.CipherSuites)
+	if err != nil {
+		return nil, nil, err
+	}
+	clientAuth, err := ParseClientAuth(cfg.ClientAuth)
+	if err != nil {
+		return nil, nil, err
+	}
+	interval := cfg.CheckInterval
+	if interval == 0 {
+		interval = DefaultCheckInterval
+	}
+	cert, err := NewCertificateWithInterval(cfg.CertFile, cfg.KeyFile, interval)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   suites,
+		ClientAuth:     clientAuth,
+		GetCertificate: cert.GetCertificate,
+	}
+	if clientAuth != tls.NoClientCert {
+		if cfg.ClientCAFile == "" {
+			return nil, nil, errors.New("クライアント証明書を検証するには、CA証明書を指定する必要があります")
+		}
+		pool, err := LoadCertPool(cfg.ClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		tlsCfg.ClientCAs = pool
+	}
+	return tlsCfg, cert, nil
+}
+
+// ParseVersion は、 1.2 または 1.3 の文字列をTLSのバージョンに変換する。空文字の場合は TLS 1.2 を返す。
+func ParseVersion(s string) (uint16, error) {
+	switch s {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("TLSの最小バージョンには 1.2 または 1.3 を指定する必要があります: %s", s)
+	}
+}
+
+// ParseCipherSuites は、暗号スイートの名前(e.g. TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256)をIDに変換する。
+//
+// 安全でない暗号スイート( [crypto/tls.InsecureCipherSuites] )は指定できない。
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, s := range tls.CipherSuites() {
+		known[s.Name] = s.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	var unknown []string
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("不明または安全でない暗号スイートです: %s", strings.Join(unknown, ", "))
+	}
+	return ids, nil
+}
+
+// ParseClientAuth は、 none, optional または require の文字列をクライアント証明書の扱いに変換する。
+func ParseClientAuth(s string) (tls.ClientAuthType, error) {
+	switch s {
+	case "", ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return 0, fmt.Errorf("クライアント証明書の扱いには %s, %s または %s を指定する必要があります: %s",
+			ClientAuthNone, ClientAuthOptional, ClientAuthRequire, s)
+	}
+}
+
+// LoadCertPool は、 path のPEM形式の証明書を含む [crypto/x509.CertPool] を返す。
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("%s にPEM形式の証明書が含まれていません", path)
+	}
+	return pool, nil
+}
+
+// Certificate は、ファイルから読み込んだサーバ証明書を保持し、ファイルが変更された場合に読み込み直す。
+//
+// 読み込みに失敗した場合(e.g. 証明書と秘密鍵の片方のみが更新された)は、元の証明書を使用し続ける。
+type Certificate struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	certStat  fileStat
+	keyStat   fileStat
+	lastCheck time.Time
+}
+
+type fileStat struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewCertificate は、 certFile 及び keyFile から読み込んだ Certificate を返す。
+func NewCertificate(certFile, keyFile string) (*Certificate, error) {
+	return NewCertificateWithInterval(certFile, keyFile, DefaultCheckInterval)
+}
+
+// NewCertificateWithInterval は、 interval 毎にファイルの変更を確認する Certificate を返す。
+func NewCertificateWithInterval(certFile, keyFile string, interval time.Duration) (*Certificate, error) {
+	c := &Certificate{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+	}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetCertificate は、 [crypto/tls.Config.GetCertificate] として使用する。
+//
+// 前回の確認から interval 以上経過している場合、ファイルの変更を確認してから証明書を返す。
+func (c *Certificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now := time.Now(); now.Sub(c.lastCheck) >= c.interval {
+		c.lastCheck = now
+		certStat, err1 := stat(c.certFile)
+		keyStat, err2 := stat(c.keyFile)
+		if err1 == nil && err2 == nil && (certStat != c.certStat || keyStat != c.keyStat) {
+			// NOTE: 読み込みに失敗した場合は記録した状態を更新しないため、次回の確認で再試行する。
+			_ = c.load()
+		}
+	}
+	return c.cert, nil
+}
+
+// Reload は、ファイルの変更の有無に関わらず証明書を読み込み直す。失敗した場合は元の証明書を維持する。
+func (c *Certificate) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.load()
+}
+
+// Leaf は、現在のサーバ証明書を返す。
+func (c *Certificate) Leaf() *x509.Certificate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cert.Leaf
+}
+
+func (c *Certificate) load() error {
+	// NOTE: 読み込みの前に状態を取得する事で、読み込み中に更新された場合も次回の確認で検知できる。
+	certStat, err := stat(c.certFile)
+	if err != nil {
+		return err
+	}
+	keyStat, err := stat(c.keyFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("サーバ証明書を読み込めません: %w", err)
+	}
+	if cert.Leaf == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("サーバ証明書を読み込めません: %w", err)
+		}
+	}
+	c.cert = &cert
+	c.certStat = certStat
+	c.keyStat = keyStat
+	return nil
+}
+
+func stat(path string) (fileStat, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileStat{}, err
+	}
+	return fileStat{modTime: fi.ModTime(), size: fi.Size()}, nil
+}
@@ -0,0 +1,236 @@
+package tlsconfig_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/pkg/tlsconfig"
+)
+
+// issued は、テスト中に発行した証明書及び秘密鍵である。
+type issued struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func issue(t *testing.T, cn string, serial int64, parent *issued, isCA bool) *issued {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("秘密鍵の生成に失敗しました: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: cn, Organization: []string{"Example"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		DNSNames:              []string{"localhost"},
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("証明書の発行に失敗しました: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("証明書の読み込みに失敗しました: %v", err)
+	}
+	return &issued{cert: cert, key: key}
+}
+
+func (i *issued) certPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: i.cert.Raw})
+}
+
+func (i *issued) keyPEM(t *testing.T) []byte {
+	t.Helper()
+	der, err := x509.MarshalECPrivateKey(i.key)
+	if err != nil {
+		t.Fatalf("秘密鍵の変換に失敗しました: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func (i *issued) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{i.cert.Raw}, PrivateKey: i.key, Leaf: i.cert}
+}
+
+func write(t *testing.T, path string, b []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatalf("ファイルの書き込みに失敗しました: %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	testcases := map[string]struct {
+		parse   func() error
+		wantErr bool
+	}{
+		"Default version": {
+			parse: func() error { _, err := tlsconfig.ParseVersion(""); return err },
+		},
+		"TLS 1.3": {
+			parse: func() error { _, err := tlsconfig.ParseVersion("1.3"); return err },
+		},
+		"TLS 1.0": {
+			parse:   func() error { _, err := tlsconfig.ParseVersion("1.0"); return err },
+			wantErr: true,
+		},
+		"Secure cipher suite": {
+			parse: func() error {
+				_, err := tlsconfig.ParseCipherSuites([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"})
+				return err
+			},
+		},
+		"Insecure cipher suite": {
+			parse: func() error {
+				_, err := tlsconfig.ParseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"})
+				return err
+			},
+			wantErr: true,
+		},
+		"Client auth": {
+			parse: func() error { _, err := tlsconfig.ParseClientAuth(tlsconfig.ClientAuthOptional); return err },
+		},
+		"Unknown client auth": {
+			parse:   func() error { _, err := tlsconfig.ParseClientAuth("always"); return err },
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testcases {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			err := tc.parse()
+			if (err != nil) != tc.wantErr {
+				t.Errorf("期待していないエラーです, got = %v, wantErr = %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	first := issue(t, "localhost", 1, nil, false)
+	write(t, certFile, first.certPEM())
+	write(t, keyFile, first.keyPEM(t))
+
+	c, err := tlsconfig.NewCertificateWithInterval(certFile, keyFile, 0)
+	if err != nil {
+		t.Fatalf("証明書の読み込みに失敗しました: %v", err)
+	}
+	serial := func() int64 {
+		cert, err := c.GetCertificate(nil)
+		if err != nil {
+			t.Fatalf("証明書の取得に失敗しました: %v", err)
+		}
+		return cert.Leaf.SerialNumber.Int64()
+	}
+	if got := serial(); got != 1 {
+		t.Errorf("期待していない証明書です, got = %d", got)
+	}
+
+	// NOTE: 証明書のみを更新した場合、秘密鍵と一致しないため元の証明書を使用し続ける。
+	second := issue(t, "localhost", 2, nil, false)
+	write(t, certFile, second.certPEM())
+	if got := serial(); got != 1 {
+		t.Errorf("不整合な証明書に差し替えられています, got = %d", got)
+	}
+
+	write(t, keyFile, second.keyPEM(t))
+	if got := serial(); got != 2 {
+		t.Errorf("証明書が読み込み直されていません, got = %d", got)
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := issue(t, "ca", 1, nil, true)
+	server := issue(t, "localhost", 2, ca, false)
+	client := issue(t, "alice", 3, ca, false)
+	other := issue(t, "mallory", 4, nil, false)
+
+	write(t, filepath.Join(dir, "ca.pem"), ca.certPEM())
+	write(t, filepath.Join(dir, "cert.pem"), server.certPEM())
+	write(t, filepath.Join(dir, "key.pem"), server.keyPEM(t))
+
+	cfg, _, err := tlsconfig.New(tlsconfig.Config{
+		CertFile:     filepath.Join(dir, "cert.pem"),
+		KeyFile:      filepath.Join(dir, "key.pem"),
+		MinVersion:   "1.3",
+		ClientAuth:   tlsconfig.ClientAuthRequire,
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+	})
+	if err != nil {
+		t.Fatalf("TLSの設定に失敗しました: %v", err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+	}))
+	srv.TLS = cfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	testcases := map[string]struct {
+		certs   []tls.Certificate
+		wantErr bool
+	}{
+		"Trusted client certificate": {
+			certs: []tls.Certificate{client.tlsCertificate()},
+		},
+		"Untrusted client certificate": {
+			certs:   []tls.Certificate{other.tlsCertificate()},
+			wantErr: true,
+		},
+		"No client certificate": {
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range testcases {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+				RootCAs:      roots,
+				Certificates: tc.certs,
+				ServerName:   "localhost",
+			}}}
+			res, err := c.Get(srv.URL)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("期待していないエラーです, got = %v, wantErr = %v", err, tc.wantErr)
+			}
+			if err == nil {
+				res.Body.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package tracing_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/pkg/tracing"
+)
+
+// collector は、OTLP/HTTPのリクエストを記録するコレクタの代替である。
+type collector struct {
+	mu       sync.Mutex
+	requests []map[string]interface{}
+	headers  []http.Header
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, req)
+	c.headers = append(c.headers, r.Header.Clone())
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte("{}"))
+}
+
+func TestOTLPExporter(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	t.Cleanup(srv.Close)
+
+	exporter, err := tracing.NewOTLPExporter(tracing.OTLPConfig{
+		Endpoint:    srv.URL + "/v1/traces",
+		ServiceName: "test-service",
+		Headers:     map[string]string{"X-Api-Key": "secret"},
+	})
+	if err != nil {
+		t.Fatalf("予期しないエラーが発生しました: %v", err)
+	}
+	tracer := tracing.NewTracer(tracing.Config{Exporter: exporter})
+
+	ctx, parent := tracer.Start(context.Background(), "GET /todos", tracing.SpanKindServer,
+		tracing.String("http.route", "/todos"),
+		tracing.Int("http.response.status_code", 500),
+		tracing.Bool("flag", true),
+	)
+	_, child := tracer.Start(ctx, "SELECT", tracing.SpanKindClient)
+	child.End()
+	parent.SetStatus(tracing.StatusError, "Internal Server Error")
+	parent.End()
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("予期しないエラーが発生しました: %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.requests) != 1 {
+		t.Fatalf("期待していないリクエストの数です, got = %d, want = 1", len(c.requests))
+	}
+	if got := c.headers[0].Get("Content-Type"); got != "application/json" {
+		t.Errorf("期待していない Content-Type です, got = %s", got)
+	}
+	if got := c.headers[0].Get("X-Api-Key"); got != "secret" {
+		t.Errorf("設定したヘッダが送信されていません, got = %s", got)
+	}
+
+	var body struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string                 `json:"key"`
+					Value map[string]interface{} `json:"value"`
+				} `json:"attributes"`
+			} `json:"resource"`
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID      string `json:"traceId"`
+					SpanID       string `json:"spanId"`
+					ParentSpanID string `json:"parentSpanId"`
+					Name         string `json:"name"`
+					Kind         int    `json:"kind"`
+					Attributes   []struct {
+						Key   string                 `json:"key"`
+						Value map[string]interface{} `json:"value"`
+					} `json:"attributes"`
+					Status struct {
+						Code int `json:"code"`
+					} `json:"status"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	b, _ := json.Marshal(c.requests[0])
+	if err := json.Unmarshal(b, &body); err != nil {
+		t.Fatalf("リクエストの読み込みに失敗しました: %v", err)
+	}
+
+	rs := body.ResourceSpans[0]
+	if a := rs.Resource.Attributes[0]; a.Key != "service.name" || a.Value["stringValue"] != "test-service" {
+		t.Errorf("service.name が送信されていません, got = %+v", a)
+	}
+	spans := rs.ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("期待していないスパンの数です, got = %d, want = 2", len(spans))
+	}
+	gotChild, gotParent := spans[0], spans[1]
+	if gotParent.TraceID != parent.SpanContext().TraceID.String() || gotParent.ParentSpanID != "" {
+		t.Errorf("期待していない親スパンです, got = %+v", gotParent)
+	}
+	if gotChild.ParentSpanID != gotParent.SpanID {
+		t.Errorf("親子関係が正しくありません, got = %s, want = %s", gotChild.ParentSpanID, gotParent.SpanID)
+	}
+	if gotParent.Kind != int(tracing.SpanKindServer) || gotParent.Status.Code != int(tracing.StatusError) {
+		t.Errorf("期待していないスパンの種類または処理結果です, got = %+v", gotParent)
+	}
+	wantAttrs := map[string]interface{}{
+		"http.route":                "/todos",
+		"http.response.status_code": "500",
+		"flag":                      true,
+	}
+	for _, a := range gotParent.Attributes {
+		var got interface{}
+		for _, v := range a.Value {
+			got = v
+		}
+		if got != wantAttrs[a.Key] {
+			t.Errorf("期待していない属性です, key = %s, got = %v, want = %v", a.Key, got, wantAttrs[a.Key])
+		}
+	}
+}
+
+func TestOTLPExporterInvalidEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"", "localhost:4318", "ftp://localhost/v1/traces"} {
+		if _, err := tracing.NewOTLPExporter(tracing.OTLPConfig{Endpoint: endpoint}); err == nil {
+			t.Errorf("不正なURLを受け付けています: %s", endpoint)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+)
+
+const (
+	// TraceparentHeader は、トレースID等を伝搬するHTTPヘッダである。
+	TraceparentHeader = "traceparent"
+	// TracestateHeader は、トレーシングシステム固有の情報を伝搬するHTTPヘッダである。
+	TracestateHeader = "tracestate"
+)
+
+const supportedVersion = 0
+
+var errInvalidTraceparent = errors.New("tracing: invalid traceparent")
+
+// ParseTraceparent は、traceparent ヘッダの値を解析する。
+//
+// Ref: https://www.w3.org/TR/trace-context/#traceparent-header
+func ParseTraceparent(s string) (SpanContext, error) {
+	// NOTE: version(2)-trace-id(32)-parent-id(16)-trace-flags(2)
+	const size = 55
+
+	if len(s) < size || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	version, ok := decodeHex(s[0:2])
+	if !ok || version[0] == 0xff {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	// NOTE: 未知のバージョンは、先頭の4フィールドのみを解釈する。
+	if version[0] == supportedVersion && len(s) != size {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	if version[0] != supportedVersion && len(s) > size && s[size] != '-' {
+		return SpanContext{}, errInvalidTraceparent
+	}
+
+	var sc SpanContext
+	traceID, ok := decodeHex(s[3:35])
+	if !ok {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	copy(sc.TraceID[:], traceID)
+	spanID, ok := decodeHex(s[36:52])
+	if !ok {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	copy(sc.SpanID[:], spanID)
+	flags, ok := decodeHex(s[53:55])
+	if !ok {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	sc.Sampled = flags[0]&0x01 == 0x01
+
+	if !sc.IsValid() {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	return sc, nil
+}
+
+// decodeHex は、小文字の16進数のみを受け付ける。
+func decodeHex(s string) ([]byte, bool) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return nil, false
+		}
+	}
+	b, err := hex.DecodeString(s)
+	return b, err == nil
+}
+
+// Traceparent は、traceparent ヘッダの値を返す。
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// Extract は、HTTPヘッダからスパンの識別情報を取得する。妥当な traceparent ヘッダが無い場合は false を返す。
+func Extract(h http.Header) (SpanContext, bool) {
+	v := h.Values(TraceparentHeader)
+	// NOTE: 複数の traceparent ヘッダは不正であるため、無視する。
+	if len(v) != 1 {
+		return SpanContext{}, false
+	}
+	sc, err := ParseTraceparent(v[0])
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc.TraceState = h.Get(TracestateHeader)
+	return sc, true
+}
+
+// Inject は、 ctx に保存されたスパンの識別情報をHTTPヘッダに設定する。
+//
+// 外部へのHTTPリクエストに設定する事で、トレースを伝搬できる。
+func Inject(ctx context.Context, h http.Header) {
+	sc := SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	h.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		h.Set(TracestateHeader, sc.TraceState)
+	}
+}
@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// Queryer は、 [database/sql.DB] 及び [database/sql.Tx] に共通するクエリのメソッドである。
+type Queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// DB は、クエリ毎に子スパンを作成する [Queryer] である。
+//
+// エラーはラップせずにそのまま返すため、呼び出し側でドライバ固有のエラーを判定できる。
+type DB struct {
+	q      Queryer
+	tracer *Tracer
+	attrs  []Attribute
+}
+
+// WrapDB は、 q のクエリ毎にスパンを作成する DB を返す。 attrs は全てのスパンに付与する(e.g. db.system)。
+func WrapDB(q Queryer, tracer *Tracer, attrs ...Attribute) *DB {
+	return &DB{
+		q:      q,
+		tracer: tracer,
+		attrs:  attrs,
+	}
+}
+
+// ExecContext は、 [database/sql.DB.ExecContext] をスパンで計測する。
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := db.start(ctx, query)
+	defer span.End()
+
+	res, err := db.q.ExecContext(ctx, query, args...)
+	span.RecordError(err)
+	return res, err
+}
+
+// QueryContext は、 [database/sql.DB.QueryContext] をスパンで計測する。
+//
+// スパンはクエリの実行までを計測し、結果の読み込みは含まない。
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := db.start(ctx, query)
+	defer span.End()
+
+	rows, err := db.q.QueryContext(ctx, query, args...)
+	span.RecordError(err)
+	return rows, err
+}
+
+// QueryRowContext は、 [database/sql.DB.QueryRowContext] をスパンで計測する。
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := db.start(ctx, query)
+	defer span.End()
+
+	row := db.q.QueryRowContext(ctx, query, args...)
+	span.RecordError(row.Err())
+	return row
+}
+
+func (db *DB) start(ctx context.Context, query string) (context.Context, *Span) {
+	operation := query
+	if i := strings.IndexAny(query, " \t\n"); i > 0 {
+		operation = query[:i]
+	}
+	operation = strings.ToUpper(operation)
+
+	attrs := make([]Attribute, 0, len(db.attrs)+2)
+	attrs = append(attrs, db.attrs...)
+	attrs = append(attrs,
+		String("db.operation", operation),
+		String("db.statement", query),
+	)
+	return db.tracer.Start(ctx, operation, SpanKindClient, attrs...)
+}
@@ -0,0 +1,75 @@
+package tracing_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/db"
+	"github.com/TechBowl-japan/go-stations/pkg/tracing"
+)
+
+func TestWrapDB(t *testing.T) {
+	d, err := db.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("データベースの作成に失敗しました: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := d.Close(); err != nil {
+			t.Errorf("データベースのクローズに失敗しました: %v", err)
+		}
+	})
+
+	rec := &recorder{}
+	tracer := tracing.NewTracer(tracing.Config{Exporter: rec})
+	wrapped := tracing.WrapDB(d, tracer, tracing.String("db.system", "sqlite"))
+
+	ctx, parent := tracer.Start(context.Background(), "parent", tracing.SpanKindServer)
+	if _, err := wrapped.ExecContext(ctx, `INSERT INTO todos(subject) VALUES(?)`, "subject"); err != nil {
+		t.Fatalf("予期しないエラーが発生しました: %v", err)
+	}
+	var subject string
+	if err := wrapped.QueryRowContext(ctx, `SELECT subject FROM todos WHERE id = ?`, 1).Scan(&subject); err != nil {
+		t.Fatalf("予期しないエラーが発生しました: %v", err)
+	}
+	if err := wrapped.QueryRowContext(ctx, `SELECT subject FROM todos WHERE id = ?`, 2).Scan(&subject); err != sql.ErrNoRows {
+		t.Errorf("エラーがそのまま返されていません, got = %v", err)
+	}
+	if _, err := wrapped.ExecContext(ctx, `INSERT INTO todos(subject) VALUES(NULL)`); err == nil {
+		t.Error("エラーが返されていません")
+	}
+	parent.End()
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("予期しないエラーが発生しました: %v", err)
+	}
+	spans := rec.get()
+	if len(spans) != 5 {
+		t.Fatalf("期待していないスパンの数です, got = %d, want = 5", len(spans))
+	}
+	wantNames := []string{"INSERT", "SELECT", "SELECT", "INSERT", "parent"}
+	for i, s := range spans[:4] {
+		if s.Name != wantNames[i] {
+			t.Errorf("期待していないスパン名です, got = %s, want = %s", s.Name, wantNames[i])
+		}
+		if s.Parent.SpanID != parent.SpanContext().SpanID {
+			t.Errorf("親スパンが正しくありません, got = %s", s.Parent.SpanID)
+		}
+		var statement string
+		for _, a := range s.Attributes {
+			if a.Key == "db.statement" {
+				statement, _ = a.Value.(string)
+			}
+		}
+		if statement == "" {
+			t.Errorf("SQLが付与されていません, got = %+v", s.Attributes)
+		}
+	}
+	if spans[3].StatusCode != tracing.StatusError {
+		t.Errorf("失敗したクエリのスパンがエラーになっていません, got = %+v", spans[3])
+	}
+	if spans[2].StatusCode != tracing.StatusUnset {
+		t.Errorf("結果が0件のクエリのスパンがエラーになっています, got = %+v", spans[2])
+	}
+}
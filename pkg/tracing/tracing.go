@@ -0,0 +1,431 @@
+// Package tracing は、W3C Trace Context に準拠した分散トレーシングを提供する。
+//
+// 記録したスパンは [Exporter] (e.g. [OTLPExporter]) によってバッチで送信される。
+//
+// Ref: https://www.w3.org/TR/trace-context/
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TraceID は、トレースを識別する16バイトのIDである。
+type TraceID [16]byte
+
+// IsValid は、全て0でない場合に true を返す。
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// String は、IDを小文字の16進数で返す。
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanID は、スパンを識別する8バイトのIDである。
+type SpanID [8]byte
+
+// IsValid は、全て0でない場合に true を返す。
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// String は、IDを小文字の16進数で返す。
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanContext は、プロセス間で伝搬するスパンの識別情報である。
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+	// TraceState は、tracestate ヘッダの値であり、解釈せずにそのまま伝搬する。
+	TraceState string
+	// Remote は、他のプロセスから伝搬された場合に true となる。
+	Remote bool
+}
+
+// IsValid は、トレースID及びスパンIDが共に有効な場合に true を返す。
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// SpanKind は、スパンの種類を表す。値はOTLPの定義に従う。
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// StatusCode は、スパンの処理結果を表す。値はOTLPの定義に従う。
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// Attribute は、スパンに付与する属性である。
+//
+// Value は string, int64, float64, bool のいずれかである。
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String は、文字列の属性を返す。
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int64 は、整数の属性を返す。
+func Int64(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int は、整数の属性を返す。
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: int64(value)}
+}
+
+// Float64 は、浮動小数点数の属性を返す。
+func Float64(key string, value float64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Bool は、真偽値の属性を返す。
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// SpanData は、終了したスパンの内容である。
+type SpanData struct {
+	Name          string
+	Kind          SpanKind
+	SpanContext   SpanContext
+	Parent        SpanContext
+	Start         time.Time
+	End           time.Time
+	Attributes    []Attribute
+	StatusCode    StatusCode
+	StatusMessage string
+}
+
+// Exporter は、終了したスパンを外部に送信する。
+type Exporter interface {
+	ExportSpans(ctx context.Context, spans []SpanData) error
+}
+
+// Span は、処理の単位を表す。
+//
+// nil の Span に対してもメソッドを呼び出せるため、トレーシングが無効な場合も呼び出し側で分岐する必要はない。
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SpanContext は、スパンの識別情報を返す。
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// IsRecording は、スパンが送信の対象である場合に true を返す。
+func (s *Span) IsRecording() bool {
+	return s != nil && s.data.SpanContext.Sampled
+}
+
+// SetName は、スパンの名前を変更する。
+func (s *Span) SetName(name string) {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Name = name
+}
+
+// SetAttributes は、スパンに属性を付与する。
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attributes = append(s.data.Attributes, attrs...)
+}
+
+// SetStatus は、スパンの処理結果を設定する。
+func (s *Span) SetStatus(code StatusCode, message string) {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.StatusCode = code
+	s.data.StatusMessage = message
+}
+
+// RecordError は、 err が nil でない場合にスパンの処理結果をエラーとする。
+func (s *Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.SetStatus(StatusError, err.Error())
+}
+
+// End は、スパンを終了して送信の対象とする。2回目以降の呼び出しは無視する。
+func (s *Span) End() {
+	if !s.IsRecording() {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	s.tracer.enqueue(data)
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpan は、 span を保存した [context.Context] を返す。
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span.SpanContext())
+}
+
+// ContextWithRemoteSpanContext は、他のプロセスから伝搬されたスパンの識別情報を保存した [context.Context] を返す。
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	sc.Remote = true
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext は、 [context.Context] に保存されたスパンの識別情報を返す。
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+// Config は、 [NewTracer] に与える設定を表す。
+type Config struct {
+	Exporter Exporter
+	// BatchTimeout は、スパンを送信する間隔である。0の場合は5秒とする。
+	BatchTimeout time.Duration
+	// MaxBatchSize は、1回で送信するスパンの最大数である。0の場合は512とする。
+	MaxBatchSize int
+	// MaxQueueSize は、送信待ちのスパンの最大数である。超えた場合、スパンは破棄する。0の場合は2048とする。
+	MaxQueueSize int
+	// ExportTimeout は、1回の送信のタイムアウトである。0の場合は10秒とする。
+	ExportTimeout time.Duration
+	// Logger は、送信の失敗等を出力する。nil の場合は [log/slog.Default] を使用する。
+	Logger *slog.Logger
+}
+
+// Tracer は、スパンを作成し、終了したスパンをバックグラウンドで送信する。
+//
+// nil の Tracer に対しても [Tracer.Start] を呼び出せる。その場合、スパンは作成されない。
+type Tracer struct {
+	exporter      Exporter
+	batchTimeout  time.Duration
+	maxBatchSize  int
+	exportTimeout time.Duration
+	logger        *slog.Logger
+
+	queue    chan SpanData
+	dropped  atomic.Int64
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewTracer は、 cfg に従って Tracer を返す。
+//
+// 終了時には [Tracer.Shutdown] を呼び出し、送信待ちのスパンを送信する必要がある。
+func NewTracer(cfg Config) *Tracer {
+	if cfg.BatchTimeout <= 0 {
+		cfg.BatchTimeout = 5 * time.Second
+	}
+	if cfg.MaxBatchSize <= 0 {
+		cfg.MaxBatchSize = 512
+	}
+	if cfg.MaxQueueSize <= 0 {
+		cfg.MaxQueueSize = 2048
+	}
+	if cfg.ExportTimeout <= 0 {
+		cfg.ExportTimeout = 10 * time.Second
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+
+	t := &Tracer{
+		exporter:      cfg.Exporter,
+		batchTimeout:  cfg.BatchTimeout,
+		maxBatchSize:  cfg.MaxBatchSize,
+		exportTimeout: cfg.ExportTimeout,
+		logger:        cfg.Logger,
+		queue:         make(chan SpanData, cfg.MaxQueueSize),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go t.loop()
+	return t
+}
+
+// Start は、 ctx に保存されたスパンを親とする新たなスパンを開始し、そのスパンを保存した [context.Context] を返す。
+//
+// 親が無い場合は新たなトレースを開始する。親が送信の対象でない場合、子も送信の対象としない。
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	parent := SpanContextFromContext(ctx)
+	sc := SpanContext{
+		SpanID:  newSpanID(),
+		Sampled: true,
+	}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Sampled = parent.Sampled
+		sc.TraceState = parent.TraceState
+	} else {
+		sc.TraceID = newTraceID()
+	}
+
+	span := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:        name,
+			Kind:        kind,
+			SpanContext: sc,
+			Parent:      parent,
+			Start:       time.Now(),
+			Attributes:  attrs,
+		},
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// Shutdown は、送信待ちのスパンを送信し、バックグラウンドの処理を終了する。
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.stopOnce.Do(func() {
+		close(t.stop)
+	})
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Tracer) enqueue(data SpanData) {
+	select {
+	case <-t.stop:
+		t.dropped.Add(1)
+		return
+	default:
+	}
+	select {
+	case t.queue <- data:
+	default:
+		// NOTE: 送信先の障害でリクエストの処理を遅延させないため、キューが一杯の場合は破棄する。
+		t.dropped.Add(1)
+	}
+}
+
+func (t *Tracer) loop() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(t.batchTimeout)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, t.maxBatchSize)
+	flush := func() {
+		if n := t.dropped.Swap(0); n > 0 {
+			t.logger.Warn("spans are dropped", slog.Int64("count", n))
+		}
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), t.exportTimeout)
+		defer cancel()
+		if err := t.exporter.ExportSpans(ctx, batch); err != nil {
+			t.logger.Error("could not export spans", slog.Int("count", len(batch)), slog.Any("err", err))
+		}
+		batch = make([]SpanData, 0, t.maxBatchSize)
+	}
+
+	for {
+		select {
+		case data := <-t.queue:
+			batch = append(batch, data)
+			if len(batch) >= t.maxBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.stop:
+			for {
+				select {
+				case data := <-t.queue:
+					batch = append(batch, data)
+					if len(batch) >= t.maxBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		readRandom(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		readRandom(id[:])
+	}
+	return id
+}
+
+func readRandom(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		// NOTE: crypto/rand の読み込み失敗は想定しない。発生した場合はリクエストの処理を継続できない。
+		panic(fmt.Sprintf("tracing: could not generate id, err =%v", err))
+	}
+}
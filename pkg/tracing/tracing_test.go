@@ -0,0 +1,177 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/TechBowl-japan/go-stations/pkg/tracing"
+)
+
+// recorder は、送信されたスパンを記録する [tracing.Exporter] である。
+type recorder struct {
+	mu    sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (r *recorder) ExportSpans(ctx context.Context, spans []tracing.SpanData) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func (r *recorder) get() []tracing.SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]tracing.SpanData(nil), r.spans...)
+}
+
+func TestParseTraceparent(t *testing.T) {
+	testcases := map[string]struct {
+		value   string
+		valid   bool
+		sampled bool
+	}{
+		"sampled": {
+			value:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			valid:   true,
+			sampled: true,
+		},
+		"not sampled": {
+			value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			valid: true,
+		},
+		"future version with extra fields": {
+			value:   "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			valid:   true,
+			sampled: true,
+		},
+		"version 00 with extra fields": {
+			value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		},
+		"invalid version": {
+			value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		},
+		"upper case": {
+			value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01",
+		},
+		"zero trace id": {
+			value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		},
+		"zero span id": {
+			value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		},
+		"too short": {
+			value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		},
+		"empty": {},
+	}
+
+	for name, tc := range testcases {
+		name := name
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			sc, err := tracing.ParseTraceparent(tc.value)
+			if !tc.valid {
+				if err == nil {
+					t.Errorf("不正な値を受け付けています: %s", tc.value)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期しないエラーが発生しました: %v", err)
+			}
+			if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+				t.Errorf("期待していないトレースIDです, got = %s", sc.TraceID)
+			}
+			if sc.SpanID.String() != "00f067aa0ba902b7" {
+				t.Errorf("期待していないスパンIDです, got = %s", sc.SpanID)
+			}
+			if sc.Sampled != tc.sampled {
+				t.Errorf("期待していない sampled フラグです, got = %t, want = %t", sc.Sampled, tc.sampled)
+			}
+		})
+	}
+}
+
+func TestStart(t *testing.T) {
+	rec := &recorder{}
+	tracer := tracing.NewTracer(tracing.Config{Exporter: rec})
+
+	h := http.Header{}
+	h.Set(tracing.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Set(tracing.TracestateHeader, "vendor=value")
+	remote, ok := tracing.Extract(h)
+	if !ok {
+		t.Fatal("traceparent ヘッダを取得できません")
+	}
+
+	ctx := tracing.ContextWithRemoteSpanContext(context.Background(), remote)
+	ctx, parent := tracer.Start(ctx, "parent", tracing.SpanKindServer)
+	childCtx, child := tracer.Start(ctx, "child", tracing.SpanKindClient, tracing.String("key", "value"))
+	child.End()
+	parent.End()
+
+	out := http.Header{}
+	tracing.Inject(childCtx, out)
+	if got, want := out.Get(tracing.TraceparentHeader), child.SpanContext().Traceparent(); got != want {
+		t.Errorf("期待していない traceparent ヘッダです, got = %s, want = %s", got, want)
+	}
+	if got := out.Get(tracing.TracestateHeader); got != "vendor=value" {
+		t.Errorf("tracestate ヘッダが伝搬されていません, got = %s", got)
+	}
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("予期しないエラーが発生しました: %v", err)
+	}
+	spans := rec.get()
+	if len(spans) != 2 {
+		t.Fatalf("期待していないスパンの数です, got = %d, want = 2", len(spans))
+	}
+	gotChild, gotParent := spans[0], spans[1]
+	if gotParent.SpanContext.TraceID != remote.TraceID || gotParent.Parent.SpanID != remote.SpanID {
+		t.Errorf("伝搬されたスパンが親になっていません, got = %+v", gotParent)
+	}
+	if gotChild.SpanContext.TraceID != remote.TraceID || gotChild.Parent.SpanID != gotParent.SpanContext.SpanID {
+		t.Errorf("親子関係が正しくありません, got = %+v", gotChild)
+	}
+	if gotChild.End.Before(gotChild.Start) {
+		t.Errorf("終了時刻が開始時刻より前です, got = %+v", gotChild)
+	}
+}
+
+func TestStartNotSampled(t *testing.T) {
+	rec := &recorder{}
+	tracer := tracing.NewTracer(tracing.Config{Exporter: rec})
+
+	remote, err := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	if err != nil {
+		t.Fatalf("予期しないエラーが発生しました: %v", err)
+	}
+	ctx := tracing.ContextWithRemoteSpanContext(context.Background(), remote)
+	_, span := tracer.Start(ctx, "span", tracing.SpanKindServer)
+	span.End()
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("予期しないエラーが発生しました: %v", err)
+	}
+	if spans := rec.get(); len(spans) != 0 {
+		t.Errorf("送信の対象でないスパンが送信されています, got = %+v", spans)
+	}
+	if span.SpanContext().TraceID != remote.TraceID {
+		t.Errorf("トレースIDが伝搬されていません, got = %s", span.SpanContext().TraceID)
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *tracing.Tracer
+	ctx, span := tracer.Start(context.Background(), "span", tracing.SpanKindInternal)
+	span.SetAttributes(tracing.String("key", "value"))
+	span.End()
+
+	if tracing.SpanContextFromContext(ctx).IsValid() {
+		t.Error("トレーシングが無効な場合にスパンが作成されています")
+	}
+}
@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress は、送信先がループバック、リンクローカル、プライベート等の内部ネットワークのアドレスである事を表す。
+var ErrForbiddenAddress = errors.New("webhook: destination address is not allowed")
+
+// sharedAddressSpace は、キャリアグレードNAT用のアドレス空間(RFC 6598)である。
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// forbiddenAddr は、 addr が外部に公開されたアドレスでない場合に true を返す。
+func forbiddenAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() ||
+		sharedAddressSpace.Contains(addr)
+}
+
+// dialControl は、名前解決後の接続先のアドレスを検証する [net.Dialer.Control] である。
+//
+// 登録時のURLの検証だけでは、内部ネットワークのアドレスに解決されるホスト名(DNS rebinding を含む)を防げないため、接続の直前に検証する。
+func dialControl(network, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+	}
+	if forbiddenAddr(ap.Addr()) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, ap.Addr())
+	}
+	return nil
+}
+
+// newClient は、リダイレクトしないHTTPクライアントを返す。
+// allowPrivateNetworks が false の場合、内部ネットワークのアドレスには接続しない。
+func newClient(allowPrivateNetworks bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if !allowPrivateNetworks {
+		dialer.Control = dialControl
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	// NOTE: プロキシを経由すると、検証の対象が送信先ではなくプロキシのアドレスになるため使用しない。
+	t.Proxy = nil
+	t.DialContext = dialer.DialContext
+	return &http.Client{
+		Transport: t,
+		// NOTE: 登録時に検証したURL以外に送信しないよう、リダイレクトしない。
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
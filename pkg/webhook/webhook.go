@@ -0,0 +1,317 @@
+// Package webhook は、署名付きのWebhookを送信し、失敗した場合に再送するディスパッチャを提供する。
+//
+// 送信予定のWebhookは [Store] で永続化し、プロセスが停止しても再起動後に送信を再開できる。
+// 送信は少なくとも1回(at-least-once)であり、受信側は [DeliveryHeader] で重複を判定する必要がある。
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/pkg/backoff"
+)
+
+// Webhookのリクエストに付与するヘッダである。
+const (
+	// SignatureHeader は、 [Sign] による署名である。
+	SignatureHeader = "X-Webhook-Signature"
+	// EventHeader は、イベントの種類である。
+	EventHeader = "X-Webhook-Event"
+	// DeliveryHeader は、送信のIDである。失敗による再送では同じ値を送信する。
+	DeliveryHeader = "X-Webhook-Delivery"
+)
+
+// maxResponseBytes は、コネクションを再利用するために読み切るレスポンスボディの最大サイズである。
+const maxResponseBytes = 64 << 10
+
+// Sign は、 t 及び body のHMAC-SHA256による署名を t=<UNIX時刻>,v1=<16進数> の形式で返す。
+//
+// 署名の対象は <UNIX時刻>.<body> であり、時刻を含める事で古いリクエストの再送(リプレイ攻撃)を検知できる。
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac(secret, ts, body))
+}
+
+// Verify は、 header が body の正しい署名であり、署名の時刻と now の差が tolerance 以内である事を検証する。
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var ts string
+	var sigs [][]byte
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			if sig, err := hex.DecodeString(v); err == nil {
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return errors.New("webhook: malformed signature")
+	}
+	if d := now.Sub(time.Unix(unix, 0)); d > tolerance || d < -tolerance {
+		return errors.New("webhook: signature is too old")
+	}
+	want := mac(secret, ts, body)
+	for _, sig := range sigs {
+		if hmac.Equal(sig, want) {
+			return nil
+		}
+	}
+	return errors.New("webhook: signature mismatch")
+}
+
+func mac(secret, ts string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// Delivery は、1回分の送信である。
+type Delivery struct {
+	// ID は、 [Store] が送信を識別する値であり、 [DeliveryHeader] で送信する。
+	ID        int64
+	URL       string
+	Secret    string
+	EventType string
+	Payload   []byte
+	// Attempts は、これまでに送信を試みた回数である。
+	Attempts int
+}
+
+// Attempt は、送信を試みた結果である。
+type Attempt struct {
+	// StatusCode は、レスポンスのstatusである。レスポンスを受け取れなかった場合は0とする。
+	StatusCode int
+	// Error は、失敗の理由である。成功した場合は空文字とする。
+	Error string
+	// RetryAfter は、再送までの時間である。0の場合は再送しない。
+	RetryAfter time.Duration
+
+	// permanent は、再送しても成功しない失敗である事を表す。
+	permanent bool
+}
+
+// Succeeded は、送信に成功したかを返す。
+func (a Attempt) Succeeded() bool {
+	return a.Error == ""
+}
+
+// Store は、送信予定の Delivery を永続化する。
+type Store interface {
+	// Claim は、送信予定の時刻を過ぎた Delivery を最大 limit 件返す。
+	// 返した Delivery は、 lease の間は再度返さない。結果を記録せずにプロセスが停止した場合は、 lease の後に再送される。
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]Delivery, error)
+	// Record は、 id の送信の結果を記録する。
+	Record(ctx context.Context, id int64, a Attempt) error
+}
+
+// Config は、 [NewDispatcher] に与える設定を表す。
+type Config struct {
+	// Workers は、並行して送信する数である。0の場合は4とする。
+	Workers int
+	// MaxAttempts は、送信を試みる最大の回数である。0の場合は8とする。
+	MaxAttempts int
+	// InitialBackoff は、最初の再送までの時間である。以降は再送毎に2倍にする。0の場合は10秒とする。
+	InitialBackoff time.Duration
+	// MaxBackoff は、再送までの時間の上限である。0の場合は1時間とする。
+	MaxBackoff time.Duration
+	// Timeout は、1回の送信のタイムアウトである。0の場合は10秒とする。
+	Timeout time.Duration
+	// PollInterval は、送信予定の Delivery を確認する間隔である。0の場合は1秒とする。
+	PollInterval time.Duration
+	// Client は、送信に使用するHTTPクライアントである。
+	// nil の場合は、リダイレクトせず、内部ネットワークのアドレスに接続しないクライアントを使用する。
+	Client *http.Client
+	// AllowPrivateNetworks は、 Client が nil の場合に、ループバック、プライベート等の内部ネットワークのアドレスへの送信を許可する。
+	// 送信先を登録できる利用者が内部のサービスにリクエストを送れる(SSRF)ため、開発環境以外では有効にしない事。
+	AllowPrivateNetworks bool
+	// Logger は、送信の失敗等を出力する。nil の場合は [log/slog.Default] を使用する。
+	Logger *slog.Logger
+}
+
+// Dispatcher は、 [Store] から送信予定の Delivery を取得し、バックグラウンドで送信する。
+type Dispatcher struct {
+	store Store
+	cfg   Config
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewDispatcher は、 cfg に従って送信を開始した Dispatcher を返す。
+//
+// 終了時には [Dispatcher.Shutdown] を呼び出し、送信中の Delivery の結果を記録する必要がある。
+func NewDispatcher(store Store, cfg Config) *Dispatcher {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 8
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 10 * time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Hour
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.Client == nil {
+		cfg.Client = newClient(cfg.AllowPrivateNetworks)
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+
+	d := &Dispatcher{
+		store: store,
+		cfg:   cfg,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go d.loop()
+	return d
+}
+
+// Shutdown は、新たな送信を停止し、送信中の Delivery の結果を記録するまで待つ。
+//
+// 取得済みで未送信の Delivery は、 [Store.Claim] の lease の後に再送される。
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.stopOnce.Do(func() {
+		close(d.stop)
+	})
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) loop() {
+	defer close(d.done)
+
+	jobs := make(chan Delivery)
+	var wg sync.WaitGroup
+	for i := 0; i < d.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dl := range jobs {
+				d.deliver(dl)
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(jobs)
+
+	// NOTE: 取得した Delivery は空いたワーカーを待って送信するため、その待ち時間を含めて lease とする。
+	lease := 3 * d.cfg.Timeout
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		ds, err := d.store.Claim(context.Background(), d.cfg.Workers, lease)
+		if err != nil {
+			d.cfg.Logger.Error("could not claim webhook deliveries", slog.Any("err", err))
+		}
+		for _, dl := range ds {
+			select {
+			case jobs <- dl:
+			case <-d.stop:
+				return
+			}
+		}
+		// NOTE: 送信予定の Delivery が残っている場合は、間隔を空けずに取得する。
+		if len(ds) == d.cfg.Workers {
+			select {
+			case <-d.stop:
+				return
+			default:
+				continue
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// deliver は、 dl を送信して結果を記録する。
+func (d *Dispatcher) deliver(dl Delivery) {
+	a := d.send(dl)
+	attempts := dl.Attempts + 1
+	if !a.Succeeded() {
+		if attempts < d.cfg.MaxAttempts && !a.permanent {
+			a.RetryAfter = d.backoff(attempts)
+		}
+		d.cfg.Logger.Warn("could not deliver webhook",
+			slog.Int64("delivery_id", dl.ID),
+			slog.Int("attempts", attempts),
+			slog.Duration("retry_after", a.RetryAfter),
+			slog.String("err", a.Error),
+		)
+	}
+
+	// NOTE: 停止中でも結果を記録できるよう、送信とは独立したタイムアウトを使用する。
+	ctx, cancel := context.WithTimeout(context.Background(), d.cfg.Timeout)
+	defer cancel()
+	if err := d.store.Record(ctx, dl.ID, a); err != nil {
+		d.cfg.Logger.Error("could not record webhook delivery", slog.Int64("delivery_id", dl.ID), slog.Any("err", err))
+	}
+}
+
+// backoff は、 attempts 回目の送信に失敗した後、再送までの時間を返す。
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	return backoff.Exponential(d.cfg.InitialBackoff, d.cfg.MaxBackoff, attempts)
+}
+
+func (d *Dispatcher) send(dl Delivery) Attempt {
+	ctx, cancel := context.WithTimeout(context.Background(), d.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dl.URL, bytes.NewReader(dl.Payload))
+	if err != nil {
+		return Attempt{Error: err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-stations-webhook")
+	req.Header.Set(EventHeader, dl.EventType)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(dl.ID, 10))
+	req.Header.Set(SignatureHeader, Sign(dl.Secret, time.Now(), dl.Payload))
+
+	res, err := d.cfg.Client.Do(req)
+	if err != nil {
+		return Attempt{Error: err.Error(), permanent: errors.Is(err, ErrForbiddenAddress)}
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, maxResponseBytes))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return Attempt{StatusCode: res.StatusCode, Error: fmt.Sprintf("unexpected status: %s", res.Status)}
+	}
+	return Attempt{StatusCode: res.StatusCode}
+}
@@ -0,0 +1,300 @@
+package webhook_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/pkg/webhook"
+)
+
+func TestSignVerify(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"type":"created"}`)
+	sig := webhook.Sign("secret", now, body)
+
+	cases := map[string]struct {
+		secret  string
+		header  string
+		body    []byte
+		now     time.Time
+		wantErr bool
+	}{
+		"Valid":            {secret: "secret", header: sig, body: body, now: now},
+		"Within tolerance": {secret: "secret", header: sig, body: body, now: now.Add(4 * time.Minute)},
+		"Rotated secret":   {secret: "secret", header: sig + ",v1=00", body: body, now: now},
+		"Wrong secret":     {secret: "other", header: sig, body: body, now: now, wantErr: true},
+		"Tampered body":    {secret: "secret", header: sig, body: []byte(`{}`), now: now, wantErr: true},
+		"Too old":          {secret: "secret", header: sig, body: body, now: now.Add(time.Hour), wantErr: true},
+		"Malformed":        {secret: "secret", header: "v1=abc", body: body, now: now, wantErr: true},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := webhook.Verify(c.secret, c.header, c.body, 5*time.Minute, c.now)
+			if (err != nil) != c.wantErr {
+				t.Errorf("期待していない検証の結果です, err = %v, wantErr = %v", err, c.wantErr)
+			}
+		})
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		// statuses は、受信側が順に返すstatusである。
+		statuses     []int
+		wantAttempts []webhook.Attempt
+	}{
+		"Success": {
+			statuses:     []int{http.StatusNoContent},
+			wantAttempts: []webhook.Attempt{{StatusCode: http.StatusNoContent}},
+		},
+		"Retry": {
+			statuses: []int{http.StatusServiceUnavailable, http.StatusOK},
+			wantAttempts: []webhook.Attempt{
+				{StatusCode: http.StatusServiceUnavailable, Error: "unexpected status: 503 Service Unavailable", RetryAfter: -1},
+				{StatusCode: http.StatusOK},
+			},
+		},
+		"Give up": {
+			statuses: []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError},
+			wantAttempts: []webhook.Attempt{
+				{StatusCode: http.StatusInternalServerError, Error: "unexpected status: 500 Internal Server Error", RetryAfter: -1},
+				{StatusCode: http.StatusInternalServerError, Error: "unexpected status: 500 Internal Server Error", RetryAfter: -1},
+				{StatusCode: http.StatusInternalServerError, Error: "unexpected status: 500 Internal Server Error"},
+			},
+		},
+		"Redirect": {
+			statuses: []int{http.StatusFound},
+			wantAttempts: []webhook.Attempt{
+				{StatusCode: http.StatusFound, Error: "unexpected status: 302 Found", RetryAfter: -1},
+			},
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			payload := []byte(`{"type":"created"}`)
+			var mu sync.Mutex
+			var received int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if err := webhook.Verify("secret", r.Header.Get(webhook.SignatureHeader), body, time.Minute, time.Now()); err != nil {
+					t.Errorf("署名を検証できません: %v", err)
+				}
+				if got := r.Header.Get(webhook.DeliveryHeader); got != "1" {
+					t.Errorf("期待していない送信のIDです, got = %s", got)
+				}
+				if got := r.Header.Get(webhook.EventHeader); got != "created" {
+					t.Errorf("期待していないイベントの種類です, got = %s", got)
+				}
+				if string(body) != string(payload) {
+					t.Errorf("期待していないボディです, got = %s", body)
+				}
+
+				mu.Lock()
+				status := c.statuses[min(received, len(c.statuses)-1)]
+				received++
+				mu.Unlock()
+				if status == http.StatusFound {
+					w.Header().Set("Location", "/elsewhere")
+				}
+				w.WriteHeader(status)
+			}))
+			defer srv.Close()
+
+			store := newMemoryStore(webhook.Delivery{ID: 1, URL: srv.URL, Secret: "secret", EventType: "created", Payload: payload})
+			d := webhook.NewDispatcher(store, webhook.Config{
+				Workers:        2,
+				MaxAttempts:    3,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     time.Millisecond,
+				PollInterval:   time.Millisecond,
+				// NOTE: httptest.Server はループバックアドレスで待ち受ける。
+				AllowPrivateNetworks: true,
+			})
+			got := store.wait(t, len(c.wantAttempts))
+			if err := d.Shutdown(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != len(c.wantAttempts) {
+				t.Fatalf("期待していない送信の回数です, got = %d, want = %d", len(got), len(c.wantAttempts))
+			}
+			for i, want := range c.wantAttempts {
+				// NOTE: 再送までの時間はランダムなため、再送するかのみを比較する。
+				if want.RetryAfter < 0 && got[i].RetryAfter > 0 {
+					got[i].RetryAfter = want.RetryAfter
+				}
+				if got[i] != want {
+					t.Errorf("%d回目の結果が期待と異なります, got = %+v, want = %+v", i+1, got[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcherShutdown(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+
+	store := newMemoryStore(webhook.Delivery{ID: 1, URL: srv.URL, Secret: "secret"})
+	d := webhook.NewDispatcher(store, webhook.Config{PollInterval: time.Millisecond, AllowPrivateNetworks: true})
+	for store.claimed() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := d.Shutdown(ctx); err == nil {
+		t.Error("送信中の Delivery を待たずに終了しました")
+	}
+
+	close(release)
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.wait(t, 1); !got[0].Succeeded() {
+		t.Errorf("送信中の Delivery の結果が記録されていません, got = %+v", got)
+	}
+}
+
+func TestDispatcherForbiddenAddress(t *testing.T) {
+	t.Parallel()
+
+	var received atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	// NOTE: 並行して実行するサブテストの完了後に確認する。
+	t.Cleanup(func() {
+		srv.Close()
+		if n := received.Load(); n != 0 {
+			t.Errorf("拒否した送信先にリクエストが届いています, got = %d", n)
+		}
+	})
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"Loopback":            srv.URL,
+		"Loopback Hostname":   "http://localhost:" + port,
+		"IPv6 Loopback":       "http://[::1]:" + port,
+		"IPv4-mapped IPv6":    "http://[::ffff:127.0.0.1]:" + port,
+		"Link-local Metadata": "http://169.254.169.254/latest/meta-data/",
+		"Private":             "http://10.0.0.1/",
+		"Unspecified":         "http://0.0.0.0:" + port,
+	}
+
+	for name, u := range cases {
+		u := u
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			store := newMemoryStore(webhook.Delivery{ID: 1, URL: u, Secret: "secret"})
+			d := webhook.NewDispatcher(store, webhook.Config{
+				MaxAttempts:    3,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     time.Millisecond,
+				PollInterval:   time.Millisecond,
+			})
+			got := store.wait(t, 1)
+			if err := d.Shutdown(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.Contains(got[0].Error, webhook.ErrForbiddenAddress.Error()) {
+				t.Errorf("送信先が拒否されていません, got = %+v", got[0])
+			}
+			// NOTE: 再送しても成功しないため、再送しない。
+			if got[0].RetryAfter != 0 {
+				t.Errorf("再送が予定されています, got = %s", got[0].RetryAfter)
+			}
+		})
+	}
+}
+
+// memoryStore は、1件の Delivery を保持する [webhook.Store] である。
+type memoryStore struct {
+	mu       sync.Mutex
+	d        webhook.Delivery
+	pending  bool
+	due      time.Time
+	claims   int
+	attempts []webhook.Attempt
+	recorded chan struct{}
+}
+
+func newMemoryStore(d webhook.Delivery) *memoryStore {
+	return &memoryStore{d: d, pending: true, recorded: make(chan struct{}, 16)}
+}
+
+func (s *memoryStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]webhook.Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.pending || time.Now().Before(s.due) {
+		return nil, nil
+	}
+	s.due = time.Now().Add(lease)
+	s.claims++
+	return []webhook.Delivery{s.d}, nil
+}
+
+func (s *memoryStore) Record(ctx context.Context, id int64, a webhook.Attempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attempts = append(s.attempts, a)
+	s.d.Attempts++
+	s.pending = !a.Succeeded() && a.RetryAfter > 0
+	s.due = time.Now().Add(a.RetryAfter)
+	s.recorded <- struct{}{}
+	return nil
+}
+
+func (s *memoryStore) claimed() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.claims
+}
+
+// wait は、 n 件の結果が記録されるまで待ち、記録された結果を返す。
+func (s *memoryStore) wait(t *testing.T, n int) []webhook.Attempt {
+	t.Helper()
+
+	for i := 0; i < n; i++ {
+		select {
+		case <-s.recorded:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("結果が記録されません, recorded = %d, want = %d", i, n)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]webhook.Attempt(nil), s.attempts...)
+}
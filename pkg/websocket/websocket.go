@@ -0,0 +1,457 @@
+// Package websocket は、RFC 6455 に準拠したWebSocketのサーバ側の実装を提供する。
+//
+// 拡張(e.g. permessage-deflate)及びサブプロトコルには対応しない。
+//
+// Ref: https://www.rfc-editor.org/rfc/rfc6455
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/TechBowl-japan/go-stations/pkg/httperror"
+)
+
+// MessageType は、データフレームの種類である。
+type MessageType int
+
+const (
+	TextMessage   MessageType = 1
+	BinaryMessage MessageType = 2
+)
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// クローズフレームのステータスコードである。
+//
+// Ref: https://www.rfc-editor.org/rfc/rfc6455#section-7.4.1
+const (
+	CloseNormalClosure    = 1000
+	CloseGoingAway        = 1001
+	CloseProtocolError    = 1002
+	CloseUnsupportedData  = 1003
+	CloseNoStatusReceived = 1005
+	CloseInvalidPayload   = 1007
+	ClosePolicyViolation  = 1008
+	CloseMessageTooBig    = 1009
+	CloseInternalError    = 1011
+	CloseTryAgainLater    = 1013
+)
+
+// DefaultMaxMessageSize は、 [Config.MaxMessageSize] のデフォルト値である。
+const DefaultMaxMessageSize = 64 << 10
+
+// acceptGUID は、Sec-WebSocket-Accept の計算に使用する固定値である。
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// closeTimeout は、クローズフレームの送信の期限である。応答しないクライアントとの終了処理を打ち切る。
+const closeTimeout = 5 * time.Second
+
+// maxControlPayload は、コントロールフレームのペイロードの最大長である。
+const maxControlPayload = 125
+
+// ErrClosed は、クローズフレームの送信後に書き込もうとした事を表す。
+var ErrClosed = errors.New("websocket: connection closed")
+
+// CloseError は、クローズフレームによって接続が終了した事を表す。
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: close %d %s", e.Code, e.Reason)
+}
+
+// Config は、 [Upgrade] に与える設定を表す。
+type Config struct {
+	// MaxMessageSize は、受信するメッセージの最大サイズ(バイト)である。0の場合は [DefaultMaxMessageSize] とする。
+	MaxMessageSize int64
+	// CheckOrigin は、Originヘッダを検証する。nil の場合は、Originヘッダが無いか、Hostと一致する場合のみ許可する。
+	CheckOrigin func(r *http.Request) bool
+}
+
+// Upgrade は、 r のハンドシェイクを検証し、コネクションをWebSocketに切り替える。
+//
+// 検証に失敗した場合は、エラーレスポンスを書き込んでエラーを返す。
+// 切り替え前に w に設定したヘッダ(e.g. X-Request-ID)は、status 101のレスポンスにも含める。
+func Upgrade(w http.ResponseWriter, r *http.Request, cfg Config) (*Conn, error) {
+	if cfg.MaxMessageSize <= 0 {
+		cfg.MaxMessageSize = DefaultMaxMessageSize
+	}
+	if cfg.CheckOrigin == nil {
+		cfg.CheckOrigin = SameOrigin
+	}
+
+	fail := func(status int, reason string) (*Conn, error) {
+		httperror.Write(w, r, status)
+		return nil, fmt.Errorf("websocket: handshake failed: %s", reason)
+	}
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		return fail(http.StatusMethodNotAllowed, "method is not GET")
+	}
+	if !hasToken(r.Header, "Connection", "upgrade") || !hasToken(r.Header, "Upgrade", "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		return fail(http.StatusUpgradeRequired, "not a websocket upgrade request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return fail(http.StatusUpgradeRequired, "unsupported version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		return fail(http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	}
+	if !cfg.CheckOrigin(r) {
+		return fail(http.StatusForbidden, "origin is not allowed")
+	}
+
+	hdr := w.Header().Clone()
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		// NOTE: HTTP/2 等、コネクションを乗っ取れない場合は切り替えられない。
+		return fail(http.StatusInternalServerError, err.Error())
+	}
+	// NOTE: [net/http.Server] の ReadTimeout 及び WriteTimeout による期限を解除し、利用側で管理する。
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	hdr.Del("Content-Type")
+	hdr.Del("Content-Length")
+	hdr.Set("Upgrade", "websocket")
+	hdr.Set("Connection", "Upgrade")
+	hdr.Set("Sec-WebSocket-Accept", acceptKey(key))
+	bw := bufio.NewWriter(conn)
+	_, _ = io.WriteString(bw, "HTTP/1.1 101 Switching Protocols\r\n")
+	_ = hdr.Write(bw)
+	_, _ = io.WriteString(bw, "\r\n")
+	if err := bw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &Conn{
+		conn:           conn,
+		br:             brw.Reader,
+		bw:             bw,
+		maxMessageSize: cfg.MaxMessageSize,
+	}, nil
+}
+
+// SameOrigin は、Originヘッダが無い(e.g. ブラウザ以外のクライアント)か、Originのホストが r.Host と一致する場合に true を返す。
+func SameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// hasToken は、カンマ区切りのヘッダ name に token が含まれるかを返す。
+func hasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Conn は、WebSocketのコネクションである。
+//
+// [Conn.ReadMessage] は1つのgoroutineから呼び出す必要がある。書き込みは複数のgoroutineから呼び出せる。
+type Conn struct {
+	conn           net.Conn
+	br             *bufio.Reader
+	maxMessageSize int64
+	pongHandler    func()
+
+	wmu       sync.Mutex
+	bw        *bufio.Writer
+	closeSent bool
+}
+
+// SetPongHandler は、pongを受信した際に呼び出す関数を設定する。 [Conn.ReadMessage] の中で呼び出される。
+func (c *Conn) SetPongHandler(fn func()) {
+	c.pongHandler = fn
+}
+
+// SetReadDeadline は、読み込みの期限を設定する。
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline は、書き込みの期限を設定する。
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// ReadMessage は、次のメッセージを読み込む。
+//
+// 分割されたメッセージは結合して返す。pingには自動でpongを返す。
+// クローズフレームを受信した場合は、クローズフレームを返して [*CloseError] を返す。
+// プロトコル違反または MaxMessageSize を超えた場合は、クローズフレームを送信して [*CloseError] を返す。
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	var typ MessageType
+	var msg []byte
+	for {
+		h, err := c.readHeader()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if h.op >= opClose {
+			if !h.fin || h.length > maxControlPayload {
+				return 0, nil, c.fail(CloseProtocolError, "invalid control frame")
+			}
+			payload, err := c.readPayload(h)
+			if err != nil {
+				return 0, nil, err
+			}
+			switch h.op {
+			case opPing:
+				if err := c.writeFrame(opPong, payload); err != nil && !errors.Is(err, ErrClosed) {
+					return 0, nil, err
+				}
+			case opPong:
+				if c.pongHandler != nil {
+					c.pongHandler()
+				}
+			case opClose:
+				return 0, nil, c.receiveClose(payload)
+			default:
+				return 0, nil, c.fail(CloseProtocolError, "unknown opcode")
+			}
+			continue
+		}
+
+		switch h.op {
+		case opText, opBinary:
+			if typ != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "expected continuation frame")
+			}
+			typ = MessageType(h.op)
+		case opContinuation:
+			if typ == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+		default:
+			return 0, nil, c.fail(CloseProtocolError, "unknown opcode")
+		}
+		if h.length > uint64(c.maxMessageSize-int64(len(msg))) {
+			return 0, nil, c.fail(CloseMessageTooBig, "message too big")
+		}
+		payload, err := c.readPayload(h)
+		if err != nil {
+			return 0, nil, err
+		}
+		msg = append(msg, payload...)
+		if !h.fin {
+			continue
+		}
+		if typ == TextMessage && !utf8.Valid(msg) {
+			return 0, nil, c.fail(CloseInvalidPayload, "invalid UTF-8")
+		}
+		return typ, msg, nil
+	}
+}
+
+type frameHeader struct {
+	fin    bool
+	op     byte
+	length uint64
+	mask   [4]byte
+}
+
+func (c *Conn) readHeader() (frameHeader, error) {
+	var b [2]byte
+	if _, err := io.ReadFull(c.br, b[:]); err != nil {
+		return frameHeader{}, err
+	}
+	h := frameHeader{
+		fin: b[0]&0x80 != 0,
+		op:  b[0] & 0x0f,
+	}
+	if b[0]&0x70 != 0 {
+		return h, c.fail(CloseProtocolError, "reserved bits are set")
+	}
+	// NOTE: クライアントからのフレームはマスクする必要がある。
+	if b[1]&0x80 == 0 {
+		return h, c.fail(CloseProtocolError, "frame is not masked")
+	}
+	switch n := b[1] & 0x7f; n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return h, err
+		}
+		h.length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return h, err
+		}
+		h.length = binary.BigEndian.Uint64(ext[:])
+		if h.length>>63 != 0 {
+			return h, c.fail(CloseProtocolError, "invalid payload length")
+		}
+	default:
+		h.length = uint64(n)
+	}
+	if _, err := io.ReadFull(c.br, h.mask[:]); err != nil {
+		return h, err
+	}
+	return h, nil
+}
+
+// readPayload は、ペイロードを読み込んでマスクを解除する。長さは呼び出し側で制限する必要がある。
+func (c *Conn) readPayload(h frameHeader) ([]byte, error) {
+	payload := make([]byte, h.length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return nil, err
+	}
+	for i := range payload {
+		payload[i] ^= h.mask[i%4]
+	}
+	return payload, nil
+}
+
+// receiveClose は、受信したクローズフレームに応答し、その内容を返す。
+func (c *Conn) receiveClose(payload []byte) error {
+	received := &CloseError{Code: CloseNoStatusReceived}
+	switch {
+	case len(payload) == 1:
+		return c.fail(CloseProtocolError, "invalid close frame")
+	case len(payload) >= 2:
+		received.Code = int(binary.BigEndian.Uint16(payload))
+		received.Reason = string(payload[2:])
+		if !validCloseCode(received.Code) || !utf8.ValidString(received.Reason) {
+			return c.fail(CloseProtocolError, "invalid close frame")
+		}
+	}
+	// NOTE: 受信したステータスコードをそのまま返す事で、クローズのハンドシェイクを完了する。
+	var reply []byte
+	if received.Code != CloseNoStatusReceived {
+		reply = payload[:2]
+	}
+	if err := c.writeFrame(opClose, reply); err != nil && !errors.Is(err, ErrClosed) {
+		return err
+	}
+	return received
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 3000 && code <= 4999:
+		return true
+	case code >= 1000 && code <= 1011:
+		return code != 1004 && code != CloseNoStatusReceived && code != 1006
+	}
+	return false
+}
+
+// fail は、 code のクローズフレームを送信し、それを表すエラーを返す。
+func (c *Conn) fail(code int, reason string) error {
+	_ = c.WriteClose(code, reason)
+	return &CloseError{Code: code, Reason: reason}
+}
+
+// WriteMessage は、 data を1つのフレームで送信する。
+func (c *Conn) WriteMessage(typ MessageType, data []byte) error {
+	if typ != TextMessage && typ != BinaryMessage {
+		return fmt.Errorf("websocket: unknown message type: %d", typ)
+	}
+	return c.writeFrame(byte(typ), data)
+}
+
+// WritePing は、pingを送信する。
+func (c *Conn) WritePing(data []byte) error {
+	if len(data) > maxControlPayload {
+		return fmt.Errorf("websocket: control frame too long: %d", len(data))
+	}
+	return c.writeFrame(opPing, data)
+}
+
+// WriteClose は、 code 及び reason のクローズフレームを送信する。以降は書き込めない。
+func (c *Conn) WriteClose(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+	if len(payload) > maxControlPayload {
+		payload = payload[:maxControlPayload]
+	}
+	return c.writeFrame(opClose, payload)
+}
+
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if c.closeSent {
+		return ErrClosed
+	}
+	if op == opClose {
+		c.closeSent = true
+		_ = c.conn.SetWriteDeadline(time.Now().Add(closeTimeout))
+	}
+
+	// NOTE: サーバからのフレームはマスクしない。
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | op
+	switch n := len(payload); {
+	case n <= 125:
+		header[1] = byte(n)
+	case n <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	if _, err := c.bw.Write(header); err != nil {
+		return err
+	}
+	if _, err := c.bw.Write(payload); err != nil {
+		return err
+	}
+	return c.bw.Flush()
+}
+
+// Close は、コネクションを閉じる。クローズフレームは送信しないため、必要に応じて先に [Conn.WriteClose] を呼び出す。
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
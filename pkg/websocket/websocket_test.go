@@ -0,0 +1,362 @@
+package websocket_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/pkg/websocket"
+)
+
+const testKey = "dGhlIHNhbXBsZSBub25jZQ=="
+
+func TestUpgrade(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(echoHandler(websocket.Config{}))
+	defer srv.Close()
+
+	c, res := dial(t, srv, nil)
+	defer c.conn.Close()
+
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("期待していないstatusです, got = %d", res.StatusCode)
+	}
+	// NOTE: RFC 6455 の例の値である。
+	if got, want := res.Header.Get("Sec-WebSocket-Accept"), "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="; got != want {
+		t.Errorf("期待していない Sec-WebSocket-Accept です, got = %s, want = %s", got, want)
+	}
+	if got := res.Header.Get("X-Test"); got != "kept" {
+		t.Errorf("切り替え前に設定したヘッダが含まれていません, got = %q", got)
+	}
+
+	c.write(t, 0x81, []byte("hello"))
+	if op, payload := c.read(t); op != 0x1 || string(payload) != "hello" {
+		t.Errorf("期待していないメッセージです, op = %#x, payload = %q", op, payload)
+	}
+
+	c.write(t, 0x89, []byte("ping"))
+	if op, payload := c.read(t); op != 0xa || string(payload) != "ping" {
+		t.Errorf("pingに対するpongではありません, op = %#x, payload = %q", op, payload)
+	}
+
+	// NOTE: 分割されたメッセージの間にコントロールフレームを挟める。
+	c.write(t, 0x01, []byte("hel"))
+	c.write(t, 0x89, nil)
+	c.write(t, 0x80, []byte("lo"))
+	if op, _ := c.read(t); op != 0xa {
+		t.Errorf("pingに対するpongではありません, op = %#x", op)
+	}
+	if op, payload := c.read(t); op != 0x1 || string(payload) != "hello" {
+		t.Errorf("分割されたメッセージが結合されていません, op = %#x, payload = %q", op, payload)
+	}
+
+	c.write(t, 0x88, closePayload(websocket.CloseNormalClosure, "bye"))
+	if op, payload := c.read(t); op != 0x8 || closeCode(payload) != websocket.CloseNormalClosure {
+		t.Errorf("クローズフレームが返されていません, op = %#x, payload = %q", op, payload)
+	}
+}
+
+func TestReadMessageClose(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		frames   func(c *client, t *testing.T)
+		wantCode int
+	}{
+		"Too big": {
+			frames: func(c *client, t *testing.T) {
+				c.write(t, 0x81, make([]byte, 9))
+			},
+			wantCode: websocket.CloseMessageTooBig,
+		},
+		"Too big after fragments": {
+			frames: func(c *client, t *testing.T) {
+				c.write(t, 0x01, make([]byte, 5))
+				c.write(t, 0x80, make([]byte, 5))
+			},
+			wantCode: websocket.CloseMessageTooBig,
+		},
+		"Not masked": {
+			frames: func(c *client, t *testing.T) {
+				c.writeRaw(t, []byte{0x81, 0x01, 'a'})
+			},
+			wantCode: websocket.CloseProtocolError,
+		},
+		"Reserved bits": {
+			frames: func(c *client, t *testing.T) {
+				c.write(t, 0xc1, []byte("a"))
+			},
+			wantCode: websocket.CloseProtocolError,
+		},
+		"Unexpected continuation": {
+			frames: func(c *client, t *testing.T) {
+				c.write(t, 0x80, []byte("a"))
+			},
+			wantCode: websocket.CloseProtocolError,
+		},
+		"Fragmented ping": {
+			frames: func(c *client, t *testing.T) {
+				c.write(t, 0x09, nil)
+			},
+			wantCode: websocket.CloseProtocolError,
+		},
+		"Invalid UTF-8": {
+			frames: func(c *client, t *testing.T) {
+				c.write(t, 0x81, []byte{0xff})
+			},
+			wantCode: websocket.CloseInvalidPayload,
+		},
+		"Invalid close code": {
+			frames: func(c *client, t *testing.T) {
+				c.write(t, 0x88, closePayload(1005, ""))
+			},
+			wantCode: websocket.CloseProtocolError,
+		},
+	}
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			errc := make(chan error, 1)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				conn, err := websocket.Upgrade(w, r, websocket.Config{MaxMessageSize: 8})
+				if err != nil {
+					errc <- err
+					return
+				}
+				defer conn.Close()
+				_, _, err = conn.ReadMessage()
+				errc <- err
+			}))
+			defer srv.Close()
+
+			cl, _ := dial(t, srv, nil)
+			defer cl.conn.Close()
+			c.frames(cl, t)
+
+			op, payload := cl.read(t)
+			if op != 0x8 || closeCode(payload) != c.wantCode {
+				t.Errorf("期待していないクローズフレームです, op = %#x, code = %d, want = %d", op, closeCode(payload), c.wantCode)
+			}
+			var ce *websocket.CloseError
+			if err := <-errc; !errors.As(err, &ce) || ce.Code != c.wantCode {
+				t.Errorf("期待していないエラーです, got = %v", err)
+			}
+		})
+	}
+}
+
+func TestUpgradeError(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]struct {
+		method     string
+		header     map[string]string
+		wantStatus int
+	}{
+		"Not GET": {
+			method:     http.MethodPost,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		"No Upgrade": {
+			header:     map[string]string{"Upgrade": ""},
+			wantStatus: http.StatusUpgradeRequired,
+		},
+		"Unsupported version": {
+			header:     map[string]string{"Sec-WebSocket-Version": "8"},
+			wantStatus: http.StatusUpgradeRequired,
+		},
+		"Invalid key": {
+			header:     map[string]string{"Sec-WebSocket-Key": "short"},
+			wantStatus: http.StatusBadRequest,
+		},
+		"Cross origin": {
+			header:     map[string]string{"Origin": "https://evil.example.com"},
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	srv := httptest.NewServer(echoHandler(websocket.Config{}))
+	t.Cleanup(srv.Close)
+
+	for name, c := range cases {
+		c := c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			method := c.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req, err := http.NewRequest(method, srv.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setHandshake(req.Header)
+			for k, v := range c.header {
+				req.Header.Set(k, v)
+			}
+			res, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			if res.StatusCode != c.wantStatus {
+				t.Errorf("期待していないstatusです, got = %d, want = %d", res.StatusCode, c.wantStatus)
+			}
+		})
+	}
+}
+
+func TestUpgradeCheckOrigin(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(echoHandler(websocket.Config{
+		CheckOrigin: func(r *http.Request) bool {
+			return r.Header.Get("Origin") == "https://app.example.com"
+		},
+	}))
+	defer srv.Close()
+
+	c, res := dial(t, srv, map[string]string{"Origin": "https://app.example.com"})
+	defer c.conn.Close()
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("許可したOriginが拒否されました, got = %d", res.StatusCode)
+	}
+}
+
+// echoHandler は、受信したメッセージをそのまま返すハンドラである。
+func echoHandler(cfg websocket.Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "kept")
+		conn, err := websocket.Upgrade(w, r, cfg)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			typ, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(typ, msg); err != nil {
+				return
+			}
+		}
+	})
+}
+
+// client は、テスト用のWebSocketクライアントである。
+type client struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dial(t *testing.T, srv *httptest.Server, header map[string]string) (*client, *http.Response) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setHandshake(req.Header)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &client{conn: conn, br: br}, res
+}
+
+func setHandshake(h http.Header) {
+	h.Set("Connection", "Upgrade")
+	h.Set("Upgrade", "websocket")
+	h.Set("Sec-WebSocket-Version", "13")
+	h.Set("Sec-WebSocket-Key", testKey)
+}
+
+// write は、マスクしたフレームを送信する。 b0 はFIN、RSV及びopcodeを含む先頭のバイトである。
+func (c *client) write(t *testing.T, b0 byte, payload []byte) {
+	t.Helper()
+
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{b0, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	c.writeRaw(t, frame)
+}
+
+func (c *client) writeRaw(t *testing.T, frame []byte) {
+	t.Helper()
+
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// read は、サーバからのフレームを受信し、opcodeとペイロードを返す。
+func (c *client) read(t *testing.T) (byte, []byte) {
+	t.Helper()
+
+	var b [2]byte
+	if _, err := io.ReadFull(c.br, b[:]); err != nil {
+		t.Fatal(err)
+	}
+	if b[1]&0x80 != 0 {
+		t.Fatal("サーバからのフレームがマスクされています")
+	}
+	n := uint64(b[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			t.Fatal(err)
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			t.Fatal(err)
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		t.Fatal(err)
+	}
+	return b[0] & 0x0f, payload
+}
+
+func closePayload(code int, reason string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...)
+}
+
+func closeCode(payload []byte) int {
+	if len(payload) < 2 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(payload))
+}
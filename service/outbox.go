@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/pkg/outbox"
+	"github.com/TechBowl-japan/go-stations/pkg/pubsub"
+)
+
+// An OutboxService reads the events recorded by TODOService in the outbox table and tracks the offset of each sink.
+//
+// It implements outbox.Store.
+type OutboxService struct {
+	db *sql.DB
+}
+
+// NewOutboxService returns new OutboxService.
+func NewOutboxService(db *sql.DB) *OutboxService {
+	return &OutboxService{db: db}
+}
+
+// Read implements outbox.Store.
+func (s *OutboxService) Read(ctx context.Context, sink string, limit int) ([]outbox.Event, error) {
+	const read = `SELECT id, event_type, payload, source, created_at FROM outbox
+		WHERE id > COALESCE((SELECT last_id FROM outbox_offsets WHERE sink = ?), 0) ORDER BY id LIMIT ?`
+
+	rows, err := s.db.QueryContext(ctx, read, sink, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []outbox.Event
+	for rows.Next() {
+		var e outbox.Event
+		var payload string
+		if err := rows.Scan(&e.ID, &e.Type, &payload, &e.Source, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Payload = []byte(payload)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// Commit implements outbox.Store.
+func (s *OutboxService) Commit(ctx context.Context, sink string, id int64) error {
+	const upsert = `INSERT INTO outbox_offsets(sink, last_id) VALUES(?, ?)
+		ON CONFLICT(sink) DO UPDATE SET last_id = MAX(last_id, excluded.last_id), updated_at = DATETIME('now')`
+
+	_, err := s.db.ExecContext(ctx, upsert, sink, id)
+	return err
+}
+
+// Purge implements outbox.Store.
+func (s *OutboxService) Purge(ctx context.Context, sinks []string, retention time.Duration) (int64, error) {
+	const purgeFmt = `DELETE FROM outbox WHERE created_at < DATETIME('now', ?) AND
+		id <= (SELECT CASE WHEN COUNT(*) = ? THEN MIN(last_id) ELSE 0 END FROM outbox_offsets WHERE sink IN (?%s))`
+
+	if len(sinks) == 0 {
+		return 0, nil
+	}
+
+	stmt := fmt.Sprintf(purgeFmt, strings.Repeat(",?", len(sinks)-1))
+
+	args := []interface{}{fmt.Sprintf("-%d seconds", int64(retention/time.Second)), len(sinks)}
+	for _, v := range sinks {
+		args = append(args, v)
+	}
+	res, err := s.db.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// A BrokerSink publishes the TODOEvents in the outbox to the subscribers in the process, e.g. of /api/todos/events.
+//
+// It implements outbox.Sink.
+type BrokerSink struct {
+	broker *pubsub.Broker
+	logger *slog.Logger
+}
+
+// NewBrokerSink returns BrokerSink which publishes to broker and writes logs to logger.
+func NewBrokerSink(broker *pubsub.Broker, logger *slog.Logger) *BrokerSink {
+	return &BrokerSink{
+		broker: broker,
+		logger: logger,
+	}
+}
+
+// Name implements outbox.Sink.
+func (s *BrokerSink) Name() string {
+	return "pubsub"
+}
+
+// Send implements outbox.Sink. Events which cannot be decoded are skipped, since retrying them never succeeds.
+func (s *BrokerSink) Send(ctx context.Context, events []outbox.Event) error {
+	for _, oe := range events {
+		var e model.TODOEvent
+		if err := json.Unmarshal(oe.Payload, &e); err != nil {
+			s.logger.ErrorContext(ctx, "could not decode outbox event", slog.Int64("event_id", oe.ID), slog.Any("err", err))
+			continue
+		}
+		s.broker.Publish(pubsub.Event{Type: e.Type, User: e.User, Source: oe.Source, Data: e})
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package service_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/db"
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/service"
+	"github.com/google/go-cmp/cmp"
+)
+
+// recordingPublisher は、受け取った変更を記録する [service.Publisher] である。
+type recordingPublisher struct {
+	mu     sync.Mutex
+	events []model.TODOEvent
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, e model.TODOEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = append(p.events, e)
+}
+
+func (p *recordingPublisher) len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.events)
+}
+
+func newOutboxDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	todoDB, err := db.NewDB(filepath.Join(t.TempDir(), "outbox_test.db"))
+	if err != nil {
+		t.Fatal("DBの作成に失敗しました:", err)
+	}
+	t.Cleanup(func() {
+		todoDB.Close()
+	})
+	return todoDB
+}
+
+// outboxEvent は、比較のために outbox のイベントを要約したものである。
+type outboxEvent struct {
+	Type string
+	IDs  []int64
+}
+
+// readAll は、 sink の未送信のイベントを limit 件ずつ読み込み、読み込む度に Commit する。
+func readAll(t *testing.T, s *service.OutboxService, sink string, limit int) []outboxEvent {
+	t.Helper()
+
+	ctx := context.Background()
+	var got []outboxEvent
+	var lastID int64
+	for {
+		events, err := s.Read(ctx, sink, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(events) == 0 {
+			return got
+		}
+		for _, oe := range events {
+			if oe.ID <= lastID {
+				t.Fatalf("イベントが id の順に読み込まれていません, got = %d, last = %d", oe.ID, lastID)
+			}
+			lastID = oe.ID
+
+			var e model.TODOEvent
+			if err := json.Unmarshal(oe.Payload, &e); err != nil {
+				t.Fatal(err)
+			}
+			if e.Type != oe.Type {
+				t.Errorf("イベントの種類が一致しません, got = %s, want = %s", oe.Type, e.Type)
+			}
+			ids := e.IDs
+			if e.TODO != nil {
+				ids = []int64{e.TODO.ID}
+			}
+			got = append(got, outboxEvent{Type: e.Type, IDs: ids})
+		}
+		if err := s.Commit(ctx, sink, lastID); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTODOServiceOutboxAtomicity(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]func(ctx context.Context, s *service.TODOService, id int64) error{
+		"Create": func(ctx context.Context, s *service.TODOService, id int64) error {
+			_, err := s.CreateTODO(ctx, "created", "")
+			return err
+		},
+		"Update": func(ctx context.Context, s *service.TODOService, id int64) error {
+			_, err := s.UpdateTODO(ctx, id, "updated", "")
+			return err
+		},
+		"Delete": func(ctx context.Context, s *service.TODOService, id int64) error {
+			return s.DeleteTODO(ctx, []int64{id})
+		},
+	}
+
+	for name, change := range cases {
+		change := change
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			todoDB := newOutboxDB(t)
+			publisher := &recordingPublisher{}
+			svc := service.NewTODOService(todoDB, service.WithPublisher(publisher))
+			outbox := service.NewOutboxService(todoDB)
+
+			todo, err := svc.CreateTODO(ctx, "subject", "description")
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := readAll(t, outbox, "test", 100)
+
+			// NOTE: outbox への記録を失敗させ、TODOの変更も取り消される事を確認する。
+			const fail = `CREATE TRIGGER fail_outbox BEFORE INSERT ON outbox BEGIN SELECT RAISE(ABORT, 'outbox unavailable'); END`
+			if _, err := todoDB.ExecContext(ctx, fail); err != nil {
+				t.Fatal(err)
+			}
+			if err := change(ctx, svc, todo.ID); err == nil {
+				t.Fatal("outbox への記録に失敗した変更がエラーになりません")
+			}
+
+			todos, err := svc.ReadTODO(ctx, 0, 100)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff([]*model.TODO{todo}, todos); diff != "" {
+				t.Errorf("outbox への記録に失敗した変更が反映されています (-want +got):\n%s", diff)
+			}
+			if n := publisher.len(); n != len(before) {
+				t.Errorf("コミットされていない変更が配信されています, got = %d, want = %d", n, len(before))
+			}
+
+			if _, err := todoDB.ExecContext(ctx, `DROP TRIGGER fail_outbox`); err != nil {
+				t.Fatal(err)
+			}
+			if got := readAll(t, outbox, "test", 100); len(got) != 0 {
+				t.Errorf("コミットされていない変更が outbox に記録されています, got = %+v", got)
+			}
+		})
+	}
+}
+
+func TestOutboxServiceOrdering(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	todoDB := newOutboxDB(t)
+	svc := service.NewTODOService(todoDB)
+	outbox := service.NewOutboxService(todoDB)
+
+	a, err := svc.CreateTODO(ctx, "a", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := svc.CreateTODO(ctx, "b", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.UpdateTODO(ctx, a.ID, "a2", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.UpdateTODO(ctx, b.ID, "b2", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.DeleteTODO(ctx, []int64{a.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.UpdateTODO(ctx, b.ID, "b3", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []outboxEvent{
+		{Type: model.TODOEventCreated, IDs: []int64{a.ID}},
+		{Type: model.TODOEventCreated, IDs: []int64{b.ID}},
+		{Type: model.TODOEventUpdated, IDs: []int64{a.ID}},
+		{Type: model.TODOEventUpdated, IDs: []int64{b.ID}},
+		{Type: model.TODOEventDeleted, IDs: []int64{a.ID}},
+		{Type: model.TODOEventUpdated, IDs: []int64{b.ID}},
+	}
+
+	// NOTE: バッチの大きさに関わらず、各TODOの変更は変更した順に読み込まれる。
+	for _, limit := range []int{1, 2, 4, 100} {
+		sink := fmt.Sprintf("limit-%d", limit)
+		if diff := cmp.Diff(want, readAll(t, outbox, sink, limit)); diff != "" {
+			t.Errorf("limit = %d: イベントの順序が一致しません (-want +got):\n%s", limit, diff)
+		}
+	}
+
+	// NOTE: Commit したイベントは、同じ sink では再度読み込まれない。
+	if got := readAll(t, outbox, "limit-100", 100); len(got) != 0 {
+		t.Errorf("Commit したイベントが再度読み込まれました, got = %+v", got)
+	}
+	// NOTE: 古い id の Commit は、 offset を戻さない。
+	if err := outbox.Commit(ctx, "limit-100", 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, outbox, "limit-100", 100); len(got) != 0 {
+		t.Errorf("offset が戻っています, got = %+v", got)
+	}
+}
+
+func TestOutboxServicePurge(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	todoDB := newOutboxDB(t)
+	svc := service.NewTODOService(todoDB)
+	outbox := service.NewOutboxService(todoDB)
+
+	for _, s := range []string{"1", "2", "3", "4"} {
+		if _, err := svc.CreateTODO(ctx, s, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := outbox.Read(ctx, "fast", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("outbox のイベント数が一致しません, got = %d", len(events))
+	}
+	// NOTE: 保持期間を過ぎたイベントとするため、記録した時刻を戻す。
+	if _, err := todoDB.ExecContext(ctx, `UPDATE outbox SET created_at = DATETIME('now', '-1 hour') WHERE id <= ?`, events[2].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := outbox.Commit(ctx, "fast", events[3].ID); err != nil {
+		t.Fatal(err)
+	}
+	// NOTE: slow は2件目までしか送信していない。
+	if err := outbox.Commit(ctx, "slow", events[1].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// NOTE: 一度も Commit していない sink がある場合は、全てのイベントが未送信である。
+	if n, err := outbox.Purge(ctx, []string{"fast", "slow", "new"}, time.Minute); err != nil || n != 0 {
+		t.Errorf("未送信の sink のイベントが削除されました, got = %d, err = %v", n, err)
+	}
+
+	// NOTE: 最も遅れている slow が送信済みで、保持期間を過ぎたイベントのみを削除する。
+	n, err := outbox.Purge(ctx, []string{"fast", "slow"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("削除したイベント数が一致しません, got = %d, want = 2", n)
+	}
+	slow, err := outbox.Read(ctx, "slow", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slow) != 2 || slow[0].ID != events[2].ID || slow[1].ID != events[3].ID {
+		t.Errorf("slow の未送信のイベントが一致しません, got = %+v", slow)
+	}
+
+	// NOTE: 全ての sink が送信済みでも、保持期間内のイベントは削除しない。
+	if err := outbox.Commit(ctx, "slow", events[3].ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := outbox.Purge(ctx, []string{"fast", "slow"}, time.Minute); err != nil || n != 1 {
+		t.Errorf("保持期間を過ぎた送信済みのイベントのみを削除していません, got = %d, err = %v", n, err)
+	}
+	var remaining int
+	if err := todoDB.QueryRowContext(ctx, `SELECT COUNT(*) FROM outbox`).Scan(&remaining); err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 1 {
+		t.Errorf("保持期間内のイベントが削除されました, remaining = %d", remaining)
+	}
+}
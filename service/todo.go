@@ -3,23 +3,87 @@ package service
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"log/slog"
 	"strings"
 	"time"
 
 	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/pkg/tracing"
 )
 
 // A TODOService implements CRUD of TODO entities.
+//
+// Each change is recorded as a TODOEvent in the outbox table in the same transaction,
+// so the event is relayed by OutboxService if and only if the change is committed.
 type TODOService struct {
-	db *sql.DB
+	db        *sql.DB
+	tracer    *tracing.Tracer
+	logger    *slog.Logger
+	publisher Publisher
+	metadata  func(ctx context.Context) (user, source string)
+	notify    func()
+}
+
+// A Publisher receives the changes of TODOs made by TODOService.
+//
+// Publish is called synchronously after each change is committed, so it must not block.
+// Unlike the outbox, the changes are lost if the process stops before Publish is called.
+type Publisher interface {
+	Publish(ctx context.Context, e model.TODOEvent)
+}
+
+// An Option configures TODOService.
+type Option func(*TODOService)
+
+// WithLogger sets the logger used by TODOService.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *TODOService) {
+		s.logger = logger
+	}
+}
+
+// WithTracer records each SQL statement as a child span of the span in the context.
+// A nil tracer disables tracing.
+func WithTracer(tracer *tracing.Tracer) Option {
+	return func(s *TODOService) {
+		s.tracer = tracer
+	}
+}
+
+// WithPublisher publishes created, updated and deleted TODOs to p.
+func WithPublisher(p Publisher) Option {
+	return func(s *TODOService) {
+		s.publisher = p
+	}
+}
+
+// WithEventMetadata sets fn returning the user and the source (e.g. the connection) of the change
+// in the context, which are recorded with the event in the outbox.
+func WithEventMetadata(fn func(ctx context.Context) (user, source string)) Option {
+	return func(s *TODOService) {
+		s.metadata = fn
+	}
+}
+
+// WithOutboxNotify calls fn after each change is committed, e.g. to relay the event without waiting for polling.
+func WithOutboxNotify(fn func()) Option {
+	return func(s *TODOService) {
+		s.notify = fn
+	}
 }
 
 // NewTODOService returns new TODOService.
-func NewTODOService(db *sql.DB) *TODOService {
-	return &TODOService{
-		db: db,
+func NewTODOService(db *sql.DB, opts ...Option) *TODOService {
+	s := &TODOService{
+		db:     db,
+		logger: slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 // CreateTODO creates a TODO on DB.
@@ -29,34 +93,46 @@ func (s *TODOService) CreateTODO(ctx context.Context, subject, description strin
 		confirm = `SELECT subject, description, created_at, updated_at FROM todos WHERE id = ?`
 	)
 
-	res, err := s.db.ExecContext(ctx, insert, subject, description)
-	if err != nil {
-		return nil, err
-	}
-	id, err := res.LastInsertId()
-	if err != nil {
-		return nil, err
-	}
+	var todo *model.TODO
+	e := model.TODOEvent{Type: model.TODOEventCreated}
+	err := s.inTx(ctx, func(tx tracing.Queryer) error {
+		res, err := tx.ExecContext(ctx, insert, subject, description)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
 
-	var rSubject, rDescription string
-	var rCreatedAt, rUpdatedAt time.Time
-	err = s.db.QueryRowContext(ctx, confirm, id).Scan(
-		&rSubject,
-		&rDescription,
-		&rCreatedAt,
-		&rUpdatedAt,
-	)
+		var rSubject, rDescription string
+		var rCreatedAt, rUpdatedAt time.Time
+		err = tx.QueryRowContext(ctx, confirm, id).Scan(
+			&rSubject,
+			&rDescription,
+			&rCreatedAt,
+			&rUpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		todo = &model.TODO{
+			ID:          id,
+			Subject:     rSubject,
+			Description: rDescription,
+			CreatedAt:   rCreatedAt,
+			UpdatedAt:   rUpdatedAt,
+		}
+		e.TODO = todo
+		return s.recordEvent(ctx, tx, &e)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	todo := &model.TODO{
-		ID:          id,
-		Subject:     rSubject,
-		Description: rDescription,
-		CreatedAt:   rCreatedAt,
-		UpdatedAt:   rUpdatedAt,
-	}
+	s.logger.DebugContext(ctx, "todo created", slog.Int64("id", todo.ID))
+	s.publish(ctx, e)
 	return todo, nil
 }
 
@@ -70,9 +146,9 @@ func (s *TODOService) ReadTODO(ctx context.Context, prevID, size int64) ([]*mode
 	var rows *sql.Rows
 	var err error
 	if prevID == 0 {
-		rows, err = s.db.QueryContext(ctx, read, size)
+		rows, err = s.queryer(s.db).QueryContext(ctx, read, size)
 	} else {
-		rows, err = s.db.QueryContext(ctx, readWithID, prevID, size)
+		rows, err = s.queryer(s.db).QueryContext(ctx, readWithID, prevID, size)
 	}
 	if err != nil {
 		return nil, err
@@ -107,6 +183,43 @@ func (s *TODOService) ReadTODO(ctx context.Context, prevID, size int64) ([]*mode
 	return todos, nil
 }
 
+// ReadTODOsByIDs reads the TODOs of ids on DB. TODOs which do not exist are not returned.
+func (s *TODOService) ReadTODOsByIDs(ctx context.Context, ids []int64) ([]*model.TODO, error) {
+	const readFmt = `SELECT id, subject, description, created_at, updated_at FROM todos WHERE id IN (?%s) ORDER BY id DESC`
+
+	if len(ids) == 0 {
+		return []*model.TODO{}, nil
+	}
+
+	stmt := fmt.Sprintf(readFmt, strings.Repeat(",?", len(ids)-1))
+
+	var args []interface{}
+	for _, v := range ids {
+		args = append(args, v)
+	}
+	rows, err := s.queryer(s.db).QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	todos := make([]*model.TODO, 0, len(ids))
+	for rows.Next() {
+		todo := &model.TODO{}
+		if err := rows.Scan(
+			&todo.ID,
+			&todo.Subject,
+			&todo.Description,
+			&todo.CreatedAt,
+			&todo.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		todos = append(todos, todo)
+	}
+	return todos, rows.Err()
+}
+
 // UpdateTODO updates the TODO on DB.
 func (s *TODOService) UpdateTODO(ctx context.Context, id int64, subject, description string) (*model.TODO, error) {
 	const (
@@ -114,34 +227,46 @@ func (s *TODOService) UpdateTODO(ctx context.Context, id int64, subject, descrip
 		confirm = `SELECT subject, description, created_at, updated_at FROM todos WHERE id = ?`
 	)
 
-	res, err := s.db.ExecContext(ctx, update, subject, description, id)
-	if err != nil {
-		return nil, err
-	}
-	num, _ := res.RowsAffected()
-	if num == 0 {
-		return nil, &model.ErrNotFound{}
-	}
+	var todo *model.TODO
+	e := model.TODOEvent{Type: model.TODOEventUpdated}
+	err := s.inTx(ctx, func(tx tracing.Queryer) error {
+		res, err := tx.ExecContext(ctx, update, subject, description, id)
+		if err != nil {
+			return err
+		}
+		num, _ := res.RowsAffected()
+		if num == 0 {
+			return &model.ErrNotFound{}
+		}
 
-	var rSubject, rDescription string
-	var rCreatedAt, rUpdatedAt time.Time
-	err = s.db.QueryRowContext(ctx, confirm, id).Scan(
-		&rSubject,
-		&rDescription,
-		&rCreatedAt,
-		&rUpdatedAt,
-	)
+		var rSubject, rDescription string
+		var rCreatedAt, rUpdatedAt time.Time
+		err = tx.QueryRowContext(ctx, confirm, id).Scan(
+			&rSubject,
+			&rDescription,
+			&rCreatedAt,
+			&rUpdatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		todo = &model.TODO{
+			ID:          id,
+			Subject:     rSubject,
+			Description: rDescription,
+			CreatedAt:   rCreatedAt,
+			UpdatedAt:   rUpdatedAt,
+		}
+		e.TODO = todo
+		return s.recordEvent(ctx, tx, &e)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	todo := &model.TODO{
-		ID:          id,
-		Subject:     rSubject,
-		Description: rDescription,
-		CreatedAt:   rCreatedAt,
-		UpdatedAt:   rUpdatedAt,
-	}
+	s.logger.DebugContext(ctx, "todo updated", slog.Int64("id", id))
+	s.publish(ctx, e)
 	return todo, nil
 }
 
@@ -159,14 +284,84 @@ func (s *TODOService) DeleteTODO(ctx context.Context, ids []int64) error {
 	for _, v := range ids {
 		args = append(args, v)
 	}
-	res, err := s.db.ExecContext(ctx, stmt, args...)
+	var num int64
+	e := model.TODOEvent{Type: model.TODOEventDeleted, IDs: ids}
+	err := s.inTx(ctx, func(tx tracing.Queryer) error {
+		res, err := tx.ExecContext(ctx, stmt, args...)
+		if err != nil {
+			return err
+		}
+		num, _ = res.RowsAffected()
+		if num == 0 {
+			return &model.ErrNotFound{}
+		}
+		return s.recordEvent(ctx, tx, &e)
+	})
 	if err != nil {
 		return err
 	}
-	num, _ := res.RowsAffected()
-	if num == 0 {
-		return &model.ErrNotFound{}
-	}
 
+	s.logger.DebugContext(ctx, "todos deleted", slog.Any("ids", ids), slog.Int64("deleted", num))
+	s.publish(ctx, e)
 	return nil
 }
+
+// queryer returns q, which records each SQL statement as a span if tracing is enabled.
+func (s *TODOService) queryer(q tracing.Queryer) tracing.Queryer {
+	if s.tracer == nil {
+		return q
+	}
+	return tracing.WrapDB(q, s.tracer, tracing.String("db.system", "sqlite"))
+}
+
+// inTx runs fn in a transaction, which is committed if fn succeeds and rolled back otherwise.
+func (s *TODOService) inTx(ctx context.Context, fn func(tx tracing.Queryer) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(s.queryer(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// recordEvent writes e to the outbox in the transaction tx, setting the user of the change.
+func (s *TODOService) recordEvent(ctx context.Context, tx tracing.Queryer, e *model.TODOEvent) error {
+	const insert = `INSERT INTO outbox(event_type, payload, source) VALUES(?, ?, ?)`
+
+	var source string
+	if s.metadata != nil {
+		e.User, source = s.metadata(ctx)
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, insert, e.Type, string(payload), source)
+	return err
+}
+
+// publish sends e to the publisher and notifies the outbox relay if configured.
+func (s *TODOService) publish(ctx context.Context, e model.TODOEvent) {
+	if s.notify != nil {
+		s.notify()
+	}
+	if s.publisher == nil {
+		return
+	}
+	s.publisher.Publish(ctx, e)
+}
+
+// CountTODO counts TODOs on DB.
+func (s *TODOService) CountTODO(ctx context.Context) (int64, error) {
+	const count = `SELECT COUNT(*) FROM todos`
+
+	var num int64
+	if err := s.queryer(s.db).QueryRowContext(ctx, count).Scan(&num); err != nil {
+		return 0, err
+	}
+	return num, nil
+}
@@ -0,0 +1,353 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/pkg/outbox"
+	"github.com/TechBowl-japan/go-stations/pkg/webhook"
+)
+
+// A WebhookService implements CRUD of Webhook entities and stores their deliveries.
+//
+// It implements outbox.Sink to enqueue the deliveries of TODOEvents, and webhook.Store to send them.
+// As the events are written to the outbox in the same transaction as the change of TODOs,
+// the deliveries of a committed change are enqueued even if the process stops right after the commit.
+type WebhookService struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+// NewWebhookService returns new WebhookService.
+func NewWebhookService(db *sql.DB) *WebhookService {
+	return NewWebhookServiceWithLogger(db, slog.Default())
+}
+
+// NewWebhookServiceWithLogger returns WebhookService which writes logs to logger.
+func NewWebhookServiceWithLogger(db *sql.DB, logger *slog.Logger) *WebhookService {
+	return &WebhookService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// CreateWebhook creates a Webhook on DB. A random secret is generated if secret is empty.
+//
+// Unlike the other methods, the returned Webhook contains the secret.
+func (s *WebhookService) CreateWebhook(ctx context.Context, url, secret string, eventTypes []string) (*model.Webhook, error) {
+	const insert = `INSERT INTO webhooks(url, secret, event_types) VALUES(?, ?, ?)`
+
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		secret = hex.EncodeToString(b)
+	}
+	res, err := s.db.ExecContext(ctx, insert, url, secret, strings.Join(eventTypes, ","))
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := s.readWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	w.Secret = secret
+	s.logger.DebugContext(ctx, "webhook created", slog.Int64("id", id))
+	return w, nil
+}
+
+// ReadWebhooks reads all Webhooks on DB.
+func (s *WebhookService) ReadWebhooks(ctx context.Context) ([]*model.Webhook, error) {
+	const read = `SELECT id, url, event_types, created_at, updated_at FROM webhooks ORDER BY id`
+
+	rows, err := s.db.QueryContext(ctx, read)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := make([]*model.Webhook, 0)
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+// UpdateWebhook updates the Webhook on DB. The secret is kept if secret is empty.
+func (s *WebhookService) UpdateWebhook(ctx context.Context, id int64, url, secret string, eventTypes []string) (*model.Webhook, error) {
+	const update = `UPDATE webhooks SET url = ?, secret = COALESCE(NULLIF(?, ''), secret), event_types = ? WHERE id = ?`
+
+	res, err := s.db.ExecContext(ctx, update, url, secret, strings.Join(eventTypes, ","), id)
+	if err != nil {
+		return nil, err
+	}
+	num, _ := res.RowsAffected()
+	if num == 0 {
+		return nil, &model.ErrNotFound{}
+	}
+
+	w, err := s.readWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.DebugContext(ctx, "webhook updated", slog.Int64("id", id))
+	return w, nil
+}
+
+// DeleteWebhooks deletes Webhooks and their deliveries on DB by ids.
+func (s *WebhookService) DeleteWebhooks(ctx context.Context, ids []int64) error {
+	const deleteFmt = `DELETE FROM webhooks WHERE id IN (?%s)`
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	stmt := fmt.Sprintf(deleteFmt, strings.Repeat(",?", len(ids)-1))
+
+	var args []interface{}
+	for _, v := range ids {
+		args = append(args, v)
+	}
+	res, err := s.db.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+	num, _ := res.RowsAffected()
+	if num == 0 {
+		return &model.ErrNotFound{}
+	}
+
+	s.logger.DebugContext(ctx, "webhooks deleted", slog.Any("ids", ids), slog.Int64("deleted", num))
+	return nil
+}
+
+func (s *WebhookService) readWebhook(ctx context.Context, id int64) (*model.Webhook, error) {
+	const confirm = `SELECT id, url, event_types, created_at, updated_at FROM webhooks WHERE id = ?`
+
+	return scanWebhook(s.db.QueryRowContext(ctx, confirm, id))
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanWebhook(row rowScanner) (*model.Webhook, error) {
+	var w model.Webhook
+	var eventTypes string
+	if err := row.Scan(&w.ID, &w.URL, &eventTypes, &w.CreatedAt, &w.UpdatedAt); err != nil {
+		return nil, err
+	}
+	w.EventTypes = make([]string, 0)
+	if eventTypes != "" {
+		w.EventTypes = strings.Split(eventTypes, ",")
+	}
+	return &w, nil
+}
+
+// ReadDeliveries reads the deliveries of the Webhook on DB, newest first. All deliveries are read if webhookID is 0.
+func (s *WebhookService) ReadDeliveries(ctx context.Context, webhookID, prevID, size int64) ([]*model.WebhookDelivery, error) {
+	const read = `SELECT ` + deliveryColumns + ` FROM webhook_deliveries
+		WHERE (? = 0 OR webhook_id = ?) AND (? = 0 OR id < ?) ORDER BY id DESC LIMIT ?`
+
+	rows, err := s.db.QueryContext(ctx, read, webhookID, webhookID, prevID, prevID, size)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]*model.WebhookDelivery, 0)
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// Redeliver enqueues a new delivery of the same payload as the delivery, regardless of its status.
+func (s *WebhookService) Redeliver(ctx context.Context, id int64) (*model.WebhookDelivery, error) {
+	const (
+		insert = `INSERT INTO webhook_deliveries(webhook_id, event_id, event_type, payload)
+			SELECT webhook_id, event_id, event_type, payload FROM webhook_deliveries WHERE id = ?`
+		confirm = `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE id = ?`
+	)
+
+	res, err := s.db.ExecContext(ctx, insert, id)
+	if err != nil {
+		return nil, err
+	}
+	num, _ := res.RowsAffected()
+	if num == 0 {
+		return nil, &model.ErrNotFound{}
+	}
+	newID, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := scanDelivery(s.db.QueryRowContext(ctx, confirm, newID))
+	if err != nil {
+		return nil, err
+	}
+	s.logger.InfoContext(ctx, "webhook redelivery enqueued", slog.Int64("id", id), slog.Int64("new_id", newID))
+	return d, nil
+}
+
+const deliveryColumns = `id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+	last_status_code, last_error, created_at, updated_at`
+
+func scanDelivery(row rowScanner) (*model.WebhookDelivery, error) {
+	var d model.WebhookDelivery
+	var payload string
+	if err := row.Scan(
+		&d.ID,
+		&d.WebhookID,
+		&d.EventID,
+		&d.EventType,
+		&payload,
+		&d.Status,
+		&d.Attempts,
+		&d.NextAttemptAt,
+		&d.LastStatusCode,
+		&d.LastError,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	d.Payload = json.RawMessage(payload)
+	return &d, nil
+}
+
+// Name implements outbox.Sink.
+func (s *WebhookService) Name() string {
+	return "webhook"
+}
+
+// Send implements outbox.Sink. It enqueues the deliveries of the TODOEvents to the Webhooks subscribing to their types.
+//
+// The deliveries already enqueued for an event are skipped, so relaying the same event again does not send it twice.
+func (s *WebhookService) Send(ctx context.Context, events []outbox.Event) error {
+	const insert = `INSERT INTO webhook_deliveries(webhook_id, event_id, event_type, payload)
+		SELECT w.id, ?, ?, ? FROM webhooks w
+		WHERE (w.event_types = '' OR INSTR(',' || w.event_types || ',', ',' || ? || ',') > 0)
+		AND NOT EXISTS (SELECT 1 FROM webhook_deliveries d WHERE d.webhook_id = w.id AND d.event_id = ?)`
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, oe := range events {
+		p := model.WebhookPayload{
+			ID:        strconv.FormatInt(oe.ID, 10),
+			Type:      oe.Type,
+			CreatedAt: oe.CreatedAt,
+		}
+		if err := json.Unmarshal(oe.Payload, &p.Data); err != nil {
+			s.logger.ErrorContext(ctx, "could not decode outbox event", slog.Int64("event_id", oe.ID), slog.Any("err", err))
+			continue
+		}
+		payload, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, insert, p.ID, p.Type, string(payload), p.Type, p.ID)
+		if err != nil {
+			return err
+		}
+		if num, _ := res.RowsAffected(); num > 0 {
+			s.logger.DebugContext(ctx, "webhook deliveries enqueued", slog.String("event_id", p.ID), slog.Int64("deliveries", num))
+		}
+	}
+	return tx.Commit()
+}
+
+// Claim implements webhook.Store.
+func (s *WebhookService) Claim(ctx context.Context, limit int, lease time.Duration) ([]webhook.Delivery, error) {
+	const (
+		read = `SELECT d.id, w.url, w.secret, d.event_type, d.payload, d.attempts
+			FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+			WHERE d.status = 'pending' AND d.next_attempt_at <= DATETIME('now')
+			ORDER BY d.next_attempt_at, d.id LIMIT ?`
+		extend = `UPDATE webhook_deliveries SET next_attempt_at = DATETIME('now', ?) WHERE id = ?`
+	)
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, read, limit)
+	if err != nil {
+		return nil, err
+	}
+	var deliveries []webhook.Delivery
+	for rows.Next() {
+		var d webhook.Delivery
+		var payload string
+		if err := rows.Scan(&d.ID, &d.URL, &d.Secret, &d.EventType, &payload, &d.Attempts); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		d.Payload = []byte(payload)
+		deliveries = append(deliveries, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, d := range deliveries {
+		if _, err := tx.ExecContext(ctx, extend, sqliteModifier(lease), d.ID); err != nil {
+			return nil, err
+		}
+	}
+	return deliveries, tx.Commit()
+}
+
+// Record implements webhook.Store.
+func (s *WebhookService) Record(ctx context.Context, id int64, a webhook.Attempt) error {
+	const record = `UPDATE webhook_deliveries SET status = ?, attempts = attempts + 1, last_status_code = ?, last_error = ?,
+		next_attempt_at = CASE WHEN ? = 'pending' THEN DATETIME('now', ?) ELSE next_attempt_at END WHERE id = ?`
+
+	status := model.WebhookDeliverySucceeded
+	switch {
+	case a.Succeeded():
+	case a.RetryAfter > 0:
+		status = model.WebhookDeliveryPending
+	default:
+		status = model.WebhookDeliveryFailed
+	}
+	_, err := s.db.ExecContext(ctx, record, status, a.StatusCode, a.Error, status, sqliteModifier(a.RetryAfter), id)
+	return err
+}
+
+// sqliteModifier returns the modifier of the SQLite date functions adding d, rounded up to seconds.
+func sqliteModifier(d time.Duration) string {
+	return fmt.Sprintf("+%d seconds", (d+time.Second-1)/time.Second)
+}
@@ -0,0 +1,274 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TechBowl-japan/go-stations/db"
+	"github.com/TechBowl-japan/go-stations/model"
+	"github.com/TechBowl-japan/go-stations/pkg/outbox"
+	"github.com/TechBowl-japan/go-stations/pkg/webhook"
+	"github.com/TechBowl-japan/go-stations/service"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWebhookDeliveries(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	todoDB, err := db.NewDB(filepath.Join(t.TempDir(), "webhook_test.db"))
+	if err != nil {
+		t.Fatal("DBの作成に失敗しました:", err)
+	}
+	t.Cleanup(func() {
+		todoDB.Close()
+	})
+
+	todos := service.NewTODOService(todoDB)
+	outbox := service.NewOutboxService(todoDB)
+	webhooks := service.NewWebhookService(todoDB)
+
+	all, err := webhooks.CreateWebhook(ctx, "https://example.com/all", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all.Secret) != 64 {
+		t.Errorf("署名の鍵が生成されていません, got = %q", all.Secret)
+	}
+	deleted, err := webhooks.CreateWebhook(ctx, "https://example.com/deleted", "secret", []string{model.TODOEventDeleted})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listed, err := webhooks.ReadWebhooks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range listed {
+		if w.Secret != "" {
+			t.Errorf("一覧に署名の鍵が含まれています, id = %d", w.ID)
+		}
+	}
+
+	todo, err := todos.CreateTODO(ctx, "subject", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := todos.UpdateTODO(ctx, todo.ID, "updated", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := todos.DeleteTODO(ctx, []int64{todo.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	// NOTE: TODOの変更と同じトランザクションで記録した outbox から送信を登録するため、コミットした変更は必ず送信される。
+	events, err := outbox.Read(ctx, webhooks.Name(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("outbox のイベント数が一致しません, got = %d", len(events))
+	}
+	if err := webhooks.Send(ctx, events); err != nil {
+		t.Fatal(err)
+	}
+	// NOTE: Commit の前に停止した場合、同じイベントが再度送られても送信は重複しない。
+	if err := webhooks.Send(ctx, events); err != nil {
+		t.Fatal(err)
+	}
+	if err := outbox.Commit(ctx, webhooks.Name(), events[len(events)-1].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	type delivery struct {
+		WebhookID int64
+		EventType string
+		Status    string
+	}
+	summarize := func(ds []*model.WebhookDelivery) []delivery {
+		got := make([]delivery, 0, len(ds))
+		for _, d := range ds {
+			got = append(got, delivery{WebhookID: d.WebhookID, EventType: d.EventType, Status: d.Status})
+		}
+		return got
+	}
+
+	got, err := webhooks.ReadDeliveries(ctx, 0, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []delivery{
+		{WebhookID: deleted.ID, EventType: model.TODOEventDeleted, Status: model.WebhookDeliveryPending},
+		{WebhookID: all.ID, EventType: model.TODOEventDeleted, Status: model.WebhookDeliveryPending},
+		{WebhookID: all.ID, EventType: model.TODOEventUpdated, Status: model.WebhookDeliveryPending},
+		{WebhookID: all.ID, EventType: model.TODOEventCreated, Status: model.WebhookDeliveryPending},
+	}
+	if diff := cmp.Diff(want, summarize(got)); diff != "" {
+		t.Errorf("送信履歴が一致しません (-want +got):\n%s", diff)
+	}
+
+	var payload model.WebhookPayload
+	if err := json.Unmarshal(got[len(got)-1].Payload, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.ID != got[len(got)-1].EventID || payload.Data == nil || payload.Data.TODO == nil || payload.Data.TODO.Subject != "subject" {
+		t.Errorf("送信する内容が一致しません, got = %s", got[len(got)-1].Payload)
+	}
+
+	// NOTE: prev_id より前の履歴を、Webhook毎に新しい順に返す。
+	page, err := webhooks.ReadDeliveries(ctx, all.ID, got[2].ID, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want[3:], summarize(page)); diff != "" {
+		t.Errorf("送信履歴のページが一致しません (-want +got):\n%s", diff)
+	}
+
+	claimed, err := webhooks.Claim(ctx, 100, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != len(want) {
+		t.Fatalf("送信予定の数が一致しません, got = %d", len(claimed))
+	}
+	if again, err := webhooks.Claim(ctx, 100, time.Minute); err != nil || len(again) != 0 {
+		t.Errorf("lease の間に再度取得されました, got = %d, err = %v", len(again), err)
+	}
+	for _, d := range claimed {
+		a := webhook.Attempt{StatusCode: 204}
+		if d.URL == deleted.URL {
+			a = webhook.Attempt{StatusCode: 500, Error: "unexpected status: 500 Internal Server Error"}
+		}
+		if err := webhooks.Record(ctx, d.ID, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	failed, err := webhooks.ReadDeliveries(ctx, deleted.ID, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].Status != model.WebhookDeliveryFailed || failed[0].Attempts != 1 || failed[0].LastStatusCode != 500 {
+		t.Fatalf("送信の結果が記録されていません, got = %+v", failed)
+	}
+
+	redelivered, err := webhooks.Redeliver(ctx, failed[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redelivered.ID == failed[0].ID || redelivered.Status != model.WebhookDeliveryPending || redelivered.Attempts != 0 ||
+		redelivered.EventID != failed[0].EventID || string(redelivered.Payload) != string(failed[0].Payload) {
+		t.Errorf("再送が登録されていません, got = %+v", redelivered)
+	}
+
+	var nerr *model.ErrNotFound
+	if _, err := webhooks.Redeliver(ctx, 999); !errors.As(err, &nerr) {
+		t.Errorf("存在しない送信の再送がエラーになりません, got = %v", err)
+	}
+}
+
+func TestDeleteWebhooksDeletesDeliveries(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	todoDB, err := db.NewDB(filepath.Join(t.TempDir(), "webhook_test.db"))
+	if err != nil {
+		t.Fatal("DBの作成に失敗しました:", err)
+	}
+	t.Cleanup(func() {
+		todoDB.Close()
+	})
+
+	todos := service.NewTODOService(todoDB)
+	outbox := service.NewOutboxService(todoDB)
+	webhooks := service.NewWebhookService(todoDB)
+
+	w, err := webhooks.CreateWebhook(ctx, "https://example.com/", "secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := todos.CreateTODO(ctx, "subject", ""); err != nil {
+		t.Fatal(err)
+	}
+	events, err := outbox.Read(ctx, webhooks.Name(), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := webhooks.Send(ctx, events); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := webhooks.DeleteWebhooks(ctx, []int64{w.ID}); err != nil {
+		t.Fatal(err)
+	}
+	ds, err := webhooks.ReadDeliveries(ctx, 0, 0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 0 {
+		t.Errorf("削除したWebhookの送信履歴が残っています, got = %d", len(ds))
+	}
+
+	var nerr *model.ErrNotFound
+	if err := webhooks.DeleteWebhooks(ctx, []int64{w.ID}); !errors.As(err, &nerr) {
+		t.Errorf("存在しないWebhookの削除がエラーになりません, got = %v", err)
+	}
+}
+
+func TestWebhookDeliveriesSurviveRestart(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "webhook_test.db")
+
+	// NOTE: TODOの変更をコミットした直後に停止し、プロセス内の配信が行われなかった場合を再現する。
+	before, err := db.NewDB(path)
+	if err != nil {
+		t.Fatal("DBの作成に失敗しました:", err)
+	}
+	w, err := service.NewWebhookService(before).CreateWebhook(ctx, "https://example.com/", "secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.NewTODOService(before).CreateTODO(ctx, "subject", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := before.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := db.NewDB(path)
+	if err != nil {
+		t.Fatal("DBの作成に失敗しました:", err)
+	}
+	t.Cleanup(func() {
+		after.Close()
+	})
+	webhooks := service.NewWebhookService(after)
+	relay := outbox.NewRelay(service.NewOutboxService(after), []outbox.Sink{webhooks}, outbox.Config{
+		PollInterval: 10 * time.Millisecond,
+	})
+	t.Cleanup(func() {
+		relay.Shutdown(context.Background())
+	})
+
+	// NOTE: 再起動後のリレーが outbox から送信を登録する。
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		ds, err := webhooks.ReadDeliveries(ctx, w.ID, 0, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ds) == 1 && ds[0].EventType == model.TODOEventCreated {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("再起動前にコミットした変更が送信されていません, got = %+v", ds)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}